@@ -2,11 +2,16 @@
 package dtsx
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -15,6 +20,7 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	schema "github.com/7045kHz/dtsx/schemas"
 )
@@ -49,18 +55,61 @@ type Package struct {
 	LocaleIDAttr                   *string  `xml:"LocaleID,attr"`
 	ObjectNameAttr                 *string  `xml:"ObjectName,attr"`
 	PackageTypeAttr                *string  `xml:"PackageType,attr"`
+	ProtectionLevelAttr            *string  `xml:"ProtectionLevel,attr"`
 	VersionBuildAttr               *string  `xml:"VersionBuild,attr"`
 	VersionGUIDAttr                *string  `xml:"VersionGUID,attr"`
 	*schema.ExecutableTypePackage
+	PackageParameters *PackageParametersType `xml:"PackageParameters"`
+	Configurations    *ConfigurationsType    `xml:"Configurations"`
 }
 
-// PackageParser provides centralized parsing and analysis functionality for DTSX packages
+// PackageParametersType holds the parameters of a package in the project deployment model (SSIS 2012+)
+type PackageParametersType struct {
+	PackageParameter []*PackageParameterType `xml:"PackageParameter"`
+}
+
+// PackageParameterType represents a package parameter; its value is carried in the ParameterValue property
+type PackageParameterType struct {
+	ObjectNameAttr   *string            `xml:"ObjectName,attr"`
+	DTSIDAttr        *string            `xml:"DTSID,attr"`
+	CreationNameAttr *string            `xml:"CreationName,attr"`
+	DescriptionAttr  *string            `xml:"Description,attr"`
+	DataTypeAttr     *int               `xml:"DataType,attr"`
+	RequiredAttr     *string            `xml:"Required,attr"`
+	SensitiveAttr    *string            `xml:"Sensitive,attr"`
+	Property         []*schema.Property `xml:"Property"`
+}
+
+// ConfigurationsType holds the package configurations of the package deployment model
+type ConfigurationsType struct {
+	Configuration []*ConfigurationType `xml:"Configuration"`
+}
+
+// ConfigurationType represents a package configuration. ConfigurationString
+// names the source (file path, environment variable, parent variable or SQL
+// table) according to ConfigurationType; ConfigurationVariable is the target
+// property path for single-value configurations.
+type ConfigurationType struct {
+	ObjectNameAttr            *string `xml:"ObjectName,attr"`
+	DTSIDAttr                 *string `xml:"DTSID,attr"`
+	CreationNameAttr          *string `xml:"CreationName,attr"`
+	DescriptionAttr           *string `xml:"Description,attr"`
+	ConfigurationTypeAttr     *int    `xml:"ConfigurationType,attr"`
+	ConfigurationStringAttr   *string `xml:"ConfigurationString,attr"`
+	ConfigurationVariableAttr *string `xml:"ConfigurationVariable,attr"`
+}
+
+// PackageParser provides centralized parsing and analysis functionality for DTSX packages.
+// Variables, connections and executables are indexed when the parser is
+// created; call Refresh after changing the package so lookups and cached
+// expression results reflect the change.
 type PackageParser struct {
 	pkg      *Package
 	vars     map[string]interface{}
 	connMap  map[string]*schema.ConnectionManagerType
 	execMap  map[string]*schema.AnyNonPackageExecutableType
 	varCache map[string]interface{} // Cache for expensive operations
+	clock    func() time.Time       // Source of GETDATE()/GETUTCDATE(); nil uses the current time
 }
 
 // NewPackageParser creates a new PackageParser for the given package
@@ -91,32 +140,69 @@ func (p *PackageParser) buildVariableMap() {
 			continue
 		}
 		fullName := *v.NamespaceAttr + "::" + *v.ObjectNameAttr
-		var value interface{}
-		if v.VariableValue != nil {
-			if num, err := strconv.ParseFloat(v.VariableValue.Value, 64); err == nil {
-				value = num
-			} else {
-				value = v.VariableValue.Value
-			}
-		} else {
-			// From properties
-			for _, prop := range v.Property {
-				if prop.NameAttr != nil && *prop.NameAttr == "Value" {
-					if num, err := strconv.ParseFloat(prop.Value, 64); err == nil {
-						value = num
-					} else {
-						value = prop.Value
-					}
-					break
-				}
-			}
-		}
+		value := typedVariableValue(v)
 		if value != nil {
 			p.vars[fullName] = value
 		}
 	}
 }
 
+// typedVariableValue returns the value of v converted for the evaluator, or
+// nil if v has no value
+func typedVariableValue(v *schema.VariableType) interface{} {
+	if v.VariableValue != nil {
+		return parseVariableValue(v.VariableValue.Value, v.VariableValue.DataTypeAttr)
+	}
+	// From properties
+	for _, prop := range v.Property {
+		if prop.NameAttr != nil && *prop.NameAttr == "Value" && prop.PropertyElementBaseType != nil && prop.AnySimpleType != nil {
+			return parseVariableValue(prop.Value, prop.DataTypeAttr)
+		}
+	}
+	return nil
+}
+
+// parseVariableValue converts a stored variable value to the type its
+// DataType code calls for: int64 for the integer types, float64 for the
+// floating point, currency and decimal types, and bool for DT_BOOL. Values of
+// any other declared type, including the string types, and values that do not
+// parse as their declared type are kept as written. A value with no DataType
+// becomes a bool when it reads True or False and a float64 when it looks
+// numeric.
+func parseVariableValue(value string, dataType *int) interface{} {
+	if dataType != nil {
+		text := strings.TrimSpace(value)
+		switch *dataType {
+		case 2, 3, 16, 17, 18, 19, 20, 21, 22, 23: // I2, I4, I1, UI1, UI2, UI4, I8, UI8, INT, UINT
+			if n, err := strconv.ParseInt(text, 10, 64); err == nil {
+				return n
+			}
+		case 4, 5, 6, 14, 25, 131: // R4, R8, CY, DECIMAL, DT_DECIMAL, DT_NUMERIC
+			if f, err := strconv.ParseFloat(text, 64); err == nil {
+				return f
+			}
+		case 11: // BOOL, stored as -1/0 or True/False
+			switch strings.ToLower(text) {
+			case "-1", "1", "true":
+				return true
+			case "0", "false":
+				return false
+			}
+		}
+		return value
+	}
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if num, err := strconv.ParseFloat(value, 64); err == nil {
+		return num
+	}
+	return value
+}
+
 // buildConnectionMap creates a map of connection managers by refId and name
 func (p *PackageParser) buildConnectionMap() {
 	p.connMap = make(map[string]*schema.ConnectionManagerType)
@@ -125,25 +211,23 @@ func (p *PackageParser) buildConnectionMap() {
 	}
 	for _, cm := range p.pkg.ConnectionManagers.ConnectionManager {
 		if cm.RefIdAttr != nil {
-			p.connMap[*cm.RefIdAttr] = cm
+			p.connMap[NormalizeRefId(*cm.RefIdAttr)] = cm
 		}
 		if cm.ObjectNameAttr != nil {
-			p.connMap[*cm.ObjectNameAttr] = cm
+			p.connMap[NormalizeRefId(*cm.ObjectNameAttr)] = cm
 		}
 	}
 }
 
-// buildExecutableMap creates a map of executables by refId
+// buildExecutableMap creates a map of executables by refId, including
+// executables nested in containers
 func (p *PackageParser) buildExecutableMap() {
 	p.execMap = make(map[string]*schema.AnyNonPackageExecutableType)
-	if p.pkg.Executable == nil {
-		return
-	}
-	for _, exec := range p.pkg.Executable {
+	p.pkg.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
 		if exec.RefIdAttr != nil {
-			p.execMap[*exec.RefIdAttr] = exec
+			p.execMap[NormalizeRefId(*exec.RefIdAttr)] = exec
 		}
-	}
+	})
 }
 
 // GetVariableValue returns the value of a variable by name
@@ -154,23 +238,110 @@ func (p *PackageParser) GetVariableValue(name string) (interface{}, error) {
 	return nil, fmt.Errorf("variable %s not found", name)
 }
 
-// GetConnectionManager returns a connection manager by refId or name
+// GetVariableInt returns the value of a variable as an int64. Integer values
+// and whole numbers (such as numeric text in a String variable) are accepted;
+// fractional numbers, booleans and non-numeric text are errors.
+func (p *PackageParser) GetVariableInt(name string) (int64, error) {
+	value, err := p.GetVariableValue(name)
+	if err != nil {
+		return 0, err
+	}
+	switch v := value.(type) {
+	case int64:
+		return v, nil
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v <= math.MaxInt64 {
+			return int64(v), nil
+		}
+		return 0, fmt.Errorf("variable %s is %v, not a whole number", name, v)
+	case string:
+		if n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("variable %s is %s, not an integer", name, describeVariableValue(value))
+}
+
+// GetVariableBool returns the value of a boolean variable, including String
+// variables holding True or False
+func (p *PackageParser) GetVariableBool(name string) (bool, error) {
+	value, err := p.GetVariableValue(name)
+	if err != nil {
+		return false, err
+	}
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		switch strings.ToLower(strings.TrimSpace(v)) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, fmt.Errorf("variable %s is %s, not a boolean", name, describeVariableValue(value))
+}
+
+// GetVariableString returns the value of a string variable. String and
+// untyped variables are returned as stored, even when their text looks
+// numeric or boolean; variables declared with a numeric or boolean DataType
+// are errors.
+func (p *PackageParser) GetVariableString(name string) (string, error) {
+	value, err := p.GetVariableValue(name)
+	if err != nil {
+		return "", err
+	}
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	if v, err := p.pkg.GetVariableByName(name); err == nil {
+		var dataType *int
+		if v.VariableValue != nil {
+			dataType = v.VariableValue.DataTypeAttr
+		}
+		if dataType == nil || *dataType == 8 { // untyped or BSTR
+			return GetVariableValue(v), nil
+		}
+	}
+	return "", fmt.Errorf("variable %s is %s, not a string", name, describeVariableValue(value))
+}
+
+// describeVariableValue names the kind of an evaluator value for errors
+func describeVariableValue(value interface{}) string {
+	switch value.(type) {
+	case int64:
+		return "an integer"
+	case float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case string:
+		return "a string"
+	}
+	return fmt.Sprintf("a %T", value)
+}
+
+// GetConnectionManager returns a connection manager by refId or name.
+// The refId may use either separator style (see NormalizeRefId).
 func (p *PackageParser) GetConnectionManager(id string) (*schema.ConnectionManagerType, error) {
-	if cm, exists := p.connMap[id]; exists {
+	if cm, exists := p.connMap[NormalizeRefId(id)]; exists {
 		return cm, nil
 	}
 	return nil, fmt.Errorf("connection manager %s not found", id)
 }
 
-// GetExecutable returns an executable by refId
+// GetExecutable returns an executable by refId, in either separator style
+// (see NormalizeRefId)
 func (p *PackageParser) GetExecutable(refId string) (*schema.AnyNonPackageExecutableType, error) {
-	if exec, exists := p.execMap[refId]; exists {
+	if exec, exists := p.execMap[NormalizeRefId(refId)]; exists {
 		return exec, nil
 	}
 	return nil, fmt.Errorf("executable %s not found", refId)
 }
 
-// EvaluateExpression evaluates an expression with caching
+// EvaluateExpression evaluates an expression with caching. Expressions that
+// call GETDATE, GETUTCDATE or NEWID are evaluated afresh each time.
 func (p *PackageParser) EvaluateExpression(expr string) (interface{}, error) {
 	if expr == "" {
 		return nil, fmt.Errorf("empty expression")
@@ -182,24 +353,44 @@ func (p *PackageParser) EvaluateExpression(expr string) (interface{}, error) {
 	}
 
 	// Evaluate using the package's EvaluateExpression
-	result, err := EvaluateExpression(expr, p.pkg)
+	var opts EvaluateOptions
+	if p.clock != nil {
+		opts.Now = p.clock()
+	}
+	result, err := EvaluateExpressionWithOptions(expr, p.pkg, opts)
 	if err != nil {
 		return nil, err
 	}
 
-	// Cache the result
-	p.varCache["expr:"+expr] = result
+	// Cache the result, unless it depends on the clock or is random
+	if !isVolatileExpression(expr) {
+		p.varCache["expr:"+expr] = result
+	}
 	return result, nil
 }
 
-// GetSQLStatements extracts SQL statements from all executables
+// SetClock sets the time source used for GETDATE() and GETUTCDATE() in
+// EvaluateExpression, for example to pin "now" in tests. A nil clock restores
+// the current time. Cached expression results are discarded.
+func (p *PackageParser) SetClock(clock func() time.Time) {
+	p.clock = clock
+	p.varCache = make(map[string]interface{})
+}
+
+// Refresh rebuilds the variable, connection and executable indexes from the
+// package and discards cached expression results. It must be called after the
+// package is modified, for example by DeleteVariable, Merge or by editing the
+// schema structs directly, or the parser keeps serving the old values.
+func (p *PackageParser) Refresh() {
+	p.varCache = make(map[string]interface{})
+	p.initialize()
+}
+
+// GetSQLStatements extracts SQL statements from all executables, including
+// executables nested in containers
 func (p *PackageParser) GetSQLStatements() []*SQLStatement {
 	var statements []*SQLStatement
-	if p.pkg.Executable == nil {
-		return statements
-	}
-
-	for _, exec := range p.pkg.Executable {
+	p.pkg.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
 		taskName := "Unknown"
 		if exec.ObjectNameAttr != nil {
 			taskName = *exec.ObjectNameAttr
@@ -210,12 +401,14 @@ func (p *PackageParser) GetSQLStatements() []*SQLStatement {
 			for _, prop := range exec.Property {
 				if prop.NameAttr != nil && *prop.NameAttr == "SqlStatementSource" &&
 					prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+					value := prop.PropertyElementBaseType.AnySimpleType
 					statements = append(statements, &SQLStatement{
 						TaskName:    taskName,
 						TaskType:    "Control Flow",
-						SQL:         prop.PropertyElementBaseType.AnySimpleType.Value,
+						SQL:         value.Value,
 						RefId:       getRefId(exec),
 						Connections: p.getConnectionsForExecutable(exec),
+						set:         func(sql string) { value.Value = sql },
 					})
 				}
 			}
@@ -227,14 +420,110 @@ func (p *PackageParser) GetSQLStatements() []*SQLStatement {
 		}
 
 		// Extract from dataflow components
-		if exec.ExecutableTypeAttr == "Microsoft.Pipeline" && exec.ObjectData != nil {
+		if NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.Pipeline" && exec.ObjectData != nil {
 			p.extractDataflowSQL(exec, &statements)
 		}
+	})
+
+	for _, stmt := range statements {
+		stmt.Dialect = p.dialectForConnections(stmt.Connections)
+	}
+
+	return statements
+}
+
+// RewriteSQLStatements calls fn for each SQL statement found by GetSQLStatements
+// and writes the returned SQL back to the property or attribute it was read
+// from. It returns the number of statements whose SQL changed. File-sourced
+// statements and OLE DB Source table names (OpenRowset) cannot be rewritten
+// and are skipped.
+func (p *PackageParser) RewriteSQLStatements(fn func(stmt *SQLStatement) string) int {
+	rewritten := 0
+	for _, stmt := range p.GetSQLStatements() {
+		if stmt.set == nil {
+			continue
+		}
+		if sql := fn(stmt); sql != stmt.SQL {
+			stmt.set(sql)
+			rewritten++
+		}
+	}
+	if rewritten > 0 {
+		p.Refresh()
+	}
+	return rewritten
+}
+
+// RewriteSQLStatements rewrites the package's SQL statements in place; see
+// (*PackageParser).RewriteSQLStatements
+func (p *Package) RewriteSQLStatements(fn func(stmt *SQLStatement) string) int {
+	if p == nil {
+		return 0
 	}
+	return NewPackageParser(p).RewriteSQLStatements(fn)
+}
 
+// GetSQLStatementsByDialect returns the SQL statements whose connection
+// targets the given dialect (e.g. "mssql", "oracle"), matched case-insensitively
+func (p *PackageParser) GetSQLStatementsByDialect(dialect string) []*SQLStatement {
+	var statements []*SQLStatement
+	for _, stmt := range p.GetSQLStatements() {
+		if strings.EqualFold(stmt.Dialect, dialect) {
+			statements = append(statements, stmt)
+		}
+	}
 	return statements
 }
 
+// sqlDialects maps provider and driver fragments, as found in a connection's
+// CreationName or connection string, to dialect names. Entries are checked in order.
+var sqlDialects = []struct {
+	fragment string
+	dialect  string
+}{
+	{"sqlncli", "mssql"},
+	{"msoledbsql", "mssql"},
+	{"sqloledb", "mssql"},
+	{"system.data.sqlclient", "mssql"},
+	{"microsoft.data.sqlclient", "mssql"},
+	{"sql server", "mssql"},
+	{"oraoledb", "oracle"},
+	{"msdaora", "oracle"},
+	{"oracleclient", "oracle"},
+	{"oracle", "oracle"},
+	{"ibmdadb2", "db2"},
+	{"db2", "db2"},
+	{"mysql", "mysql"},
+	{"npgsql", "postgres"},
+	{"postgres", "postgres"},
+}
+
+// DetectSQLDialect returns the SQL dialect a connection manager targets,
+// inferred from its CreationName and provider, or "" if it is not recognised
+func DetectSQLDialect(cm *schema.ConnectionManagerType) string {
+	if cm == nil {
+		return ""
+	}
+	source := strings.ToLower(derefString(cm.CreationNameAttr) + ";" + GetConnectionString(cm))
+	for _, d := range sqlDialects {
+		if strings.Contains(source, d.fragment) {
+			return d.dialect
+		}
+	}
+	return ""
+}
+
+// dialectForConnections returns the dialect of the first named connection
+// with a recognised provider
+func (p *PackageParser) dialectForConnections(connections []string) string {
+	for _, name := range connections {
+		if dialect := DetectSQLDialect(p.connMap[NormalizeRefId(name)]); dialect != "" {
+			return dialect
+		}
+	}
+	return ""
+}
+
 // SQLStatement represents a SQL statement found in the package
 type SQLStatement struct {
 	TaskName    string
@@ -242,6 +531,22 @@ type SQLStatement struct {
 	SQL         string
 	RefId       string
 	Connections []string
+	// SourceType is "Variable" or "FileConnection" when an Execute SQL Task
+	// reads its SQL indirectly, and empty for inline SQL
+	SourceType string
+	// Source is the variable or file connection name the SQL comes from.
+	// File-sourced statements leave SQL empty.
+	Source string
+	// Dialect is the SQL engine of the first connection with a recognised
+	// provider (see DetectSQLDialect), or empty if none is known
+	Dialect string
+	// ComponentClassID is the class of the dataflow component the SQL came
+	// from (e.g. "Microsoft.Lookup"), and empty for control flow SQL
+	ComponentClassID string
+
+	// set writes new SQL back to where the statement was found; nil if the
+	// statement cannot be rewritten
+	set func(sql string)
 }
 
 // getRefId safely gets the refId from an executable
@@ -252,6 +557,120 @@ func getRefId(exec *schema.AnyNonPackageExecutableType) string {
 	return ""
 }
 
+// NormalizeExecutableType returns the canonical Microsoft.* form of an
+// executable type, so that the STOCK: names written by older SSIS versions
+// (STOCK:SQLTask, STOCK:Pipeline), versioned ProgIDs (SSIS.Pipeline.3),
+// assembly-qualified class names and short names compare equal to the types
+// SSIS 2012+ writes. Container types (STOCK:SEQUENCE, STOCK:FORLOOP,
+// STOCK:FOREACHLOOP) are still written as STOCK: names and are returned
+// upper-cased. Unknown types are returned unchanged.
+func NormalizeExecutableType(t string) string {
+	key := strings.ToLower(strings.TrimSpace(t))
+	if i := strings.Index(key, ","); i >= 0 {
+		// Microsoft.SqlServer.Dts.Tasks.ExecuteSQLTask.ExecuteSQLTask, Microsoft.SqlServer.SQLTask, Version=...
+		key = strings.TrimSpace(key[:i])
+	}
+	if canonical, ok := executableTypeAliases[key]; ok {
+		return canonical
+	}
+	if strings.HasPrefix(key, "ssis.pipeline") || strings.HasPrefix(key, "dts.pipeline") {
+		return "Microsoft.Pipeline"
+	}
+	return t
+}
+
+// executableTypeAliases maps lowercased legacy and short executable type
+// names to the form returned by NormalizeExecutableType
+var executableTypeAliases = map[string]string{
+	"microsoft.executesqltask": "Microsoft.ExecuteSQLTask",
+	"stock:sqltask":            "Microsoft.ExecuteSQLTask",
+	"stock:executesqltask":     "Microsoft.ExecuteSQLTask",
+	"executesqltask":           "Microsoft.ExecuteSQLTask",
+	"sqltask":                  "Microsoft.ExecuteSQLTask",
+	"microsoft.sqlserver.dts.tasks.executesqltask.executesqltask": "Microsoft.ExecuteSQLTask",
+
+	"microsoft.pipeline": "Microsoft.Pipeline",
+	"stock:pipeline":     "Microsoft.Pipeline",
+	"pipeline":           "Microsoft.Pipeline",
+	"dataflow":           "Microsoft.Pipeline",
+
+	"microsoft.scripttask": "Microsoft.ScriptTask",
+	"stock:scripttask":     "Microsoft.ScriptTask",
+	"scripttask":           "Microsoft.ScriptTask",
+	"microsoft.sqlserver.dts.tasks.scripttask.scripttask": "Microsoft.ScriptTask",
+
+	"microsoft.executepackagetask": "Microsoft.ExecutePackageTask",
+	"stock:executepackagetask":     "Microsoft.ExecutePackageTask",
+	"executepackagetask":           "Microsoft.ExecutePackageTask",
+
+	"microsoft.executeprocess": "Microsoft.ExecuteProcess",
+	"stock:executeprocesstask": "Microsoft.ExecuteProcess",
+	"executeprocesstask":       "Microsoft.ExecuteProcess",
+
+	"microsoft.filesystemtask": "Microsoft.FileSystemTask",
+	"stock:filesystemtask":     "Microsoft.FileSystemTask",
+	"filesystemtask":           "Microsoft.FileSystemTask",
+
+	"microsoft.sendmailtask": "Microsoft.SendMailTask",
+	"stock:sendmailtask":     "Microsoft.SendMailTask",
+	"sendmailtask":           "Microsoft.SendMailTask",
+
+	"microsoft.ftptask": "Microsoft.FtpTask",
+	"stock:ftptask":     "Microsoft.FtpTask",
+	"ftptask":           "Microsoft.FtpTask",
+
+	"microsoft.bulkinserttask": "Microsoft.BulkInsertTask",
+	"stock:bulkinserttask":     "Microsoft.BulkInsertTask",
+	"bulkinserttask":           "Microsoft.BulkInsertTask",
+
+	"stock:sequence":    "STOCK:SEQUENCE",
+	"stock:forloop":     "STOCK:FORLOOP",
+	"stock:foreachloop": "STOCK:FOREACHLOOP",
+}
+
+// NormalizeRefId returns a canonical form of a refId so that the backslash
+// style (Package\Task) and the dotted/bracketed style
+// (Package.ConnectionManagers[Name]) compare equal. Segments are separated by
+// backslashes and a bracketed name becomes its own segment, e.g.
+// "Package.ConnectionManagers[Source DB]" and "Package\ConnectionManagers\Source DB"
+// both normalize to the latter. Text inside brackets is never split.
+func NormalizeRefId(refId string) string {
+	var segments []string
+	var current strings.Builder
+	flush := func() {
+		if seg := strings.TrimSpace(current.String()); seg != "" {
+			segments = append(segments, seg)
+		}
+		current.Reset()
+	}
+
+	depth := 0
+	for _, r := range strings.TrimSpace(refId) {
+		switch {
+		case r == '[':
+			if depth == 0 {
+				flush()
+			} else {
+				current.WriteRune(r)
+			}
+			depth++
+		case r == ']' && depth > 0:
+			depth--
+			if depth == 0 {
+				flush()
+			} else {
+				current.WriteRune(r)
+			}
+		case depth == 0 && (r == '\\' || r == '/' || r == '.'):
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+	return strings.Join(segments, `\`)
+}
+
 // getConnectionsForExecutable finds connection managers used by an executable
 func (p *PackageParser) getConnectionsForExecutable(exec *schema.AnyNonPackageExecutableType) []string {
 	var connections []string
@@ -267,13 +686,13 @@ func (p *PackageParser) getConnectionsForExecutable(exec *schema.AnyNonPackageEx
 	}
 
 	// For dataflows, check component connections
-	if exec.ExecutableTypeAttr == "Microsoft.Pipeline" && exec.ObjectData != nil {
+	if NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.Pipeline" && exec.ObjectData != nil {
 		if exec.ObjectData.Pipeline != nil && exec.ObjectData.Pipeline.Components != nil {
 			for _, comp := range exec.ObjectData.Pipeline.Components.Component {
 				if comp.Connections != nil {
 					for _, conn := range comp.Connections.Connection {
 						if conn.ConnectionManagerIDAttr != nil {
-							if cm, exists := p.connMap[*conn.ConnectionManagerIDAttr]; exists {
+							if cm, exists := p.connMap[NormalizeRefId(*conn.ConnectionManagerIDAttr)]; exists {
 								if cm.ObjectNameAttr != nil {
 									connections = append(connections, *cm.ObjectNameAttr)
 								}
@@ -288,15 +707,38 @@ func (p *PackageParser) getConnectionsForExecutable(exec *schema.AnyNonPackageEx
 	return connections
 }
 
+// connectionName returns the name of the connection manager with the given
+// refId, name or DTSID, or id itself if no such connection exists
+func (p *PackageParser) connectionName(id string) string {
+	if cm := p.findConnection(id); cm != nil {
+		return GetConnectionName(cm)
+	}
+	return id
+}
+
+// findConnection returns the connection manager with the given refId, name
+// or DTSID, or nil if there is none
+func (p *PackageParser) findConnection(id string) *schema.ConnectionManagerType {
+	if cm, exists := p.connMap[NormalizeRefId(id)]; exists {
+		return cm
+	}
+	if p.pkg.ConnectionManagers != nil {
+		for _, cm := range p.pkg.ConnectionManagers.ConnectionManager {
+			if cm.DTSIDAttr != nil && *cm.DTSIDAttr == id {
+				return cm
+			}
+		}
+	}
+	return nil
+}
+
 // extractConnectionRefs finds connection manager references in expressions
 func (p *PackageParser) extractConnectionRefs(expr string) []string {
 	var connections []string
 	// Look for patterns like @[ConnectionManager::Name]
-	re := regexp.MustCompile(`@\[ConnectionManager::([^\]]+)\]`)
-	matches := re.FindAllStringSubmatch(expr, -1)
-	for _, match := range matches {
-		if len(match) > 1 {
-			connections = append(connections, match[1])
+	for _, dep := range extractExpressionDependencies(expr) {
+		if name, ok := strings.CutPrefix(dep, "ConnectionManager::"); ok {
+			connections = append(connections, name)
 		}
 	}
 	return connections
@@ -314,36 +756,144 @@ func (p *PackageParser) extractDataflowSQL(exec *schema.AnyNonPackageExecutableT
 	}
 
 	for _, comp := range exec.ObjectData.Pipeline.Components.Component {
-		var sql string
+		var sql, sqlParam string
+		var sqlProp, sqlParamProp *schema.PipelineComponentPropertyType
+		found := false
 		if comp.Properties != nil {
 			for _, prop := range comp.Properties.Property {
 				if prop.NameAttr == nil {
 					continue
 				}
 				propName := *prop.NameAttr
+				if propName == "SqlCommandParam" {
+					sqlParam = strings.TrimSpace(prop.Value)
+					sqlParamProp = prop
+					continue
+				}
+				if found {
+					continue
+				}
 				if propName == "SqlCommand" || propName == "SqlStatement" || propName == "CommandText" ||
 					propName == "Query" || propName == "SelectQuery" || propName == "InsertQuery" ||
 					propName == "UpdateQuery" || propName == "DeleteQuery" || propName == "OpenRowset" {
+					found = true
 					sql = strings.TrimSpace(prop.Value)
 					if propName == "OpenRowset" && sql != "" {
 						sql = "SELECT * FROM " + sql
+					} else {
+						sqlProp = prop
 					}
-					break
+				}
+			}
+		}
+
+		classID := derefString(comp.ComponentClassIDAttr)
+		var set func(string)
+		if sqlProp != nil {
+			set = func(sql string) {
+				setComponentPropertyXML(exec.ObjectData, comp, *sqlProp.NameAttr, sqlProp.Value, sql)
+				sqlProp.Value = sql
+			}
+		}
+		// The OLE DB Command may keep its command with the input column mappings
+		if sql == "" && classID == "Microsoft.OLEDBCommand" {
+			if value := inputColumnSQL(comp); value != nil {
+				sql = strings.TrimSpace(value.Value)
+				set = func(sql string) {
+					setComponentPropertyXML(exec.ObjectData, comp, "SqlCommand", value.Value, sql)
+					value.Value = sql
 				}
 			}
 		}
 
 		if sql != "" {
-			connections := p.getConnectionsForComponent(comp)
 			*statements = append(*statements, &SQLStatement{
-				TaskName:    taskName,
-				TaskType:    "Dataflow",
-				SQL:         sql,
-				RefId:       getRefId(exec),
-				Connections: connections,
+				TaskName:         taskName,
+				TaskType:         "Dataflow",
+				SQL:              sql,
+				RefId:            getRefId(exec),
+				Connections:      p.getConnectionsForComponent(comp),
+				ComponentClassID: classID,
+				set:              set,
 			})
 		}
+		// A Lookup with a parameterised cache query runs it in addition to its SqlCommand
+		if classID == "Microsoft.Lookup" && sqlParam != "" && sqlParam != sql {
+			*statements = append(*statements, &SQLStatement{
+				TaskName:         taskName,
+				TaskType:         "Dataflow",
+				SQL:              sqlParam,
+				RefId:            getRefId(exec),
+				Connections:      p.getConnectionsForComponent(comp),
+				ComponentClassID: classID,
+				set: func(sql string) {
+					setComponentPropertyXML(exec.ObjectData, comp, "SqlCommandParam", sqlParamProp.Value, sql)
+					sqlParamProp.Value = sql
+				},
+			})
+		}
+	}
+}
+
+// setComponentPropertyXML sets the raw XML of the named property of comp,
+// whose current value is old, to value. Marshal writes the raw pipeline XML,
+// so rewriting only the typed property would be lost.
+func setComponentPropertyXML(data *schema.ExecutableObjectDataType, comp *schema.PipelineComponentType, name, old, value string) {
+	if data.InnerXML == "" {
+		return
+	}
+	elems := scanRawElements(data.InnerXML)
+	// insideComponent reports whether element i lies within a raw component
+	// element that matches comp
+	insideComponent := func(i int) bool {
+		for i = elems[i].parent; i != -1; i = elems[i].parent {
+			if elems[i].name.Local != "component" {
+				continue
+			}
+			if comp.IdAttr != nil {
+				id, _ := elems[i].attr("id")
+				return id == *comp.IdAttr
+			}
+			raw, _ := elems[i].attr("name")
+			return raw == derefString(comp.NameAttr)
+		}
+		return false
+	}
+	old = strings.TrimSpace(old)
+	for i, el := range elems {
+		if el.name.Local != "property" {
+			continue
+		}
+		if propName, _ := el.attr("name"); propName != name || strings.TrimSpace(el.text(data.InnerXML)) != old || !insideComponent(i) {
+			continue
+		}
+		data.InnerXML = applyRawEdits(data.InnerXML, []rawEdit{rawTextEdit(data.InnerXML, el, value)})
+		return
+	}
+}
+
+// inputColumnSQL returns the first non-empty SqlCommand property value found
+// on a component's input columns, or nil if there is none
+func inputColumnSQL(comp *schema.PipelineComponentType) *schema.AnySimpleType {
+	if comp.Inputs == nil {
+		return nil
+	}
+	for _, input := range comp.Inputs.Input {
+		if input.InputColumns == nil {
+			continue
+		}
+		for _, col := range input.InputColumns.InputColumn {
+			for _, props := range col.Properties {
+				for _, prop := range props.Property {
+					if prop.NameAttr != nil && *prop.NameAttr == "SqlCommand" && prop.AnySimpleType != nil &&
+						strings.TrimSpace(prop.AnySimpleType.Value) != "" {
+						return prop.AnySimpleType
+					}
+				}
+			}
+		}
 	}
+	return nil
 }
 
 // getConnectionsForComponent finds connections used by a component
@@ -352,7 +902,7 @@ func (p *PackageParser) getConnectionsForComponent(comp *schema.PipelineComponen
 	if comp.Connections != nil {
 		for _, conn := range comp.Connections.Connection {
 			if conn.ConnectionManagerIDAttr != nil {
-				if cm, exists := p.connMap[*conn.ConnectionManagerIDAttr]; exists {
+				if cm, exists := p.connMap[NormalizeRefId(*conn.ConnectionManagerIDAttr)]; exists {
 					if cm.ObjectNameAttr != nil {
 						connections = append(connections, *cm.ObjectNameAttr)
 					}
@@ -403,32 +953,34 @@ func (p *PrecedenceAnalyzer) buildDependencies() {
 	}
 
 	// Build dependency graph from precedence constraints
-	for _, exec := range p.pkg.Executable {
-		if exec.RefIdAttr == nil {
-			continue
-		}
-		refId := *exec.RefIdAttr
-
-		if exec.PrecedenceConstraint != nil {
-			for _, pc := range exec.PrecedenceConstraint {
-				if pc.Executable != nil {
-					for _, pcExec := range pc.Executable {
-						if pcExec.IDREFAttr != nil {
-							// This executable depends on the referenced executable
-							p.dependencies[refId] = append(p.dependencies[refId], *pcExec.IDREFAttr)
-						}
-					}
-				}
-			}
+	for _, link := range p.pkg.precedenceLinks() {
+		if link.to != "" {
+			// The constrained executable depends on each predecessor
+			p.dependencies[link.to] = append(p.dependencies[link.to], link.from...)
 		}
 	}
 }
 
-// GetExecutionOrder returns the execution order for an executable
+// GetExecutionOrder returns the execution order for an executable. If the
+// constraints contain a cycle, the error names the full cycle path.
 func (p *PrecedenceAnalyzer) GetExecutionOrder(refId string) (int, error) {
+	return p.executionOrder(refId, make(map[string]bool), nil)
+}
+
+// executionOrder computes GetExecutionOrder. visiting marks the executables
+// on the current walk and stack lists them in walk order, so a cycle can be
+// reported as a path.
+func (p *PrecedenceAnalyzer) executionOrder(refId string, visiting map[string]bool, stack []string) (int, error) {
 	if order, exists := p.orderCache[refId]; exists {
 		return order, nil
 	}
+	if visiting[refId] {
+		for i, id := range stack {
+			if id == refId {
+				return 0, fmt.Errorf("circular dependency detected: %s", formatCycle(stack[i:]))
+			}
+		}
+	}
 
 	// If no dependencies, assign sequential order
 	if len(p.dependencies[refId]) == 0 {
@@ -438,9 +990,11 @@ func (p *PrecedenceAnalyzer) GetExecutionOrder(refId string) (int, error) {
 	}
 
 	// Find maximum order among dependencies
+	visiting[refId] = true
+	stack = append(stack, refId)
 	maxDepOrder := 0
 	for _, depId := range p.dependencies[refId] {
-		depOrder, err := p.GetExecutionOrder(depId)
+		depOrder, err := p.executionOrder(depId, visiting, stack)
 		if err != nil {
 			return 0, err
 		}
@@ -448,16 +1002,19 @@ func (p *PrecedenceAnalyzer) GetExecutionOrder(refId string) (int, error) {
 			maxDepOrder = depOrder
 		}
 	}
+	visiting[refId] = false
 
 	order := maxDepOrder + 1
 	p.orderCache[refId] = order
 	return order, nil
 }
 
-// GetAllExecutionOrders returns execution orders for all executables
+// GetAllExecutionOrders returns execution orders for all executables.
+// Executables are visited in package declaration order, so independent tasks
+// get the same order numbers on every run.
 func (p *PrecedenceAnalyzer) GetAllExecutionOrders() (map[string]int, error) {
 	orders := make(map[string]int)
-	for refId := range p.execMap {
+	for _, refId := range p.refIds() {
 		order, err := p.GetExecutionOrder(refId)
 		if err != nil {
 			return nil, err
@@ -467,17 +1024,84 @@ func (p *PrecedenceAnalyzer) GetAllExecutionOrders() (map[string]int, error) {
 	return orders, nil
 }
 
-// GetExecutableChain returns the execution chain for an executable (all predecessors)
+// GetExecutionLevels groups executables by the length of the longest
+// precedence chain leading to them. Level 1 holds tasks with no predecessors;
+// tasks on the same level have no dependency on each other and can run in
+// parallel. Each level lists refIds in declaration order. An error is
+// returned if the constraints contain a cycle.
+func (p *PrecedenceAnalyzer) GetExecutionLevels() (map[int][]string, error) {
+	depths := make(map[string]int)
+	visiting := make(map[string]bool)
+
+	var depth func(string) (int, error)
+	depth = func(refId string) (int, error) {
+		if d, done := depths[refId]; done {
+			return d, nil
+		}
+		if visiting[refId] {
+			return 0, fmt.Errorf("circular dependency detected at %s", refId)
+		}
+		visiting[refId] = true
+		level := 1
+		for _, depId := range p.dependencies[refId] {
+			d, err := depth(depId)
+			if err != nil {
+				return 0, err
+			}
+			if d+1 > level {
+				level = d + 1
+			}
+		}
+		visiting[refId] = false
+		depths[refId] = level
+		return level, nil
+	}
+
+	levels := make(map[int][]string)
+	for _, refId := range p.refIds() {
+		level, err := depth(refId)
+		if err != nil {
+			return nil, err
+		}
+		levels[level] = append(levels[level], refId)
+	}
+	return levels, nil
+}
+
+// refIds returns the refIds of the package's executables in declaration order
+func (p *PrecedenceAnalyzer) refIds() []string {
+	var refIds []string
+	if p.pkg == nil {
+		return refIds
+	}
+	for _, exec := range p.pkg.Executable {
+		if exec.RefIdAttr != nil {
+			refIds = append(refIds, *exec.RefIdAttr)
+		}
+	}
+	return refIds
+}
+
+// GetExecutableChain returns the execution chain for an executable (all
+// predecessors, each listed once, followed by the executable itself). If the
+// constraints contain a cycle, the error names the full cycle path in
+// execution order, e.g. "A -> B -> C -> A".
 func (p *PrecedenceAnalyzer) GetExecutableChain(refId string) ([]string, error) {
 	var chain []string
-	visited := make(map[string]bool)
+	done := make(map[string]bool)
+	var stack []string
 
 	var buildChain func(string) error
 	buildChain = func(id string) error {
-		if visited[id] {
-			return fmt.Errorf("circular dependency detected at %s", id)
+		if done[id] {
+			return nil
 		}
-		visited[id] = true
+		for i, onStack := range stack {
+			if onStack == id {
+				return fmt.Errorf("circular dependency detected: %s", formatCycle(stack[i:]))
+			}
+		}
+		stack = append(stack, id)
 
 		for _, depId := range p.dependencies[id] {
 			if err := buildChain(depId); err != nil {
@@ -485,6 +1109,8 @@ func (p *PrecedenceAnalyzer) GetExecutableChain(refId string) ([]string, error)
 			}
 		}
 
+		stack = stack[:len(stack)-1]
+		done[id] = true
 		chain = append(chain, id)
 		return nil
 	}
@@ -496,12 +1122,36 @@ func (p *PrecedenceAnalyzer) GetExecutableChain(refId string) ([]string, error)
 	return chain, nil
 }
 
-// ValidateConstraints checks for constraint violations and circular dependencies
+// formatCycle renders a dependency cycle found while walking predecessors.
+// The walk runs against execution order, so the path is reversed to read
+// predecessor -> successor and starts and ends at the first node walked.
+func formatCycle(walk []string) string {
+	path := []string{walk[0]}
+	for i := len(walk) - 1; i > 0; i-- {
+		path = append(path, walk[i])
+	}
+	path = append(path, walk[0])
+	return strings.Join(path, " -> ")
+}
+
+// ValidateConstraints checks for constraint violations and circular
+// dependencies. A constraint whose IDREF matches no executable refId is
+// reported as well, since GetExecutionOrder would otherwise treat the missing
+// predecessor as a task with no dependencies.
 func (p *PrecedenceAnalyzer) ValidateConstraints() []error {
 	var errors []error
 
+	// Check for predecessors that do not exist
+	for _, refId := range p.refIds() {
+		for _, depId := range p.dependencies[refId] {
+			if _, exists := p.execMap[depId]; !exists {
+				errors = append(errors, fmt.Errorf("precedence constraint on %s references unknown executable %s", refId, depId))
+			}
+		}
+	}
+
 	// Check for circular dependencies
-	for refId := range p.execMap {
+	for _, refId := range p.refIds() {
 		if _, err := p.GetExecutableChain(refId); err != nil {
 			errors = append(errors, fmt.Errorf("constraint validation failed for %s: %v", refId, err))
 		}
@@ -531,16 +1181,16 @@ func (p *PrecedenceAnalyzer) GetExecutionFlowDescription() string {
 		typ   string
 	}
 	var execs []execInfo
-	for refId, order := range orders {
+	for _, refId := range p.refIds() {
 		if exec, exists := p.execMap[refId]; exists {
 			name := GetExecutableName(exec)
 			typ := exec.ExecutableTypeAttr
-			execs = append(execs, execInfo{order, name, typ})
+			execs = append(execs, execInfo{orders[refId], name, typ})
 		}
 	}
 
-	// Sort by order
-	sort.Slice(execs, func(i, j int) bool {
+	// Sort by order, keeping declaration order for ties
+	sort.SliceStable(execs, func(i, j int) bool {
 		return execs[i].order < execs[j].order
 	})
 
@@ -555,33 +1205,360 @@ func (p *PrecedenceAnalyzer) GetExecutionFlowDescription() string {
 	return flow.String()
 }
 
-// PackageValidator provides validation functions for DTSX packages
-type PackageValidator struct {
-	pkg      *Package
-	parser   *PackageParser
-	analyzer *PrecedenceAnalyzer
-}
+// GetDetailedFlow returns the execution flow description with each task's SQL
+// (truncated) and connections, as found by the parser's GetSQLStatements
+func (p *PrecedenceAnalyzer) GetDetailedFlow(parser *PackageParser) string {
+	if p.pkg == nil || len(p.pkg.Executable) == 0 {
+		return "No executables found in package."
+	}
 
-// NewPackageValidator creates a new validator for the package
-func NewPackageValidator(pkg *Package) *PackageValidator {
-	return &PackageValidator{
-		pkg:      pkg,
-		parser:   NewPackageParser(pkg),
-		analyzer: NewPrecedenceAnalyzer(pkg),
+	orders, err := p.GetAllExecutionOrders()
+	if err != nil {
+		return fmt.Sprintf("Error calculating execution order: %v", err)
 	}
-}
 
-// Validate performs comprehensive validation of the package
-func (v *PackageValidator) Validate() []*ValidationError {
-	var errors []*ValidationError
+	// Group SQL statements by owning task
+	statements := make(map[string][]*SQLStatement)
+	for _, stmt := range parser.GetSQLStatements() {
+		statements[stmt.RefId] = append(statements[stmt.RefId], stmt)
+	}
 
-	// Validate variables
-	if varErrors := v.pkg.validateVariables(); len(varErrors) > 0 {
-		for _, err := range varErrors {
-			errors = append(errors, &ValidationError{
-				Severity: err.Severity,
-				Message:  err.Message,
-				Path:     err.Path,
+	var refIds []string
+	for refId := range orders {
+		if _, exists := p.execMap[refId]; exists {
+			refIds = append(refIds, refId)
+		}
+	}
+	sort.Slice(refIds, func(i, j int) bool {
+		if orders[refIds[i]] != orders[refIds[j]] {
+			return orders[refIds[i]] < orders[refIds[j]]
+		}
+		return refIds[i] < refIds[j]
+	})
+
+	var flow strings.Builder
+	flow.WriteString("Detailed Execution Flow:\n")
+	for _, refId := range refIds {
+		exec := p.execMap[refId]
+		flow.WriteString(fmt.Sprintf("Task %d: %s", orders[refId], GetExecutableName(exec)))
+		if exec.ExecutableTypeAttr != "" {
+			flow.WriteString(fmt.Sprintf(" (%s)", exec.ExecutableTypeAttr))
+		}
+		flow.WriteString("\n")
+
+		connections := parser.getConnectionsForExecutable(exec)
+		for _, stmt := range statements[refId] {
+			if stmt.SourceType == "FileConnection" {
+				flow.WriteString("    SQL: (from file connection " + stmt.Source + ")\n")
+			} else {
+				flow.WriteString("    SQL: " + truncateSQL(stmt.SQL, 80) + "\n")
+			}
+			connections = append(connections, stmt.Connections...)
+		}
+		if unique := uniqueStrings(connections); len(unique) > 0 {
+			flow.WriteString("    Connections: " + strings.Join(unique, ", ") + "\n")
+		}
+	}
+
+	return flow.String()
+}
+
+// GetDOTGraph renders the precedence graph in GraphViz DOT format, suitable
+// for piping into dot. Each executable is a node labeled with its name and
+// type, keyed by refId; each precedence constraint is an edge from the
+// predecessor to the task it gates.
+func (p *PrecedenceAnalyzer) GetDOTGraph() string {
+	var dot strings.Builder
+	dot.WriteString("digraph precedence {\n")
+	dot.WriteString("    node [shape=box];\n")
+	for _, refId := range p.refIds() {
+		exec := p.execMap[refId]
+		label := dotEscape(GetExecutableName(exec))
+		if exec.ExecutableTypeAttr != "" {
+			label += `\n` + dotEscape(exec.ExecutableTypeAttr)
+		}
+		fmt.Fprintf(&dot, "    \"%s\" [label=\"%s\"];\n", dotEscape(refId), label)
+	}
+	for _, refId := range p.refIds() {
+		for _, dep := range p.dependencies[refId] {
+			fmt.Fprintf(&dot, "    \"%s\" -> \"%s\";\n", dotEscape(dep), dotEscape(refId))
+		}
+	}
+	dot.WriteString("}\n")
+	return dot.String()
+}
+
+// GetMermaidFlowchart renders the control flow as a Mermaid "flowchart TD"
+// block for embedding in markdown. Executables become nodes named t1, t2, ...
+// in declaration order; each precedence constraint becomes an arrow labeled
+// with its condition (Success, Failure or Completion) when the constraint
+// sets one.
+func (p *PrecedenceAnalyzer) GetMermaidFlowchart() string {
+	var chart strings.Builder
+	chart.WriteString("flowchart TD\n")
+
+	ids := make(map[string]string)
+	node := func(refId, label string) string {
+		if id, exists := ids[refId]; exists {
+			return id
+		}
+		id := fmt.Sprintf("t%d", len(ids)+1)
+		ids[refId] = id
+		fmt.Fprintf(&chart, "    %s[\"%s\"]\n", id, mermaidEscape(label))
+		return id
+	}
+	for _, refId := range p.refIds() {
+		node(refId, GetExecutableName(p.execMap[refId]))
+	}
+
+	for _, link := range p.pkg.precedenceLinks() {
+		if link.to == "" {
+			continue
+		}
+		arrow := "-->"
+		if link.value != "" {
+			arrow = "-->|" + constraintValueName(link.value) + "|"
+		}
+		to := node(link.to, link.to)
+		for _, refId := range link.from {
+			from := node(refId, refId)
+			fmt.Fprintf(&chart, "    %s %s %s\n", from, arrow, to)
+		}
+	}
+	return chart.String()
+}
+
+// mermaidEscape replaces characters that would end a quoted Mermaid label
+func mermaidEscape(s string) string {
+	return strings.ReplaceAll(s, `"`, "#quot;")
+}
+
+// dotEscape escapes backslashes and quotes for use in a DOT quoted string
+func dotEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
+
+// truncateSQL collapses whitespace in sql and shortens it to at most max characters
+func truncateSQL(sql string, max int) string {
+	sql = strings.Join(strings.Fields(sql), " ")
+	if runes := []rune(sql); len(runes) > max {
+		return string(runes[:max-3]) + "..."
+	}
+	return sql
+}
+
+// uniqueStrings returns values with duplicates removed, keeping first occurrences
+func uniqueStrings(values []string) []string {
+	var unique []string
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// containsString reports whether values contains v
+func containsString(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// appendUnique appends v to values unless it is already present
+func appendUnique(values []string, v string) []string {
+	if containsString(values, v) {
+		return values
+	}
+	return append(values, v)
+}
+
+// ConstraintStatus describes a precedence constraint and whether its expression currently holds
+type ConstraintStatus struct {
+	From            []string // RefIds of the predecessor executables
+	To              string   // RefId of the constrained executable
+	Value           string   // "Success", "Failure" or "Completion"
+	EvalOp          string   // "Constraint", "Expression", "ExpressionAndConstraint" or "ExpressionOrConstraint"
+	Expression      string
+	Active          bool // true when the expression evaluates to true (or the constraint has no expression)
+	EvaluationError string
+}
+
+// GetConstraintStatus returns every precedence constraint in the package along with
+// the evaluated state of its expression given the current variable values.
+// Constraints inside containers are included, in either the SSIS 2012+
+// PrecedenceConstraints form or the older IDREF form.
+func (p *Package) GetConstraintStatus() []ConstraintStatus {
+	var statuses []ConstraintStatus
+	if p == nil || p.ExecutableTypePackage == nil {
+		return statuses
+	}
+
+	var links []precedenceLink
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		links = append(links, resolvePrecedenceConstraints(precedenceConstraints(exec.PrecedenceConstraint, exec.PrecedenceConstraints), getRefId(exec))...)
+	})
+	links = append(links, resolvePrecedenceConstraints(precedenceConstraints(p.PrecedenceConstraint, p.PrecedenceConstraints), "")...)
+
+	parser := NewPackageParser(p)
+	for _, link := range links {
+		status := ConstraintStatus{
+			From:       link.from,
+			To:         link.to,
+			Value:      constraintValueName(link.value),
+			EvalOp:     constraintEvalOpName(link.evalOp),
+			Expression: link.expression,
+			Active:     true,
+		}
+		if status.Expression != "" {
+			result, err := parser.EvaluateExpression(status.Expression)
+			if err != nil {
+				status.Active = false
+				status.EvaluationError = err.Error()
+			} else {
+				status.Active = toBool(result)
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// precedenceLink is a precedence constraint with its ends resolved to refIds
+type precedenceLink struct {
+	from       []string
+	to         string
+	value      string // raw Value code
+	evalOp     string // raw EvalOp code
+	expression string
+}
+
+// resolvePrecedenceConstraints resolves the ends and settings of the precedence
+// constraints declared on owner, the refId of the enclosing executable ("" for
+// the package). Older packages store the settings as Property elements and the
+// ends as IDREF children, with the owner as the default target; SSIS 2012+
+// wraps the constraints in PrecedenceConstraints and stores everything as
+// attributes, naming the ends in From and To.
+func resolvePrecedenceConstraints(constraints []*schema.PrecedenceConstraintType, owner string) []precedenceLink {
+	var links []precedenceLink
+	for _, pc := range constraints {
+		link := precedenceLink{
+			to:         owner,
+			value:      attrOrProperty(pc.ValueAttr, pc.Property, "Value"),
+			evalOp:     attrOrProperty(pc.EvalOpAttr, pc.Property, "EvalOp"),
+			expression: attrOrProperty(pc.ExpressionAttr, pc.Property, "Expression"),
+		}
+		if pc.FromAttr != nil {
+			link.from = append(link.from, *pc.FromAttr)
+		}
+		if pc.ToAttr != nil {
+			link.to = *pc.ToAttr
+		}
+		for _, ref := range pc.Executable {
+			if ref.IDREFAttr == nil {
+				continue
+			}
+			// IsFrom="0" marks the constrained side; anything else is a predecessor
+			if ref.IsFromAttr != nil && *ref.IsFromAttr == 0 {
+				link.to = *ref.IDREFAttr
+				continue
+			}
+			link.from = append(link.from, *ref.IDREFAttr)
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// precedenceLinks returns the precedence constraints between the package's
+// top-level executables: those declared on the package in either form and the
+// legacy ones stored on the gated executable itself. Constraints wrapped
+// inside a container link that container's children and are left out.
+func (p *Package) precedenceLinks() []precedenceLink {
+	var links []precedenceLink
+	if p == nil || p.ExecutableTypePackage == nil {
+		return links
+	}
+	for _, exec := range p.Executable {
+		links = append(links, resolvePrecedenceConstraints(exec.PrecedenceConstraint, getRefId(exec))...)
+	}
+	return append(links, resolvePrecedenceConstraints(precedenceConstraints(p.PrecedenceConstraint, p.PrecedenceConstraints), "")...)
+}
+
+// constraintValueName maps a precedence constraint Value code to its name
+func constraintValueName(code string) string {
+	switch code {
+	case "", "0":
+		return "Success"
+	case "1":
+		return "Failure"
+	case "2":
+		return "Completion"
+	default:
+		return code
+	}
+}
+
+// constraintEvalOpName maps a precedence constraint EvalOp code to its name
+func constraintEvalOpName(code string) string {
+	switch code {
+	case "", "2":
+		return "Constraint"
+	case "1":
+		return "Expression"
+	case "3":
+		return "ExpressionAndConstraint"
+	case "4":
+		return "ExpressionOrConstraint"
+	default:
+		return code
+	}
+}
+
+// getPropertyValue returns the value of the named property, or "" if it is absent
+func getPropertyValue(props []*schema.Property, name string) string {
+	for _, prop := range props {
+		if prop.NameAttr != nil && *prop.NameAttr == name &&
+			prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+			return prop.PropertyElementBaseType.AnySimpleType.Value
+		}
+	}
+	return ""
+}
+
+// PackageValidator provides validation functions for DTSX packages
+type PackageValidator struct {
+	pkg      *Package
+	parser   *PackageParser
+	analyzer *PrecedenceAnalyzer
+}
+
+// NewPackageValidator creates a new validator for the package
+func NewPackageValidator(pkg *Package) *PackageValidator {
+	return &PackageValidator{
+		pkg:      pkg,
+		parser:   NewPackageParser(pkg),
+		analyzer: NewPrecedenceAnalyzer(pkg),
+	}
+}
+
+// Validate performs comprehensive validation of the package
+func (v *PackageValidator) Validate() []*ValidationError {
+	var errors []*ValidationError
+
+	// Validate variables
+	if varErrors := v.pkg.validateVariables(); len(varErrors) > 0 {
+		for _, err := range varErrors {
+			errors = append(errors, &ValidationError{
+				Severity: err.Severity,
+				Message:  err.Message,
+				Path:     err.Path,
 			})
 		}
 	}
@@ -601,6 +1578,7 @@ func (v *PackageValidator) Validate() []*ValidationError {
 	if connErrors := v.validateConnections(); len(connErrors) > 0 {
 		errors = append(errors, connErrors...)
 	}
+	errors = append(errors, v.validateConnectionReferences()...)
 
 	// Validate expressions
 	if exprErrors := v.validateExpressions(); len(exprErrors) > 0 {
@@ -610,6 +1588,60 @@ func (v *PackageValidator) Validate() []*ValidationError {
 	return errors
 }
 
+// validateConnectionReferences reports tasks and data flow components whose
+// connection reference (a Connection property, an Execute SQL Task connection
+// or a component's connectionManagerID) matches no connection manager in the
+// package. Project connection managers live outside the package and are not
+// checked.
+func (v *PackageValidator) validateConnectionReferences() []*ValidationError {
+	var errors []*ValidationError
+
+	check := func(owner, path, id string) {
+		if id == "" || strings.HasSuffix(id, ":external") || strings.HasPrefix(id, "Project.ConnectionManagers") {
+			return
+		}
+		if v.parser.findConnection(id) == nil {
+			errors = append(errors, &ValidationError{
+				Severity: "error",
+				Message:  fmt.Sprintf("%s references unknown connection %s", owner, id),
+				Path:     path,
+			})
+		}
+	}
+
+	v.pkg.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		name := GetExecutableName(exec)
+		path := "Executables." + getRefId(exec)
+		owner := "Task " + name
+
+		check(owner, path, getPropertyValue(exec.Property, "Connection"))
+
+		if NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.ExecuteSQLTask" && exec.ObjectData != nil {
+			connection := ""
+			if data := exec.ObjectData.SQLTaskSqlTaskData; data != nil && data.SQLTaskSqlTaskBaseAttributeGroup != nil {
+				connection = data.SQLTaskSqlTaskBaseAttributeGroup.ConnectionAttr
+			}
+			if connection == "" {
+				connection = sqlTaskAttribute(exec.ObjectData.InnerXML, "Connection")
+			}
+			check(owner, path, connection)
+		}
+
+		if exec.ObjectData != nil && exec.ObjectData.Pipeline != nil && exec.ObjectData.Pipeline.Components != nil {
+			for _, comp := range exec.ObjectData.Pipeline.Components.Component {
+				if comp.Connections == nil {
+					continue
+				}
+				for _, conn := range comp.Connections.Connection {
+					check(fmt.Sprintf("Component %s in %s", derefString(comp.NameAttr), name), path, derefString(conn.ConnectionManagerIDAttr))
+				}
+			}
+		}
+	})
+
+	return errors
+}
+
 // validateConnections checks connection managers for issues
 func (v *PackageValidator) validateConnections() []*ValidationError {
 	var errors []*ValidationError
@@ -670,7 +1702,32 @@ func (v *PackageValidator) validateExpressions() []*ValidationError {
 
 	exprInfos := expressions.Results.([]*ExpressionInfo)
 	for _, expr := range exprInfos {
-		_, err := v.parser.EvaluateExpression(expr.Expression)
+		text := expr.Expression
+		if expr.Location == "ForLoop" && expr.Name != "EvalExpression" {
+			// Init and assign expressions are assignments such as
+			// @Counter = 0; the assigned value is what gets evaluated
+			if _, value, ok := splitAssignment(text); ok {
+				text = value
+			}
+		}
+		if err := ValidateExpressionSyntax(text); err != nil {
+			errors = append(errors, &ValidationError{
+				Severity: "error",
+				Message:  fmt.Sprintf("Expression syntax error: %v", err),
+				Path:     expr.Location + "." + expr.Context,
+			})
+			continue
+		}
+		if ast, err := ParseExpression(text); err == nil {
+			for _, issue := range CheckExpression(ast) {
+				errors = append(errors, &ValidationError{
+					Severity: "warning",
+					Message:  fmt.Sprintf("Expression check: %s", issue),
+					Path:     expr.Location + "." + expr.Context,
+				})
+			}
+		}
+		_, err := v.parser.EvaluateExpression(text)
 		if err != nil {
 			errors = append(errors, &ValidationError{
 				Severity: "error",
@@ -738,116 +1795,596 @@ func GetConnectionName(cm *schema.ConnectionManagerType) string {
 	return "unnamed"
 }
 
-// GetVariableName returns the full name (namespace::name) of a variable
-func GetVariableName(v *schema.VariableType) string {
-	if v == nil {
-		return "unnamed"
-	}
-	namespace := "User"
-	if v.NamespaceAttr != nil {
-		namespace = *v.NamespaceAttr
-	}
-	name := "unnamed"
-	if v.ObjectNameAttr != nil {
-		name = *v.ObjectNameAttr
-	}
-	return namespace + "::" + name
+// FlatFileConnInfo holds the settings of a FLATFILE connection manager.
+// Delimiters are decoded from the _xHHHH_ form SSIS stores them in.
+type FlatFileConnInfo struct {
+	FilePath                  string
+	Format                    string // "Delimited", "FixedWidth" or "RaggedRight"
+	LocaleID                  string
+	CodePage                  string
+	Unicode                   bool
+	HeaderRowDelimiter        string
+	HeaderRowsToSkip          int
+	DataRowsToSkip            int
+	ColumnNamesInFirstDataRow bool
+	RowDelimiter              string
+	TextQualifier             string // "" when the file has no text qualifier
+	Columns                   []FlatFileColumnInfo
 }
 
-// GetExecutableName returns the name of an executable
-func GetExecutableName(exec *schema.AnyNonPackageExecutableType) string {
-	if exec == nil {
-		return "unnamed"
-	}
-	if exec.ObjectNameAttr != nil {
-		return *exec.ObjectNameAttr
+// FlatFileColumnInfo describes a column of a flat file connection manager
+type FlatFileColumnInfo struct {
+	Name          string
+	ColumnType    string
+	Delimiter     string
+	Width         int
+	MaximumWidth  int
+	DataType      int
+	DataPrecision int
+	DataScale     int
+	TextQualified bool
+}
+
+// OLEDBConnInfo holds the settings of an OLEDB connection manager
+type OLEDBConnInfo struct {
+	ConnectionString     string
+	Provider             string
+	DataSource           string
+	InitialCatalog       string
+	RetainSameConnection bool
+	ConnectRetryCount    int
+	ConnectRetryInterval int
+}
+
+// ExcelConnInfo holds the settings of an EXCEL connection manager
+type ExcelConnInfo struct {
+	ConnectionString       string
+	Provider               string
+	FilePath               string
+	ExcelVersion           string // e.g. "Excel 12.0 XML"
+	FirstRowHasColumnNames bool
+}
+
+// GetFlatFileProperties returns the settings of a FLATFILE connection
+// manager, or nil if cm is not a flat file connection
+func GetFlatFileProperties(cm *schema.ConnectionManagerType) *FlatFileConnInfo {
+	if !isConnectionType(cm, "FLATFILE") {
+		return nil
 	}
-	// Fallback to property
-	for _, prop := range exec.Property {
-		if prop.NameAttr != nil && *prop.NameAttr == "ObjectName" &&
-			prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
-			return prop.PropertyElementBaseType.AnySimpleType.Value
+	settings := connectionManagerSettings(cm)
+	info := &FlatFileConnInfo{
+		FilePath:                  settings["ConnectionString"],
+		Format:                    settings["Format"],
+		LocaleID:                  settings["LocaleID"],
+		CodePage:                  settings["CodePage"],
+		Unicode:                   parseSettingBool(settings["Unicode"]),
+		HeaderRowDelimiter:        decodeSSISEscapes(settings["HeaderRowDelimiter"]),
+		HeaderRowsToSkip:          parseSettingInt(settings["HeaderRowsToSkip"]),
+		DataRowsToSkip:            parseSettingInt(settings["DataRowsToSkip"]),
+		ColumnNamesInFirstDataRow: parseSettingBool(settings["ColumnNamesInFirstDataRow"]),
+		RowDelimiter:              decodeSSISEscapes(settings["RowDelimiter"]),
+		TextQualifier:             decodeSSISEscapes(settings["TextQualifier"]),
+	}
+	if info.TextQualifier == "<none>" {
+		info.TextQualifier = ""
+	}
+
+	if cm.ObjectData != nil && cm.ObjectData.ConnectionManager != nil {
+		data := cm.ObjectData.ConnectionManager
+		// SSIS 2012+ nests attribute-form columns under FlatFileColumns;
+		// older packages list property-form columns directly
+		columns := append(append([]*schema.FlatFileColumnType{}, data.FlatFileColumns...), data.FlatFileColumn...)
+		for _, col := range columns {
+			values := flatFileColumnSettings(col)
+			info.Columns = append(info.Columns, FlatFileColumnInfo{
+				Name:          values["ObjectName"],
+				ColumnType:    values["ColumnType"],
+				Delimiter:     decodeSSISEscapes(values["ColumnDelimiter"]),
+				Width:         parseSettingInt(values["ColumnWidth"]),
+				MaximumWidth:  parseSettingInt(values["MaximumWidth"]),
+				DataType:      parseSettingInt(values["DataType"]),
+				DataPrecision: parseSettingInt(values["DataPrecision"]),
+				DataScale:     parseSettingInt(values["DataScale"]),
+				TextQualified: parseSettingBool(values["TextQualified"]),
+			})
 		}
 	}
-	return "unnamed"
+	return info
 }
 
-// GetExpressionDetails returns detailed information about an expression including evaluation result and dependencies
-func GetExpressionDetails(exprInfo *ExpressionInfo, pkg *Package) *ExpressionDetails {
-	if exprInfo == nil {
+// GetOLEDBProperties returns the settings of an OLEDB connection manager, or
+// nil if cm is not an OLE DB connection
+func GetOLEDBProperties(cm *schema.ConnectionManagerType) *OLEDBConnInfo {
+	if !isConnectionType(cm, "OLEDB") {
 		return nil
 	}
-
-	details := &ExpressionDetails{
-		Expression: exprInfo.Expression,
-		Location:   exprInfo.Location,
-		Name:       exprInfo.Name,
-		Context:    exprInfo.Context,
+	settings := connectionManagerSettings(cm)
+	connStr := settings["ConnectionString"]
+	conn := ParseConnectionInfo(connStr)
+	retain := settings["Retain"]
+	if retain == "" {
+		retain = settings["RetainSameConnection"]
+	}
+	return &OLEDBConnInfo{
+		ConnectionString:     connStr,
+		Provider:             conn.Provider,
+		DataSource:           conn.Server,
+		InitialCatalog:       conn.Database,
+		RetainSameConnection: parseSettingBool(retain),
+		ConnectRetryCount:    parseSettingInt(settings["ConnectRetryCount"]),
+		ConnectRetryInterval: parseSettingInt(settings["ConnectRetryInterval"]),
 	}
+}
 
-	// Try to evaluate the expression
-	if pkg != nil {
-		parser := NewPackageParser(pkg)
-		if result, err := parser.EvaluateExpression(exprInfo.Expression); err == nil {
-			details.EvaluatedValue = fmt.Sprintf("%v", result)
-		} else {
-			details.EvaluationError = err.Error()
+// GetExcelProperties returns the settings of an EXCEL connection manager, or
+// nil if cm is not an Excel connection
+func GetExcelProperties(cm *schema.ConnectionManagerType) *ExcelConnInfo {
+	if !isConnectionType(cm, "EXCEL") {
+		return nil
+	}
+	connStr := connectionManagerSettings(cm)["ConnectionString"]
+	parts := ParseConnectionString(connStr)
+	info := &ExcelConnInfo{
+		ConnectionString: connStr,
+		Provider:         parts["provider"],
+		FilePath:         parts["data source"],
+		// The Jet and ACE providers treat the first row as headers unless HDR=NO
+		FirstRowHasColumnNames: true,
+	}
+	extended := parts["extended properties"]
+	for _, part := range strings.Split(extended, ";") {
+		if part = strings.TrimSpace(part); part != "" && !strings.Contains(part, "=") {
+			info.ExcelVersion = part
+			break
 		}
-
-		// Extract dependencies (variables, parameters, etc.)
-		details.Dependencies = extractExpressionDependencies(exprInfo.Expression, pkg)
 	}
+	if hdr, ok := ParseConnectionString(extended)["hdr"]; ok {
+		info.FirstRowHasColumnNames = !strings.EqualFold(hdr, "NO")
+	}
+	return info
+}
 
-	return details
+// isConnectionType reports whether cm has the given creation name
+func isConnectionType(cm *schema.ConnectionManagerType, creationName string) bool {
+	return cm != nil && strings.EqualFold(derefString(cm.CreationNameAttr), creationName)
 }
 
-// ExpressionDetails provides comprehensive information about an expression
-type ExpressionDetails struct {
-	Expression      string
-	Location        string
-	Name            string
-	Context         string
-	EvaluatedValue  string
-	EvaluationError string
-	Dependencies    []string
+// connectionManagerSettings merges the properties of a connection manager with
+// those of its ObjectData, which take precedence. Both the SSIS 2012+
+// attribute form and the older property form are read.
+func connectionManagerSettings(cm *schema.ConnectionManagerType) map[string]string {
+	settings := make(map[string]string)
+	addPropertySettings(settings, cm.Property)
+	if cm.ObjectData == nil || cm.ObjectData.ConnectionManager == nil {
+		return settings
+	}
+	data := cm.ObjectData.ConnectionManager
+	addPropertySettings(settings, data.Property)
+	addAttrSettings(settings, map[string]*string{
+		"ConnectRetryCount":         data.ConnectRetryCountAttr,
+		"ConnectRetryInterval":      data.ConnectRetryIntervalAttr,
+		"Retain":                    data.RetainAttr,
+		"Format":                    data.FormatAttr,
+		"LocaleID":                  data.LocaleIDAttr,
+		"Unicode":                   data.UnicodeAttr,
+		"HeaderRowsToSkip":          data.HeaderRowsToSkipAttr,
+		"HeaderRowDelimiter":        data.HeaderRowDelimiterAttr,
+		"ColumnNamesInFirstDataRow": data.ColumnNamesInFirstDataRowAttr,
+		"RowDelimiter":              data.RowDelimiterAttr,
+		"DataRowsToSkip":            data.DataRowsToSkipAttr,
+		"TextQualifier":             data.TextQualifierAttr,
+		"CodePage":                  data.CodePageAttr,
+		"ConnectionString":          data.ConnectionStringAttr,
+	})
+	return settings
 }
 
-// extractExpressionDependencies extracts variable and parameter references from an expression
-func extractExpressionDependencies(expr string, pkg *Package) []string {
-	var deps []string
+// flatFileColumnSettings returns the settings of a flat file column in either
+// the attribute or the property form
+func flatFileColumnSettings(col *schema.FlatFileColumnType) map[string]string {
+	settings := make(map[string]string)
+	if col == nil {
+		return settings
+	}
+	addPropertySettings(settings, col.Property)
+	addAttrSettings(settings, map[string]*string{
+		"ColumnType":      col.ColumnTypeAttr,
+		"ColumnDelimiter": col.ColumnDelimiterAttr,
+		"ColumnWidth":     col.ColumnWidthAttr,
+		"MaximumWidth":    col.MaximumWidthAttr,
+		"DataType":        col.DataTypeAttr,
+		"DataPrecision":   col.DataPrecisionAttr,
+		"DataScale":       col.DataScaleAttr,
+		"TextQualified":   col.TextQualifiedAttr,
+		"ObjectName":      col.ObjectNameAttr,
+	})
+	return settings
+}
 
-	// Simple regex patterns for common SSIS expression syntax
-	// Variables: @[User::VarName] or @[System::VarName]
-	varRegex := regexp.MustCompile(`@\[([^]]+)\]`)
-	matches := varRegex.FindAllStringSubmatch(expr, -1)
-	for _, match := range matches {
-		if len(match) > 1 {
-			deps = append(deps, match[1])
+// addPropertySettings copies named DTS:Property values into settings
+func addPropertySettings(settings map[string]string, props []*schema.Property) {
+	for _, prop := range props {
+		if prop.NameAttr != nil && prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+			settings[*prop.NameAttr] = prop.PropertyElementBaseType.AnySimpleType.Value
 		}
 	}
+}
 
-	// Parameters: $Project::ParamName or $Package::ParamName
-	paramRegex := regexp.MustCompile(`\$([^:]+)::([^\s\)]+)`)
-	paramMatches := paramRegex.FindAllStringSubmatch(expr, -1)
-	for _, match := range paramMatches {
-		if len(match) > 2 {
-			deps = append(deps, match[1]+"::"+match[2])
+// addAttrSettings copies the non-nil attribute values into settings
+func addAttrSettings(settings map[string]string, attrs map[string]*string) {
+	for name, attr := range attrs {
+		if attr != nil {
+			settings[name] = *attr
 		}
 	}
+}
 
-	return deps
+// parseSettingBool parses an SSIS boolean setting ("True", "False", "1", "0")
+func parseSettingBool(value string) bool {
+	b, _ := strconv.ParseBool(strings.TrimSpace(value))
+	return b
 }
 
-// GetProperty returns the value of the specified property by name for any struct
-func GetProperty(s interface{}, name string) interface{} {
-	t := reflect.TypeOf(s)
-	v := reflect.ValueOf(s)
-	if t.Kind() == reflect.Ptr {
-		t = t.Elem()
-		v = v.Elem()
-	}
-	if t.Kind() != reflect.Struct {
-		return nil
+// parseSettingInt parses an integer setting, returning 0 if it is not a number
+func parseSettingInt(value string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(value))
+	return n
+}
+
+var ssisEscapePattern = regexp.MustCompile(`_x([0-9A-Fa-f]{4})_`)
+
+// decodeSSISEscapes decodes the _xHHHH_ character escapes SSIS uses for
+// delimiters, e.g. "_x000D__x000A_" becomes "\r\n"
+func decodeSSISEscapes(s string) string {
+	return ssisEscapePattern.ReplaceAllStringFunc(s, func(m string) string {
+		code, _ := strconv.ParseUint(m[2:6], 16, 32)
+		return string(rune(code))
+	})
+}
+
+// ParseConnectionString splits a connection string into its key/value pairs.
+// Keys are trimmed and lowercased, e.g. "data source". A value may be wrapped
+// in double quotes, single quotes or braces to contain semicolons; a doubled
+// closing character inside it stands for itself.
+func ParseConnectionString(connStr string) map[string]string {
+	values := make(map[string]string)
+	for _, pair := range splitConnectionString(connStr) {
+		values[pair.key] = pair.value
+	}
+	return values
+}
+
+// connectionStringPair is one key/value pair of a connection string
+type connectionStringPair struct {
+	key, value string
+	start, end int // byte range in the connection string, including the trailing semicolon
+}
+
+// splitConnectionString returns the pairs of connStr in order, using the
+// quoting rules described on ParseConnectionString
+func splitConnectionString(connStr string) []connectionStringPair {
+	var pairs []connectionStringPair
+	for i := 0; i < len(connStr); {
+		sep := strings.IndexAny(connStr[i:], "=;")
+		if sep < 0 {
+			break
+		}
+		if connStr[i+sep] == ';' {
+			i += sep + 1
+			continue
+		}
+		start := i
+		key := strings.ToLower(strings.TrimSpace(connStr[i : i+sep]))
+		i += sep + 1
+		for i < len(connStr) && connStr[i] == ' ' {
+			i++
+		}
+
+		var value string
+		if i < len(connStr) && strings.IndexByte(`"'{`, connStr[i]) >= 0 {
+			closing := connStr[i]
+			if closing == '{' {
+				closing = '}'
+			}
+			i++
+			var b strings.Builder
+			for i < len(connStr) {
+				if connStr[i] == closing {
+					// A doubled closing character is an escaped literal
+					if i+1 < len(connStr) && connStr[i+1] == closing {
+						b.WriteByte(closing)
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteByte(connStr[i])
+				i++
+			}
+			value = b.String()
+			if end := strings.IndexByte(connStr[i:], ';'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(connStr)
+			}
+		} else {
+			end := strings.IndexByte(connStr[i:], ';')
+			if end < 0 {
+				end = len(connStr) - i
+			}
+			value = strings.TrimSpace(connStr[i : i+end])
+			i += end + 1
+		}
+		if i > len(connStr) {
+			i = len(connStr)
+		}
+
+		if key != "" {
+			pairs = append(pairs, connectionStringPair{key: key, value: value, start: start, end: i})
+		}
+	}
+	return pairs
+}
+
+// ConnectionInfo holds the common components of a connection string
+type ConnectionInfo struct {
+	Server             string
+	Database           string
+	Provider           string
+	IntegratedSecurity bool
+}
+
+// ParseConnectionInfo extracts the server, database, provider and
+// authentication mode from a connection string. Both the OLE DB keys (Data
+// Source, Initial Catalog, Integrated Security) and their ADO.NET and ODBC
+// synonyms (Server, Database, Trusted_Connection) are recognised.
+func ParseConnectionInfo(connStr string) *ConnectionInfo {
+	parts := ParseConnectionString(connStr)
+	info := &ConnectionInfo{
+		Server:   firstConnectionValue(parts, "data source", "server", "address", "addr", "network address"),
+		Database: firstConnectionValue(parts, "initial catalog", "database"),
+		Provider: parts["provider"],
+	}
+	switch strings.ToLower(firstConnectionValue(parts, "integrated security", "trusted_connection")) {
+	case "sspi", "true", "yes":
+		info.IntegratedSecurity = true
+	}
+	return info
+}
+
+// firstConnectionValue returns the value of the first key present in parts
+func firstConnectionValue(parts map[string]string, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := parts[key]; ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// GetParameterName returns the expression name of a package parameter, e.g. "$Package::BatchSize"
+func GetParameterName(param *PackageParameterType) string {
+	if param == nil || param.ObjectNameAttr == nil {
+		return "$Package::unnamed"
+	}
+	return "$Package::" + *param.ObjectNameAttr
+}
+
+// GetParameterValue returns the design-time value of a package parameter
+func GetParameterValue(param *PackageParameterType) string {
+	if param == nil {
+		return ""
+	}
+	return getPropertyValue(param.Property, "ParameterValue")
+}
+
+// GetVariableName returns the full name (namespace::name) of a variable
+func GetVariableName(v *schema.VariableType) string {
+	if v == nil {
+		return "unnamed"
+	}
+	namespace := "User"
+	if v.NamespaceAttr != nil {
+		namespace = *v.NamespaceAttr
+	}
+	name := "unnamed"
+	if v.ObjectNameAttr != nil {
+		name = *v.ObjectNameAttr
+	}
+	return namespace + "::" + name
+}
+
+// GetExecutableName returns the name of an executable
+func GetExecutableName(exec *schema.AnyNonPackageExecutableType) string {
+	if exec == nil {
+		return "unnamed"
+	}
+	if exec.ObjectNameAttr != nil {
+		return *exec.ObjectNameAttr
+	}
+	// Fallback to property
+	for _, prop := range exec.Property {
+		if prop.NameAttr != nil && *prop.NameAttr == "ObjectName" &&
+			prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+			return prop.PropertyElementBaseType.AnySimpleType.Value
+		}
+	}
+	return "unnamed"
+}
+
+// hasExecutableName reports whether an executable has an ObjectName attribute or property
+func hasExecutableName(exec *schema.AnyNonPackageExecutableType) bool {
+	if exec.ObjectNameAttr != nil && *exec.ObjectNameAttr != "" {
+		return true
+	}
+	return getPropertyValue(exec.Property, "ObjectName") != ""
+}
+
+// nameFromRefId derives an object name from the last segment of a refId, e.g. "Package\Load Data" -> "Load Data"
+func nameFromRefId(refId string) string {
+	if i := strings.LastIndex(refId, "\\"); i >= 0 {
+		return refId[i+1:]
+	}
+	return refId
+}
+
+// GetExecutablesMissingName returns executables that have no ObjectName
+func (p *Package) GetExecutablesMissingName() []*schema.AnyNonPackageExecutableType {
+	return p.QueryExecutables(func(exec *schema.AnyNonPackageExecutableType) bool {
+		return !hasExecutableName(exec)
+	})
+}
+
+// FillMissingNames sets ObjectName on unnamed executables from their refId and returns the number filled
+func (p *Package) FillMissingNames() int {
+	filled := 0
+	for _, exec := range p.GetExecutablesMissingName() {
+		if name := nameFromRefId(getRefId(exec)); name != "" {
+			exec.ObjectNameAttr = stringPtr(name)
+			filled++
+		}
+	}
+	return filled
+}
+
+// GetExpressionDetails returns detailed information about an expression including evaluation result and dependencies
+func GetExpressionDetails(exprInfo *ExpressionInfo, pkg *Package) *ExpressionDetails {
+	if exprInfo == nil {
+		return nil
+	}
+
+	details := &ExpressionDetails{
+		Expression: exprInfo.Expression,
+		Location:   exprInfo.Location,
+		Name:       exprInfo.Name,
+		Context:    exprInfo.Context,
+	}
+
+	// Try to evaluate the expression
+	if pkg != nil {
+		parser := NewPackageParser(pkg)
+		if result, err := parser.EvaluateExpression(exprInfo.Expression); err == nil {
+			details.EvaluatedValue = fmt.Sprintf("%v", result)
+		} else {
+			details.EvaluationError = err.Error()
+		}
+
+		details.Dependencies = extractExpressionDependencies(exprInfo.Expression)
+		details.Functions = extractExpressionFunctions(exprInfo.Expression)
+	}
+
+	return details
+}
+
+// ExpressionDetails provides comprehensive information about an expression
+type ExpressionDetails struct {
+	Expression      string
+	Location        string
+	Name            string
+	Context         string
+	EvaluatedValue  string
+	EvaluationError string
+	// Dependencies lists the variables (User::Name), parameters
+	// (Project::Name) and connection managers (ConnectionManager::Name) the
+	// expression references
+	Dependencies []string
+	// Functions lists the built-in functions the expression calls, uppercased
+	Functions []string
+}
+
+// GetReferencedParameters returns the distinct project and package parameter
+// references ($Project::Name, $Package::Name) found across all expressions, in
+// the order they are first seen. Variables are not included.
+func (p *Package) GetReferencedParameters() []string {
+	var params []string
+	seen := make(map[string]bool)
+	exprs := p.GetExpressions().Results.([]*ExpressionInfo)
+	for _, expr := range exprs {
+		for _, param := range extractParameterReferences(expr.Expression) {
+			if !seen[param] {
+				seen[param] = true
+				params = append(params, param)
+			}
+		}
+	}
+	return params
+}
+
+// extractParameterReferences extracts $Scope::Name parameter references, with or without @[...]
+func extractParameterReferences(expr string) []string {
+	re := regexp.MustCompile(`\$([A-Za-z]+)::([^\]\s(),+"]+)`)
+	var refs []string
+	for _, match := range re.FindAllStringSubmatch(expr, -1) {
+		refs = append(refs, "$"+match[1]+"::"+match[2])
+	}
+	return refs
+}
+
+// extractExpressionDependencies returns the distinct variables (User::Name),
+// parameters (Project::Name, Package::Name) and connection managers
+// (ConnectionManager::Name) an expression references, in the order they appear
+func extractExpressionDependencies(expr string) []string {
+	var deps []string
+	seen := make(map[string]bool)
+	add := func(dep string) {
+		if dep != "" && !seen[dep] {
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+	}
+
+	tokens := tokenize(expr)
+	for i, tok := range tokens {
+		switch {
+		case tok.Type == "variable":
+			// @[User::Name], @[ConnectionManager::Name] or @[$Project::Name]
+			name := strings.TrimSuffix(strings.TrimPrefix(tok.Value, "@["), "]")
+			add(strings.TrimPrefix(name, "$"))
+		case tok.Type == "parameter":
+			// $Project::Name or $[Project::Name]
+			name := strings.TrimPrefix(tok.Value, "$")
+			add(strings.TrimSuffix(strings.TrimPrefix(name, "["), "]"))
+		case tok.Type == "unknown" && tok.Value == "@" && i+1 < len(tokens) && tokens[i+1].Type == "identifier":
+			// Unbracketed @Name
+			add(tokens[i+1].Value)
+		}
+	}
+	return deps
+}
+
+// extractExpressionFunctions returns the distinct built-in functions an
+// expression calls, uppercased, in the order they appear
+func extractExpressionFunctions(expr string) []string {
+	var functions []string
+	seen := make(map[string]bool)
+	tokens := tokenize(expr)
+	for i, tok := range tokens {
+		if tok.Type != "identifier" || i+1 >= len(tokens) || tokens[i+1].Type != "lparen" {
+			continue
+		}
+		if i > 0 && tokens[i-1].Type == "unknown" && tokens[i-1].Value == "@" {
+			continue
+		}
+		name := strings.ToUpper(tok.Value)
+		if !seen[name] {
+			seen[name] = true
+			functions = append(functions, name)
+		}
+	}
+	return functions
+}
+
+// GetProperty returns the value of the specified property by name for any struct
+func GetProperty(s interface{}, name string) interface{} {
+	t := reflect.TypeOf(s)
+	v := reflect.ValueOf(s)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		v = v.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
 	}
 	for i := 0; i < t.NumField(); i++ {
 		field := t.Field(i)
@@ -909,23 +2446,899 @@ func (p *Package) GetVariableByName(name string) (*schema.VariableType, error) {
 			}
 		}
 	}
-	return nil, fmt.Errorf("variable %s not found", name)
+	return nil, fmt.Errorf("variable %s not found", name)
+}
+
+// GetExecutableByName finds an executable by its ObjectName, given as an
+// attribute or as a property. Tasks nested in containers are searched too;
+// the first match in document order is returned.
+func (p *Package) GetExecutableByName(name string) (*schema.AnyNonPackageExecutableType, error) {
+	if p == nil || p.ExecutableTypePackage == nil || p.Executable == nil {
+		return nil, fmt.Errorf("package or executables are nil")
+	}
+
+	var found *schema.AnyNonPackageExecutableType
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		if found == nil && hasExecutableName(exec) && GetExecutableName(exec) == name {
+			found = exec
+		}
+	})
+	if found == nil {
+		return nil, fmt.Errorf("executable %s not found", name)
+	}
+	return found, nil
+}
+
+// GetParameters returns all package parameters (DTS:PackageParameters).
+// Parameters are referenced in expressions as $Package::Name; project
+// parameters ($Project::Name) live in the project, not in the .dtsx file.
+func (p *Package) GetParameters() *QueryResult {
+	if p == nil || p.PackageParameters == nil || p.PackageParameters.PackageParameter == nil {
+		return &QueryResult{Count: 0, Results: []*PackageParameterType{}}
+	}
+	return &QueryResult{
+		Count:   len(p.PackageParameters.PackageParameter),
+		Results: p.PackageParameters.PackageParameter,
+	}
+}
+
+// GetParameterByName finds a package parameter by name. The name may be
+// given as "$Package::Name", "Package::Name" or just "Name".
+func (p *Package) GetParameterByName(name string) (*PackageParameterType, error) {
+	if p == nil || p.PackageParameters == nil || p.PackageParameters.PackageParameter == nil {
+		return nil, fmt.Errorf("package or parameters are nil")
+	}
+
+	searchName := strings.TrimPrefix(name, "$")
+	if scope, objectName, found := strings.Cut(searchName, "::"); found {
+		if scope != "Package" {
+			return nil, fmt.Errorf("parameter %s not found: only $Package parameters are stored in the package", name)
+		}
+		searchName = objectName
+	}
+
+	for _, param := range p.PackageParameters.PackageParameter {
+		if param.ObjectNameAttr != nil && *param.ObjectNameAttr == searchName {
+			return param, nil
+		}
+	}
+	return nil, fmt.Errorf("parameter %s not found", name)
+}
+
+// GetConfigurations returns the package configurations (DTS:Configurations).
+// Configurations stored in the older property-based format are converted so
+// both formats are reported the same way.
+func (p *Package) GetConfigurations() *QueryResult {
+	configs := []*ConfigurationType{}
+	if p == nil {
+		return &QueryResult{Count: 0, Results: configs}
+	}
+	if p.Configurations != nil {
+		configs = append(configs, p.Configurations.Configuration...)
+	}
+	if p.ExecutableTypePackage != nil {
+		for _, legacy := range p.Configuration {
+			cfg := &ConfigurationType{}
+			if v := getPropertyValue(legacy.Property, "ObjectName"); v != "" {
+				cfg.ObjectNameAttr = stringPtr(v)
+			}
+			if v, err := strconv.Atoi(getPropertyValue(legacy.Property, "ConfigurationType")); err == nil {
+				cfg.ConfigurationTypeAttr = &v
+			}
+			if v := getPropertyValue(legacy.Property, "ConfigurationString"); v != "" {
+				cfg.ConfigurationStringAttr = stringPtr(v)
+			}
+			if v := getPropertyValue(legacy.Property, "ConfigurationVariable"); v != "" {
+				cfg.ConfigurationVariableAttr = stringPtr(v)
+			}
+			configs = append(configs, cfg)
+		}
+	}
+	return &QueryResult{Count: len(configs), Results: configs}
+}
+
+// EventHandlerInfo summarizes an event handler and the container it is attached to
+type EventHandlerInfo struct {
+	EventName   string   // e.g. "OnError", "OnPreExecute"
+	HostName    string   // object name of the package or task hosting the handler
+	HostRefId   string   // refId of the host, "Package" for package-level handlers
+	HostType    string   // "Package" or the executable type of the host task
+	Executables []string // names of the tasks the handler runs
+	Handler     *schema.EventHandlerType
+}
+
+// GetEventHandlers returns the event handlers of the package and of every
+// task, including tasks nested in containers. Results are []*EventHandlerInfo.
+func (p *Package) GetEventHandlers() *QueryResult {
+	handlers := []*EventHandlerInfo{}
+	if p == nil || p.ExecutableTypePackage == nil {
+		return &QueryResult{Count: 0, Results: handlers}
+	}
+
+	host, refId := "Package", "Package"
+	if p.ObjectNameAttr != nil {
+		host = *p.ObjectNameAttr
+	}
+	if p.RefIdAttr != nil {
+		refId = *p.RefIdAttr
+	}
+	for _, eh := range append(append([]*schema.EventHandlerType{}, p.EventHandler...), p.EventHandlers...) {
+		handlers = append(handlers, newEventHandlerInfo(eh, host, refId, "Package"))
+	}
+
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		for _, eh := range append(append([]*schema.EventHandlerType{}, exec.EventHandler...), exec.EventHandlers...) {
+			handlers = append(handlers, newEventHandlerInfo(eh, GetExecutableName(exec), getRefId(exec), exec.ExecutableTypeAttr))
+		}
+	})
+
+	return &QueryResult{Count: len(handlers), Results: handlers}
+}
+
+// newEventHandlerInfo summarizes eh, reading the event name from the SSIS
+// 2012+ attribute or the older EventName property
+func newEventHandlerInfo(eh *schema.EventHandlerType, hostName, hostRefId, hostType string) *EventHandlerInfo {
+	info := &EventHandlerInfo{
+		EventName: derefString(eh.EventNameAttr),
+		HostName:  hostName,
+		HostRefId: hostRefId,
+		HostType:  hostType,
+		Handler:   eh,
+	}
+	if info.EventName == "" {
+		info.EventName = getPropertyValue(eh.Property, "EventName")
+	}
+	for _, exec := range append(append([]*schema.AnyNonPackageExecutableType{}, eh.Executable...), eh.Executables...) {
+		info.Executables = append(info.Executables, GetExecutableName(exec))
+	}
+	return info
+}
+
+// ForEachLoopInfo describes a For Each Loop container: its enumerator and the
+// variables each iteration's values are written to
+type ForEachLoopInfo struct {
+	Name           string
+	RefId          string
+	EnumeratorType string // "File", "Item", "ADO", "ADO.NET Schema Rowset", "Variable", "NodeList", "SMO" or ""
+	CreationName   string // enumerator creation name, e.g. "Microsoft.ForEachFileEnumerator"
+	// Settings holds the enumerator configuration, e.g. Folder and FileSpec
+	// for the file enumerator or VarName for the ADO enumerator
+	Settings map[string]string
+	Mappings []ForEachVariableMapping
+}
+
+// ForEachVariableMapping maps an enumerated value index to a variable
+type ForEachVariableMapping struct {
+	Index    int
+	Variable string // e.g. "User::CurrentFile"
+}
+
+// forEachEnumeratorTypes maps creation name fragments to enumerator types.
+// Schema rowset enumerators are listed first because their names also
+// contain "ADO".
+var forEachEnumeratorTypes = []struct {
+	fragment       string
+	enumeratorType string
+}{
+	{"schemarowset", "ADO.NET Schema Rowset"},
+	{"foreachfileenumerator", "File"},
+	{"foreachitemenumerator", "Item"},
+	{"foreachadoenumerator", "ADO"},
+	{"foreachfromvarenumerator", "Variable"},
+	{"foreachnodelistenumerator", "NodeList"},
+	{"foreachsmoenumerator", "SMO"},
+}
+
+// GetForEachLoops returns every For Each Loop container in the package,
+// including loops nested in other containers, in document order
+func (p *Package) GetForEachLoops() []*ForEachLoopInfo {
+	var loops []*ForEachLoopInfo
+	if p == nil || p.ExecutableTypePackage == nil {
+		return loops
+	}
+
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		if exec.ForEachEnumerator != nil || strings.EqualFold(exec.ExecutableTypeAttr, "STOCK:FOREACHLOOP") {
+			loops = append(loops, newForEachLoopInfo(exec))
+		}
+	})
+	return loops
+}
+
+// newForEachLoopInfo summarizes a For Each Loop executable. Both the SSIS
+// 2012+ attribute form and the older property form are read.
+func newForEachLoopInfo(exec *schema.AnyNonPackageExecutableType) *ForEachLoopInfo {
+	info := &ForEachLoopInfo{
+		Name:     GetExecutableName(exec),
+		RefId:    getRefId(exec),
+		Settings: make(map[string]string),
+	}
+
+	if enum := exec.ForEachEnumerator; enum != nil {
+		info.CreationName = derefString(enum.CreationNameAttr)
+		if info.CreationName == "" {
+			info.CreationName = getPropertyValue(enum.Property, "CreationName")
+		}
+		lower := strings.ToLower(info.CreationName)
+		for _, t := range forEachEnumeratorTypes {
+			if strings.Contains(lower, t.fragment) {
+				info.EnumeratorType = t.enumeratorType
+				break
+			}
+		}
+		if data := enum.ObjectData; data != nil {
+			addForEachEnumeratorSettings(info, data)
+		}
+	}
+
+	for _, mapping := range append(append([]*schema.ForEachVariableMappingType{}, exec.ForEachVariableMapping...), exec.ForEachVariableMappings...) {
+		m := ForEachVariableMapping{Variable: derefString(mapping.VariableNameAttr)}
+		if mapping.ValueIndexAttr != nil {
+			m.Index = *mapping.ValueIndexAttr
+		} else {
+			m.Index, _ = strconv.Atoi(getPropertyValue(mapping.Property, "ValueIndex"))
+		}
+		if m.Variable == "" {
+			m.Variable = getPropertyValue(mapping.Property, "VariableName")
+		}
+		info.Mappings = append(info.Mappings, m)
+	}
+	return info
+}
+
+// addForEachEnumeratorSettings copies the enumerator configuration into
+// info.Settings and infers the enumerator type from it when the creation name
+// is not recognised
+func addForEachEnumeratorSettings(info *ForEachLoopInfo, data *schema.ForEachEnumeratorObjectDataType) {
+	inferred := ""
+	switch {
+	case data.ForEachFileEnumeratorProperties != nil:
+		inferred = "File"
+		for _, prop := range data.ForEachFileEnumeratorProperties.FEFEProperty {
+			if prop.FolderAttr != nil {
+				info.Settings["Folder"] = *prop.FolderAttr
+			}
+			if prop.FileSpecAttr != nil {
+				info.Settings["FileSpec"] = *prop.FileSpecAttr
+			}
+			if prop.FileNameRetrievalTypeAttr != nil {
+				info.Settings["FileNameRetrievalType"] = strconv.Itoa(*prop.FileNameRetrievalTypeAttr)
+			}
+			if prop.RecurseAttr != nil {
+				info.Settings["Recurse"] = strconv.Itoa(*prop.RecurseAttr)
+			}
+		}
+	case data.FEEADO != nil:
+		inferred = "ADO"
+		info.Settings["EnumType"] = data.FEEADO.EnumTypeAttr
+		info.Settings["VarName"] = data.FEEADO.VarNameAttr
+	case data.FEESchemaRowset != nil:
+		inferred = "ADO.NET Schema Rowset"
+		info.Settings["Connection"] = data.FEESchemaRowset.ConnectionAttr
+		info.Settings["Schema"] = data.FEESchemaRowset.SchemaAttr
+	case data.FEEFVE != nil:
+		inferred = "Variable"
+		info.Settings["VariableName"] = data.FEEFVE.VariableNameAttr
+	case data.FEENODELIST != nil:
+		inferred = "NodeList"
+		info.Settings["EnumerationType"] = data.FEENODELIST.EnumerationTypeAttr
+		info.Settings["SourceType"] = data.FEENODELIST.SourceTypeAttr
+		info.Settings["SourceDocument"] = data.FEENODELIST.SourceDocumentAttr
+		info.Settings["OuterXPathString"] = data.FEENODELIST.OuterXPathStringAttr
+	case data.FEESMO != nil:
+		inferred = "SMO"
+		info.Settings["EnumURN"] = data.FEESMO.EnumURNAttr
+	case data.FEIEItems != nil:
+		inferred = "Item"
+	}
+	if info.EnumeratorType == "" {
+		info.EnumeratorType = inferred
+	}
+}
+
+// ForLoopInfo describes a For Loop container and the expressions that drive
+// its iteration
+type ForLoopInfo struct {
+	Name             string
+	RefId            string
+	InitExpression   string // e.g. "@Counter = 0"
+	EvalExpression   string // e.g. "@Counter < 10"
+	AssignExpression string // e.g. "@Counter = @Counter + 1"
+	Executable       *schema.AnyNonPackageExecutableType
+}
+
+// GetForLoops returns every For Loop container in the package, including
+// loops nested in other containers, in document order. The expressions are
+// read from the SSIS 2012+ attributes or the older properties.
+func (p *Package) GetForLoops() []*ForLoopInfo {
+	var loops []*ForLoopInfo
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		if !strings.EqualFold(exec.ExecutableTypeAttr, "STOCK:FORLOOP") {
+			return
+		}
+		loops = append(loops, &ForLoopInfo{
+			Name:             GetExecutableName(exec),
+			RefId:            getRefId(exec),
+			InitExpression:   attrOrProperty(exec.InitExpressionAttr, exec.Property, "InitExpression"),
+			EvalExpression:   attrOrProperty(exec.EvalExpressionAttr, exec.Property, "EvalExpression"),
+			AssignExpression: attrOrProperty(exec.AssignExpressionAttr, exec.Property, "AssignExpression"),
+			Executable:       exec,
+		})
+	})
+	return loops
+}
+
+// attrOrProperty returns the attribute value when it is set, otherwise the
+// value of the named property
+func attrOrProperty(attr *string, props []*schema.Property, name string) string {
+	if attr != nil {
+		return *attr
+	}
+	return getPropertyValue(props, name)
+}
+
+// LogProviderInfo summarizes a package log provider
+type LogProviderInfo struct {
+	Name         string
+	DTSID        string
+	Type         string // e.g. "SQL Server", "Text file", "Windows Event Log"
+	CreationName string
+	ConfigString string // connection manager (or event log source) the provider writes to
+	Description  string
+	Provider     *schema.LogProviderType
+}
+
+// logProviderTypes maps creation name fragments to log provider types.
+// Profiler is listed before SQL Server because its name contains both.
+var logProviderTypes = []struct {
+	fragment     string
+	providerType string
+}{
+	{"sqlprofiler", "SQL Server Profiler"},
+	{"sqlserver", "SQL Server"},
+	{"textfile", "Text file"},
+	{"xmlfile", "XML file"},
+	{"eventlog", "Windows Event Log"},
+}
+
+// GetLogProviders returns the log providers configured on the package, in
+// document order. Attributes written by SSIS 2012+ take precedence over the
+// equivalent properties of older formats.
+func (p *Package) GetLogProviders() []*LogProviderInfo {
+	var providers []*LogProviderInfo
+	if p == nil || p.ExecutableTypePackage == nil {
+		return providers
+	}
+	for _, lp := range append(append([]*schema.LogProviderType{}, p.LogProvider...), p.LogProviders...) {
+		providers = append(providers, newLogProviderInfo(lp))
+	}
+	return providers
+}
+
+// newLogProviderInfo summarizes lp and infers its type from the creation name
+func newLogProviderInfo(lp *schema.LogProviderType) *LogProviderInfo {
+	attrOrProperty := func(attr *string, name string) string {
+		if attr != nil {
+			return *attr
+		}
+		return getPropertyValue(lp.Property, name)
+	}
+	info := &LogProviderInfo{
+		Name:         attrOrProperty(lp.ObjectNameAttr, "ObjectName"),
+		DTSID:        attrOrProperty(lp.DTSIDAttr, "DTSID"),
+		CreationName: attrOrProperty(lp.CreationNameAttr, "CreationName"),
+		ConfigString: attrOrProperty(lp.ConfigStringAttr, "ConfigString"),
+		Description:  attrOrProperty(lp.DescriptionAttr, "Description"),
+		Provider:     lp,
+	}
+	lower := strings.ToLower(info.CreationName)
+	for _, t := range logProviderTypes {
+		if strings.Contains(lower, t.fragment) {
+			info.Type = t.providerType
+			break
+		}
+	}
+	if info.Type == "" {
+		info.Type = info.CreationName
+	}
+	return info
+}
+
+// ConfigurationEntry is a single property set by a configuration
+type ConfigurationEntry struct {
+	Path      string // e.g. \Package.Variables[User::Color].Properties[Value]
+	Value     string
+	ValueType string
+}
+
+// ResolvedConfiguration describes where a configuration reads from and the
+// property values it sets
+type ResolvedConfiguration struct {
+	Name    string
+	Type    string // ConfigFile, EnvVariable, RegEntry, ParentVariable, SqlServer, or an indirect (I-prefixed) variant
+	Source  string // file path, environment variable, registry key, parent variable or SQL table
+	Entries []ConfigurationEntry
+}
+
+// configurationTypeNames maps DTSConfigurationType codes to their names
+var configurationTypeNames = map[int]string{
+	1:  "ConfigFile",
+	2:  "EnvVariable",
+	3:  "RegEntry",
+	4:  "ParentVariable",
+	5:  "IConfigFile",
+	7:  "SqlServer",
+	8:  "IRegEntry",
+	9:  "IParentVariable",
+	10: "ISqlServer",
+}
+
+// ResolveConfiguration returns the source, property paths and values of a
+// configuration. XML configuration files are read from disk, with indirect
+// configurations resolving the file path from the named environment variable.
+// Environment variable configurations read the current environment. SQL Server,
+// registry and parent variable values are only known at run time, so only the
+// source and any target path are reported. On error the partially resolved
+// configuration (name, type and source) is still returned.
+func ResolveConfiguration(cfg *ConfigurationType) (*ResolvedConfiguration, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("configuration is nil")
+	}
+
+	resolved := &ResolvedConfiguration{
+		Name:   derefString(cfg.ObjectNameAttr),
+		Source: derefString(cfg.ConfigurationStringAttr),
+	}
+	typeCode := 0
+	if cfg.ConfigurationTypeAttr != nil {
+		typeCode = *cfg.ConfigurationTypeAttr
+	}
+	if name, ok := configurationTypeNames[typeCode]; ok {
+		resolved.Type = name
+	} else {
+		resolved.Type = fmt.Sprintf("Unknown(%d)", typeCode)
+	}
+	target := derefString(cfg.ConfigurationVariableAttr)
+
+	switch resolved.Type {
+	case "ConfigFile", "IConfigFile":
+		path := resolved.Source
+		if resolved.Type == "IConfigFile" {
+			path = os.Getenv(resolved.Source)
+			if path == "" {
+				return resolved, fmt.Errorf("environment variable %s for configuration %s is not set", resolved.Source, resolved.Name)
+			}
+			resolved.Source = path
+		}
+		entries, err := readConfigurationFile(path)
+		if err != nil {
+			return resolved, err
+		}
+		resolved.Entries = entries
+	case "EnvVariable":
+		resolved.Entries = []ConfigurationEntry{{Path: target, Value: os.Getenv(resolved.Source)}}
+	default:
+		if target != "" {
+			resolved.Entries = []ConfigurationEntry{{Path: target}}
+		}
+	}
+	return resolved, nil
+}
+
+// readConfigurationFile reads the entries of a .dtsConfig XML file
+func readConfigurationFile(path string) ([]ConfigurationEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	var doc struct {
+		Configuration []struct {
+			Path            string `xml:"Path,attr"`
+			ValueType       string `xml:"ValueType,attr"`
+			ConfiguredValue string `xml:"ConfiguredValue"`
+		} `xml:"Configuration"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse configuration file %s: %w", path, err)
+	}
+	entries := make([]ConfigurationEntry, 0, len(doc.Configuration))
+	for _, c := range doc.Configuration {
+		entries = append(entries, ConfigurationEntry{Path: c.Path, Value: c.ConfiguredValue, ValueType: c.ValueType})
+	}
+	return entries, nil
+}
+
+// propertyTarget is the object a DTSX property path such as
+// \Package.Variables[User::X].Value refers to, and the property named on it
+type propertyTarget struct {
+	variable   *schema.VariableType
+	connection *schema.ConnectionManagerType
+	object     interface{} // package, executable, variable or connection manager
+	property   string
+}
+
+// ResolvePropertyPath returns the current value of the property a DTSX
+// property path refers to, using the syntax of configurations and dtexec /Set:
+//
+//	\Package.Variables[User::X].Value
+//	\Package.Connections[Warehouse].ConnectionString
+//	\Package\Load Customers.Properties[Disable]
+//
+// A container path (\Package\Container\Task) selects an executable by name;
+// Variables[...] and Connections[...] select a variable or connection manager.
+// Properties may be written as Name or Properties[Name]. Variable values are
+// returned typed as in expression evaluation (int64, float64, bool or string);
+// all other properties are returned as strings.
+func (p *Package) ResolvePropertyPath(path string) (interface{}, error) {
+	target, err := p.resolvePropertyPath(path)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case target.variable != nil && target.property == "Value":
+		return typedVariableValue(target.variable), nil
+	case target.connection != nil && target.property == "ConnectionString":
+		return pathConnectionString(target.connection), nil
+	}
+	value, ok := pathProperty(target.object, target.property)
+	if !ok {
+		return nil, fmt.Errorf("property %s not found for path %s", target.property, path)
+	}
+	return value, nil
+}
+
+// SetPropertyByPath sets the property a DTSX property path refers to, using
+// the same syntax as ResolvePropertyPath, e.g.
+// \Package.Variables[User::X].Value or
+// \Package.Connections[Warehouse].ConnectionString. The variable, connection
+// manager or executable must exist. Properties missing from the object are
+// added as DTS:Property elements.
+func (p *Package) SetPropertyByPath(path, value string) error {
+	target, err := p.resolvePropertyPath(path)
+	if err != nil {
+		return err
+	}
+	switch {
+	case target.variable != nil && target.property == "Value":
+		if target.variable.VariableValue == nil {
+			target.variable.VariableValue = &schema.VariableValue{}
+		}
+		target.variable.VariableValue.Value = value
+		return nil
+	case target.connection != nil && target.property == "ConnectionString":
+		cm := target.connection
+		if GetConnectionString(cm) == "" && cm.ObjectData != nil && cm.ObjectData.ConnectionManager != nil {
+			cm.ObjectData.ConnectionManager.ConnectionStringAttr = &value
+			return nil
+		}
+	}
+	if err := setPathProperty(target.object, target.property, value); err != nil {
+		return fmt.Errorf("cannot set %s: %w", path, err)
+	}
+	return nil
+}
+
+// setPathProperty sets a property of a package object, preferring an
+// existing DTS:Property element over an unset attribute of the same name
+func setPathProperty(object interface{}, name, value string) error {
+	v := reflect.ValueOf(object).Elem()
+	props := pathPropertyElements(v)
+	for _, prop := range props {
+		if prop.NameAttr != nil && *prop.NameAttr == name {
+			if prop.PropertyElementBaseType == nil {
+				prop.PropertyElementBaseType = &schema.PropertyElementBaseType{}
+			}
+			if prop.PropertyElementBaseType.AnySimpleType == nil {
+				prop.PropertyElementBaseType.AnySimpleType = &schema.AnySimpleType{}
+			}
+			prop.PropertyElementBaseType.AnySimpleType.Value = value
+			return nil
+		}
+	}
+
+	if field, ok := v.Type().FieldByName(name + "Attr"); ok {
+		if fv, err := v.FieldByIndexErr(field.Index); err == nil {
+			return setPathAttribute(fv, value)
+		}
+	}
+
+	field, ok := v.Type().FieldByName("Property")
+	if !ok {
+		return fmt.Errorf("property %s not found", name)
+	}
+	fv, err := v.FieldByIndexErr(field.Index)
+	if err != nil {
+		return fmt.Errorf("property %s not found", name)
+	}
+	fv.Set(reflect.ValueOf(append(props, &schema.Property{
+		NameAttr: stringPtr(name),
+		PropertyElementBaseType: &schema.PropertyElementBaseType{
+			AnySimpleType: &schema.AnySimpleType{Value: value},
+		},
+	})))
+	return nil
+}
+
+// setPathAttribute parses value into a string, int or bool attribute field,
+// allocating it when the field is a nil pointer
+func setPathAttribute(field reflect.Value, value string) error {
+	t := field.Type()
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	parsed := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		parsed.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("value %q is not an integer", value)
+		}
+		parsed.SetInt(int64(n))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("value %q is not a boolean", value)
+		}
+		parsed.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported attribute type %s", field.Type())
+	}
+
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(t)
+		ptr.Elem().Set(parsed)
+		field.Set(ptr)
+	} else {
+		field.Set(parsed)
+	}
+	return nil
+}
+
+// resolvePropertyPath locates the object and property a path refers to
+func (p *Package) resolvePropertyPath(path string) (*propertyTarget, error) {
+	if p == nil || p.ExecutableTypePackage == nil {
+		return nil, fmt.Errorf("package is nil")
+	}
+	rest, ok := strings.CutPrefix(path, `\Package`)
+	if !ok {
+		return nil, fmt.Errorf("property path %s must start with \\Package", path)
+	}
+
+	// Container path: \Package\Sequence\Task
+	var host interface{} = p
+	variables := []*schema.VariableType(nil)
+	if p.Variables != nil {
+		variables = p.Variables.Variable
+	}
+	execs := p.Executable
+	for strings.HasPrefix(rest, `\`) {
+		end := strings.IndexAny(rest[1:], `\.`)
+		if end < 0 {
+			end = len(rest) - 1
+		}
+		name := rest[1 : end+1]
+		rest = rest[end+1:]
+
+		var found *schema.AnyNonPackageExecutableType
+		for _, exec := range execs {
+			if GetExecutableName(exec) == name {
+				found = exec
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("executable %s not found for path %s", name, path)
+		}
+		host, variables, execs = found, found.Variable, childExecutables(found)
+	}
+
+	accessors, err := splitPropertyPath(rest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid property path %s: %w", path, err)
+	}
+	target := &propertyTarget{object: host}
+	name, key := accessors[0].name, accessors[0].key
+	switch {
+	case name == "Variables" && key != "":
+		for _, v := range variables {
+			if GetVariableName(v) == key || (!strings.Contains(key, "::") && derefString(v.ObjectNameAttr) == key) {
+				target.variable = v
+				break
+			}
+		}
+		if target.variable == nil {
+			return nil, fmt.Errorf("variable %s not found for path %s", key, path)
+		}
+		target.object = target.variable
+		accessors = accessors[1:]
+	case name == "Connections" && key != "":
+		if host != p {
+			return nil, fmt.Errorf("connections are only defined on the package, path %s", path)
+		}
+		if p.ConnectionManagers != nil {
+			for _, cm := range p.ConnectionManagers.ConnectionManager {
+				if GetConnectionName(cm) == key {
+					target.connection = cm
+					break
+				}
+			}
+		}
+		if target.connection == nil {
+			return nil, fmt.Errorf("connection manager %s not found for path %s", key, path)
+		}
+		target.object = target.connection
+		accessors = accessors[1:]
+	}
+
+	if len(accessors) != 1 {
+		return nil, fmt.Errorf("invalid property path %s: expected a single property after the object", path)
+	}
+	switch {
+	case accessors[0].name == "Properties" && accessors[0].key != "":
+		target.property = accessors[0].key
+	case accessors[0].key == "":
+		target.property = accessors[0].name
+	default:
+		return nil, fmt.Errorf("invalid property path %s: unexpected %s[%s]", path, accessors[0].name, accessors[0].key)
+	}
+	return target, nil
+}
+
+// propertyPathAccessor is one dot-separated part of a property path, such as
+// Variables[User::X] (name Variables, key User::X) or Value
+type propertyPathAccessor struct {
+	name, key string
+}
+
+// splitPropertyPath splits the part of a property path after the container
+// path, e.g. ".Variables[User::X].Value", into accessors. Dots inside brackets
+// are part of the key.
+func splitPropertyPath(rest string) ([]propertyPathAccessor, error) {
+	if !strings.HasPrefix(rest, ".") {
+		return nil, fmt.Errorf("expected '.' after the container path")
+	}
+	var accessors []propertyPathAccessor
+	for len(rest) > 0 {
+		rest = rest[1:] // the leading '.'
+		var acc propertyPathAccessor
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		acc.name = rest[:end]
+		rest = rest[end:]
+		if strings.HasPrefix(rest, "[") {
+			closing := strings.Index(rest, "]")
+			if closing < 0 {
+				return nil, fmt.Errorf("unterminated '[' after %s", acc.name)
+			}
+			acc.key = rest[1:closing]
+			rest = rest[closing+1:]
+		}
+		if acc.name == "" {
+			return nil, fmt.Errorf("empty name")
+		}
+		if rest != "" && !strings.HasPrefix(rest, ".") {
+			return nil, fmt.Errorf("unexpected %q after %s", rest, acc.name)
+		}
+		accessors = append(accessors, acc)
+	}
+	return accessors, nil
+}
+
+// pathProperty reads a property of a package object: the DTS attribute of
+// that name in the SSIS 2012+ form, or the DTS:Property element of the older
+// form
+func pathProperty(object interface{}, name string) (string, bool) {
+	v := reflect.ValueOf(object)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return "", false
+	}
+	v = v.Elem()
+	if field, ok := v.Type().FieldByName(name + "Attr"); ok {
+		if fv, err := v.FieldByIndexErr(field.Index); err == nil {
+			if fv.Kind() != reflect.Ptr {
+				return fmt.Sprint(fv.Interface()), true
+			}
+			if !fv.IsNil() {
+				return fmt.Sprint(fv.Elem().Interface()), true
+			}
+		}
+	}
+	for _, prop := range pathPropertyElements(v) {
+		if prop.NameAttr != nil && *prop.NameAttr == name {
+			if prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+				return prop.PropertyElementBaseType.AnySimpleType.Value, true
+			}
+			return "", true
+		}
+	}
+	return "", false
+}
+
+// pathPropertyElements returns the DTS:Property elements of a schema struct
+func pathPropertyElements(v reflect.Value) []*schema.Property {
+	field, ok := v.Type().FieldByName("Property")
+	if !ok {
+		return nil
+	}
+	fv, err := v.FieldByIndexErr(field.Index)
+	if err != nil {
+		return nil
+	}
+	props, _ := fv.Interface().([]*schema.Property)
+	return props
+}
+
+// pathConnectionString returns the connection string of a connection manager
+// from its ConnectionString property or, in the SSIS 2012+ form, from its
+// object data
+func pathConnectionString(cm *schema.ConnectionManagerType) string {
+	if s := GetConnectionString(cm); s != "" {
+		return s
+	}
+	if cm.ObjectData != nil && cm.ObjectData.ConnectionManager != nil {
+		return derefString(cm.ObjectData.ConnectionManager.ConnectionStringAttr)
+	}
+	return ""
 }
 
-// QueryExecutables finds executables matching a filter function
+// QueryExecutables finds executables matching a filter function, including
+// executables nested in containers
 func (p *Package) QueryExecutables(filter func(*schema.AnyNonPackageExecutableType) bool) []*schema.AnyNonPackageExecutableType {
 	var results []*schema.AnyNonPackageExecutableType
-	if p == nil || p.Executable == nil {
-		return results
-	}
-	for _, exec := range p.Executable {
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
 		if filter(exec) {
 			results = append(results, exec)
 		}
-	}
+	})
 	return results
 }
 
+// WalkExecutables calls fn for every executable in the package's control
+// flow, depth first in document order, descending into Sequence, For Loop and
+// For Each Loop containers. parentRefId is the refId of the enclosing
+// container, or the package refId for top-level executables. Tasks inside
+// event handlers are not visited.
+func (p *Package) WalkExecutables(fn func(exec *schema.AnyNonPackageExecutableType, parentRefId string)) {
+	if p == nil || p.ExecutableTypePackage == nil {
+		return
+	}
+	refId := "Package"
+	if p.RefIdAttr != nil {
+		refId = *p.RefIdAttr
+	}
+	walkExecutables(p.Executable, refId, fn)
+}
+
+// walkExecutables visits execs and their children for WalkExecutables
+func walkExecutables(execs []*schema.AnyNonPackageExecutableType, parentRefId string, fn func(*schema.AnyNonPackageExecutableType, string)) {
+	for _, exec := range execs {
+		fn(exec, parentRefId)
+		walkExecutables(childExecutables(exec), getRefId(exec), fn)
+	}
+}
+
+// childExecutables returns the executables directly inside a container, in
+// either the SSIS 2012+ DTS:Executables form or the older flat form
+func childExecutables(exec *schema.AnyNonPackageExecutableType) []*schema.AnyNonPackageExecutableType {
+	if len(exec.Executable) == 0 {
+		return exec.Executables
+	}
+	return append(append([]*schema.AnyNonPackageExecutableType{}, exec.Executable...), exec.Executables...)
+}
+
+// precedenceConstraints returns the legacy precedence constraints followed by
+// those inside the SSIS 2012+ PrecedenceConstraints wrapper
+func precedenceConstraints(legacy, wrapped []*schema.PrecedenceConstraintType) []*schema.PrecedenceConstraintType {
+	if len(legacy) == 0 {
+		return wrapped
+	}
+	return append(append([]*schema.PrecedenceConstraintType{}, legacy...), wrapped...)
+}
+
 // ExpressionInfo contains information about an expression found in the package
 type ExpressionInfo struct {
 	Expression string
@@ -961,6 +3374,17 @@ func (p *Package) GetExpressions() *QueryResult {
 			if exec.PropertyExpression != nil {
 				for _, expr := range exec.PropertyExpression {
 					if expr.AnySimpleType != nil && expr.AnySimpleType.Value != "" {
+						// Data flow component properties are set by expressions
+						// on the Data Flow task named [Component].[Property]
+						if component, property, ok := dataflowComponentProperty(exec, expr.NameAttr); ok {
+							expressions = append(expressions, &ExpressionInfo{
+								Expression: expr.AnySimpleType.Value,
+								Location:   "DataflowComponent",
+								Name:       property,
+								Context:    fmt.Sprintf("Executable[%d] (%s) Component %s", i, GetExecutableName(exec), component),
+							})
+							continue
+						}
 						context := fmt.Sprintf("Executable[%d]", i)
 						if exec.ExecutableTypeAttr != "" {
 							context = fmt.Sprintf("%s (%s)", context, exec.ExecutableTypeAttr)
@@ -976,19 +3400,25 @@ func (p *Package) GetExpressions() *QueryResult {
 			}
 
 			// Precedence constraints within executables
-			if exec.PrecedenceConstraint != nil {
-				for j, pc := range exec.PrecedenceConstraint {
-					if pc.PropertyExpression != nil {
-						for _, expr := range pc.PropertyExpression {
-							if expr.AnySimpleType != nil && expr.AnySimpleType.Value != "" {
-								context := fmt.Sprintf("Executable[%d] PrecedenceConstraint[%d]", i, j)
-								expressions = append(expressions, &ExpressionInfo{
-									Expression: expr.AnySimpleType.Value,
-									Location:   "PrecedenceConstraint",
-									Name:       expr.NameAttr,
-									Context:    context,
-								})
-							}
+			for j, pc := range precedenceConstraints(exec.PrecedenceConstraint, exec.PrecedenceConstraints) {
+				if pc.ExpressionAttr != nil && *pc.ExpressionAttr != "" {
+					expressions = append(expressions, &ExpressionInfo{
+						Expression: *pc.ExpressionAttr,
+						Location:   "PrecedenceConstraint",
+						Name:       "Expression",
+						Context:    fmt.Sprintf("Executable[%d] PrecedenceConstraint[%d]", i, j),
+					})
+				}
+				if pc.PropertyExpression != nil {
+					for _, expr := range pc.PropertyExpression {
+						if expr.AnySimpleType != nil && expr.AnySimpleType.Value != "" {
+							context := fmt.Sprintf("Executable[%d] PrecedenceConstraint[%d]", i, j)
+							expressions = append(expressions, &ExpressionInfo{
+								Expression: expr.AnySimpleType.Value,
+								Location:   "PrecedenceConstraint",
+								Name:       expr.NameAttr,
+								Context:    context,
+							})
 						}
 					}
 				}
@@ -996,20 +3426,44 @@ func (p *Package) GetExpressions() *QueryResult {
 		}
 	}
 
+	// For Loop iteration expressions
+	for _, loop := range p.GetForLoops() {
+		for _, expr := range []struct{ name, value string }{
+			{"InitExpression", loop.InitExpression},
+			{"EvalExpression", loop.EvalExpression},
+			{"AssignExpression", loop.AssignExpression},
+		} {
+			if expr.value != "" {
+				expressions = append(expressions, &ExpressionInfo{
+					Expression: expr.value,
+					Location:   "ForLoop",
+					Name:       expr.name,
+					Context:    fmt.Sprintf("ForLoop (%s)", loop.Name),
+				})
+			}
+		}
+	}
+
 	// Package-level precedence constraints
-	if p.PrecedenceConstraint != nil {
-		for i, pc := range p.PrecedenceConstraint {
-			if pc.PropertyExpression != nil {
-				for _, expr := range pc.PropertyExpression {
-					if expr.AnySimpleType != nil && expr.AnySimpleType.Value != "" {
-						context := fmt.Sprintf("Package PrecedenceConstraint[%d]", i)
-						expressions = append(expressions, &ExpressionInfo{
-							Expression: expr.AnySimpleType.Value,
-							Location:   "PrecedenceConstraint",
-							Name:       expr.NameAttr,
-							Context:    context,
-						})
-					}
+	for i, pc := range precedenceConstraints(p.PrecedenceConstraint, p.PrecedenceConstraints) {
+		if pc.ExpressionAttr != nil && *pc.ExpressionAttr != "" {
+			expressions = append(expressions, &ExpressionInfo{
+				Expression: *pc.ExpressionAttr,
+				Location:   "PrecedenceConstraint",
+				Name:       "Expression",
+				Context:    fmt.Sprintf("Package PrecedenceConstraint[%d]", i),
+			})
+		}
+		if pc.PropertyExpression != nil {
+			for _, expr := range pc.PropertyExpression {
+				if expr.AnySimpleType != nil && expr.AnySimpleType.Value != "" {
+					context := fmt.Sprintf("Package PrecedenceConstraint[%d]", i)
+					expressions = append(expressions, &ExpressionInfo{
+						Expression: expr.AnySimpleType.Value,
+						Location:   "PrecedenceConstraint",
+						Name:       expr.NameAttr,
+						Context:    context,
+					})
 				}
 			}
 		}
@@ -1018,25 +3472,27 @@ func (p *Package) GetExpressions() *QueryResult {
 	// Variable expressions
 	if p.Variables != nil && p.Variables.Variable != nil {
 		for i, v := range p.Variables.Variable {
-			if v.PropertyExpression != nil {
-				for _, expr := range v.PropertyExpression {
-					if expr.AnySimpleType != nil && expr.AnySimpleType.Value != "" {
-						context := fmt.Sprintf("Variable[%d]", i)
-						// Try to get variable name from attributes
-						var varName string
-						if v.ObjectNameAttr != nil {
-							varName = *v.ObjectNameAttr
-						}
-						if varName != "" {
-							context = fmt.Sprintf("Variable[%d] (%s)", i, varName)
-						}
-						expressions = append(expressions, &ExpressionInfo{
-							Expression: expr.AnySimpleType.Value,
-							Location:   "Variable",
-							Name:       expr.NameAttr,
-							Context:    context,
-						})
-					}
+			context := fmt.Sprintf("Variable[%d]", i)
+			if v.ObjectNameAttr != nil && *v.ObjectNameAttr != "" {
+				context = fmt.Sprintf("Variable[%d] (%s)", i, *v.ObjectNameAttr)
+			}
+			// The expression a variable evaluates to its value
+			if expr := variableExpression(v); expr != "" {
+				expressions = append(expressions, &ExpressionInfo{
+					Expression: expr,
+					Location:   "Variable",
+					Name:       "Expression",
+					Context:    context,
+				})
+			}
+			for _, expr := range v.PropertyExpression {
+				if expr.AnySimpleType != nil && expr.AnySimpleType.Value != "" {
+					expressions = append(expressions, &ExpressionInfo{
+						Expression: expr.AnySimpleType.Value,
+						Location:   "Variable",
+						Name:       expr.NameAttr,
+						Context:    context,
+					})
 				}
 			}
 		}
@@ -1067,25 +3523,44 @@ func (p *Package) GetExpressions() *QueryResult {
 	}
 }
 
-// Unmarshal parses DTSX XML data and returns a Package
-func Unmarshal(data []byte) (*Package, error) {
-	// Preprocess XML to ensure DTS namespace compatibility
-	xmlStr := string(data)
-
-	// Remove DTS prefixes to match the schema structs
-	xmlStr = strings.ReplaceAll(xmlStr, `<DTS:`, `<`)
-	xmlStr = strings.ReplaceAll(xmlStr, `</DTS:`, `</`)
-	xmlStr = strings.ReplaceAll(xmlStr, ` DTS:`, ` `)
-	xmlStr = strings.ReplaceAll(xmlStr, `xmlns:DTS="www.microsoft.com/SqlServer/Dts"`, ``)
-
-	data = []byte(xmlStr)
+// variableExpression returns the expression a variable is evaluated from:
+// the DTS:Expression attribute in SSIS 2012+ packages, or the Expression
+// property in older ones
+func variableExpression(v *schema.VariableType) string {
+	if v.ExpressionAttr != nil {
+		return *v.ExpressionAttr
+	}
+	return getPropertyValue(v.Property, "Expression")
+}
 
-	var pkg Package
-	err := xml.Unmarshal(data, &pkg)
-	if err != nil {
-		return nil, err
+// dataflowComponentProperty splits a Data Flow task property expression name
+// of the form [Component].[Property] when the component is in the task's
+// pipeline
+func dataflowComponentProperty(exec *schema.AnyNonPackageExecutableType, name string) (component, property string, ok bool) {
+	if exec.ObjectData == nil || exec.ObjectData.Pipeline == nil || exec.ObjectData.Pipeline.Components == nil {
+		return "", "", false
 	}
-	return &pkg, nil
+	if !strings.HasPrefix(name, "[") || !strings.HasSuffix(name, "]") {
+		return "", "", false
+	}
+	component, property, ok = strings.Cut(name[1:len(name)-1], "].[")
+	if !ok {
+		return "", "", false
+	}
+	for _, comp := range exec.ObjectData.Pipeline.Components.Component {
+		if derefString(comp.NameAttr) == component {
+			return component, property, true
+		}
+	}
+	return "", "", false
+}
+
+// Unmarshal parses DTSX XML data and returns a Package.
+// The decoder resolves the DTS namespace itself: the schema tags carry only
+// local names, which match DTS:-prefixed elements and attributes, so values
+// are decoded verbatim with no textual prefix stripping.
+func Unmarshal(data []byte) (*Package, error) {
+	return UnmarshalStream(bytes.NewReader(data))
 }
 
 // UnmarshalFromReader parses DTSX XML from an io.Reader and returns a Package
@@ -1115,82 +3590,66 @@ func UnmarshalFromFile(filename string) (*Package, error) {
 	return UnmarshalFromReader(file)
 }
 
-// Marshal converts a Package to DTSX XML format
-func Marshal(pkg *Package) ([]byte, error) {
-	data, err := xml.MarshalIndent(pkg, "", "  ")
-	if err != nil {
-		return nil, err
+// UnmarshalStream parses DTSX XML from an io.Reader token by token, without
+// reading the whole document into memory first. Parse errors are prefixed with
+// the line and column in the source document where decoding stopped; the
+// original error is wrapped, so errors.As still finds an *xml.SyntaxError.
+func UnmarshalStream(r io.Reader) (*Package, error) {
+	dec := xml.NewDecoder(r)
+	var pkg Package
+	if err := dec.Decode(&pkg); err != nil {
+		return nil, decodeError(dec, err)
 	}
-	// Add XML declaration and fix namespace
-	xmlStr := string(data)
-	// Replace the root Executable element with DTS prefix
-	xmlStr = strings.Replace(xmlStr, `<Executable `, `<DTS:Executable `, 1)
+	return &pkg, nil
+}
 
-	// Add DTS prefix to all attributes except those in xmlns
-	xmlStr = regexp.MustCompile(`(\w+)="([^"]*)"`).ReplaceAllStringFunc(xmlStr, func(match string) string {
-		// Skip if this is part of xmlns declaration
-		if strings.Contains(match, `xmlns`) || strings.HasPrefix(match, `DTS:`) {
-			return match
-		}
-		parts := strings.SplitN(match, `="`, 2)
-		if len(parts) == 2 {
-			return `DTS:` + parts[0] + `="` + parts[1]
-		}
-		return match
-	})
+// decodeError adds the decoder's input position to a decoding error. The
+// document is decoded as read, so the position refers to the source text.
+func decodeError(dec *xml.Decoder, err error) error {
+	line, column := dec.InputPos()
+	var syntaxErr *xml.SyntaxError
+	if errors.As(err, &syntaxErr) && syntaxErr.Line != line {
+		// The decoder may have read past the line the error was found on
+		return fmt.Errorf("line %d: %w", syntaxErr.Line, err)
+	}
+	return fmt.Errorf("line %d, column %d: %w", line, column, err)
+}
 
-	// Add xmlns declaration to the root element
-	xmlStr = strings.Replace(xmlStr, `<DTS:Executable `, `<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" `, 1)
-
-	// Add DTS prefix to all inner elements
-	xmlStr = regexp.MustCompile(`<Property`).ReplaceAllString(xmlStr, `<DTS:Property`)
-	xmlStr = regexp.MustCompile(`</Property>`).ReplaceAllString(xmlStr, `</DTS:Property>`)
-	xmlStr = regexp.MustCompile(`<ConnectionManagers`).ReplaceAllString(xmlStr, `<DTS:ConnectionManagers`)
-	xmlStr = regexp.MustCompile(`</ConnectionManagers>`).ReplaceAllString(xmlStr, `</DTS:ConnectionManagers>`)
-	xmlStr = regexp.MustCompile(`<ConnectionManager`).ReplaceAllString(xmlStr, `<DTS:ConnectionManager`)
-	xmlStr = regexp.MustCompile(`</ConnectionManager>`).ReplaceAllString(xmlStr, `</DTS:ConnectionManager>`)
-	xmlStr = regexp.MustCompile(`<Variables`).ReplaceAllString(xmlStr, `<DTS:Variables`)
-	xmlStr = regexp.MustCompile(`</Variables>`).ReplaceAllString(xmlStr, `</DTS:Variables>`)
-	xmlStr = regexp.MustCompile(`<Variable`).ReplaceAllString(xmlStr, `<DTS:Variable`)
-	xmlStr = regexp.MustCompile(`</Variable>`).ReplaceAllString(xmlStr, `</DTS:Variable>`)
-	xmlStr = regexp.MustCompile(`<VariableValue`).ReplaceAllString(xmlStr, `<DTS:VariableValue`)
-	xmlStr = regexp.MustCompile(`</VariableValue>`).ReplaceAllString(xmlStr, `</DTS:VariableValue>`)
-	xmlStr = regexp.MustCompile(`<Executables`).ReplaceAllString(xmlStr, `<DTS:Executables`)
-	xmlStr = regexp.MustCompile(`</Executables>`).ReplaceAllString(xmlStr, `</DTS:Executables>`)
-	xmlStr = regexp.MustCompile(`<Executable`).ReplaceAllString(xmlStr, `<DTS:Executable`)
-	xmlStr = regexp.MustCompile(`</Executable>`).ReplaceAllString(xmlStr, `</DTS:Executable>`)
-	xmlStr = regexp.MustCompile(`<ObjectData`).ReplaceAllString(xmlStr, `<DTS:ObjectData`)
-	xmlStr = regexp.MustCompile(`</ObjectData>`).ReplaceAllString(xmlStr, `</DTS:ObjectData>`)
-
-	// Pipeline component properties are represented as lowercase <property> elements
-	// and in the original DTSX they use unprefixed attributes. After the generic
-	// attribute prefixing above, these end up with `DTS:` prefixes while the
-	// element remains lowercase. This mismatch can cause SSIS validation errors.
-	// Remove `DTS:` prefixes from attributes specifically within lowercase
-	// `<property ...>` opening tags so they match the original DTSX structure.
-	// Use DOTALL to capture attributes across newlines for multiline formatting
-	propRe := regexp.MustCompile(`(?s)<property\s+([^>]*?)>`) // matches only lowercase `property` and attributes across lines
-	xmlStr = propRe.ReplaceAllStringFunc(xmlStr, func(match string) string {
-		// Extract attributes part and remove any `DTS:` prefixes from attr names
-		m := propRe.FindStringSubmatch(match)
-		if len(m) < 2 {
-			return match
-		}
-		attrs := m[1]
-		attrs = strings.ReplaceAll(attrs, "DTS:", "")
-		return "<property " + attrs + ">"
-	})
+// Marshal converts a Package to DTSX XML format. Elements and attributes are
+// written with their DTS (or task) namespace prefixes directly, so values
+// containing quotes, ampersands or markup-like text round-trip unchanged.
+// Executable ObjectData read by Unmarshal is written back from its raw XML
+// (ExecutableObjectDataType.InnerXML), not from the typed task structs; the
+// package's own mutators keep both in step, but code editing the typed
+// ObjectData directly must update InnerXML as well or set it to "".
+func Marshal(pkg *Package) ([]byte, error) {
+	return MarshalWithOptions(pkg, MarshalOptions{})
+}
 
-	return []byte(xml.Header + xmlStr), nil
+// MarshalWithOptions converts a Package to DTSX XML like Marshal, with the
+// indentation chosen by opts: a custom indent string such as a tab, or
+// compact output with no line breaks between elements.
+func MarshalWithOptions(pkg *Package, opts MarshalOptions) ([]byte, error) {
+	if pkg == nil {
+		return nil, fmt.Errorf("package is nil")
+	}
+	return encodePackage(pkg, opts)
 }
 
-// marshalToWriter writes a Package as DTSX XML to an io.Writer (unexported)
-func marshalToWriter(w io.Writer, pkg *Package) error {
-	data, err := Marshal(pkg)
+// WriteTo writes the package as DTSX XML, formatted as by Marshal, and
+// implements io.WriterTo
+func (p *Package) WriteTo(w io.Writer) (int64, error) {
+	data, err := Marshal(p)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	_, err = w.Write(data)
+	n, err := w.Write(data)
+	return int64(n), err
+}
+
+// marshalToWriter writes a Package as DTSX XML to an io.Writer (unexported)
+func marshalToWriter(w io.Writer, pkg *Package) error {
+	_, err := pkg.WriteTo(w)
 	return err
 }
 
@@ -1219,6 +3678,176 @@ func IsDTSXPackage(filename string) (*Package, bool) {
 	return pkg, true
 }
 
+// Clone returns a deep copy of the package. Variables, connections,
+// executables, properties, expressions and every other element are copied, so
+// the clone can be modified without affecting p.
+func (p *Package) Clone() *Package {
+	if p == nil {
+		return nil
+	}
+	clone := reflect.New(reflect.TypeOf(*p))
+	deepCopyValue(clone.Elem(), reflect.ValueOf(p).Elem())
+	return clone.Interface().(*Package)
+}
+
+// MergeStrategy decides what Merge does when both packages define an element
+// with the same name
+type MergeStrategy int
+
+const (
+	// MergeSkip keeps the receiver's element and ignores the other one
+	MergeSkip MergeStrategy = iota
+	// MergeOverwrite replaces the receiver's element, keeping its position
+	MergeOverwrite
+	// MergeError leaves the receiver's element in place and reports the collision
+	MergeError
+)
+
+// Merge copies the variables, connection managers and top-level executables
+// of other into p. Variables are matched by Namespace::Name, connection
+// managers by name and executables by name, the same keys Validate uses to
+// detect duplicates; onConflict decides what happens on a match. Elements
+// without a name never collide and are always added. other is not modified:
+// merged elements are deep copies. With MergeError every collision is
+// returned and the remaining elements are still merged.
+func (p *Package) Merge(other *Package, onConflict MergeStrategy) []error {
+	if p == nil {
+		return []error{fmt.Errorf("package is nil")}
+	}
+	if other == nil || other.ExecutableTypePackage == nil {
+		return nil
+	}
+	if p.ExecutableTypePackage == nil {
+		p.ExecutableTypePackage = &schema.ExecutableTypePackage{}
+	}
+	src := other.Clone()
+	var errs []error
+
+	if src.Variables != nil {
+		if p.Variables == nil {
+			p.Variables = &schema.VariablesType{}
+		}
+		for _, v := range src.Variables.Variable {
+			key, ok := variableKey(v)
+			index := -1
+			if ok {
+				for i, existing := range p.Variables.Variable {
+					if k, _ := variableKey(existing); k == key {
+						index = i
+						break
+					}
+				}
+			}
+			switch {
+			case index < 0:
+				p.Variables.Variable = append(p.Variables.Variable, v)
+			case onConflict == MergeOverwrite:
+				p.Variables.Variable[index] = v
+			case onConflict == MergeError:
+				errs = append(errs, fmt.Errorf("variable %s already exists", key))
+			}
+		}
+	}
+
+	if src.ConnectionManagers != nil {
+		if p.ConnectionManagers == nil {
+			p.ConnectionManagers = &schema.ConnectionManagersType{}
+		}
+		for _, cm := range src.ConnectionManagers.ConnectionManager {
+			key, ok := connectionKey(cm)
+			index := -1
+			if ok {
+				for i, existing := range p.ConnectionManagers.ConnectionManager {
+					if k, _ := connectionKey(existing); k == key {
+						index = i
+						break
+					}
+				}
+			}
+			switch {
+			case index < 0:
+				p.ConnectionManagers.ConnectionManager = append(p.ConnectionManagers.ConnectionManager, cm)
+			case onConflict == MergeOverwrite:
+				p.ConnectionManagers.ConnectionManager[index] = cm
+			case onConflict == MergeError:
+				errs = append(errs, fmt.Errorf("connection manager %s already exists", key))
+			}
+		}
+	}
+
+	for _, exec := range src.Executable {
+		index := -1
+		if exec.ObjectNameAttr != nil {
+			for i, existing := range p.Executable {
+				if existing.ObjectNameAttr != nil && *existing.ObjectNameAttr == *exec.ObjectNameAttr {
+					index = i
+					break
+				}
+			}
+		}
+		switch {
+		case index < 0:
+			p.Executable = append(p.Executable, exec)
+		case onConflict == MergeOverwrite:
+			p.Executable[index] = exec
+		case onConflict == MergeError:
+			errs = append(errs, fmt.Errorf("executable %s already exists", *exec.ObjectNameAttr))
+		}
+	}
+
+	return errs
+}
+
+// deepCopyValue copies src into dst, allocating new pointers, slices and maps
+// so nothing is shared with src
+func deepCopyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.New(src.Type().Elem()))
+		deepCopyValue(dst.Elem(), src.Elem())
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				deepCopyValue(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			deepCopyValue(dst.Index(i), src.Index(i))
+		}
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			deepCopyValue(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		for _, key := range src.MapKeys() {
+			value := reflect.New(src.Type().Elem()).Elem()
+			deepCopyValue(value, src.MapIndex(key))
+			dst.SetMapIndex(key, value)
+		}
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		value := reflect.New(src.Elem().Type()).Elem()
+		deepCopyValue(value, src.Elem())
+		dst.Set(value)
+	default:
+		dst.Set(src)
+	}
+}
+
 // RunOptions contains options for executing a DTSX package with dtexec.exe
 type RunOptions struct {
 	// Package parameters (format: "[$Package::|$Project::|$ServerOption::]ParamName[(DataType)];Value")
@@ -1298,15 +3927,142 @@ type RunOptions struct {
 
 	// Run in 32-bit mode (x86)
 	X86 bool
+
+	// SSIS catalog path of the package to run instead of a file
+	// (format: "\SSISDB\folder\project\package.dtsx"). Catalog execution
+	// options are passed as parameters, e.g. "$ServerOption::SYNCHRONIZED(Boolean);True".
+	ISServerPath string
+
+	// SQL Server instance hosting the SSIS catalog; Server is used when empty
+	SQLServerInstance string
 }
 
 // RunPackage executes a DTSX package using dtexec.exe.
 // It takes the path to dtexec.exe, the path to the DTSX file, and optional RunOptions.
 // Returns the combined stdout/stderr output and any error that occurred.
 func RunPackage(dtexecPath, dtsxPath string, opts *RunOptions) (string, error) {
+	return RunPackageContext(context.Background(), dtexecPath, dtsxPath, opts)
+}
+
+// RunPackageContext is like RunPackage but kills dtexec.exe when ctx is done.
+// If ctx is cancelled or times out, the output so far is returned along with
+// ctx.Err().
+func RunPackageContext(ctx context.Context, dtexecPath, dtsxPath string, opts *RunOptions) (string, error) {
+	cmd := exec.CommandContext(ctx, dtexecPath, BuildDTExecArgs(dtsxPath, opts)...)
+	// Don't wait on output pipes held open by child processes once dtexec is killed
+	cmd.WaitDelay = time.Second
+	output, err := cmd.CombinedOutput()
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+
+	return strings.TrimSpace(string(output)), err
+}
+
+// DTExecResult is the outcome of a dtexec.exe run, classified by exit code
+type DTExecResult struct {
+	ExitCode int
+	Status   string // "Success", "Failure", "Cancelled", "NotFound", "LoadFailed", "CommandLineError" or "Unknown"
+	Output   string // Combined stdout/stderr, trimmed
+}
+
+// dtexecStatuses maps dtexec.exe's documented exit codes to a Status
+var dtexecStatuses = map[int]string{
+	0: "Success",          // The package executed successfully
+	1: "Failure",          // The package failed
+	3: "Cancelled",        // The package was cancelled by the user
+	4: "NotFound",         // The package could not be found
+	5: "LoadFailed",       // The package could not be loaded
+	6: "CommandLineError", // Internal syntactic or semantic errors in the command line
+}
+
+// ClassifyDTExecExitCode returns the Status for a dtexec.exe exit code, or
+// "Unknown" for codes dtexec does not document
+func ClassifyDTExecExitCode(code int) string {
+	if status, exists := dtexecStatuses[code]; exists {
+		return status
+	}
+	return "Unknown"
+}
+
+// Succeeded reports whether dtexec.exe exited with code 0
+func (r *DTExecResult) Succeeded() bool {
+	return r != nil && r.ExitCode == 0
+}
+
+// RunPackageResult executes a DTSX package like RunPackage and classifies
+// dtexec.exe's exit code. A non-zero exit code is reported in the result, not
+// as an error; the error is non-nil only if dtexec.exe could not be run.
+func RunPackageResult(dtexecPath, dtsxPath string, opts *RunOptions) (*DTExecResult, error) {
+	output, err := RunPackage(dtexecPath, dtsxPath, opts)
+	result := &DTExecResult{Output: output}
+	if err != nil {
+		exitErr, ok := err.(*exec.ExitError)
+		if !ok {
+			return nil, err
+		}
+		result.ExitCode = exitErr.ExitCode()
+	}
+	result.Status = ClassifyDTExecExitCode(result.ExitCode)
+	return result, nil
+}
+
+// RunPackageStreaming executes a DTSX package like RunPackage but, instead of
+// buffering output, calls onLine for each line of dtexec.exe's stdout and
+// stderr as it arrives, in the order written. Trailing carriage returns are
+// removed. It returns once the process has exited and all output has been
+// delivered.
+func RunPackageStreaming(dtexecPath, dtsxPath string, opts *RunOptions, onLine func(line string)) error {
+	pr, pw := io.Pipe()
+	cmd := exec.Command(dtexecPath, BuildDTExecArgs(dtsxPath, opts)...)
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		pw.Close()
+		done <- err
+	}()
+
+	scanner := bufio.NewScanner(pr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if onLine != nil {
+			onLine(strings.TrimRight(scanner.Text(), "\r"))
+		}
+	}
+	// Keep draining so dtexec never blocks on a full pipe
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		io.Copy(io.Discard, pr)
+	}
+
+	if err := <-done; err != nil {
+		return err
+	}
+	return scanErr
+}
+
+// BuildDTExecArgs returns the dtexec.exe arguments RunPackage uses for the
+// given package and options. The package is run from dtsxPath with /File,
+// or from the SSIS catalog with /ISServer when opts.ISServerPath is set.
+func BuildDTExecArgs(dtsxPath string, opts *RunOptions) []string {
 	args := []string{"/File", dtsxPath}
 
 	if opts != nil {
+		// Catalog packages are addressed by path on a server instead of a file
+		server := opts.Server
+		if opts.ISServerPath != "" {
+			args = []string{"/ISServer", opts.ISServerPath}
+			if opts.SQLServerInstance != "" {
+				server = opts.SQLServerInstance
+			}
+		}
+
 		// Add parameters
 		for _, param := range opts.Parameters {
 			args = append(args, "/Par", param)
@@ -1338,8 +4094,8 @@ func RunPackage(dtexecPath, dtsxPath string, opts *RunOptions) (string, error) {
 		}
 
 		// Add server
-		if opts.Server != "" {
-			args = append(args, "/Server", opts.Server)
+		if server != "" {
+			args = append(args, "/Server", server)
 		}
 
 		// Add SQL authentication
@@ -1434,10 +4190,7 @@ func RunPackage(dtexecPath, dtsxPath string, opts *RunOptions) (string, error) {
 		}
 	}
 
-	cmd := exec.Command(dtexecPath, args...)
-	output, err := cmd.CombinedOutput()
-
-	return strings.TrimSpace(string(output)), err
+	return args
 }
 
 // PackageBuilder provides a fluent API for constructing DTSX packages
@@ -1468,42 +4221,93 @@ func (pb *PackageBuilder) AddVariableWithType(namespace, name, value string, dat
 		pb.pkg.Variables.Variable = []*schema.VariableType{}
 	}
 
-	// Map common data type names to SSIS data type codes
-	dataTypeCode := mapDataTypeToCode(dataType)
-
 	v := &schema.VariableType{
 		NamespaceAttr:  &namespace,
 		ObjectNameAttr: &name,
-		VariableValue: &schema.VariableValue{
-			DataTypeAttr: &dataTypeCode,
-			Value:        value,
-		},
+		VariableValue:  NewVariableValue(value, dataType),
 	}
 	pb.pkg.Variables.Variable = append(pb.pkg.Variables.Variable, v)
 	return pb
 }
 
+// DataTypeCode returns the SSIS data type code stored in a variable's DataType
+// attribute for a type name such as "Int32", "Boolean" or "DT_WSTR".
+// Unrecognised names map to DT_WSTR (8).
+func DataTypeCode(name string) int {
+	return mapDataTypeToCode(name)
+}
+
+// NewVariableValue returns a VariableValue holding value with the DataType
+// code for dataType (see DataTypeCode)
+func NewVariableValue(value, dataType string) *schema.VariableValue {
+	code := mapDataTypeToCode(dataType)
+	return &schema.VariableValue{
+		DataTypeAttr: &code,
+		Value:        value,
+	}
+}
+
 // mapDataTypeToCode maps common data type names to SSIS data type codes
 func mapDataTypeToCode(dataType string) int {
 	switch strings.ToLower(dataType) {
-	case "string", "str", "dt_str":
+	case "string", "str", "dt_str", "wstr", "dt_wstr":
 		return 8 // DT_WSTR (Unicode string)
+	case "sbyte", "int8", "i1", "dt_i1":
+		return 16 // DT_I1
+	case "byte", "uint8", "ui1", "dt_ui1":
+		return 17 // DT_UI1
+	case "short", "int16", "i2", "dt_i2":
+		return 2 // DT_I2
+	case "ushort", "uint16", "ui2", "dt_ui2":
+		return 18 // DT_UI2
 	case "int", "int32", "i4", "dt_i4":
 		return 3 // DT_I4
+	case "uint", "uint32", "ui4", "dt_ui4":
+		return 19 // DT_UI4
 	case "int64", "i8", "dt_i8":
 		return 20 // DT_I8
+	case "uint64", "ui8", "dt_ui8":
+		return 21 // DT_UI8
 	case "bool", "boolean", "dt_bool":
 		return 11 // DT_BOOL
+	case "date", "dt_date":
+		return 7 // DT_DATE
+	case "dbdate", "dt_dbdate":
+		return 133 // DT_DBDATE
+	case "time", "dbtime", "dt_dbtime":
+		return 134 // DT_DBTIME
+	case "time2", "dbtime2", "dt_dbtime2":
+		return 145 // DT_DBTIME2
 	case "datetime", "dt_dbtimestamp":
 		return 135 // DT_DBTIMESTAMP
+	case "datetimeoffset", "dt_dbtimestampoffset":
+		return 146 // DT_DBTIMESTAMPOFFSET
+	case "datetime2", "dt_dbtimestamp2":
+		return 304 // DT_DBTIMESTAMP2
+	case "filetime", "dt_filetime":
+		return 64 // DT_FILETIME
 	case "decimal", "dt_decimal":
 		return 25 // DT_DECIMAL
+	case "numeric", "dt_numeric":
+		return 131 // DT_NUMERIC
+	case "currency", "money", "cy", "dt_cy":
+		return 6 // DT_CY
+	case "single", "real", "r4", "dt_r4":
+		return 4 // DT_R4
 	case "double", "float", "r8", "dt_r8":
 		return 5 // DT_R8
 	case "guid", "dt_guid":
 		return 72 // DT_GUID
+	case "bytes", "binary", "dt_bytes":
+		return 128 // DT_BYTES
+	case "image", "dt_image":
+		return 301 // DT_IMAGE
+	case "text", "dt_text":
+		return 302 // DT_TEXT
+	case "ntext", "dt_ntext":
+		return 303 // DT_NTEXT
 	case "object", "dt_object":
-		return 301 // DT_OBJECT
+		return 13 // Object, as SSIS stores it for variables
 	default:
 		return 8 // Default to string (DT_WSTR)
 	}
@@ -1560,7 +4364,185 @@ func (pb *PackageBuilder) AddConnectionExpression(connectionName, propertyName,
 		}
 	}
 
-	return pb
+	return pb
+}
+
+// AddExecutable adds a task of the given executable type (e.g. "Microsoft.ExecuteSQLTask")
+// to the package, with a refId of Package\name and a new DTSID
+func (pb *PackageBuilder) AddExecutable(name, executableType string) *PackageBuilder {
+	pb.newExecutable(name, executableType)
+	return pb
+}
+
+// AddSQLTask adds an Execute SQL Task running sql against the named connection.
+// The connection is referenced by its DTSID when it has one, otherwise by name.
+func (pb *PackageBuilder) AddSQLTask(name, connectionName, sql string) *PackageBuilder {
+	exec := pb.newExecutable(name, "Microsoft.ExecuteSQLTask")
+
+	connection := connectionName
+	if pb.pkg.ConnectionManagers != nil {
+		for _, cm := range pb.pkg.ConnectionManagers.ConnectionManager {
+			if cm.ObjectNameAttr != nil && *cm.ObjectNameAttr == connectionName && cm.DTSIDAttr != nil {
+				connection = *cm.DTSIDAttr
+				break
+			}
+		}
+	}
+
+	var data strings.Builder
+	data.WriteString(`<SQLTask:SqlTaskData SQLTask:Connection="`)
+	data.WriteString(escapeXML(connection, true))
+	data.WriteString(`" SQLTask:SqlStatementSource="`)
+	data.WriteString(escapeXML(sql, true))
+	data.WriteString(`" xmlns:SQLTask="www.microsoft.com/sqlserver/dts/tasks/sqltask" />`)
+	exec.ObjectData = &schema.ExecutableObjectDataType{InnerXML: data.String()}
+	return pb
+}
+
+// AddPrecedenceConstraint makes the task toTaskName run after fromTaskName when
+// fromTaskName ends with condition ("Success", "Failure" or "Completion";
+// empty means Success). The constraint is stored on the target task and
+// refers to the predecessor by refId. If either task is unknown or the
+// condition is not recognized, the builder is returned unchanged.
+func (pb *PackageBuilder) AddPrecedenceConstraint(fromTaskName, toTaskName, condition string) *PackageBuilder {
+	var value string
+	switch strings.ToLower(condition) {
+	case "", "success":
+		value = "0"
+	case "failure":
+		value = "1"
+	case "completion":
+		value = "2"
+	default:
+		return pb
+	}
+
+	var from, to *schema.AnyNonPackageExecutableType
+	for _, exec := range pb.pkg.Executable {
+		if exec.ObjectNameAttr == nil {
+			continue
+		}
+		switch *exec.ObjectNameAttr {
+		case fromTaskName:
+			from = exec
+		case toTaskName:
+			to = exec
+		}
+	}
+	if from == nil || to == nil || from.RefIdAttr == nil {
+		return pb
+	}
+
+	isFrom := 1
+	to.PrecedenceConstraint = append(to.PrecedenceConstraint, &schema.PrecedenceConstraintType{
+		Property: []*schema.Property{
+			{
+				NameAttr: stringPtr("Value"),
+				PropertyElementBaseType: &schema.PropertyElementBaseType{
+					AnySimpleType: &schema.AnySimpleType{Value: value},
+				},
+			},
+		},
+		Executable: []*schema.PrecedenceConstraintExecutableReferenceType{
+			{IDREFAttr: stringPtr(*from.RefIdAttr), IsFromAttr: &isFrom},
+		},
+	})
+	return pb
+}
+
+// newExecutable appends an initialized executable to the package
+func (pb *PackageBuilder) newExecutable(name, executableType string) *schema.AnyNonPackageExecutableType {
+	exec := newExecutable("Package", name, executableType)
+	pb.pkg.Executable = append(pb.pkg.Executable, exec)
+	return exec
+}
+
+// newExecutable returns an executable with a refId of parentRefId\name and a
+// new DTSID
+func newExecutable(parentRefId, name, executableType string) *schema.AnyNonPackageExecutableType {
+	return &schema.AnyNonPackageExecutableType{
+		RefIdAttr:          stringPtr(parentRefId + `\` + name),
+		ExecutableTypeAttr: executableType,
+		ObjectNameAttr:     stringPtr(name),
+		CreationNameAttr:   stringPtr(executableType),
+		DTSIDAttr:          stringPtr(generateGUID()),
+	}
+}
+
+// EventHandlerBuilder adds tasks to an event handler created by AddEventHandler
+type EventHandlerBuilder struct {
+	pb      *PackageBuilder
+	handler *schema.EventHandlerType
+}
+
+// AddEventHandler attaches a handler for eventName (e.g. "OnError" or
+// "OnPreExecute") to the package, when targetRefId is "Package" or the
+// package refId, or to the task with that refId, and returns a builder for
+// the tasks the handler runs. If no task has targetRefId the handler is not
+// attached; use Package.AddEventHandler to get an error instead.
+func (pb *PackageBuilder) AddEventHandler(targetRefId, eventName string) *EventHandlerBuilder {
+	handler, _ := pb.pkg.attachEventHandler(targetRefId, eventName)
+	return &EventHandlerBuilder{pb: pb, handler: handler}
+}
+
+// AddEventHandler attaches a handler for eventName to the package or to the
+// task with refId targetRefId, like PackageBuilder.AddEventHandler, and
+// returns an error if there is no such task
+func (p *Package) AddEventHandler(targetRefId, eventName string) (*EventHandlerBuilder, error) {
+	if p == nil || p.ExecutableTypePackage == nil {
+		return nil, fmt.Errorf("package is nil")
+	}
+	handler, err := p.attachEventHandler(targetRefId, eventName)
+	if err != nil {
+		return nil, err
+	}
+	return &EventHandlerBuilder{pb: &PackageBuilder{pkg: p}, handler: handler}, nil
+}
+
+// attachEventHandler creates an event handler in the SSIS 2012+ form and adds
+// it to the host named by targetRefId. The handler is returned even when the
+// host is not found, so builder chains can continue.
+func (p *Package) attachEventHandler(targetRefId, eventName string) (*schema.EventHandlerType, error) {
+	handler := &schema.EventHandlerType{
+		RefIdAttr:        stringPtr(targetRefId + ".EventHandlers[" + eventName + "]"),
+		CreationNameAttr: stringPtr(eventName),
+		DTSIDAttr:        stringPtr(generateGUID()),
+		EventNameAttr:    stringPtr(eventName),
+	}
+
+	if targetRefId == "Package" || (p.RefIdAttr != nil && *p.RefIdAttr == targetRefId) {
+		p.EventHandlers = append(p.EventHandlers, handler)
+		return handler, nil
+	}
+	var host *schema.AnyNonPackageExecutableType
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		if host == nil && getRefId(exec) == targetRefId {
+			host = exec
+		}
+	})
+	if host == nil {
+		return handler, fmt.Errorf("executable %s not found", targetRefId)
+	}
+	host.EventHandlers = append(host.EventHandlers, handler)
+	return handler, nil
+}
+
+// AddExecutable adds a task of the given executable type to the event
+// handler, with a refId below the handler's and a new DTSID
+func (eb *EventHandlerBuilder) AddExecutable(name, executableType string) *EventHandlerBuilder {
+	exec := newExecutable(derefString(eb.handler.RefIdAttr), name, executableType)
+	eb.handler.Executables = append(eb.handler.Executables, exec)
+	return eb
+}
+
+// Handler returns the event handler being built
+func (eb *EventHandlerBuilder) Handler() *schema.EventHandlerType {
+	return eb.handler
+}
+
+// Done returns the package builder, to continue building the package
+func (eb *EventHandlerBuilder) Done() *PackageBuilder {
+	return eb.pb
 }
 
 // Build returns the constructed package
@@ -1568,6 +4550,16 @@ func (pb *PackageBuilder) Build() *Package {
 	return pb.pkg
 }
 
+// Validate runs the variable and connection checks on the package built so far,
+// so duplicate names or missing connection strings can be caught mid-chain.
+// Package-level structure checks are left to Validate on the built package.
+func (pb *PackageBuilder) Validate() []ValidationError {
+	var errors []ValidationError
+	errors = append(errors, pb.pkg.validateVariables()...)
+	errors = append(errors, pb.pkg.validateConnections()...)
+	return errors
+}
+
 // stringPtr returns a pointer to a string
 func stringPtr(s string) *string {
 	return &s
@@ -1580,6 +4572,50 @@ type ValidationError struct {
 	Path     string // Location in the package, e.g., "Variables.User::MyVar"
 }
 
+// Error formats the result as "[severity] path: message", omitting the path
+// when it is empty, so a ValidationError can be returned or wrapped as an error
+func (e ValidationError) Error() string {
+	if e.Path == "" {
+		return "[" + e.Severity + "] " + e.Message
+	}
+	return "[" + e.Severity + "] " + e.Path + ": " + e.Message
+}
+
+// ValidationErrors is a list of validation results, as returned by Validate
+type ValidationErrors []ValidationError
+
+// HasErrors reports whether any result has "error" severity; warnings and
+// info results alone do not count
+func (errs ValidationErrors) HasErrors() bool {
+	for _, err := range errs {
+		if err.Severity == "error" {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterBySeverity returns the results with the given severity ("error",
+// "warning" or "info"), in their original order
+func FilterBySeverity(errs []ValidationError, sev string) []ValidationError {
+	var filtered []ValidationError
+	for _, err := range errs {
+		if err.Severity == sev {
+			filtered = append(filtered, err)
+		}
+	}
+	return filtered
+}
+
+// CountBySeverity returns the number of results for each severity present
+func CountBySeverity(errs []ValidationError) map[string]int {
+	counts := make(map[string]int)
+	for _, err := range errs {
+		counts[err.Severity]++
+	}
+	return counts
+}
+
 // Validate performs comprehensive validation on the package
 func (p *Package) Validate() []ValidationError {
 	var errors []ValidationError
@@ -1614,7 +4650,8 @@ func (p *Package) validateVariables() []ValidationError {
 	// Check for duplicate variable names
 	nameMap := make(map[string]bool)
 	for _, v := range p.Variables.Variable {
-		if v.NamespaceAttr == nil || v.ObjectNameAttr == nil {
+		fullName, ok := variableKey(v)
+		if !ok {
 			errors = append(errors, ValidationError{
 				Severity: "error",
 				Message:  "Variable missing namespace or name",
@@ -1622,7 +4659,6 @@ func (p *Package) validateVariables() []ValidationError {
 			})
 			continue
 		}
-		fullName := *v.NamespaceAttr + "::" + *v.ObjectNameAttr
 		if nameMap[fullName] {
 			errors = append(errors, ValidationError{
 				Severity: "error",
@@ -1657,6 +4693,24 @@ func (p *Package) validateVariables() []ValidationError {
 	return errors
 }
 
+// variableKey returns the Namespace::Name that identifies a variable when
+// checking for duplicates; ok is false if the namespace or name is missing
+func variableKey(v *schema.VariableType) (key string, ok bool) {
+	if v.NamespaceAttr == nil || v.ObjectNameAttr == nil {
+		return "", false
+	}
+	return *v.NamespaceAttr + "::" + *v.ObjectNameAttr, true
+}
+
+// connectionKey returns the object name that identifies a connection manager
+// when checking for duplicates; ok is false if the name is missing
+func connectionKey(cm *schema.ConnectionManagerType) (key string, ok bool) {
+	if cm.ObjectNameAttr == nil {
+		return "", false
+	}
+	return *cm.ObjectNameAttr, true
+}
+
 // validateConnections checks for connection-related issues
 func (p *Package) validateConnections() []ValidationError {
 	var errors []ValidationError
@@ -1668,7 +4722,8 @@ func (p *Package) validateConnections() []ValidationError {
 	// Check for duplicate connection names
 	nameMap := make(map[string]bool)
 	for _, cm := range p.ConnectionManagers.ConnectionManager {
-		if cm.ObjectNameAttr == nil {
+		name, ok := connectionKey(cm)
+		if !ok {
 			errors = append(errors, ValidationError{
 				Severity: "error",
 				Message:  "Connection manager missing name",
@@ -1676,7 +4731,6 @@ func (p *Package) validateConnections() []ValidationError {
 			})
 			continue
 		}
-		name := *cm.ObjectNameAttr
 		if nameMap[name] {
 			errors = append(errors, ValidationError{
 				Severity: "error",
@@ -1769,6 +4823,124 @@ func (p *Package) validateExpressions() []ValidationError {
 	return errors
 }
 
+// ValidateFilesystem checks that file-based connections (FLATFILE, FILE) with a
+// static path point at files that exist on this machine. Connections whose
+// ConnectionString is set by an expression are skipped, since the path is only
+// known at run time. Missing files are reported as warnings.
+func ValidateFilesystem(p *Package) []ValidationError {
+	var errors []ValidationError
+
+	if p == nil || p.ConnectionManagers == nil {
+		return errors
+	}
+
+	for _, cm := range p.ConnectionManagers.ConnectionManager {
+		if cm.CreationNameAttr == nil {
+			continue
+		}
+		switch strings.ToUpper(*cm.CreationNameAttr) {
+		case "FLATFILE", "FILE":
+		default:
+			continue
+		}
+
+		// Skip expression-driven paths
+		dynamic := false
+		for _, expr := range cm.PropertyExpression {
+			if expr.NameAttr == "ConnectionString" {
+				dynamic = true
+				break
+			}
+		}
+		path := GetConnectionString(cm)
+		if dynamic || path == "" {
+			continue
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			errors = append(errors, ValidationError{
+				Severity: "warning",
+				Message:  fmt.Sprintf("File connection points at a missing path: %s", path),
+				Path:     "ConnectionManagers." + GetConnectionName(cm),
+			})
+		}
+	}
+
+	return errors
+}
+
+// ExternalDependency is an external resource a package touches
+type ExternalDependency struct {
+	Kind     string // "File", "Database", "Process", "SMTP" or "FTP"
+	Location string // file path or UNC share, server, executable or host
+	Database string // database name, for Database dependencies
+	Source   string // name of the connection manager or task it comes from
+}
+
+// argumentPathPattern matches absolute Windows paths and UNC shares in
+// process arguments, quoted or unquoted
+var argumentPathPattern = regexp.MustCompile(`"((?:[A-Za-z]:\\|\\\\)[^"]*)"|((?:[A-Za-z]:\\|\\\\)[^\s"]*)`)
+
+// GetExternalDependencies lists the external resources the package uses, for
+// deployment planning: files and shares from file connections, servers and
+// databases from database connection strings, SMTP and FTP hosts, and the
+// executables of Execute Process tasks together with any absolute paths in
+// their arguments. Connections come first, in document order, then tasks.
+func (p *Package) GetExternalDependencies() []ExternalDependency {
+	var deps []ExternalDependency
+	if p == nil || p.ExecutableTypePackage == nil {
+		return deps
+	}
+	seen := make(map[ExternalDependency]bool)
+	add := func(dep ExternalDependency) {
+		if dep.Location != "" && !seen[dep] {
+			seen[dep] = true
+			deps = append(deps, dep)
+		}
+	}
+
+	if p.ConnectionManagers != nil {
+		for _, cm := range p.ConnectionManagers.ConnectionManager {
+			name := GetConnectionName(cm)
+			connStr := pathConnectionString(cm)
+			values := ParseConnectionString(connStr)
+			creationName := strings.ToUpper(derefString(cm.CreationNameAttr))
+			switch {
+			case creationName == "FLATFILE" || creationName == "FILE" ||
+				creationName == "MULTIFILE" || creationName == "MULTIFLATFILE":
+				add(ExternalDependency{Kind: "File", Location: connStr, Source: name})
+			case creationName == "EXCEL":
+				add(ExternalDependency{Kind: "File", Location: values["data source"], Source: name})
+			case creationName == "SMTP":
+				add(ExternalDependency{Kind: "SMTP", Location: values["smtpserver"], Source: name})
+			case creationName == "FTP":
+				add(ExternalDependency{Kind: "FTP", Location: connStr, Source: name})
+			case strings.HasPrefix(creationName, "OLEDB") || strings.HasPrefix(creationName, "ADO.NET") ||
+				strings.HasPrefix(creationName, "ODBC") || strings.HasPrefix(creationName, "MSOLAP"):
+				info := ParseConnectionInfo(connStr)
+				add(ExternalDependency{Kind: "Database", Location: info.Server, Database: info.Database, Source: name})
+			}
+		}
+	}
+
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		if exec.ObjectData == nil || exec.ObjectData.ExecuteProcessData == nil {
+			return
+		}
+		name := GetExecutableName(exec)
+		data := exec.ObjectData.ExecuteProcessData
+		add(ExternalDependency{Kind: "Process", Location: derefString(data.ExecutableAttr), Source: name})
+		for _, match := range argumentPathPattern.FindAllStringSubmatch(derefString(data.ArgumentsAttr), -1) {
+			path := match[1]
+			if path == "" {
+				path = match[2]
+			}
+			add(ExternalDependency{Kind: "File", Location: path, Source: name})
+		}
+	})
+	return deps
+}
+
 // validateStructure checks for structural issues
 func (p *Package) validateStructure() []ValidationError {
 	var errors []ValidationError
@@ -1782,6 +4954,26 @@ func (p *Package) validateStructure() []ValidationError {
 		})
 	}
 
+	// Check for executables without a name
+	for i, exec := range p.Executable {
+		if hasExecutableName(exec) {
+			continue
+		}
+		if refId := getRefId(exec); nameFromRefId(refId) != "" {
+			errors = append(errors, ValidationError{
+				Severity: "warning",
+				Message:  fmt.Sprintf("Executable has no name; FillMissingNames can derive one from refId %s", refId),
+				Path:     "Executables." + refId,
+			})
+		} else {
+			errors = append(errors, ValidationError{
+				Severity: "error",
+				Message:  "Executable has neither a name nor a refId",
+				Path:     fmt.Sprintf("Executables[%d]", i),
+			})
+		}
+	}
+
 	// Check for missing package properties
 	if len(p.Property) == 0 {
 		errors = append(errors, ValidationError{
@@ -1817,6 +5009,9 @@ type DependencyGraph struct {
 	TaskDependencies map[string][]string
 	// ExpressionDependencies: expression -> list of variables it references
 	ExpressionDependencies map[string][]string
+	// ConnectionVariables: connection name -> list of variables its property
+	// expressions reference, e.g. a ConnectionString built from variables
+	ConnectionVariables map[string][]string
 }
 
 // BuildDependencyGraph analyzes the package and builds a dependency graph
@@ -1826,6 +5021,7 @@ func (p *Package) BuildDependencyGraph() *DependencyGraph {
 		ConnectionDependencies: make(map[string][]string),
 		TaskDependencies:       make(map[string][]string),
 		ExpressionDependencies: make(map[string][]string),
+		ConnectionVariables:    make(map[string][]string),
 	}
 
 	if p == nil {
@@ -1848,52 +5044,92 @@ func (p *Package) BuildDependencyGraph() *DependencyGraph {
 		}
 	}
 
-	// Analyze tasks for connection dependencies
-	if p.Executable != nil {
-		for i, exec := range p.Executable {
-			taskID := fmt.Sprintf("Executable[%d]", i)
-			if exec.ExecutableTypeAttr != "" {
-				taskID = fmt.Sprintf("%s (%s)", taskID, exec.ExecutableTypeAttr)
-			}
-
-			// Check properties for connection references
-			if exec.Property != nil {
-				for _, prop := range exec.Property {
-					if prop.NameAttr != nil && *prop.NameAttr == "Connection" && prop.Value != "" {
-						connName := prop.Value
-						graph.ConnectionDependencies[connName] = append(graph.ConnectionDependencies[connName], taskID)
-						graph.TaskDependencies[taskID] = append(graph.TaskDependencies[taskID], "Connection:"+connName)
-					}
+	// Link variables to the connections whose properties they drive
+	for _, cm := range p.GetConnections().Results.([]*schema.ConnectionManagerType) {
+		connName := GetConnectionName(cm)
+		for _, expr := range cm.PropertyExpression {
+			if expr.AnySimpleType == nil {
+				continue
+			}
+			for _, v := range extractVariableReferences(expr.AnySimpleType.Value) {
+				graph.ConnectionVariables[connName] = appendUnique(graph.ConnectionVariables[connName], v)
+				graph.VariableDependencies[v] = appendUnique(graph.VariableDependencies[v], "Connection:"+connName)
+			}
+		}
+	}
+
+	// Connections used by SQL statements, keyed by task refId
+	sqlConnections := make(map[string][]string)
+	for _, stmt := range NewPackageParser(p).GetSQLStatements() {
+		sqlConnections[stmt.RefId] = append(sqlConnections[stmt.RefId], stmt.Connections...)
+	}
+
+	// Analyze tasks for connection dependencies. Tasks are numbered in
+	// WalkExecutables order, so those inside containers are included.
+	i := 0
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		taskID := fmt.Sprintf("Executable[%d]", i)
+		i++
+		if exec.ExecutableTypeAttr != "" {
+			taskID = fmt.Sprintf("%s (%s)", taskID, exec.ExecutableTypeAttr)
+		}
+
+		// Check properties for connection references
+		if exec.Property != nil {
+			for _, prop := range exec.Property {
+				if prop.NameAttr != nil && *prop.NameAttr == "Connection" && prop.Value != "" {
+					connName := prop.Value
+					graph.ConnectionDependencies[connName] = append(graph.ConnectionDependencies[connName], taskID)
+					graph.TaskDependencies[taskID] = append(graph.TaskDependencies[taskID], "Connection:"+connName)
 				}
 			}
+		}
+		for _, connName := range uniqueStrings(sqlConnections[getRefId(exec)]) {
+			if containsString(graph.ConnectionDependencies[connName], taskID) {
+				continue
+			}
+			graph.ConnectionDependencies[connName] = append(graph.ConnectionDependencies[connName], taskID)
+			graph.TaskDependencies[taskID] = append(graph.TaskDependencies[taskID], "Connection:"+connName)
+		}
 
-			// Check for variable references in task properties
-			if exec.Property != nil {
-				for _, prop := range exec.Property {
-					if prop.Value != "" {
-						vars := extractVariableReferences(prop.Value)
-						for _, v := range vars {
-							graph.VariableDependencies[v] = append(graph.VariableDependencies[v], taskID)
-							graph.TaskDependencies[taskID] = append(graph.TaskDependencies[taskID], "Variable:"+v)
-						}
+		// Check for variable references in task properties
+		if exec.Property != nil {
+			for _, prop := range exec.Property {
+				if prop.Value != "" {
+					vars := extractVariableReferences(prop.Value)
+					for _, v := range vars {
+						graph.VariableDependencies[v] = append(graph.VariableDependencies[v], taskID)
+						graph.TaskDependencies[taskID] = append(graph.TaskDependencies[taskID], "Variable:"+v)
 					}
 				}
 			}
 		}
-	}
+	})
 
 	return graph
 }
 
-// GetVariableImpact returns all locations affected by a variable change
+// GetVariableImpact returns all locations affected by a variable change.
+// When the variable drives a connection property, the tasks using that
+// connection are included after the connection itself.
 func (dg *DependencyGraph) GetVariableImpact(varName string) []string {
 	if dg == nil {
 		return nil
 	}
-	return dg.VariableDependencies[varName]
+	var impact []string
+	for _, location := range dg.VariableDependencies[varName] {
+		impact = appendUnique(impact, location)
+		if connName, ok := strings.CutPrefix(location, "Connection:"); ok {
+			for _, task := range dg.ConnectionDependencies[connName] {
+				impact = appendUnique(impact, task)
+			}
+		}
+	}
+	return impact
 }
 
-// GetConnectionImpact returns all tasks affected by a connection change
+// GetConnectionImpact returns all tasks affected by a connection change,
+// including tasks that run an Execute SQL statement against it
 func (dg *DependencyGraph) GetConnectionImpact(connName string) []string {
 	if dg == nil {
 		return nil
@@ -1901,6 +5137,15 @@ func (dg *DependencyGraph) GetConnectionImpact(connName string) []string {
 	return dg.ConnectionDependencies[connName]
 }
 
+// GetConnectionVariables returns the variables a connection's property
+// expressions depend on; a change to any of them changes the connection
+func (dg *DependencyGraph) GetConnectionVariables(connName string) []string {
+	if dg == nil {
+		return nil
+	}
+	return dg.ConnectionVariables[connName]
+}
+
 // GetUnusedVariables returns variables that are not referenced anywhere
 func (p *Package) GetUnusedVariables() []string {
 	if p == nil || p.Variables == nil || p.Variables.Variable == nil {
@@ -1925,6 +5170,193 @@ func (p *Package) GetUnusedVariables() []string {
 	return unused
 }
 
+// GetUnusedConnections returns the names of the connection managers that no
+// task, data flow component or expression references, in package order.
+// References by name, refId and DTSID are all recognized.
+func (p *Package) GetUnusedConnections() []string {
+	connections := p.GetConnections().Results.([]*schema.ConnectionManagerType)
+	if len(connections) == 0 {
+		return nil
+	}
+
+	parser := NewPackageParser(p)
+	used := make(map[*schema.ConnectionManagerType]bool)
+	markUsed := func(id string) {
+		if id == "" {
+			return
+		}
+		if cm := parser.findConnection(id); cm != nil {
+			used[cm] = true
+		}
+	}
+
+	for id := range p.BuildDependencyGraph().ConnectionDependencies {
+		markUsed(id)
+	}
+	for _, stmt := range parser.GetSQLStatements() {
+		for _, id := range stmt.Connections {
+			markUsed(id)
+		}
+	}
+	for _, expr := range p.GetExpressions().Results.([]*ExpressionInfo) {
+		for _, name := range parser.extractConnectionRefs(expr.Expression) {
+			markUsed(name)
+		}
+	}
+	// Nested tasks and data flow components are not in the dependency graph
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		markUsed(getPropertyValue(exec.Property, "Connection"))
+		if exec.ObjectData == nil || exec.ObjectData.Pipeline == nil || exec.ObjectData.Pipeline.Components == nil {
+			return
+		}
+		for _, comp := range exec.ObjectData.Pipeline.Components.Component {
+			if comp.Connections == nil {
+				continue
+			}
+			for _, conn := range comp.Connections.Connection {
+				markUsed(derefString(conn.ConnectionManagerIDAttr))
+			}
+		}
+	})
+
+	var unused []string
+	for _, cm := range connections {
+		if !used[cm] {
+			unused = append(unused, GetConnectionName(cm))
+		}
+	}
+	return unused
+}
+
+// GetUndefinedVariableReferences returns the distinct @[Namespace::Name]
+// references in expressions, SQL statements and task properties that match no
+// package variable or parameter, in the order they are first seen. System
+// variables and $Project parameters are defined outside the package and are
+// never reported.
+func (p *Package) GetUndefinedVariableReferences() []string {
+	if p == nil {
+		return nil
+	}
+
+	defined := make(map[string]bool)
+	for _, v := range p.GetVariables().Results.([]*schema.VariableType) {
+		defined[GetVariableName(v)] = true
+		if v.ObjectNameAttr != nil {
+			// Unqualified references resolve against the object name alone
+			defined[*v.ObjectNameAttr] = true
+		}
+	}
+	for _, param := range p.GetParameters().Results.([]*PackageParameterType) {
+		defined[GetParameterName(param)] = true
+	}
+
+	var texts []string
+	for _, expr := range p.GetExpressions().Results.([]*ExpressionInfo) {
+		texts = append(texts, expr.Expression)
+	}
+	for _, stmt := range NewPackageParser(p).GetSQLStatements() {
+		texts = append(texts, stmt.SQL)
+	}
+	for _, exec := range p.Executable {
+		for _, prop := range exec.Property {
+			if prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+				texts = append(texts, prop.PropertyElementBaseType.AnySimpleType.Value)
+			}
+		}
+	}
+
+	var undefined []string
+	seen := make(map[string]bool)
+	for _, text := range texts {
+		for _, ref := range extractVariableReferences(text) {
+			if defined[ref] || seen[ref] || strings.HasPrefix(ref, "System::") || strings.HasPrefix(ref, "$Project::") {
+				continue
+			}
+			seen[ref] = true
+			undefined = append(undefined, ref)
+		}
+	}
+	return undefined
+}
+
+// DefaultDataflowComponentThreshold is the component count above which
+// GetOptimizationSuggestions flags a data flow as overly complex
+const DefaultDataflowComponentThreshold = 30
+
+// DataflowScore summarizes the size and complexity of one data flow task
+type DataflowScore struct {
+	Name       string
+	RefId      string
+	Components int
+	Paths      int
+	Transforms int // components with both inputs and non-error outputs
+	Score      int // Components + Paths + Transforms
+}
+
+// DataflowComplexity returns component, path and transform counts with a
+// complexity score for every data flow task in the package, including those
+// inside containers
+func (p *Package) DataflowComplexity() []DataflowScore {
+	var scores []DataflowScore
+	if p == nil {
+		return scores
+	}
+
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		if exec.ObjectData == nil || exec.ObjectData.Pipeline == nil {
+			return
+		}
+		pipeline := exec.ObjectData.Pipeline
+		score := DataflowScore{
+			Name:  GetExecutableName(exec),
+			RefId: getRefId(exec),
+		}
+		if pipeline.Components != nil {
+			for _, comp := range pipeline.Components.Component {
+				score.Components++
+				if isTransformComponent(comp) {
+					score.Transforms++
+				}
+			}
+		}
+		if pipeline.Paths != nil {
+			score.Paths = len(pipeline.Paths.Path)
+		}
+		score.Score = score.Components + score.Paths + score.Transforms
+		scores = append(scores, score)
+	})
+
+	return scores
+}
+
+// isTransformComponent reports whether a component both consumes and produces rows
+func isTransformComponent(comp *schema.PipelineComponentType) bool {
+	if comp.Inputs == nil || len(comp.Inputs.Input) == 0 || comp.Outputs == nil {
+		return false
+	}
+	for _, out := range comp.Outputs.Output {
+		if out.IsErrorOutAttr == nil || !*out.IsErrorOutAttr {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDataflowSuggestions flags data flows with more than threshold components
+func (p *Package) GetDataflowSuggestions(threshold int) []ValidationError {
+	var suggestions []ValidationError
+	for _, df := range p.DataflowComplexity() {
+		if df.Components > threshold {
+			suggestions = append(suggestions, ValidationError{
+				Severity: "warning",
+				Message:  fmt.Sprintf("Data flow has %d components (complexity score %d) - consider splitting it", df.Components, df.Score),
+				Path:     "Executables." + df.RefId,
+			})
+		}
+	}
+	return suggestions
+}
+
 // GetOptimizationSuggestions returns performance and best practice suggestions
 func (p *Package) GetOptimizationSuggestions() []ValidationError {
 	var suggestions []ValidationError
@@ -1978,8 +5410,183 @@ func (p *Package) GetOptimizationSuggestions() []ValidationError {
 			})
 		}
 	}
-
-	return suggestions
+
+	// Check for overly complex data flows
+	suggestions = append(suggestions, p.GetDataflowSuggestions(DefaultDataflowComponentThreshold)...)
+
+	return suggestions
+}
+
+// ExtractConstant moves a repeated literal into a new string variable and rewrites
+// expressions and connection strings to reference it, including expressions on
+// tasks inside containers, precedence constraints and variables evaluated as
+// expressions. newVarName may be qualified
+// ("User::Server"); the User namespace is assumed otherwise. Connection strings
+// are rewritten by adding a ConnectionString property expression, leaving the
+// design-time value in place. It returns the number of occurrences replaced.
+func (p *Package) ExtractConstant(value, newVarName string) (replaced int, err error) {
+	if p == nil {
+		return 0, fmt.Errorf("package is nil")
+	}
+	if value == "" {
+		return 0, fmt.Errorf("value to extract is empty")
+	}
+	namespace, name := "User", newVarName
+	if strings.Contains(newVarName, "::") {
+		parts := strings.SplitN(newVarName, "::", 2)
+		namespace, name = parts[0], parts[1]
+	}
+	if name == "" {
+		return 0, fmt.Errorf("variable name is empty")
+	}
+	if _, err := p.GetVariableByName(namespace + "::" + name); err == nil {
+		return 0, fmt.Errorf("variable %s::%s already exists", namespace, name)
+	}
+	ref := "@[" + namespace + "::" + name + "]"
+
+	rewrite := func(exprs []*schema.PropertyExpressionElementType) {
+		for _, expr := range exprs {
+			if expr.AnySimpleType != nil {
+				var n int
+				expr.AnySimpleType.Value, n = replaceInStringLiterals(expr.AnySimpleType.Value, value, ref)
+				replaced += n
+			}
+		}
+	}
+
+	rewriteAttr := func(attr *string) {
+		if attr != nil {
+			var n int
+			*attr, n = replaceInStringLiterals(*attr, value, ref)
+			replaced += n
+		}
+	}
+	rewriteConstraints := func(constraints []*schema.PrecedenceConstraintType) {
+		for _, pc := range constraints {
+			rewrite(pc.PropertyExpression)
+			rewriteAttr(pc.ExpressionAttr)
+		}
+	}
+	// A variable evaluated from an expression keeps it in the DTS:Expression
+	// attribute, or in an Expression property in older formats
+	rewriteVariables := func(vars []*schema.VariableType) {
+		for _, v := range vars {
+			rewrite(v.PropertyExpression)
+			rewriteAttr(v.ExpressionAttr)
+			for _, prop := range v.Property {
+				if prop.NameAttr != nil && *prop.NameAttr == "Expression" && prop.PropertyElementBaseType != nil && prop.AnySimpleType != nil {
+					rewriteAttr(&prop.AnySimpleType.Value)
+				}
+			}
+		}
+	}
+
+	rewrite(p.PropertyExpression)
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		rewrite(exec.PropertyExpression)
+		rewriteConstraints(precedenceConstraints(exec.PrecedenceConstraint, exec.PrecedenceConstraints))
+		rewriteVariables(exec.Variable)
+	})
+	rewriteConstraints(precedenceConstraints(p.PrecedenceConstraint, p.PrecedenceConstraints))
+	if p.Variables != nil {
+		rewriteVariables(p.Variables.Variable)
+	}
+	if p.ConnectionManagers != nil {
+		for _, cm := range p.ConnectionManagers.ConnectionManager {
+			rewrite(cm.PropertyExpression)
+
+			// Static connection strings get an expression unless one already exists
+			connStr := GetConnectionString(cm)
+			if !strings.Contains(connStr, value) {
+				continue
+			}
+			hasExpr := false
+			for _, expr := range cm.PropertyExpression {
+				if expr.NameAttr == "ConnectionString" {
+					hasExpr = true
+					break
+				}
+			}
+			if hasExpr {
+				continue
+			}
+			expr, n := replaceInStringLiterals(quoteExpressionString(connStr), value, ref)
+			cm.PropertyExpression = append(cm.PropertyExpression, &schema.PropertyExpressionElementType{
+				NameAttr:      "ConnectionString",
+				AnySimpleType: &schema.AnySimpleType{Value: expr},
+			})
+			replaced += n
+		}
+	}
+
+	if p.Variables == nil {
+		p.Variables = &schema.VariablesType{}
+	}
+	dataTypeCode := mapDataTypeToCode("string")
+	p.Variables.Variable = append(p.Variables.Variable, &schema.VariableType{
+		NamespaceAttr:  stringPtr(namespace),
+		ObjectNameAttr: stringPtr(name),
+		VariableValue: &schema.VariableValue{
+			DataTypeAttr: &dataTypeCode,
+			Value:        value,
+		},
+	})
+
+	return replaced, nil
+}
+
+// quoteExpressionString returns s as an SSIS string literal
+func quoteExpressionString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// replaceInStringLiterals splits every string literal in expr that contains value
+// around it, concatenating ref in its place: "a=X;" becomes "a=" + ref + ";"
+func replaceInStringLiterals(expr, value, ref string) (string, int) {
+	needle := quoteExpressionString(value)
+	needle = needle[1 : len(needle)-1]
+
+	var out strings.Builder
+	count := 0
+	for i := 0; i < len(expr); {
+		if expr[i] != '"' {
+			out.WriteByte(expr[i])
+			i++
+			continue
+		}
+		// Find the end of the literal, honoring backslash escapes
+		j := i + 1
+		for j < len(expr) && expr[j] != '"' {
+			if expr[j] == '\\' {
+				j++
+			}
+			j++
+		}
+		if j > len(expr) {
+			j = len(expr)
+		}
+		body := expr[i+1 : min(j, len(expr))]
+		pieces := strings.Split(body, needle)
+		if len(pieces) == 1 {
+			out.WriteString(expr[i:min(j+1, len(expr))])
+		} else {
+			var parts []string
+			for k, piece := range pieces {
+				if piece != "" {
+					parts = append(parts, `"`+piece+`"`)
+				}
+				if k < len(pieces)-1 {
+					parts = append(parts, ref)
+					count++
+				}
+			}
+			out.WriteString(strings.Join(parts, " + "))
+		}
+		i = j + 1
+	}
+	return out.String(), count
 }
 
 // updateVariable updates the value of an existing variable (internal)
@@ -2006,6 +5613,24 @@ func (p *Package) updateVariable(namespace string, name, newValue string) error
 
 // UpdateVariable was removed from the exported API; use internal updateVariable instead.
 
+// DeleteVariable removes the variable namespace::name from the package.
+// Removing the last variable leaves an empty Variables element in place.
+func (p *Package) DeleteVariable(namespace, name string) error {
+	if p == nil || p.ExecutableTypePackage == nil || p.Variables == nil || p.Variables.Variable == nil {
+		return fmt.Errorf("package has no variables")
+	}
+
+	for i, v := range p.Variables.Variable {
+		if v.NamespaceAttr != nil && v.ObjectNameAttr != nil &&
+			*v.NamespaceAttr == namespace && *v.ObjectNameAttr == name {
+			p.Variables.Variable = append(p.Variables.Variable[:i], p.Variables.Variable[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("variable %s::%s not found", namespace, name)
+}
+
 // updateConnectionString updates the connection string of an existing connection manager (internal)
 func (p *Package) updateConnectionString(connectionName, newConnectionString string) error {
 	if p == nil || p.ConnectionManagers == nil || p.ConnectionManagers.ConnectionManager == nil {
@@ -2045,6 +5670,425 @@ func (p *Package) updateConnectionString(connectionName, newConnectionString str
 
 // UpdateConnectionString was removed from the exported API; use internal updateConnectionString instead.
 
+// DeleteConnection removes the connection manager with the given name. As in
+// updateConnectionString, an ObjectName property takes precedence over the
+// ObjectName attribute.
+func (p *Package) DeleteConnection(name string) error {
+	if p == nil || p.ExecutableTypePackage == nil || p.ConnectionManagers == nil || p.ConnectionManagers.ConnectionManager == nil {
+		return fmt.Errorf("package has no connection managers")
+	}
+
+	for i, cm := range p.ConnectionManagers.ConnectionManager {
+		connName := getPropertyValue(cm.Property, "ObjectName")
+		if connName == "" && cm.ObjectNameAttr != nil {
+			connName = *cm.ObjectNameAttr
+		}
+		if connName == name {
+			p.ConnectionManagers.ConnectionManager = append(p.ConnectionManagers.ConnectionManager[:i], p.ConnectionManagers.ConnectionManager[i+1:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("connection manager %s not found", name)
+}
+
+// RenameVariable renames the package variable oldFullName (Namespace::Name)
+// and rewrites every @[oldFullName] reference in the package, including
+// expressions, property values and task settings such as SQL statements, to
+// @[newFullName]. It returns the number of references rewritten.
+func (p *Package) RenameVariable(oldFullName, newFullName string) (int, error) {
+	v, err := p.GetVariableByName(oldFullName)
+	if err != nil {
+		return 0, err
+	}
+	namespace, name, ok := strings.Cut(newFullName, "::")
+	if !ok || namespace == "" || name == "" {
+		return 0, fmt.Errorf("variable name %q is not of the form Namespace::Name", newFullName)
+	}
+	if existing, err := p.GetVariableByName(newFullName); err == nil && existing != v {
+		return 0, fmt.Errorf("variable %s already exists", newFullName)
+	}
+
+	oldName := GetVariableName(v)
+	v.NamespaceAttr = &namespace
+	v.ObjectNameAttr = &name
+	return replaceStringValues(reflect.ValueOf(p), "@["+oldName+"]", "@["+newFullName+"]"), nil
+}
+
+// RenameConnection renames the connection manager oldName and rewrites the
+// references to it: a refId of the form Package.ConnectionManagers[oldName],
+// task and data flow component connections that name it by refId or name,
+// and @[ConnectionManager::oldName] references in expressions and property
+// values. References by DTSID stay valid and are left alone. It returns the
+// number of references rewritten.
+func (p *Package) RenameConnection(oldName, newName string) (int, error) {
+	if p == nil || p.ExecutableTypePackage == nil || p.ConnectionManagers == nil {
+		return 0, fmt.Errorf("package has no connection managers")
+	}
+	if newName == "" {
+		return 0, fmt.Errorf("connection name is empty")
+	}
+	var target *schema.ConnectionManagerType
+	for _, cm := range p.ConnectionManagers.ConnectionManager {
+		switch GetConnectionName(cm) {
+		case oldName:
+			target = cm
+		case newName:
+			return 0, fmt.Errorf("connection manager %s already exists", newName)
+		}
+	}
+	if target == nil {
+		return 0, fmt.Errorf("connection manager %s not found", oldName)
+	}
+
+	if target.ObjectNameAttr != nil || getPropertyValue(target.Property, "ObjectName") == "" {
+		target.ObjectNameAttr = &newName
+	}
+	for _, prop := range target.Property {
+		if prop.NameAttr != nil && *prop.NameAttr == "ObjectName" && prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+			prop.PropertyElementBaseType.AnySimpleType.Value = newName
+		}
+	}
+	oldRefId, newRefId := derefString(target.RefIdAttr), ""
+	if oldRefId != "" {
+		newRefId = strings.Replace(oldRefId, "ConnectionManagers["+oldName+"]", "ConnectionManagers["+newName+"]", 1)
+		target.RefIdAttr = &newRefId
+	}
+
+	// rename returns the rewritten form of a connection reference, which may
+	// carry a suffix such as ":external" after the refId
+	rename := func(id string) (string, bool) {
+		if id == oldName {
+			return newName, true
+		}
+		if rest, ok := strings.CutPrefix(id, oldRefId); ok && oldRefId != "" && (rest == "" || strings.HasPrefix(rest, ":")) {
+			return newRefId + rest, true
+		}
+		return id, false
+	}
+
+	count := 0
+	p.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		for _, prop := range exec.Property {
+			if prop.NameAttr != nil && *prop.NameAttr == "Connection" && prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+				if id, ok := rename(prop.PropertyElementBaseType.AnySimpleType.Value); ok {
+					prop.PropertyElementBaseType.AnySimpleType.Value = id
+					count++
+				}
+			}
+		}
+		if exec.ObjectData == nil {
+			return
+		}
+		// The typed task data and the raw XML Marshal writes describe the same
+		// references, so each is counted once
+		sqlTaskRenamed := false
+		if data := exec.ObjectData.SQLTaskSqlTaskData; data != nil && data.SQLTaskSqlTaskBaseAttributeGroup != nil {
+			if id, ok := rename(data.SQLTaskSqlTaskBaseAttributeGroup.ConnectionAttr); ok {
+				data.SQLTaskSqlTaskBaseAttributeGroup.ConnectionAttr = id
+				sqlTaskRenamed = true
+			}
+		}
+		if id, ok := rename(sqlTaskAttribute(exec.ObjectData.InnerXML, "Connection")); ok && exec.ObjectData.InnerXML != "" {
+			exec.ObjectData.InnerXML = setSQLTaskAttribute(exec.ObjectData.InnerXML, "Connection", id)
+			sqlTaskRenamed = true
+		}
+		if sqlTaskRenamed {
+			count++
+		}
+
+		typedRenamed := 0
+		if exec.ObjectData.Pipeline != nil && exec.ObjectData.Pipeline.Components != nil {
+			for _, comp := range exec.ObjectData.Pipeline.Components.Component {
+				if comp.Connections == nil {
+					continue
+				}
+				for _, conn := range comp.Connections.Connection {
+					if id, ok := rename(derefString(conn.ConnectionManagerIDAttr)); ok {
+						conn.ConnectionManagerIDAttr = &id
+						typedRenamed++
+					}
+				}
+			}
+		}
+		if exec.ObjectData.InnerXML == "" {
+			count += typedRenamed
+			return
+		}
+		raw, rawRenamed := rewriteRawAttributes(exec.ObjectData.InnerXML,
+			func(el rawElement) bool { return el.name.Local == "connection" },
+			func(name, value string) (string, bool) {
+				if name != "connectionManagerID" && name != "connectionManagerRefId" {
+					return value, false
+				}
+				return rename(value)
+			})
+		exec.ObjectData.InnerXML = raw
+		count += max(typedRenamed, rawRenamed)
+	})
+
+	count += replaceStringValues(reflect.ValueOf(p), "@[ConnectionManager::"+oldName+"]", "@[ConnectionManager::"+newName+"]")
+	return count, nil
+}
+
+// replaceStringValues replaces old with new in every string and *string
+// field below v and returns the number of occurrences replaced. ObjectData
+// holds each reference twice, in the typed task data and in the raw XML that
+// Marshal writes; both are rewritten, but each reference is counted once.
+func replaceStringValues(v reflect.Value, old, new string) int {
+	replaced := 0
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			break
+		}
+		if s, ok := v.Interface().(*string); ok {
+			if n := strings.Count(*s, old); n > 0 {
+				updated := strings.ReplaceAll(*s, old, new)
+				v.Set(reflect.ValueOf(&updated))
+				replaced += n
+			}
+			break
+		}
+		if data, ok := v.Interface().(*schema.ExecutableObjectDataType); ok {
+			replaced += replaceObjectDataValues(data, old, new)
+			break
+		}
+		replaced += replaceStringValues(v.Elem(), old, new)
+	case reflect.String:
+		if n := strings.Count(v.String(), old); n > 0 && v.CanSet() {
+			v.SetString(strings.ReplaceAll(v.String(), old, new))
+			replaced += n
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Field(i); field.CanSet() {
+				replaced += replaceStringValues(field, old, new)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			replaced += replaceStringValues(v.Index(i), old, new)
+		}
+	}
+	return replaced
+}
+
+// replaceObjectDataValues is replaceStringValues for task ObjectData: the typed
+// task data is walked without the raw XML, which is rewritten on its own, and
+// the larger of the two counts is returned
+func replaceObjectDataValues(data *schema.ExecutableObjectDataType, old, new string) int {
+	raw := data.InnerXML
+	data.InnerXML = ""
+	typed := replaceStringValues(reflect.ValueOf(data).Elem(), old, new)
+	oldRaw := escapeXML(old, false)
+	data.InnerXML = strings.ReplaceAll(raw, oldRaw, escapeXML(new, false))
+	return max(typed, strings.Count(raw, oldRaw))
+}
+
+// protectionLevels maps SSIS protection level names to the values stored in
+// the package
+var protectionLevels = map[string]int{
+	"DontSaveSensitive":            0,
+	"EncryptSensitiveWithUserKey":  1,
+	"EncryptSensitiveWithPassword": 2,
+	"EncryptAllWithPassword":       3,
+	"EncryptAllWithUserKey":        4,
+	"ServerStorage":                5,
+}
+
+// SetProtectionLevel sets the package protection level, given by name (e.g.
+// "DontSaveSensitive") or by its numeric value. A ProtectionLevel property
+// written by older formats is updated in place; otherwise the attribute used
+// by SSIS 2012+ is set. Changing the level does not touch stored values; call
+// StripSensitive before saving a package as DontSaveSensitive.
+func (p *Package) SetProtectionLevel(level string) error {
+	if p == nil {
+		return fmt.Errorf("package is nil")
+	}
+
+	value, ok := -1, false
+	for name, v := range protectionLevels {
+		if strings.EqualFold(name, level) {
+			value, ok = v, true
+		}
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(level)); !ok && err == nil {
+		for _, v := range protectionLevels {
+			if v == n {
+				value, ok = n, true
+			}
+		}
+	}
+	if !ok {
+		return fmt.Errorf("unknown protection level %q", level)
+	}
+
+	text := strconv.Itoa(value)
+	if p.ExecutableTypePackage != nil {
+		for _, prop := range p.Property {
+			if prop.NameAttr != nil && *prop.NameAttr == "ProtectionLevel" &&
+				prop.PropertyElementBaseType != nil && prop.PropertyElementBaseType.AnySimpleType != nil {
+				prop.PropertyElementBaseType.AnySimpleType.Value = text
+				return nil
+			}
+		}
+	}
+	p.ProtectionLevelAttr = &text
+	return nil
+}
+
+// StripSensitive removes sensitive data the way SSIS does when saving with
+// DontSaveSensitive: properties flagged Sensitive (such as encrypted
+// parameter values), password elements, and the Password/PWD parts of
+// connection manager connection strings. It returns the number of values
+// removed.
+func (p *Package) StripSensitive() int {
+	if p == nil {
+		return 0
+	}
+	removed := stripSensitiveValue(reflect.ValueOf(p).Elem())
+
+	if p.ExecutableTypePackage == nil || p.ConnectionManagers == nil {
+		return removed
+	}
+	stripProperties := func(props []*schema.Property) {
+		for _, prop := range props {
+			if prop.NameAttr == nil || *prop.NameAttr != "ConnectionString" ||
+				prop.PropertyElementBaseType == nil || prop.PropertyElementBaseType.AnySimpleType == nil {
+				continue
+			}
+			if stripped, ok := stripConnectionStringPasswords(prop.PropertyElementBaseType.AnySimpleType.Value); ok {
+				prop.PropertyElementBaseType.AnySimpleType.Value = stripped
+				removed++
+			}
+		}
+	}
+	for _, cm := range p.ConnectionManagers.ConnectionManager {
+		stripProperties(cm.Property)
+		if cm.ObjectData == nil || cm.ObjectData.ConnectionManager == nil {
+			continue
+		}
+		inner := cm.ObjectData.ConnectionManager
+		stripProperties(inner.Property)
+		if inner.ConnectionStringAttr != nil {
+			if stripped, ok := stripConnectionStringPasswords(*inner.ConnectionStringAttr); ok {
+				inner.ConnectionStringAttr = &stripped
+				removed++
+			}
+		}
+	}
+	return removed
+}
+
+var (
+	propertySliceType   = reflect.TypeOf([]*schema.Property(nil))
+	passwordElementType = reflect.TypeOf((*schema.PasswordElementType)(nil))
+	objectDataType      = reflect.TypeOf((*schema.ExecutableObjectDataType)(nil))
+)
+
+// rawPasswordElements lists the raw ObjectData elements that hold passwords
+// whether or not they carry a Sensitive flag
+var rawPasswordElements = map[string]bool{"PackagePassword": true, "Password": true}
+
+// stripSensitiveObjectData strips executable ObjectData, removing the same
+// secrets from its raw XML, which is what Marshal writes. Each secret is
+// counted once although it appears in both forms.
+func stripSensitiveObjectData(data *schema.ExecutableObjectDataType) int {
+	removed := stripSensitiveValue(reflect.ValueOf(data).Elem())
+	if data.InnerXML == "" {
+		return removed
+	}
+	raw, rawRemoved := removeRawElements(data.InnerXML, func(el rawElement) bool {
+		flag, ok := el.attr("Sensitive")
+		return rawPasswordElements[el.name.Local] || ok && isSensitiveFlag(&flag)
+	})
+	data.InnerXML = raw
+	return max(removed, rawRemoved)
+}
+
+// stripSensitiveValue drops the sensitive properties and password elements
+// found anywhere below v and returns how many it removed
+func stripSensitiveValue(v reflect.Value) int {
+	removed := 0
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			removed += stripSensitiveValue(v.Elem())
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Field(i)
+			if !field.CanSet() {
+				continue
+			}
+			switch field.Type() {
+			case objectDataType:
+				if !field.IsNil() {
+					removed += stripSensitiveObjectData(field.Interface().(*schema.ExecutableObjectDataType))
+				}
+			case passwordElementType:
+				if !field.IsNil() {
+					field.Set(reflect.Zero(passwordElementType))
+					removed++
+				}
+			case propertySliceType:
+				props := field.Interface().([]*schema.Property)
+				kept := props[:0]
+				for _, prop := range props {
+					if prop != nil && isSensitiveFlag(prop.SensitiveAttr) {
+						removed++
+						continue
+					}
+					kept = append(kept, prop)
+				}
+				if len(kept) < len(props) {
+					field.Set(reflect.ValueOf(kept))
+				}
+			default:
+				removed += stripSensitiveValue(field)
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			removed += stripSensitiveValue(v.Index(i))
+		}
+	}
+	return removed
+}
+
+// isSensitiveFlag reports whether a Sensitive attribute marks its element as
+// sensitive; SSIS writes "1", "-1" or "True"
+func isSensitiveFlag(flag *string) bool {
+	if flag == nil {
+		return false
+	}
+	value := strings.TrimSpace(*flag)
+	return value != "" && value != "0" && !strings.EqualFold(value, "false")
+}
+
+// sensitiveConnectionKeys lists the connection string keys that hold secrets
+var sensitiveConnectionKeys = map[string]bool{"password": true, "pwd": true}
+
+// stripConnectionStringPasswords removes the password pairs from connStr and
+// reports whether any were found
+func stripConnectionStringPasswords(connStr string) (string, bool) {
+	var b strings.Builder
+	last, found := 0, false
+	for _, pair := range splitConnectionString(connStr) {
+		if !sensitiveConnectionKeys[pair.key] {
+			continue
+		}
+		b.WriteString(connStr[last:pair.start])
+		last, found = pair.end, true
+	}
+	if !found {
+		return connStr, false
+	}
+	b.WriteString(connStr[last:])
+	return b.String(), true
+}
+
 // updateExpression updates an expression for a specific property (internal)
 func (p *Package) updateExpression(targetType, targetName, propertyName, newExpression string) error {
 	if p == nil {
@@ -2240,6 +6284,64 @@ func (p *Package) updateProperty(targetType, targetName, propertyName, newValue
 
 // UpdateProperty was removed from the exported API; use internal updateProperty instead.
 
+// PreviewUpdate reports what updateProperty would do for the same arguments
+// without modifying the package: the target's current value ("" when the
+// property would be created) and whether the update would succeed. When it
+// would not, err explains why. newValue is accepted so calls mirror the update.
+func (p *Package) PreviewUpdate(targetType, targetName, propertyName, newValue string) (oldValue string, willApply bool, err error) {
+	if p == nil {
+		return "", false, fmt.Errorf("package is nil")
+	}
+
+	switch targetType {
+	case "package":
+		return getPropertyValue(p.Property, propertyName), true, nil
+	case "variable":
+		if p.Variables == nil || p.Variables.Variable == nil {
+			return "", false, fmt.Errorf("package has no variables")
+		}
+		parts := strings.Split(targetName, "::")
+		if len(parts) != 2 {
+			return "", false, fmt.Errorf("variable name must be in format namespace::name")
+		}
+		for _, v := range p.Variables.Variable {
+			if v.NamespaceAttr != nil && v.ObjectNameAttr != nil &&
+				*v.NamespaceAttr == parts[0] && *v.ObjectNameAttr == parts[1] {
+				if propertyName == "Value" {
+					if v.VariableValue != nil {
+						return v.VariableValue.Value, true, nil
+					}
+					return "", true, nil
+				}
+				return getPropertyValue(v.Property, propertyName), true, nil
+			}
+		}
+		return "", false, fmt.Errorf("variable %s not found", targetName)
+	case "connection":
+		if p.ConnectionManagers == nil || p.ConnectionManagers.ConnectionManager == nil {
+			return "", false, fmt.Errorf("package has no connection managers")
+		}
+		for _, cm := range p.ConnectionManagers.ConnectionManager {
+			if getPropertyValue(cm.Property, "ObjectName") == targetName {
+				return getPropertyValue(cm.Property, propertyName), true, nil
+			}
+		}
+		return "", false, fmt.Errorf("connection manager %s not found", targetName)
+	case "executable":
+		if p.Executable == nil {
+			return "", false, fmt.Errorf("package has no executables")
+		}
+		for _, exec := range p.Executable {
+			if getPropertyValue(exec.Property, "ObjectName") == targetName {
+				return getPropertyValue(exec.Property, propertyName), true, nil
+			}
+		}
+		return "", false, fmt.Errorf("executable %s not found", targetName)
+	default:
+		return "", false, fmt.Errorf("unsupported target type: %s (supported: package, variable, connection, executable)", targetType)
+	}
+}
+
 // updatePackageProperty updates a property on the package itself
 func (p *Package) updatePackageProperty(propertyName, newValue string) error {
 	if p.Property == nil {
@@ -2477,32 +6579,63 @@ func (p *PackageParser) extractTaskSpecificSQL(exec *schema.AnyNonPackageExecuta
 	}
 
 	// Special handling for Execute SQL Task due to namespace parsing issues
-	if exec.ExecutableTypeAttr == "Microsoft.ExecuteSQLTask" {
-		// First try the normal schema parsing
-		if exec.ObjectData.SQLTaskSqlTaskData != nil {
-			sql := GetSqlStatementSource(exec.ObjectData.SQLTaskSqlTaskData)
-			if sql != "" {
-				*statements = append(*statements, &SQLStatement{
-					TaskName:    taskName,
-					TaskType:    "Control Flow",
-					SQL:         sql,
-					RefId:       getRefId(exec),
-					Connections: p.getConnectionsForExecutable(exec),
-				})
-				return
+	if NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.ExecuteSQLTask" {
+		// First try the normal schema parsing, then fall back to raw XML parsing
+		source, sourceType, connection := "", "", ""
+		data := exec.ObjectData.SQLTaskSqlTaskData
+		if data != nil && data.SQLTaskSqlTaskBaseAttributeGroup != nil {
+			source = data.SQLTaskSqlTaskBaseAttributeGroup.SqlStatementSourceAttr
+			sourceType = data.SQLTaskSqlTaskBaseAttributeGroup.SqlStmtSourceTypeAttr
+			connection = data.SQLTaskSqlTaskBaseAttributeGroup.ConnectionAttr
+		}
+		if source == "" {
+			source = p.extractSQLFromExecuteSQLTask(exec)
+			connection = sqlTaskAttribute(exec.ObjectData.InnerXML, "Connection")
+			sourceType = sqlTaskAttribute(exec.ObjectData.InnerXML, "SqlStmtSourceType")
+			if sourceType == "" {
+				sourceType = sqlTaskAttribute(exec.ObjectData.InnerXML, "SqlStatementSourceType")
 			}
 		}
-		// Fallback to raw XML parsing
-		sql := p.extractSQLFromExecuteSQLTask(exec)
-		if sql != "" {
-			*statements = append(*statements, &SQLStatement{
-				TaskName:    taskName,
-				TaskType:    "Control Flow",
-				SQL:         sql,
-				RefId:       getRefId(exec),
-				Connections: p.getConnectionsForExecutable(exec),
-			})
+		if source == "" {
+			return
+		}
+
+		stmt := &SQLStatement{
+			TaskName:    taskName,
+			TaskType:    "Control Flow",
+			RefId:       getRefId(exec),
+			Connections: p.getConnectionsForExecutable(exec),
+		}
+		if connection != "" {
+			stmt.Connections = uniqueStrings(append([]string{p.connectionName(connection)}, stmt.Connections...))
+		}
+		switch sourceType {
+		case "Variable":
+			// The statement source names the variable holding the SQL
+			stmt.SourceType = sourceType
+			stmt.Source = source
+			if v, err := p.pkg.GetVariableByName(source); err == nil {
+				stmt.SQL = GetVariableValue(v)
+				stmt.set = func(sql string) {
+					p.pkg.updateVariable(derefString(v.NamespaceAttr), derefString(v.ObjectNameAttr), sql)
+				}
+			}
+		case "FileConnection":
+			// The statement source names the file connection holding the SQL,
+			// which is not read here
+			stmt.SourceType = sourceType
+			stmt.Source = p.connectionName(source)
+		default:
+			stmt.SQL = source
+			stmt.set = func(sql string) {
+				// Marshal writes InnerXML verbatim, so keep it in step with the typed data
+				if data != nil && data.SQLTaskSqlTaskBaseAttributeGroup != nil {
+					data.SQLTaskSqlTaskBaseAttributeGroup.SqlStatementSourceAttr = sql
+				}
+				exec.ObjectData.InnerXML = setSQLTaskAttribute(exec.ObjectData.InnerXML, "SqlStatementSource", sql)
+			}
 		}
+		*statements = append(*statements, stmt)
 		return
 	}
 
@@ -2511,12 +6644,14 @@ func (p *PackageParser) extractTaskSpecificSQL(exec *schema.AnyNonPackageExecuta
 		sqlTaskData := exec.ObjectData.SQLTaskSqlTaskData
 		if sqlTaskData.SQLTaskSqlTaskBaseAttributeGroup != nil &&
 			sqlTaskData.SQLTaskSqlTaskBaseAttributeGroup.SqlStatementSourceAttr != "" {
+			attrs := sqlTaskData.SQLTaskSqlTaskBaseAttributeGroup
 			*statements = append(*statements, &SQLStatement{
 				TaskName:    taskName,
 				TaskType:    "Control Flow",
-				SQL:         sqlTaskData.SQLTaskSqlTaskBaseAttributeGroup.SqlStatementSourceAttr,
+				SQL:         attrs.SqlStatementSourceAttr,
 				RefId:       getRefId(exec),
 				Connections: p.getConnectionsForExecutable(exec),
+				set:         func(sql string) { attrs.SqlStatementSourceAttr = sql },
 			})
 		}
 	}
@@ -2536,19 +6671,22 @@ func (p *PackageParser) extractSQLFromExecuteSQLTask(exec *schema.AnyNonPackageE
 
 	// Find the SqlStatementSource attribute
 	// The XML contains: SQLTask:SqlStatementSource="EXEC [ETC].[GetUtcDate]"
-	start := strings.Index(xmlStr, `SqlStatementSource="`)
-	if start == -1 {
-		return ""
-	}
+	return sqlTaskAttribute(xmlStr, "SqlStatementSource")
+}
 
-	start += len(`SqlStatementSource="`)
-	end := strings.Index(xmlStr[start:], `"`)
-	if end == -1 {
+// sqlTaskAttribute returns the unescaped value of the named SQLTask attribute
+// in raw Execute SQL Task XML, or "" if it is not present
+func sqlTaskAttribute(xmlStr, name string) string {
+	start, end := sqlTaskAttributeSpan(xmlStr, name)
+	if start == -1 {
 		return ""
 	}
 
-	sql := xmlStr[start : start+end]
+	sql := xmlStr[start:end]
 	// Unescape XML entities if any
+	sql = strings.ReplaceAll(sql, "&#xA;", "\n")
+	sql = strings.ReplaceAll(sql, "&#xD;", "\r")
+	sql = strings.ReplaceAll(sql, "&#x9;", "\t")
 	sql = strings.ReplaceAll(sql, "&lt;", "<")
 	sql = strings.ReplaceAll(sql, "&gt;", ">")
 	sql = strings.ReplaceAll(sql, "&amp;", "&")
@@ -2557,3 +6695,164 @@ func (p *PackageParser) extractSQLFromExecuteSQLTask(exec *schema.AnyNonPackageE
 
 	return sql
 }
+
+// setSQLTaskAttribute returns xmlStr with the named SQLTask attribute set to
+// value; xmlStr is returned unchanged if the attribute is not present
+func setSQLTaskAttribute(xmlStr, name, value string) string {
+	start, end := sqlTaskAttributeSpan(xmlStr, name)
+	if start == -1 {
+		return xmlStr
+	}
+	return xmlStr[:start] + escapeXML(value, true) + xmlStr[end:]
+}
+
+// sqlTaskAttributeSpan returns the byte range of the named attribute's raw
+// value in xmlStr, or -1, -1 if it is not present
+func sqlTaskAttributeSpan(xmlStr, name string) (int, int) {
+	start := strings.Index(xmlStr, ":"+name+`="`)
+	if start == -1 {
+		if start = strings.Index(xmlStr, " "+name+`="`); start == -1 {
+			return -1, -1
+		}
+	}
+
+	start += len(name) + 3
+	end := strings.Index(xmlStr[start:], `"`)
+	if end == -1 {
+		return -1, -1
+	}
+	return start, start + end
+}
+
+// TableUsage records a task reading or writing a table
+type TableUsage struct {
+	TaskName  string
+	RefId     string
+	Table     string // as written in the SQL, without brackets
+	Operation string // SELECT, INSERT, UPDATE, DELETE, MERGE or TRUNCATE
+	Write     bool   // false for reads (SELECT, and MERGE sources)
+	SQL       string
+}
+
+// sqlTableName matches a possibly bracketed, multi-part table name such as [dbo].[Orders]
+const sqlTableName = `((?:\[[^\]]+\]|[\w#@$]+)(?:\.(?:\[[^\]]+\]|[\w#@$]+)){0,3})`
+
+// sqlTablePatterns classify table references; writes come first so that the
+// FROM in DELETE FROM is not also counted as a read
+var sqlTablePatterns = []struct {
+	re        *regexp.Regexp
+	operation string
+	write     bool
+}{
+	{regexp.MustCompile(`(?i)\bINSERT\s+(?:INTO\s+)?` + sqlTableName), "INSERT", true},
+	{regexp.MustCompile(`(?i)\bUPDATE\s+` + sqlTableName), "UPDATE", true},
+	{regexp.MustCompile(`(?i)\bDELETE\s+(?:FROM\s+)?` + sqlTableName), "DELETE", true},
+	{regexp.MustCompile(`(?i)\bMERGE\s+(?:INTO\s+)?` + sqlTableName), "MERGE", true},
+	{regexp.MustCompile(`(?i)\bTRUNCATE\s+TABLE\s+` + sqlTableName), "TRUNCATE", true},
+	{regexp.MustCompile(`(?i)\bUSING\s+` + sqlTableName), "MERGE", false},
+	{regexp.MustCompile(`(?i)\b(?:FROM|JOIN)\s+` + sqlTableName), "SELECT", false},
+}
+
+// extractTableUsage finds the tables referenced by a SQL statement and how each is used
+func extractTableUsage(sql string) []TableUsage {
+	// Drop comments and string literals so they are not mistaken for table references
+	cleaned := regexp.MustCompile(`(?s)/\*.*?\*/|--[^\n]*|'(?:[^']|'')*'`).ReplaceAllString(sql, " ")
+
+	type match struct {
+		pos   int
+		usage TableUsage
+	}
+	var matches []match
+	claimed := make(map[int]bool)
+	for _, pattern := range sqlTablePatterns {
+		for _, m := range pattern.re.FindAllStringSubmatchIndex(cleaned, -1) {
+			if claimed[m[2]] {
+				continue
+			}
+			claimed[m[2]] = true
+			table := strings.NewReplacer("[", "", "]", "").Replace(cleaned[m[2]:m[3]])
+			if isSQLKeyword(table) {
+				continue
+			}
+			matches = append(matches, match{m[2], TableUsage{Table: table, Operation: pattern.operation, Write: pattern.write, SQL: sql}})
+		}
+	}
+
+	// Report references in the order they appear in the statement
+	sort.Slice(matches, func(i, j int) bool { return matches[i].pos < matches[j].pos })
+	usages := make([]TableUsage, len(matches))
+	for i, m := range matches {
+		usages[i] = m.usage
+	}
+	return usages
+}
+
+// isSQLKeyword reports whether a matched name is a keyword rather than a table (e.g. DELETE FROM, MERGE INTO)
+func isSQLKeyword(name string) bool {
+	switch strings.ToUpper(name) {
+	case "FROM", "INTO", "SET", "SELECT", "TABLE", "TOP", "STATISTICS":
+		return true
+	}
+	return false
+}
+
+// tableNameMatches reports whether a referenced table matches the requested name,
+// ignoring brackets and case; an unqualified name matches on the last part only
+func tableNameMatches(ref, table string) bool {
+	normalize := func(s string) string {
+		return strings.ToLower(strings.NewReplacer("[", "", "]", "").Replace(s))
+	}
+	ref, table = normalize(ref), normalize(table)
+	if ref == table {
+		return true
+	}
+	if !strings.Contains(table, ".") {
+		if i := strings.LastIndex(ref, "."); i >= 0 {
+			return ref[i+1:] == table
+		}
+	}
+	return strings.HasSuffix(ref, "."+table)
+}
+
+// getTableUsages returns every table reference in the package's SQL statements
+func (p *Package) getTableUsages() []TableUsage {
+	var usages []TableUsage
+	if p == nil {
+		return usages
+	}
+	for _, stmt := range NewPackageParser(p).GetSQLStatements() {
+		for _, usage := range extractTableUsage(stmt.SQL) {
+			usage.TaskName = stmt.TaskName
+			usage.RefId = stmt.RefId
+			usages = append(usages, usage)
+		}
+	}
+	return usages
+}
+
+// GetReferencedTables returns the distinct tables referenced by SQL statements in
+// the package, in the order they are first seen
+func (p *Package) GetReferencedTables() []string {
+	var tables []string
+	seen := make(map[string]bool)
+	for _, usage := range p.getTableUsages() {
+		key := strings.ToLower(usage.Table)
+		if !seen[key] {
+			seen[key] = true
+			tables = append(tables, usage.Table)
+		}
+	}
+	return tables
+}
+
+// FindTableUsage returns each task that reads or writes the named table, classified
+// by operation. The name may be qualified (dbo.Orders) or not (Orders).
+func (p *Package) FindTableUsage(table string) []TableUsage {
+	var usages []TableUsage
+	for _, usage := range p.getTableUsages() {
+		if tableNameMatches(usage.Table, table) {
+			usages = append(usages, usage)
+		}
+	}
+	return usages
+}
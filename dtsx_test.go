@@ -1,9 +1,21 @@
 package dtsx_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/7045kHz/dtsx"
 	schema "github.com/7045kHz/dtsx/schemas"
@@ -73,6 +85,192 @@ func TestMarshalUnmarshal(t *testing.T) {
 	t.Logf("Successfully marshaled and unmarshaled package")
 }
 
+func TestMarshalSpecialCharacters(t *testing.T) {
+	description := `Loads "daily" sales & returns for Zürich; filter: Region="EU" <all>`
+	value := `SELECT 1 -- <Property Name="x"> & more`
+	pkg := &dtsx.Package{
+		DescriptionAttr: &description,
+		ObjectNameAttr:  stringPtr("Ünïcode & Co"),
+		ExecutableTypePackage: &schema.ExecutableTypePackage{
+			Property: []*schema.Property{{
+				NameAttr: stringPtr("Comment"),
+				PropertyElementBaseType: &schema.PropertyElementBaseType{
+					AnySimpleType: &schema.AnySimpleType{Value: value},
+				},
+			}},
+		},
+	}
+
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Failed to marshal package: %v", err)
+	}
+	xmlStr := string(data)
+	if !strings.Contains(xmlStr, `<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts"`) {
+		t.Errorf("Expected namespaced root element, got:\n%s", xmlStr)
+	}
+	if !strings.Contains(xmlStr, `DTS:Description="Loads &quot;daily&quot; sales &amp; returns`) {
+		t.Errorf("Expected escaped, prefixed Description attribute, got:\n%s", xmlStr)
+	}
+
+	pkg2, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal marshaled package: %v", err)
+	}
+	if pkg2.DescriptionAttr == nil || *pkg2.DescriptionAttr != description {
+		t.Errorf("Description did not round-trip: got %v", pkg2.DescriptionAttr)
+	}
+	if pkg2.ObjectNameAttr == nil || *pkg2.ObjectNameAttr != "Ünïcode & Co" {
+		t.Errorf("ObjectName did not round-trip: got %v", pkg2.ObjectNameAttr)
+	}
+	if len(pkg2.Property) != 1 || pkg2.Property[0].Value != value {
+		t.Errorf("Property value did not round-trip: got %+v", pkg2.Property)
+	}
+
+	// Re-marshaling the round-tripped package must be byte-identical
+	data2, err := dtsx.Marshal(pkg2)
+	if err != nil {
+		t.Fatalf("Failed to re-marshal package: %v", err)
+	}
+	if string(data2) != string(data) {
+		t.Errorf("Re-marshaled output differs:\n%s\n---\n%s", data, data2)
+	}
+}
+
+func TestMarshalPreservesSQLTaskObjectData(t *testing.T) {
+	const statement = `SQLTask:SqlStatementSource="UPDATE [dbo].[Orders] SET Status = &quot;Done&quot; WHERE Qty &gt; 0 &amp; Id &lt;&gt; 7"`
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="SqlTaskPackage">
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Update Orders" DTS:ExecutableType="Microsoft.ExecuteSQLTask" DTS:ObjectName="Update Orders">
+      <DTS:ObjectData>
+        <SQLTask:SqlTaskData SQLTask:Connection="{11111111-2222-3333-4444-555555555555}" ` + statement + ` xmlns:SQLTask="www.microsoft.com/sqlserver/dts/tasks/sqltask" />
+      </DTS:ObjectData>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Failed to unmarshal package: %v", err)
+	}
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Failed to marshal package: %v", err)
+	}
+	xmlStr := string(data)
+
+	if !strings.Contains(xmlStr, statement) {
+		t.Errorf("Expected SqlStatementSource to survive unchanged, got:\n%s", xmlStr)
+	}
+	if strings.Contains(xmlStr, "DTS:SQLTask") || strings.Contains(xmlStr, "<DTS:SqlTaskData") {
+		t.Errorf("SQLTask prefixes were rewritten:\n%s", xmlStr)
+	}
+	if strings.Count(xmlStr, "<SQLTask:SqlTaskData") != 1 {
+		t.Errorf("Expected exactly one SqlTaskData element, got:\n%s", xmlStr)
+	}
+
+	// The re-marshaled package still yields the statement
+	pkg2, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal re-marshaled package: %v", err)
+	}
+	statements := dtsx.NewPackageParser(pkg2).GetSQLStatements()
+	if len(statements) != 1 || !strings.Contains(statements[0].SQL, "UPDATE [dbo].[Orders]") {
+		t.Errorf("Expected the UPDATE statement after round-trip, got %+v", statements)
+	}
+}
+
+func TestUnmarshalStream(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("SSIS_EXAMPLES", "*.dtsx"))
+	if err != nil || len(files) == 0 {
+		t.Skip("No DTSX example files found in SSIS_EXAMPLES directory")
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		expected, err := dtsx.UnmarshalFromReader(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("UnmarshalFromReader(%s) failed: %v", file, err)
+		}
+		// iotest.OneByteReader exercises reads that split lines and prefixes
+		streamed, err := dtsx.UnmarshalStream(iotest.OneByteReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("UnmarshalStream(%s) failed: %v", file, err)
+		}
+		if !reflect.DeepEqual(expected, streamed) {
+			t.Errorf("UnmarshalStream(%s) result differs from UnmarshalFromReader", file)
+		}
+	}
+
+	if _, err := dtsx.UnmarshalStream(strings.NewReader("<DTS:Executable")); err == nil {
+		t.Error("Expected error for truncated XML")
+	}
+}
+
+func TestUnmarshalPreservesDTSText(t *testing.T) {
+	const sql = `SELECT 'Source DTS: legacy' AS Origin, Note FROM dbo.Log WHERE Note LIKE '% DTS:Property%'`
+	const connStr = `Data Source=.;Application Name=Loader DTS:Nightly;`
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="TextPackage">
+  <DTS:ConnectionManagers>
+    <DTS:ConnectionManager DTS:refId="Package.ConnectionManagers[Source]" DTS:ObjectName="Source">
+      <DTS:Property DTS:Name="ConnectionString">` + connStr + `</DTS:Property>
+    </DTS:ConnectionManager>
+  </DTS:ConnectionManagers>
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Query" DTS:ExecutableType="Microsoft.ExecuteSQLTask" DTS:ObjectName="Query">
+      <DTS:Property DTS:Name="SqlStatementSource">` + sql + `</DTS:Property>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`
+
+	for name, unmarshal := range map[string]func([]byte) (*dtsx.Package, error){
+		"Unmarshal":       dtsx.Unmarshal,
+		"UnmarshalStream": func(b []byte) (*dtsx.Package, error) { return dtsx.UnmarshalStream(bytes.NewReader(b)) },
+	} {
+		pkg, err := unmarshal([]byte(input))
+		if err != nil {
+			t.Fatalf("%s failed: %v", name, err)
+		}
+		if got := *pkg.ObjectNameAttr; got != "TextPackage" {
+			t.Errorf("%s: expected DTS:ObjectName to decode, got %q", name, got)
+		}
+		statements := dtsx.NewPackageParser(pkg).GetSQLStatements()
+		if len(statements) != 1 || statements[0].SQL != sql {
+			t.Errorf("%s: SQL statement not preserved verbatim, got %+v", name, statements)
+		}
+		if got := dtsx.GetConnectionString(pkg.ConnectionManagers.ConnectionManager[0]); got != connStr {
+			t.Errorf("%s: connection string not preserved verbatim, got %q", name, got)
+		}
+	}
+}
+
+func benchmarkUnmarshal(b *testing.B, unmarshal func(io.Reader) (*dtsx.Package, error)) {
+	data, err := os.ReadFile(filepath.Join("SSIS_EXAMPLES", "Loader.dtsx"))
+	if err != nil {
+		b.Skip("SSIS_EXAMPLES/Loader.dtsx not found")
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := unmarshal(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalFromReader(b *testing.B) {
+	benchmarkUnmarshal(b, dtsx.UnmarshalFromReader)
+}
+
+func BenchmarkUnmarshalStream(b *testing.B) {
+	benchmarkUnmarshal(b, dtsx.UnmarshalStream)
+}
+
 func TestIsDTSXPackage(t *testing.T) {
 	// Test with a valid DTSX file
 	files, err := os.ReadDir("SSIS_EXAMPLES")
@@ -186,6 +384,173 @@ func TestRunPackage(t *testing.T) {
 	})
 }
 
+func TestRunPackageContextCancel(t *testing.T) {
+	dtexec := fakeCommand(t, "exec sleep 30")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := dtsx.RunPackageContext(ctx, dtexec, "Load.dtsx", nil)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected RunPackageContext to return promptly, took %v", elapsed)
+	}
+}
+
+func TestRunPackageStreaming(t *testing.T) {
+	dtexec := fakeCommand(t, `echo "Started: $1 $2"
+echo "Progress: 50%" >&2
+printf 'Progress: 100%%\r\n'
+echo "DTExec: The package execution returned DTSER_SUCCESS (0)."`)
+
+	var lines []string
+	err := dtsx.RunPackageStreaming(dtexec, "Load.dtsx", nil, func(line string) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatalf("RunPackageStreaming failed: %v", err)
+	}
+	expected := []string{
+		"Started: /File Load.dtsx",
+		"Progress: 50%",
+		"Progress: 100%",
+		"DTExec: The package execution returned DTSER_SUCCESS (0).",
+	}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected lines %q, got %q", expected, lines)
+	}
+
+	failing := fakeCommand(t, "echo failed; exit 1")
+	if err := dtsx.RunPackageStreaming(failing, "Load.dtsx", nil, func(string) {}); err == nil {
+		t.Error("Expected an error for a non-zero exit code")
+	}
+}
+
+func TestRunPackageResult(t *testing.T) {
+	tests := []struct {
+		exitCode int
+		status   string
+	}{
+		{0, "Success"},
+		{1, "Failure"},
+		{3, "Cancelled"},
+		{4, "NotFound"},
+		{5, "LoadFailed"},
+		{6, "CommandLineError"},
+		{42, "Unknown"},
+	}
+
+	for _, tt := range tests {
+		dtexec := fakeCommand(t, fmt.Sprintf("echo exiting; exit %d", tt.exitCode))
+		result, err := dtsx.RunPackageResult(dtexec, "Load.dtsx", nil)
+		if err != nil {
+			t.Errorf("Exit code %d: RunPackageResult failed: %v", tt.exitCode, err)
+			continue
+		}
+		if result.ExitCode != tt.exitCode || result.Status != tt.status || result.Output != "exiting" {
+			t.Errorf("Exit code %d: expected status %s, got %+v", tt.exitCode, tt.status, result)
+		}
+		if result.Succeeded() != (tt.exitCode == 0) {
+			t.Errorf("Exit code %d: unexpected Succeeded() = %v", tt.exitCode, result.Succeeded())
+		}
+	}
+
+	if _, err := dtsx.RunPackageResult(filepath.Join(t.TempDir(), "missing"), "Load.dtsx", nil); err == nil {
+		t.Error("Expected an error when dtexec cannot be started")
+	}
+}
+
+func TestBuildDTExecArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     dtsx.RunOptions
+		expected []string
+	}{
+		{"Parameters", dtsx.RunOptions{Parameters: []string{"$Package::A;1", "$Project::B;2"}}, []string{"/Par", "$Package::A;1", "/Par", "$Project::B;2"}},
+		{"EnvironmentVars", dtsx.RunOptions{EnvironmentVars: []string{"STAGE=dev"}}, []string{"/Env", "STAGE=dev"}},
+		{"Connections", dtsx.RunOptions{Connections: []string{"Warehouse;Data Source=DW;"}}, []string{"/Conn", "Warehouse;Data Source=DW;"}},
+		{"ConfigFile", dtsx.RunOptions{ConfigFile: "prod.dtsConfig"}, []string{"/ConfigFile", "prod.dtsConfig"}},
+		{"PropertySets", dtsx.RunOptions{PropertySets: []string{`\Package.Variables[User::X].Value;5`}}, []string{"/Set", `\Package.Variables[User::X].Value;5`}},
+		{"DecryptPassword", dtsx.RunOptions{DecryptPassword: "secret"}, []string{"/Decrypt", "secret"}},
+		{"Server", dtsx.RunOptions{Server: "ETL01"}, []string{"/Server", "ETL01"}},
+		{"User", dtsx.RunOptions{User: "etl"}, []string{"/User", "etl"}},
+		{"Password", dtsx.RunOptions{Password: "pw"}, []string{"/Password", "pw"}},
+		{"Checkpointing", dtsx.RunOptions{Checkpointing: "on"}, []string{"/CheckPointing", "on"}},
+		{"CheckpointFile", dtsx.RunOptions{CheckpointFile: "load.chk"}, []string{"/CheckFile", "load.chk"}},
+		{"Restart", dtsx.RunOptions{Restart: "ifPossible"}, []string{"/Restart", "ifPossible"}},
+		{"MaxConcurrent", dtsx.RunOptions{MaxConcurrent: -1}, []string{"/MaxConcurrent", "-1"}},
+		{"Validate", dtsx.RunOptions{Validate: true}, []string{"/Validate"}},
+		{"WarnAsError", dtsx.RunOptions{WarnAsError: true}, []string{"/WarnAsError"}},
+		{"VerifyBuild", dtsx.RunOptions{VerifyBuild: "1;0;42"}, []string{"/VerifyBuild", "1;0;42"}},
+		{"VerifyPackageID", dtsx.RunOptions{VerifyPackageID: "{PKG}"}, []string{"/VerifyPackageID", "{PKG}"}},
+		{"VerifyVersionID", dtsx.RunOptions{VerifyVersionID: "{VER}"}, []string{"/VerifyVersionID", "{VER}"}},
+		{"VerifySigned", dtsx.RunOptions{VerifySigned: true}, []string{"/VerifySigned"}},
+		{"ReportingLevel", dtsx.RunOptions{ReportingLevel: "EW"}, []string{"/Reporting", "EW"}},
+		{"ConsoleLog", dtsx.RunOptions{ConsoleLog: []string{"NM"}}, []string{"/ConsoleLog", "NM"}},
+		{"Loggers", dtsx.RunOptions{Loggers: []string{"DTS.LogProviderTextFile;log.txt"}}, []string{"/Logger", "DTS.LogProviderTextFile;log.txt"}},
+		{"VerboseLog", dtsx.RunOptions{VerboseLog: "verbose.log"}, []string{"/VLog", "verbose.log"}},
+		{"DumpOnCodes", dtsx.RunOptions{DumpOnCodes: "0xC020801C"}, []string{"/Dump", "0xC020801C"}},
+		{"DumpOnError", dtsx.RunOptions{DumpOnError: true}, []string{"/DumpOnError"}},
+		{"X86", dtsx.RunOptions{X86: true}, []string{"/X86"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := dtsx.BuildDTExecArgs("Load.dtsx", &tt.opts)
+			expected := append([]string{"/File", "Load.dtsx"}, tt.expected...)
+			if !reflect.DeepEqual(args, expected) {
+				t.Errorf("Expected %q, got %q", expected, args)
+			}
+		})
+	}
+
+	// Every option is covered, either above or by TestBuildDTExecArgsModes
+	covered := map[string]bool{"ISServerPath": true, "SQLServerInstance": true}
+	for _, tt := range tests {
+		covered[tt.name] = true
+	}
+	optsType := reflect.TypeOf(dtsx.RunOptions{})
+	for i := 0; i < optsType.NumField(); i++ {
+		if name := optsType.Field(i).Name; !covered[name] {
+			t.Errorf("RunOptions.%s has no test case", name)
+		}
+	}
+
+	// Zero values add no flags
+	if args := dtsx.BuildDTExecArgs("Load.dtsx", &dtsx.RunOptions{}); !reflect.DeepEqual(args, []string{"/File", "Load.dtsx"}) {
+		t.Errorf("Expected only /File for empty options, got %q", args)
+	}
+}
+
+func TestBuildDTExecArgsModes(t *testing.T) {
+	fileArgs := dtsx.BuildDTExecArgs(`C:\packages\Load.dtsx`, &dtsx.RunOptions{Server: "ETL01"})
+	if expected := []string{"/File", `C:\packages\Load.dtsx`, "/Server", "ETL01"}; !reflect.DeepEqual(fileArgs, expected) {
+		t.Errorf("File mode: expected %q, got %q", expected, fileArgs)
+	}
+
+	catalogArgs := dtsx.BuildDTExecArgs(`C:\packages\Load.dtsx`, &dtsx.RunOptions{
+		ISServerPath:      `\SSISDB\ETL\Warehouse\Load.dtsx`,
+		SQLServerInstance: `SQL01\CATALOG`,
+		Server:            "ETL01",
+		Parameters:        []string{"$ServerOption::SYNCHRONIZED(Boolean);True"},
+	})
+	expected := []string{
+		"/ISServer", `\SSISDB\ETL\Warehouse\Load.dtsx`,
+		"/Par", "$ServerOption::SYNCHRONIZED(Boolean);True",
+		"/Server", `SQL01\CATALOG`,
+	}
+	if !reflect.DeepEqual(catalogArgs, expected) {
+		t.Errorf("Catalog mode: expected %q, got %q", expected, catalogArgs)
+	}
+
+	if args := dtsx.BuildDTExecArgs("Load.dtsx", nil); !reflect.DeepEqual(args, []string{"/File", "Load.dtsx"}) {
+		t.Errorf("Nil options: expected file mode, got %q", args)
+	}
+}
+
 func TestGetConnections(t *testing.T) {
 	// Test with a valid DTSX file
 	files, err := os.ReadDir("SSIS_EXAMPLES")
@@ -449,3 +814,3579 @@ func TestGetExpressions(t *testing.T) {
 		t.Errorf("Expected 0 expressions for nil package, got %d", nilResult.Count)
 	}
 }
+
+func TestGetConstraintStatus(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Count", "5", "int").
+		Build()
+
+	constraint := func(from, expression string) *schema.PrecedenceConstraintType {
+		return &schema.PrecedenceConstraintType{
+			Property: []*schema.Property{
+				{NameAttr: stringPtr("EvalOp"), PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: "1"}}},
+				{NameAttr: stringPtr("Expression"), PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: expression}}},
+			},
+			Executable: []*schema.PrecedenceConstraintExecutableReferenceType{{IDREFAttr: stringPtr(from)}},
+		}
+	}
+
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{RefIdAttr: stringPtr(`Package\Start`), ObjectNameAttr: stringPtr("Start")},
+		{
+			RefIdAttr:            stringPtr(`Package\Big`),
+			ObjectNameAttr:       stringPtr("Big"),
+			PrecedenceConstraint: []*schema.PrecedenceConstraintType{constraint(`Package\Start`, "@[User::Count] > 3")},
+		},
+		{
+			RefIdAttr:            stringPtr(`Package\Small`),
+			ObjectNameAttr:       stringPtr("Small"),
+			PrecedenceConstraint: []*schema.PrecedenceConstraintType{constraint(`Package\Start`, "@[User::Count] <= 3")},
+		},
+	}
+
+	statuses := pkg.GetConstraintStatus()
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 constraint statuses, got %d", len(statuses))
+	}
+
+	for _, status := range statuses {
+		if len(status.From) != 1 || status.From[0] != `Package\Start` {
+			t.Errorf("Unexpected From for %s: %v", status.To, status.From)
+		}
+		if status.EvalOp != "Expression" {
+			t.Errorf("Expected EvalOp Expression, got %s", status.EvalOp)
+		}
+		if status.Value != "Success" {
+			t.Errorf("Expected Value Success, got %s", status.Value)
+		}
+		switch status.To {
+		case `Package\Big`:
+			if !status.Active {
+				t.Errorf("Expected constraint into Big to be active: %+v", status)
+			}
+		case `Package\Small`:
+			if status.Active {
+				t.Errorf("Expected constraint into Small to be inactive: %+v", status)
+			}
+		default:
+			t.Errorf("Unexpected constraint target %s", status.To)
+		}
+	}
+}
+
+func TestFillMissingNames(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().Build()
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{RefIdAttr: stringPtr(`Package\Named`), ObjectNameAttr: stringPtr("Named")},
+		{RefIdAttr: stringPtr(`Package\Load Data`)},
+		{},
+	}
+
+	missing := pkg.GetExecutablesMissingName()
+	if len(missing) != 2 {
+		t.Fatalf("Expected 2 executables missing a name, got %d", len(missing))
+	}
+
+	warnings, errs := 0, 0
+	for _, v := range pkg.Validate() {
+		if strings.HasPrefix(v.Path, "Executables") && strings.Contains(v.Message, "name") {
+			switch v.Severity {
+			case "warning":
+				warnings++
+			case "error":
+				errs++
+			}
+		}
+	}
+	if warnings != 1 || errs != 1 {
+		t.Errorf("Expected 1 warning and 1 error for unnamed executables, got %d and %d", warnings, errs)
+	}
+
+	if filled := pkg.FillMissingNames(); filled != 1 {
+		t.Errorf("Expected 1 name filled, got %d", filled)
+	}
+	if name := dtsx.GetExecutableName(pkg.Executable[1]); name != "Load Data" {
+		t.Errorf("Expected filled name 'Load Data', got %s", name)
+	}
+	if len(pkg.GetExecutablesMissingName()) != 1 {
+		t.Errorf("Expected only the executable without refId to remain unnamed")
+	}
+}
+
+func TestExtractConstant(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Source", "OLEDB", "Data Source=PRODSQL01;Initial Catalog=Sales;").
+		AddConnection("Target", "OLEDB", "Data Source=PRODSQL01;Initial Catalog=Warehouse;").
+		AddConnection("Other", "OLEDB", "Data Source=DEVSQL;").
+		Build()
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{
+			RefIdAttr:      stringPtr(`Package\Audit`),
+			ObjectNameAttr: stringPtr("Audit"),
+			PropertyExpression: []*schema.PropertyExpressionElementType{
+				{NameAttr: "Description", AnySimpleType: &schema.AnySimpleType{Value: `"Loading from PRODSQL01"`}},
+			},
+		},
+	}
+
+	replaced, err := pkg.ExtractConstant("PRODSQL01", "User::ServerName")
+	if err != nil {
+		t.Fatalf("ExtractConstant failed: %v", err)
+	}
+	if replaced != 3 {
+		t.Errorf("Expected 3 replacements, got %d", replaced)
+	}
+
+	v, err := pkg.GetVariableByName("User::ServerName")
+	if err != nil {
+		t.Fatalf("Expected new variable: %v", err)
+	}
+	if dtsx.GetVariableValue(v) != "PRODSQL01" {
+		t.Errorf("Expected variable value PRODSQL01, got %s", dtsx.GetVariableValue(v))
+	}
+
+	if got := pkg.Executable[0].PropertyExpression[0].Value; got != `"Loading from " + @[User::ServerName]` {
+		t.Errorf("Unexpected rewritten expression: %s", got)
+	}
+
+	source := pkg.ConnectionManagers.ConnectionManager[0]
+	if len(source.PropertyExpression) != 1 {
+		t.Fatalf("Expected a ConnectionString expression on Source")
+	}
+	expected := `"Data Source=" + @[User::ServerName] + ";Initial Catalog=Sales;"`
+	if got := source.PropertyExpression[0].Value; got != expected {
+		t.Errorf("Expected %s, got %s", expected, got)
+	}
+	result, err := dtsx.EvaluateExpression(source.PropertyExpression[0].Value, pkg)
+	if err != nil || result != "Data Source=PRODSQL01;Initial Catalog=Sales;" {
+		t.Errorf("Rewritten expression evaluated to %v (err %v)", result, err)
+	}
+
+	if len(pkg.ConnectionManagers.ConnectionManager[2].PropertyExpression) != 0 {
+		t.Error("Expected connection without the value to be left alone")
+	}
+
+	if _, err := pkg.ExtractConstant("PRODSQL01", "ServerName"); err == nil {
+		t.Error("Expected error when the variable already exists")
+	}
+}
+
+func TestExtractConstantNested(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().Build()
+	pkg.Variables = &schema.VariablesType{Variable: []*schema.VariableType{
+		{
+			NamespaceAttr:            stringPtr("User"),
+			ObjectNameAttr:           stringPtr("Path"),
+			EvaluateAsExpressionAttr: stringPtr("True"),
+			ExpressionAttr:           stringPtr(`"\\\\FILESRV01\\drop\\" + @[User::File]`),
+		},
+	}}
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{
+			RefIdAttr:      stringPtr(`Package\Loop`),
+			ObjectNameAttr: stringPtr("Loop"),
+			Executables: []*schema.AnyNonPackageExecutableType{
+				{
+					RefIdAttr:      stringPtr(`Package\Loop\Copy`),
+					ObjectNameAttr: stringPtr("Copy"),
+					PropertyExpression: []*schema.PropertyExpressionElementType{
+						{NameAttr: "Description", AnySimpleType: &schema.AnySimpleType{Value: `"Copy from FILESRV01"`}},
+					},
+				},
+			},
+		},
+	}
+
+	replaced, err := pkg.ExtractConstant("FILESRV01", "User::FileServer")
+	if err != nil {
+		t.Fatalf("ExtractConstant failed: %v", err)
+	}
+	if replaced != 2 {
+		t.Errorf("Expected 2 replacements, got %d", replaced)
+	}
+	if got := pkg.Executable[0].Executables[0].PropertyExpression[0].Value; got != `"Copy from " + @[User::FileServer]` {
+		t.Errorf("Unexpected nested task expression: %s", got)
+	}
+	if got := *pkg.Variables.Variable[0].ExpressionAttr; got != `"\\\\" + @[User::FileServer] + "\\drop\\" + @[User::File]` {
+		t.Errorf("Unexpected variable expression: %s", got)
+	}
+}
+
+func TestToYAML(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "BatchSize", "500").
+		AddVariable("User", "Source", "Sales").
+		AddConnection("Warehouse", "OLEDB", "Data Source=DW;").
+		Build()
+	pkg.ObjectNameAttr = stringPtr("LoadSales")
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{RefIdAttr: stringPtr(`Package\Extract`), ObjectNameAttr: stringPtr("Extract"), ExecutableTypeAttr: "Microsoft.ExecuteSQLTask"},
+		{
+			RefIdAttr:          stringPtr(`Package\Load`),
+			ObjectNameAttr:     stringPtr("Load"),
+			ExecutableTypeAttr: "Microsoft.Pipeline",
+			PrecedenceConstraint: []*schema.PrecedenceConstraintType{
+				{Executable: []*schema.PrecedenceConstraintExecutableReferenceType{{IDREFAttr: stringPtr(`Package\Extract`)}}},
+			},
+		},
+	}
+
+	first, err := pkg.ToYAML()
+	if err != nil {
+		t.Fatalf("ToYAML failed: %v", err)
+	}
+	yaml := string(first)
+	for _, want := range []string{
+		"package:\n  name: \"LoadSales\"",
+		"variables:\n  - name: \"User::BatchSize\"",
+		"connections:\n  - name: \"Warehouse\"",
+		"tasks:\n  - name: \"Extract\"",
+		"    order: 2\n    dependsOn:\n      - \"Package\\\\Extract\"",
+	} {
+		if !strings.Contains(yaml, want) {
+			t.Errorf("Expected YAML to contain %q, got:\n%s", want, yaml)
+		}
+	}
+
+	for i := 0; i < 5; i++ {
+		again, err := pkg.ToYAML()
+		if err != nil {
+			t.Fatalf("ToYAML failed: %v", err)
+		}
+		if string(again) != yaml {
+			t.Fatalf("ToYAML output is not deterministic:\n%s\nvs\n%s", yaml, string(again))
+		}
+	}
+}
+
+func TestToYAMLVariableExpressions(t *testing.T) {
+	pkg, err := dtsx.UnmarshalFromFile(filepath.Join("SSIS_EXAMPLES", "Expressions.dtsx"))
+	if err != nil {
+		t.Skipf("Expressions.dtsx not available: %v", err)
+	}
+	out, err := pkg.ToYAML()
+	if err != nil {
+		t.Fatalf("ToYAML failed: %v", err)
+	}
+	if !strings.Contains(string(out), `expression: "\"Data Source=\"+ @[User::DB_NAME]`) {
+		t.Errorf("Expected the DB_CS expression in the YAML, got:\n%s", out)
+	}
+}
+
+func TestAnalyzeJSON(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "BatchSize", "500").
+		AddVariable("User", "Source", "Sales").
+		AddConnection("Warehouse", "OLEDB", "Data Source=DW;Provider=SQLNCLI11.1;").
+		AddConnectionExpression("Warehouse", "ConnectionString", `"Data Source=" + @[User::Source]`).
+		AddSQLTask("Extract", "Warehouse", "SELECT * FROM dbo.Sales").
+		AddExecutable("Load", "Microsoft.Pipeline").
+		AddPrecedenceConstraint("Extract", "Load", "Success").
+		Build()
+
+	data, err := pkg.AnalyzeJSON()
+	if err != nil {
+		t.Fatalf("AnalyzeJSON failed: %v", err)
+	}
+
+	var analysis dtsx.PackageAnalysis
+	if err := json.Unmarshal(data, &analysis); err != nil {
+		t.Fatalf("Failed to decode analysis JSON: %v\n%s", err, data)
+	}
+	if len(analysis.Variables) != 2 || analysis.Variables[0].Name != "User::BatchSize" {
+		t.Errorf("Expected 2 variables starting with User::BatchSize, got %+v", analysis.Variables)
+	}
+	if len(analysis.Connections) != 1 || analysis.Connections[0].Name != "Warehouse" {
+		t.Errorf("Expected the Warehouse connection, got %+v", analysis.Connections)
+	}
+	if len(analysis.SQLStatements) != 1 || analysis.SQLStatements[0].Dialect != "mssql" {
+		t.Errorf("Expected 1 mssql statement, got %+v", analysis.SQLStatements)
+	}
+	if len(analysis.Expressions) != 1 {
+		t.Errorf("Expected 1 expression, got %+v", analysis.Expressions)
+	}
+	if len(analysis.Tasks) != 2 || analysis.Tasks[0].Order != 1 || analysis.Tasks[1].Order != 2 {
+		t.Fatalf("Expected Extract then Load, got %+v", analysis.Tasks)
+	}
+	if deps := analysis.Tasks[1].DependsOn; len(deps) != 1 || deps[0] != `Package\Extract` {
+		t.Errorf("Expected Load to depend on Extract, got %v", deps)
+	}
+
+	// Empty lists are written as [] so consumers need not handle null
+	empty, err := dtsx.NewPackageBuilder().Build().AnalyzeJSON()
+	if err != nil {
+		t.Fatalf("AnalyzeJSON failed: %v", err)
+	}
+	if !strings.Contains(string(empty), `"sqlStatements": []`) {
+		t.Errorf("Expected empty sqlStatements list, got:\n%s", empty)
+	}
+}
+
+func TestAnalyzeJSONVariableExpressions(t *testing.T) {
+	pkg, err := dtsx.UnmarshalFromFile(filepath.Join("SSIS_EXAMPLES", "Expressions.dtsx"))
+	if err != nil {
+		t.Skipf("Expressions.dtsx not available: %v", err)
+	}
+	data, err := pkg.AnalyzeJSON()
+	if err != nil {
+		t.Fatalf("AnalyzeJSON failed: %v", err)
+	}
+	var analysis dtsx.PackageAnalysis
+	if err := json.Unmarshal(data, &analysis); err != nil {
+		t.Fatalf("Failed to decode analysis JSON: %v", err)
+	}
+
+	expected := map[string]string{
+		"User::CSV_LOCATION": `@[User::CSV_DIRECTORY] +"\\"+ @[User::CSV_FILENAME]`,
+		"User::DB_CS":        `"Data Source="+ @[User::DB_NAME] +";Initial Catalog=PROTO;Provider=MSOLEDBSQL.1;Integrated Security=SSPI;Auto Translate=False;"`,
+	}
+	for _, v := range analysis.Variables {
+		if want, ok := expected[v.Name]; ok {
+			if v.Expression != want {
+				t.Errorf("Expected %s expression %q, got %q", v.Name, want, v.Expression)
+			}
+			delete(expected, v.Name)
+		}
+	}
+	for name := range expected {
+		t.Errorf("Variable %s missing from the analysis", name)
+	}
+}
+
+func TestValidateFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "input.csv")
+	if err := os.WriteFile(existing, []byte("a,b\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	missing := filepath.Join(dir, "missing.csv")
+
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Input", "FLATFILE", existing).
+		AddConnection("Output", "FLATFILE", missing).
+		AddConnection("Dynamic", "FLATFILE", filepath.Join(dir, "also-missing.csv")).
+		AddConnectionExpression("Dynamic", "ConnectionString", `@[User::Dir] + "\\out.csv"`).
+		AddConnection("Database", "OLEDB", "Data Source=DW;").
+		Build()
+
+	warnings := dtsx.ValidateFilesystem(pkg)
+	if len(warnings) != 1 {
+		t.Fatalf("Expected 1 warning, got %d: %+v", len(warnings), warnings)
+	}
+	if warnings[0].Path != "ConnectionManagers.Output" || warnings[0].Severity != "warning" {
+		t.Errorf("Unexpected warning: %+v", warnings[0])
+	}
+	if !strings.Contains(warnings[0].Message, missing) {
+		t.Errorf("Expected message to mention %s, got %s", missing, warnings[0].Message)
+	}
+}
+
+func TestGetReferencedParameters(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "Server", "localhost").
+		AddConnection("Warehouse", "OLEDB", "Data Source=DW;").
+		AddConnectionExpression("Warehouse", "ConnectionString", `"Data Source=" + @[$Project::Env] + "-sql;Initial Catalog=" + @[$Package::Database]`).
+		AddConnectionExpression("Warehouse", "ServerName", `@[$Project::Env] + @[User::Server]`).
+		Build()
+
+	params := pkg.GetReferencedParameters()
+	expected := []string{"$Project::Env", "$Package::Database"}
+	if len(params) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, params)
+	}
+	for i, want := range expected {
+		if params[i] != want {
+			t.Errorf("Expected parameter %d to be %s, got %s", i, want, params[i])
+		}
+	}
+}
+
+func TestGetDetailedFlow(t *testing.T) {
+	sqlProp := func(sql string) []*schema.Property {
+		return []*schema.Property{
+			{NameAttr: stringPtr("SqlStatementSource"), PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: sql}}},
+		}
+	}
+
+	pkg := dtsx.NewPackageBuilder().Build()
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{
+			RefIdAttr:          stringPtr(`Package\Truncate Staging`),
+			ObjectNameAttr:     stringPtr("Truncate Staging"),
+			ExecutableTypeAttr: "Microsoft.ExecuteSQLTask",
+			Property:           sqlProp("TRUNCATE TABLE dbo.Staging"),
+			PropertyExpression: []*schema.PropertyExpressionElementType{
+				{NameAttr: "Connection", AnySimpleType: &schema.AnySimpleType{Value: "@[ConnectionManager::Warehouse]"}},
+			},
+		},
+		{
+			RefIdAttr:          stringPtr(`Package\Merge`),
+			ObjectNameAttr:     stringPtr("Merge"),
+			ExecutableTypeAttr: "Microsoft.ExecuteSQLTask",
+			Property:           sqlProp("EXEC dbo.MergeStaging @BatchSize = 1000, @Mode = 'full', @Verbose = 1, @IncludeArchivedRows = 0"),
+			PrecedenceConstraint: []*schema.PrecedenceConstraintType{
+				{Executable: []*schema.PrecedenceConstraintExecutableReferenceType{{IDREFAttr: stringPtr(`Package\Truncate Staging`)}}},
+			},
+		},
+	}
+
+	analyzer := dtsx.NewPrecedenceAnalyzer(pkg)
+	flow := analyzer.GetDetailedFlow(dtsx.NewPackageParser(pkg))
+
+	lines := strings.Split(flow, "\n")
+	taskLine := func(name string) int {
+		for i, line := range lines {
+			if strings.HasPrefix(line, "Task ") && strings.Contains(line, name) {
+				return i
+			}
+		}
+		t.Fatalf("Task %s not found in flow:\n%s", name, flow)
+		return -1
+	}
+
+	i := taskLine("Truncate Staging")
+	if !strings.HasPrefix(lines[0], "Detailed Execution Flow") || !strings.HasPrefix(lines[i], "Task 1:") {
+		t.Errorf("Expected Truncate Staging to run first:\n%s", flow)
+	}
+	if lines[i+1] != "    SQL: TRUNCATE TABLE dbo.Staging" {
+		t.Errorf("Expected SQL under Truncate Staging, got %q", lines[i+1])
+	}
+	if lines[i+2] != "    Connections: Warehouse" {
+		t.Errorf("Expected connections under Truncate Staging, got %q", lines[i+2])
+	}
+
+	j := taskLine("Merge")
+	if !strings.HasPrefix(lines[j], "Task 2:") {
+		t.Errorf("Expected Merge to run second:\n%s", flow)
+	}
+	if !strings.HasPrefix(lines[j+1], "    SQL: EXEC dbo.MergeStaging") || !strings.HasSuffix(lines[j+1], "...") {
+		t.Errorf("Expected truncated SQL under Merge, got %q", lines[j+1])
+	}
+}
+
+func TestGetDetailedFlowWithCycle(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddExecutable("A", "Microsoft.ExecuteSQLTask").
+		AddExecutable("B", "Microsoft.ExecuteSQLTask").
+		AddPrecedenceConstraint("A", "B", "Success").
+		AddPrecedenceConstraint("B", "A", "Success").
+		Build()
+
+	analyzer := dtsx.NewPrecedenceAnalyzer(pkg)
+	_, err := analyzer.GetExecutionOrder(`Package\A`)
+	if err == nil || !strings.Contains(err.Error(), `Package\A -> Package\B -> Package\A`) {
+		t.Errorf("Expected the cycle path in the error, got %v", err)
+	}
+	if _, err := analyzer.GetAllExecutionOrders(); err == nil {
+		t.Error("Expected GetAllExecutionOrders to report the cycle")
+	}
+
+	flow := analyzer.GetDetailedFlow(dtsx.NewPackageParser(pkg))
+	if !strings.HasPrefix(flow, "Error calculating execution order: circular dependency detected") {
+		t.Errorf("Expected the flow to report the cycle, got:\n%s", flow)
+	}
+}
+
+func TestPreviewUpdate(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "BatchSize", "500").
+		Build()
+
+	oldValue, willApply, err := pkg.PreviewUpdate("variable", "User::BatchSize", "Value", "1000")
+	if err != nil {
+		t.Fatalf("PreviewUpdate failed: %v", err)
+	}
+	if oldValue != "500" || !willApply {
+		t.Errorf("Expected old value 500 and willApply, got %q and %v", oldValue, willApply)
+	}
+
+	v, _ := pkg.GetVariableByName("User::BatchSize")
+	if got := dtsx.GetVariableValue(v); got != "500" {
+		t.Errorf("PreviewUpdate modified the package: value is %s", got)
+	}
+
+	if _, willApply, err := pkg.PreviewUpdate("variable", "User::Missing", "Value", "1"); willApply || err == nil {
+		t.Errorf("Expected preview of a missing variable to fail, got willApply=%v err=%v", willApply, err)
+	}
+	if _, willApply, err := pkg.PreviewUpdate("widget", "x", "Value", "1"); willApply || err == nil {
+		t.Errorf("Expected unsupported target type to fail, got willApply=%v err=%v", willApply, err)
+	}
+
+	// A package property that does not exist yet would be created
+	oldValue, willApply, err = pkg.PreviewUpdate("package", "", "Description", "Nightly load")
+	if err != nil || !willApply || oldValue != "" {
+		t.Errorf("Expected new package property to apply with empty old value, got %q, %v, %v", oldValue, willApply, err)
+	}
+	if len(pkg.Property) != 0 {
+		t.Errorf("PreviewUpdate added a package property")
+	}
+}
+
+func TestDataflowComplexity(t *testing.T) {
+	input := &schema.PipelineComponentInputsType{Input: []*schema.PipelineComponentInputType{{}}}
+	output := &schema.PipelineComponentOutputsType{Output: []*schema.PipelineComponentOutputType{{}}}
+	isError := true
+	errorOnly := &schema.PipelineComponentOutputsType{Output: []*schema.PipelineComponentOutputType{{IsErrorOutAttr: &isError}}}
+
+	pkg := dtsx.NewPackageBuilder().Build()
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{RefIdAttr: stringPtr(`Package\Prepare`), ObjectNameAttr: stringPtr("Prepare")},
+		{
+			RefIdAttr:          stringPtr(`Package\Load Orders`),
+			ObjectNameAttr:     stringPtr("Load Orders"),
+			ExecutableTypeAttr: "Microsoft.Pipeline",
+			ObjectData: &schema.ExecutableObjectDataType{
+				Pipeline: &schema.PipelineObjectDataType{
+					Components: &schema.PipelineComponentsType{
+						Component: []*schema.PipelineComponentType{
+							{NameAttr: stringPtr("Source"), Outputs: output},
+							{NameAttr: stringPtr("Derived Column"), Inputs: input, Outputs: output},
+							{NameAttr: stringPtr("Lookup"), Inputs: input, Outputs: output},
+							{NameAttr: stringPtr("Destination"), Inputs: input, Outputs: errorOnly},
+						},
+					},
+					Paths: &schema.PipelinePathsType{
+						Path: []*schema.PipelinePathType{{}, {}, {}},
+					},
+				},
+			},
+		},
+	}
+
+	scores := pkg.DataflowComplexity()
+	if len(scores) != 1 {
+		t.Fatalf("Expected 1 data flow, got %d", len(scores))
+	}
+	df := scores[0]
+	if df.Name != "Load Orders" || df.Components != 4 || df.Paths != 3 || df.Transforms != 2 {
+		t.Errorf("Unexpected counts: %+v", df)
+	}
+	if df.Score != 9 {
+		t.Errorf("Expected score 9, got %d", df.Score)
+	}
+
+	if suggestions := pkg.GetDataflowSuggestions(3); len(suggestions) != 1 {
+		t.Errorf("Expected 1 suggestion above threshold 3, got %d", len(suggestions))
+	}
+	if suggestions := pkg.GetDataflowSuggestions(4); len(suggestions) != 0 {
+		t.Errorf("Expected no suggestions at threshold 4, got %d", len(suggestions))
+	}
+}
+
+func TestDataflowComplexityInContainers(t *testing.T) {
+	components := &schema.PipelineComponentsType{Component: []*schema.PipelineComponentType{
+		{NameAttr: stringPtr("Source")},
+		{NameAttr: stringPtr("Destination")},
+	}}
+	pkg := dtsx.NewPackageBuilder().Build()
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{
+			RefIdAttr:          stringPtr(`Package\Each File`),
+			ObjectNameAttr:     stringPtr("Each File"),
+			ExecutableTypeAttr: "Microsoft.ForEachLoop",
+			Executables: []*schema.AnyNonPackageExecutableType{
+				{
+					RefIdAttr:          stringPtr(`Package\Each File\Load File`),
+					ObjectNameAttr:     stringPtr("Load File"),
+					ExecutableTypeAttr: "Microsoft.Pipeline",
+					Property: []*schema.Property{
+						{NameAttr: stringPtr("Connection"), PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: "Staging"}}},
+					},
+					ObjectData: &schema.ExecutableObjectDataType{
+						Pipeline: &schema.PipelineObjectDataType{Components: components},
+					},
+				},
+			},
+		},
+	}
+
+	scores := pkg.DataflowComplexity()
+	if len(scores) != 1 || scores[0].RefId != `Package\Each File\Load File` || scores[0].Components != 2 {
+		t.Fatalf("Expected the nested data flow to be scored, got %+v", scores)
+	}
+	if suggestions := pkg.GetDataflowSuggestions(1); len(suggestions) != 1 {
+		t.Errorf("Expected the nested data flow to be flagged, got %v", suggestions)
+	}
+
+	graph := pkg.BuildDependencyGraph()
+	if users := graph.ConnectionDependencies["Staging"]; len(users) != 1 || users[0] != "Executable[1] (Microsoft.Pipeline)" {
+		t.Errorf("Expected the nested task to depend on Staging, got %v", users)
+	}
+}
+
+func TestFindTableUsage(t *testing.T) {
+	sqlTask := func(name, sql string) *schema.AnyNonPackageExecutableType {
+		return &schema.AnyNonPackageExecutableType{
+			RefIdAttr:          stringPtr(`Package\` + name),
+			ObjectNameAttr:     stringPtr(name),
+			ExecutableTypeAttr: "Microsoft.ExecuteSQLTask",
+			Property: []*schema.Property{
+				{NameAttr: stringPtr("SqlStatementSource"), PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: sql}}},
+			},
+		}
+	}
+
+	pkg := dtsx.NewPackageBuilder().Build()
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		sqlTask("Load", "INSERT INTO [dbo].[Orders] (Id, Total) SELECT Id, Total FROM staging.Orders s JOIN dbo.Customers c ON c.Id = s.CustomerId"),
+		sqlTask("Report", "SELECT COUNT(*) FROM dbo.Orders WHERE Status = 'DELETE FROM dbo.Orders'"),
+		sqlTask("Purge", "DELETE FROM dbo.Orders WHERE Total = 0; UPDATE dbo.Customers SET Active = 0"),
+	}
+
+	tables := pkg.GetReferencedTables()
+	expectedTables := []string{"dbo.Orders", "staging.Orders", "dbo.Customers"}
+	if strings.Join(tables, ",") != strings.Join(expectedTables, ",") {
+		t.Errorf("Expected tables %v, got %v", expectedTables, tables)
+	}
+
+	usages := pkg.FindTableUsage("dbo.Orders")
+	if len(usages) != 3 {
+		t.Fatalf("Expected 3 usages of dbo.Orders, got %d: %+v", len(usages), usages)
+	}
+	expected := []struct {
+		task      string
+		operation string
+		write     bool
+	}{
+		{"Load", "INSERT", true},
+		{"Report", "SELECT", false},
+		{"Purge", "DELETE", true},
+	}
+	for i, want := range expected {
+		got := usages[i]
+		if got.TaskName != want.task || got.Operation != want.operation || got.Write != want.write {
+			t.Errorf("Usage %d: expected %s %s (write=%v), got %s %s (write=%v)", i, want.task, want.operation, want.write, got.TaskName, got.Operation, got.Write)
+		}
+	}
+
+	// Unqualified names match any schema
+	if n := len(pkg.FindTableUsage("orders")); n != 4 {
+		t.Errorf("Expected 4 usages of unqualified orders, got %d", n)
+	}
+	if n := len(pkg.FindTableUsage("dbo.Customers")); n != 2 {
+		t.Errorf("Expected 2 usages of dbo.Customers, got %d", n)
+	}
+}
+
+func TestPackageBuilderValidate(t *testing.T) {
+	pb := dtsx.NewPackageBuilder().
+		AddVariable("User", "Counter", "0").
+		AddConnection("Source", "OLEDB", "Data Source=.;Initial Catalog=Sales")
+
+	if errs := pb.Validate(); len(errs) != 0 {
+		t.Fatalf("Expected no validation errors, got %+v", errs)
+	}
+
+	pb.AddConnection("Source", "OLEDB", "")
+	errs := pb.Validate()
+
+	var duplicate, missingConnStr bool
+	for _, e := range errs {
+		if e.Severity == "error" && e.Message == "Duplicate connection manager name: Source" {
+			duplicate = true
+		}
+		if strings.Contains(e.Message, "connection string") && e.Path == "ConnectionManagers.Source" {
+			missingConnStr = true
+		}
+	}
+	if !duplicate {
+		t.Errorf("Expected duplicate connection error, got %+v", errs)
+	}
+	if !missingConnStr {
+		t.Errorf("Expected missing connection string issue, got %+v", errs)
+	}
+
+	// The builder stays usable after validating
+	if pkg := pb.AddVariable("User", "Other", "x").Build(); len(pkg.Variables.Variable) != 2 {
+		t.Errorf("Expected 2 variables after continuing the chain, got %d", len(pkg.Variables.Variable))
+	}
+}
+
+func TestNormalizeRefId(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{`Package.ConnectionManagers[Source DB]`, `Package\ConnectionManagers\Source DB`},
+		{`Package.ConnectionManagers[Source DB]`, `Package\ConnectionManagers[Source DB]`},
+		{`Package\Load Sales`, `Package.Load Sales`},
+		{`Package\Loop\Load Sales`, `Package/Loop/Load Sales`},
+		{`Package\Data Flow.Outputs[OLE DB Source Output]`, `Package\Data Flow\Outputs\OLE DB Source Output`},
+	}
+	for _, tt := range tests {
+		if got, want := dtsx.NormalizeRefId(tt.a), dtsx.NormalizeRefId(tt.b); got != want {
+			t.Errorf("NormalizeRefId(%q) = %q, want %q (from %q)", tt.a, got, want, tt.b)
+		}
+	}
+
+	if got := dtsx.NormalizeRefId(`Package.ConnectionManagers[Server.Db\Inst]`); got != `Package\ConnectionManagers\Server.Db\Inst` {
+		t.Errorf("Expected bracketed name to be kept intact, got %q", got)
+	}
+
+	pkg := &dtsx.Package{
+		ExecutableTypePackage: &schema.ExecutableTypePackage{
+			ConnectionManagers: &schema.ConnectionManagersType{
+				ConnectionManager: []*schema.ConnectionManagerType{{
+					RefIdAttr:      stringPtr("Package.ConnectionManagers[Source DB]"),
+					ObjectNameAttr: stringPtr("Source DB"),
+				}},
+			},
+			Executable: []*schema.AnyNonPackageExecutableType{{
+				RefIdAttr:      stringPtr(`Package\Load Sales`),
+				ObjectNameAttr: stringPtr("Load Sales"),
+			}},
+		},
+	}
+	parser := dtsx.NewPackageParser(pkg)
+
+	for _, refId := range []string{`Package\Load Sales`, `Package.Load Sales`} {
+		exec, err := parser.GetExecutable(refId)
+		if err != nil {
+			t.Errorf("GetExecutable(%q) failed: %v", refId, err)
+			continue
+		}
+		if *exec.ObjectNameAttr != "Load Sales" {
+			t.Errorf("GetExecutable(%q) returned %q", refId, *exec.ObjectNameAttr)
+		}
+	}
+	for _, id := range []string{"Package.ConnectionManagers[Source DB]", `Package\ConnectionManagers\Source DB`, "Source DB"} {
+		if _, err := parser.GetConnectionManager(id); err != nil {
+			t.Errorf("GetConnectionManager(%q) failed: %v", id, err)
+		}
+	}
+	if _, err := parser.GetExecutable(`Package\Missing`); err == nil {
+		t.Error("Expected error for unknown executable")
+	}
+}
+
+func TestGetParameters(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Params">
+  <DTS:PackageParameters>
+    <DTS:PackageParameter DTS:ObjectName="BatchSize" DTS:DataType="3" DTS:Required="True">
+      <DTS:Property DTS:DataType="3" DTS:Name="ParameterValue">500</DTS:Property>
+    </DTS:PackageParameter>
+    <DTS:PackageParameter DTS:ObjectName="Region" DTS:DataType="8">
+      <DTS:Property DTS:DataType="8" DTS:Name="ParameterValue">West</DTS:Property>
+    </DTS:PackageParameter>
+  </DTS:PackageParameters>
+</DTS:Executable>`)
+
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	result := pkg.GetParameters()
+	if result.Count != 2 {
+		t.Fatalf("Expected 2 parameters, got %d", result.Count)
+	}
+	params := result.Results.([]*dtsx.PackageParameterType)
+	if got := dtsx.GetParameterName(params[0]); got != "$Package::BatchSize" {
+		t.Errorf("Expected $Package::BatchSize, got %s", got)
+	}
+	if got := dtsx.GetParameterValue(params[1]); got != "West" {
+		t.Errorf("Expected West, got %s", got)
+	}
+
+	for _, name := range []string{"$Package::Region", "Package::Region", "Region"} {
+		param, err := pkg.GetParameterByName(name)
+		if err != nil {
+			t.Errorf("GetParameterByName(%s) failed: %v", name, err)
+			continue
+		}
+		if *param.ObjectNameAttr != "Region" {
+			t.Errorf("GetParameterByName(%s) returned %s", name, *param.ObjectNameAttr)
+		}
+	}
+	if _, err := pkg.GetParameterByName("$Project::Region"); err == nil {
+		t.Error("Expected project parameters not to be found in the package")
+	}
+	if _, err := pkg.GetParameterByName("$Package::Missing"); err == nil {
+		t.Error("Expected error for missing parameter")
+	}
+
+	// A package without parameters returns an empty result
+	empty := dtsx.NewPackageBuilder().Build()
+	if empty.GetParameters().Count != 0 {
+		t.Error("Expected no parameters on a new package")
+	}
+}
+
+func TestGetConfigurations(t *testing.T) {
+	pkg, err := dtsx.UnmarshalFromFile(filepath.Join("SSIS_EXAMPLES", "ConfigTables.dtsx"))
+	if err != nil {
+		t.Skipf("ConfigTables.dtsx not available: %v", err)
+	}
+	result := pkg.GetConfigurations()
+	if result.Count != 2 {
+		t.Fatalf("Expected 2 configurations, got %d", result.Count)
+	}
+	configs := result.Results.([]*dtsx.ConfigurationType)
+	sqlCfg, err := dtsx.ResolveConfiguration(configs[1])
+	if err != nil {
+		t.Fatalf("ResolveConfiguration failed: %v", err)
+	}
+	if sqlCfg.Name != "ConfigTable" || sqlCfg.Type != "SqlServer" || !strings.Contains(sqlCfg.Source, "[dbo].[SSIS Configurations]") {
+		t.Errorf("Unexpected SQL Server configuration: %+v", sqlCfg)
+	}
+
+	// A configuration file on disk, referenced directly and through an environment variable
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "Colors.dtsConfig")
+	configXML := `<?xml version="1.0"?>
+<DTSConfiguration>
+  <Configuration ConfiguredType="Property" Path="\Package.Variables[User::Color].Properties[Value]" ValueType="String">
+    <ConfiguredValue>Red</ConfiguredValue>
+  </Configuration>
+  <Configuration ConfiguredType="Property" Path="\Package.Connections[Source].Properties[ConnectionString]" ValueType="String">
+    <ConfiguredValue>Data Source=.;Initial Catalog=Colors</ConfiguredValue>
+  </Configuration>
+</DTSConfiguration>`
+	if err := os.WriteFile(configPath, []byte(configXML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DTSX_TEST_CONFIG", configPath)
+	t.Setenv("DTSX_TEST_REGION", "West")
+
+	data := []byte(`<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Configured">
+  <DTS:Configurations>
+    <DTS:Configuration DTS:ConfigurationString="` + configPath + `" DTS:ConfigurationType="1" DTS:ObjectName="Direct" />
+    <DTS:Configuration DTS:ConfigurationString="DTSX_TEST_CONFIG" DTS:ConfigurationType="5" DTS:ObjectName="Indirect" />
+    <DTS:Configuration DTS:ConfigurationString="DTSX_TEST_REGION" DTS:ConfigurationType="2" DTS:ConfigurationVariable="\Package.Variables[User::Region].Properties[Value]" DTS:ObjectName="Env" />
+  </DTS:Configurations>
+</DTS:Executable>`)
+	pkg, err = dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	configs = pkg.GetConfigurations().Results.([]*dtsx.ConfigurationType)
+	if len(configs) != 3 {
+		t.Fatalf("Expected 3 configurations, got %d", len(configs))
+	}
+
+	for _, cfg := range configs[:2] {
+		resolved, err := dtsx.ResolveConfiguration(cfg)
+		if err != nil {
+			t.Fatalf("ResolveConfiguration(%s) failed: %v", *cfg.ObjectNameAttr, err)
+		}
+		if resolved.Source != configPath {
+			t.Errorf("%s: expected source %s, got %s", resolved.Name, configPath, resolved.Source)
+		}
+		if len(resolved.Entries) != 2 ||
+			resolved.Entries[0].Path != `\Package.Variables[User::Color].Properties[Value]` || resolved.Entries[0].Value != "Red" ||
+			resolved.Entries[1].Path != `\Package.Connections[Source].Properties[ConnectionString]` {
+			t.Errorf("%s: unexpected entries %+v", resolved.Name, resolved.Entries)
+		}
+	}
+
+	env, err := dtsx.ResolveConfiguration(configs[2])
+	if err != nil {
+		t.Fatalf("ResolveConfiguration(Env) failed: %v", err)
+	}
+	if len(env.Entries) != 1 || env.Entries[0].Path != `\Package.Variables[User::Region].Properties[Value]` || env.Entries[0].Value != "West" {
+		t.Errorf("Unexpected environment configuration: %+v", env)
+	}
+
+	// A missing file still reports where the configuration points
+	missing := &dtsx.ConfigurationType{ConfigurationStringAttr: stringPtr(filepath.Join(dir, "missing.dtsConfig")), ConfigurationTypeAttr: intPtr(1)}
+	resolved, err := dtsx.ResolveConfiguration(missing)
+	if err == nil {
+		t.Error("Expected error for missing configuration file")
+	}
+	if resolved == nil || resolved.Type != "ConfigFile" {
+		t.Errorf("Expected partially resolved configuration, got %+v", resolved)
+	}
+}
+
+func TestDeleteVariable(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "A", "1").
+		AddVariable("User", "B", "2").
+		AddVariable("System", "A", "3").
+		Build()
+
+	if err := pkg.DeleteVariable("User", "A"); err != nil {
+		t.Fatalf("DeleteVariable failed: %v", err)
+	}
+	if _, err := pkg.GetVariableByName("User::A"); err == nil {
+		t.Error("Expected User::A to be removed")
+	}
+	if _, err := pkg.GetVariableByName("System::A"); err != nil {
+		t.Error("Expected System::A to be kept")
+	}
+	if pkg.GetVariables().Count != 2 {
+		t.Errorf("Expected 2 variables, got %d", pkg.GetVariables().Count)
+	}
+
+	if err := pkg.DeleteVariable("User", "Missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+
+	// Deleting the last variables leaves the package usable
+	if err := pkg.DeleteVariable("User", "B"); err != nil {
+		t.Fatalf("DeleteVariable failed: %v", err)
+	}
+	if err := pkg.DeleteVariable("System", "A"); err != nil {
+		t.Fatalf("DeleteVariable failed: %v", err)
+	}
+	if pkg.GetVariables().Count != 0 {
+		t.Errorf("Expected no variables, got %d", pkg.GetVariables().Count)
+	}
+	if err := pkg.DeleteVariable("User", "B"); err == nil {
+		t.Error("Expected error deleting from an empty package")
+	}
+	if _, err := dtsx.Marshal(pkg); err != nil {
+		t.Errorf("Marshal after deleting all variables failed: %v", err)
+	}
+
+	if err := dtsx.NewPackageBuilder().Build().DeleteVariable("User", "A"); err == nil {
+		t.Error("Expected error for package without variables")
+	}
+}
+
+func TestDeleteConnection(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Source", "OLEDB", "Data Source=.;Initial Catalog=Sales").
+		AddConnection("Target", "OLEDB", "Data Source=.;Initial Catalog=Warehouse").
+		Build()
+
+	// Older packages carry the name as an ObjectName property instead of an attribute
+	pkg.ConnectionManagers.ConnectionManager = append(pkg.ConnectionManagers.ConnectionManager, &schema.ConnectionManagerType{
+		CreationNameAttr: stringPtr("FLATFILE"),
+		Property: []*schema.Property{{
+			NameAttr: stringPtr("ObjectName"),
+			PropertyElementBaseType: &schema.PropertyElementBaseType{
+				AnySimpleType: &schema.AnySimpleType{Value: "Export File"},
+			},
+		}},
+	})
+
+	if err := pkg.DeleteConnection("Source"); err != nil {
+		t.Fatalf("DeleteConnection by attribute name failed: %v", err)
+	}
+	if err := pkg.DeleteConnection("Export File"); err != nil {
+		t.Fatalf("DeleteConnection by property name failed: %v", err)
+	}
+
+	conns := pkg.GetConnections()
+	if conns.Count != 1 || dtsx.GetConnectionName(conns.Results.([]*schema.ConnectionManagerType)[0]) != "Target" {
+		t.Errorf("Expected only Target to remain, got %d connections", conns.Count)
+	}
+
+	if err := pkg.DeleteConnection("Source"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if err := dtsx.NewPackageBuilder().Build().DeleteConnection("Source"); err == nil {
+		t.Error("Expected error for package without connections")
+	}
+}
+
+func TestPackageBuilderAddExecutable(t *testing.T) {
+	sql := "UPDATE dbo.Orders\nSET Status = 'Done' WHERE Qty > 0 AND Note <> \"x\""
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;Initial Catalog=Warehouse").
+		AddExecutable("Run Script", "Microsoft.ScriptTask").
+		AddSQLTask("Update Orders", "Warehouse", sql).
+		Build()
+
+	tasks := pkg.QueryExecutables(func(*schema.AnyNonPackageExecutableType) bool { return true })
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 executables, got %d", len(tasks))
+	}
+	script, sqlTask := tasks[0], tasks[1]
+	if *script.RefIdAttr != `Package\Run Script` || script.ExecutableTypeAttr != "Microsoft.ScriptTask" || *script.CreationNameAttr != "Microsoft.ScriptTask" {
+		t.Errorf("Unexpected script task: refId %s, type %s", *script.RefIdAttr, script.ExecutableTypeAttr)
+	}
+	if script.DTSIDAttr == nil || sqlTask.DTSIDAttr == nil || *script.DTSIDAttr == *sqlTask.DTSIDAttr {
+		t.Error("Expected each executable to get its own DTSID")
+	}
+	if sqlTask.ExecutableTypeAttr != "Microsoft.ExecuteSQLTask" {
+		t.Errorf("Expected Execute SQL Task, got %s", sqlTask.ExecutableTypeAttr)
+	}
+
+	sqlTasks := pkg.QueryExecutables(func(e *schema.AnyNonPackageExecutableType) bool {
+		return e.ExecutableTypeAttr == "Microsoft.ExecuteSQLTask"
+	})
+	if len(sqlTasks) != 1 || dtsx.GetExecutableName(sqlTasks[0]) != "Update Orders" {
+		t.Errorf("Expected QueryExecutables to find the SQL task, got %d", len(sqlTasks))
+	}
+
+	// The statement survives extraction and a Marshal/Unmarshal round-trip
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	pkg2, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	for _, p := range []*dtsx.Package{pkg, pkg2} {
+		statements := dtsx.NewPackageParser(p).GetSQLStatements()
+		if len(statements) != 1 || statements[0].SQL != sql {
+			t.Errorf("Expected SQL statement %q, got %+v", sql, statements)
+		}
+	}
+}
+
+func TestPackageBuilderAddPrecedenceConstraint(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;Initial Catalog=Warehouse").
+		AddSQLTask("Load", "Warehouse", "INSERT INTO dbo.Orders SELECT * FROM stage.Orders").
+		AddSQLTask("Truncate Stage", "Warehouse", "TRUNCATE TABLE stage.Orders").
+		AddExecutable("Notify", "Microsoft.SendMailTask").
+		AddPrecedenceConstraint("Truncate Stage", "Load", "Success").
+		AddPrecedenceConstraint("Load", "Notify", "Failure").
+		AddPrecedenceConstraint("Load", "Missing", "Success").
+		AddPrecedenceConstraint("Load", "Notify", "Sometimes").
+		Build()
+
+	analyzer := dtsx.NewPrecedenceAnalyzer(pkg)
+	if errs := analyzer.ValidateConstraints(); len(errs) != 0 {
+		t.Fatalf("Unexpected constraint errors: %v", errs)
+	}
+	orders := map[string]int{}
+	for _, name := range []string{"Truncate Stage", "Load", "Notify"} {
+		order, err := analyzer.GetExecutionOrder(`Package\` + name)
+		if err != nil {
+			t.Fatalf("GetExecutionOrder(%s) failed: %v", name, err)
+		}
+		orders[name] = order
+	}
+	if !(orders["Truncate Stage"] < orders["Load"] && orders["Load"] < orders["Notify"]) {
+		t.Errorf("Expected Truncate Stage < Load < Notify, got %v", orders)
+	}
+
+	statuses := pkg.GetConstraintStatus()
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 constraints (unknown task and condition ignored), got %d", len(statuses))
+	}
+	for _, s := range statuses {
+		if s.To == `Package\Notify` && s.Value != "Failure" {
+			t.Errorf("Expected Failure constraint into Notify, got %s", s.Value)
+		}
+		if s.To == `Package\Load` && (s.Value != "Success" || len(s.From) != 1 || s.From[0] != `Package\Truncate Stage`) {
+			t.Errorf("Unexpected constraint into Load: %+v", s)
+		}
+	}
+}
+
+func TestExecutionOrderDeterministic(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddExecutable("Extract Customers", "Microsoft.Pipeline").
+		AddExecutable("Extract Orders", "Microsoft.Pipeline").
+		AddExecutable("Extract Products", "Microsoft.Pipeline").
+		AddExecutable("Extract Regions", "Microsoft.Pipeline").
+		AddExecutable("Merge", "Microsoft.ExecuteSQLTask").
+		AddPrecedenceConstraint("Extract Orders", "Merge", "Success").
+		Build()
+
+	first, err := dtsx.NewPrecedenceAnalyzer(pkg).GetAllExecutionOrders()
+	if err != nil {
+		t.Fatalf("GetAllExecutionOrders failed: %v", err)
+	}
+	firstFlow := dtsx.NewPrecedenceAnalyzer(pkg).GetExecutionFlowDescription()
+
+	// Map iteration order varies between runs, so repeat enough times to expose it
+	for i := 0; i < 20; i++ {
+		orders, err := dtsx.NewPrecedenceAnalyzer(pkg).GetAllExecutionOrders()
+		if err != nil {
+			t.Fatalf("GetAllExecutionOrders failed: %v", err)
+		}
+		if !reflect.DeepEqual(orders, first) {
+			t.Fatalf("Execution orders differ between runs: %v vs %v", first, orders)
+		}
+		if flow := dtsx.NewPrecedenceAnalyzer(pkg).GetExecutionFlowDescription(); flow != firstFlow {
+			t.Fatalf("Flow description differs between runs:\n%s\nvs\n%s", firstFlow, flow)
+		}
+	}
+
+	// Independent tasks are numbered in declaration order
+	for i, name := range []string{"Extract Customers", "Extract Orders", "Extract Products", "Extract Regions"} {
+		if got := first[`Package\`+name]; got != i+1 {
+			t.Errorf("Expected %s to be order %d, got %d", name, i+1, got)
+		}
+	}
+	if first[`Package\Merge`] != 3 {
+		t.Errorf("Expected Merge to follow Extract Orders with order 3, got %d", first[`Package\Merge`])
+	}
+}
+
+func TestGetExecutionLevels(t *testing.T) {
+	// Diamond: A -> B, A -> C, B -> D, C -> D
+	pkg := dtsx.NewPackageBuilder().
+		AddExecutable("A", "Microsoft.ExecuteSQLTask").
+		AddExecutable("B", "Microsoft.ExecuteSQLTask").
+		AddExecutable("C", "Microsoft.ExecuteSQLTask").
+		AddExecutable("D", "Microsoft.ExecuteSQLTask").
+		AddExecutable("E", "Microsoft.ExecuteSQLTask").
+		AddPrecedenceConstraint("A", "B", "Success").
+		AddPrecedenceConstraint("A", "C", "Success").
+		AddPrecedenceConstraint("B", "D", "Success").
+		AddPrecedenceConstraint("C", "D", "Success").
+		Build()
+
+	levels, err := dtsx.NewPrecedenceAnalyzer(pkg).GetExecutionLevels()
+	if err != nil {
+		t.Fatalf("GetExecutionLevels failed: %v", err)
+	}
+	expected := map[int][]string{
+		1: {`Package\A`, `Package\E`},
+		2: {`Package\B`, `Package\C`},
+		3: {`Package\D`},
+	}
+	if !reflect.DeepEqual(levels, expected) {
+		t.Errorf("Expected levels %v, got %v", expected, levels)
+	}
+
+	// A cycle is reported as an error
+	pkg = dtsx.NewPackageBuilder().
+		AddExecutable("X", "Microsoft.ExecuteSQLTask").
+		AddExecutable("Y", "Microsoft.ExecuteSQLTask").
+		AddPrecedenceConstraint("X", "Y", "Success").
+		AddPrecedenceConstraint("Y", "X", "Success").
+		Build()
+	if _, err := dtsx.NewPrecedenceAnalyzer(pkg).GetExecutionLevels(); err == nil {
+		t.Error("Expected error for circular constraints")
+	}
+}
+
+func TestValidateConstraintsCyclePath(t *testing.T) {
+	// A runs before B, B before C, and C before A
+	pkg := dtsx.NewPackageBuilder().
+		AddExecutable("A", "Microsoft.ExecuteSQLTask").
+		AddExecutable("B", "Microsoft.ExecuteSQLTask").
+		AddExecutable("C", "Microsoft.ExecuteSQLTask").
+		AddPrecedenceConstraint("A", "B", "Success").
+		AddPrecedenceConstraint("B", "C", "Success").
+		AddPrecedenceConstraint("C", "A", "Success").
+		Build()
+	analyzer := dtsx.NewPrecedenceAnalyzer(pkg)
+
+	_, err := analyzer.GetExecutableChain(`Package\A`)
+	if err == nil {
+		t.Fatal("Expected cycle error")
+	}
+	if want := `Package\A -> Package\B -> Package\C -> Package\A`; !strings.Contains(err.Error(), want) {
+		t.Errorf("Expected cycle path %q in error, got %q", want, err.Error())
+	}
+
+	errs := analyzer.ValidateConstraints()
+	if len(errs) != 3 {
+		t.Fatalf("Expected an error for each executable in the cycle, got %d", len(errs))
+	}
+	if want := `Package\B -> Package\C -> Package\A -> Package\B`; !strings.Contains(errs[1].Error(), want) {
+		t.Errorf("Expected cycle path %q in error, got %q", want, errs[1].Error())
+	}
+
+	// Shared predecessors (a diamond) are not a cycle
+	pkg = dtsx.NewPackageBuilder().
+		AddExecutable("A", "Microsoft.ExecuteSQLTask").
+		AddExecutable("B", "Microsoft.ExecuteSQLTask").
+		AddExecutable("C", "Microsoft.ExecuteSQLTask").
+		AddExecutable("D", "Microsoft.ExecuteSQLTask").
+		AddPrecedenceConstraint("A", "B", "Success").
+		AddPrecedenceConstraint("A", "C", "Success").
+		AddPrecedenceConstraint("B", "D", "Success").
+		AddPrecedenceConstraint("C", "D", "Success").
+		Build()
+	analyzer = dtsx.NewPrecedenceAnalyzer(pkg)
+	if errs := analyzer.ValidateConstraints(); len(errs) != 0 {
+		t.Errorf("Expected no cycle errors for a diamond, got %v", errs)
+	}
+	chain, err := analyzer.GetExecutableChain(`Package\D`)
+	if err != nil {
+		t.Fatalf("GetExecutableChain failed: %v", err)
+	}
+	if !reflect.DeepEqual(chain, []string{`Package\A`, `Package\B`, `Package\C`, `Package\D`}) {
+		t.Errorf("Unexpected chain %v", chain)
+	}
+}
+
+func TestGetSQLStatementsIndirectSource(t *testing.T) {
+	sqlTask := func(name, sourceType, source string) *schema.AnyNonPackageExecutableType {
+		return &schema.AnyNonPackageExecutableType{
+			RefIdAttr:          stringPtr(`Package\` + name),
+			ObjectNameAttr:     stringPtr(name),
+			ExecutableTypeAttr: "Microsoft.ExecuteSQLTask",
+			ObjectData: &schema.ExecutableObjectDataType{
+				InnerXML: `<SQLTask:SqlTaskData SQLTask:SqlStmtSourceType="` + sourceType + `" SQLTask:SqlStatementSource="` + source +
+					`" xmlns:SQLTask="www.microsoft.com/sqlserver/dts/tasks/sqltask" />`,
+			},
+		}
+	}
+
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "DupeCheck", "SELECT COUNT(*) FROM dbo.Orders").
+		AddConnection("Cleanup Script", "FILE", `C:\scripts\cleanup.sql`).
+		Build()
+	pkg.ConnectionManagers.ConnectionManager[0].DTSIDAttr = stringPtr("{6D2C1A4E-5B3F-4C8D-9E7A-1F0B2C3D4E5F}")
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		sqlTask("Check Dupes", "Variable", "User::DupeCheck"),
+		sqlTask("Cleanup", "FileConnection", "{6D2C1A4E-5B3F-4C8D-9E7A-1F0B2C3D4E5F}"),
+	}
+
+	statements := dtsx.NewPackageParser(pkg).GetSQLStatements()
+	if len(statements) != 2 {
+		t.Fatalf("Expected 2 SQL statements, got %d", len(statements))
+	}
+
+	variable := statements[0]
+	if variable.SourceType != "Variable" || variable.Source != "User::DupeCheck" {
+		t.Errorf("Expected variable source User::DupeCheck, got %q %q", variable.SourceType, variable.Source)
+	}
+	if variable.SQL != "SELECT COUNT(*) FROM dbo.Orders" {
+		t.Errorf("Expected SQL resolved from the variable, got %q", variable.SQL)
+	}
+
+	file := statements[1]
+	if file.SourceType != "FileConnection" || file.Source != "Cleanup Script" {
+		t.Errorf("Expected file connection source Cleanup Script, got %q %q", file.SourceType, file.Source)
+	}
+	if file.SQL != "" {
+		t.Errorf("Expected no SQL for a file-sourced statement, got %q", file.SQL)
+	}
+}
+
+func TestDetectSQLDialect(t *testing.T) {
+	tests := []struct {
+		creationName     string
+		connectionString string
+		expected         string
+	}{
+		{"OLEDB", "Data Source=.;Provider=SQLNCLI11.1;Integrated Security=SSPI;", "mssql"},
+		{"OLEDB", "Data Source=.;Provider=MSOLEDBSQL.1;Integrated Security=SSPI;", "mssql"},
+		{"ADO.NET:System.Data.SqlClient.SqlConnection, System.Data", "Data Source=.;Integrated Security=True;", "mssql"},
+		{"OLEDB", "Data Source=ORCL;Provider=OraOLEDB.Oracle.1;User ID=scott;", "oracle"},
+		{"ODBC", "Driver={IBM DB2 ODBC DRIVER};Database=SAMPLE;", "db2"},
+		{"FLATFILE", `C:\data\orders.csv`, ""},
+	}
+
+	for _, test := range tests {
+		pkg := dtsx.NewPackageBuilder().AddConnection("Conn", test.creationName, test.connectionString).Build()
+		if got := dtsx.DetectSQLDialect(pkg.ConnectionManagers.ConnectionManager[0]); got != test.expected {
+			t.Errorf("DetectSQLDialect(%q, %q) = %q, expected %q", test.creationName, test.connectionString, got, test.expected)
+		}
+	}
+}
+
+func TestGetSQLStatementsByDialect(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;Provider=SQLNCLI11.1;").
+		AddConnection("Ledger", "OLEDB", "Data Source=ORCL;Provider=OraOLEDB.Oracle.1;").
+		AddSQLTask("Load Warehouse", "Warehouse", "EXEC dbo.LoadFacts").
+		AddSQLTask("Close Ledger", "Ledger", "BEGIN close_period; END;").
+		Build()
+
+	parser := dtsx.NewPackageParser(pkg)
+	for _, stmt := range parser.GetSQLStatements() {
+		if len(stmt.Connections) != 1 {
+			t.Errorf("Expected the task connection on %s, got %v", stmt.TaskName, stmt.Connections)
+		}
+	}
+
+	oracle := parser.GetSQLStatementsByDialect("Oracle")
+	if len(oracle) != 1 || oracle[0].TaskName != "Close Ledger" {
+		t.Fatalf("Expected only Close Ledger for oracle, got %+v", oracle)
+	}
+	if oracle[0].Dialect != "oracle" {
+		t.Errorf("Expected dialect oracle, got %q", oracle[0].Dialect)
+	}
+
+	mssql := parser.GetSQLStatementsByDialect("mssql")
+	if len(mssql) != 1 || mssql[0].TaskName != "Load Warehouse" {
+		t.Errorf("Expected only Load Warehouse for mssql, got %+v", mssql)
+	}
+}
+
+func TestGetSQLStatementsLookupAndOLEDBCommand(t *testing.T) {
+	prop := func(name, value string) *schema.PipelineComponentPropertyType {
+		return &schema.PipelineComponentPropertyType{NameAttr: stringPtr(name), Value: value}
+	}
+
+	pkg := dtsx.NewPackageBuilder().Build()
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{
+		{
+			RefIdAttr:          stringPtr(`Package\Load Orders`),
+			ObjectNameAttr:     stringPtr("Load Orders"),
+			ExecutableTypeAttr: "Microsoft.Pipeline",
+			ObjectData: &schema.ExecutableObjectDataType{
+				Pipeline: &schema.PipelineObjectDataType{
+					Components: &schema.PipelineComponentsType{
+						Component: []*schema.PipelineComponentType{
+							{
+								NameAttr:             stringPtr("Lookup Customer"),
+								ComponentClassIDAttr: stringPtr("Microsoft.Lookup"),
+								Properties: &schema.PipelineComponentPropertiesType{
+									Property: []*schema.PipelineComponentPropertyType{
+										prop("SqlCommand", "SELECT CustomerId, Name FROM dbo.Customer"),
+										prop("SqlCommandParam", "SELECT * FROM (SELECT CustomerId, Name FROM dbo.Customer) AS refTable WHERE refTable.CustomerId = ?"),
+									},
+								},
+							},
+							{
+								NameAttr:             stringPtr("Update Status"),
+								ComponentClassIDAttr: stringPtr("Microsoft.OLEDBCommand"),
+								Inputs: &schema.PipelineComponentInputsType{
+									Input: []*schema.PipelineComponentInputType{{
+										InputColumns: &schema.PipelineComponentInputColumnsType{
+											InputColumn: []*schema.PipelineComponentInputColumnType{{
+												Properties: []*schema.PipelineComponentInputColumnPropertiesType{{
+													Property: []*schema.PipelineComponentInputColumnPropertyType{{
+														NameAttr:      stringPtr("SqlCommand"),
+														AnySimpleType: &schema.AnySimpleType{Value: "UPDATE dbo.Orders SET Status = ? WHERE OrderId = ?"},
+													}},
+												}},
+											}},
+										},
+									}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	statements := dtsx.NewPackageParser(pkg).GetSQLStatements()
+	if len(statements) != 3 {
+		t.Fatalf("Expected 3 SQL statements, got %d", len(statements))
+	}
+
+	expected := []struct {
+		classID string
+		prefix  string
+	}{
+		{"Microsoft.Lookup", "SELECT CustomerId, Name FROM dbo.Customer"},
+		{"Microsoft.Lookup", "SELECT * FROM (SELECT CustomerId"},
+		{"Microsoft.OLEDBCommand", "UPDATE dbo.Orders SET Status"},
+	}
+	for i, want := range expected {
+		stmt := statements[i]
+		if stmt.ComponentClassID != want.classID || !strings.HasPrefix(stmt.SQL, want.prefix) {
+			t.Errorf("Statement %d: expected %s %q, got %s %q", i, want.classID, want.prefix, stmt.ComponentClassID, stmt.SQL)
+		}
+		if stmt.TaskType != "Dataflow" {
+			t.Errorf("Statement %d: expected Dataflow task type, got %q", i, stmt.TaskType)
+		}
+	}
+}
+
+func TestRewriteSQLStatements(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;Provider=SQLNCLI11.1;").
+		AddSQLTask("Load Facts", "Warehouse", "EXEC dbo.LoadFacts").
+		Build()
+	pkg.Executable = append(pkg.Executable, &schema.AnyNonPackageExecutableType{
+		RefIdAttr:          stringPtr(`Package\Load Orders`),
+		ObjectNameAttr:     stringPtr("Load Orders"),
+		ExecutableTypeAttr: "Microsoft.Pipeline",
+		ObjectData: &schema.ExecutableObjectDataType{
+			Pipeline: &schema.PipelineObjectDataType{
+				Components: &schema.PipelineComponentsType{
+					Component: []*schema.PipelineComponentType{{
+						NameAttr:             stringPtr("Orders Source"),
+						ComponentClassIDAttr: stringPtr("Microsoft.OLEDBSource"),
+						Properties: &schema.PipelineComponentPropertiesType{
+							Property: []*schema.PipelineComponentPropertyType{
+								{NameAttr: stringPtr("SqlCommand"), Value: "SELECT * FROM dbo.Orders"},
+							},
+						},
+					}},
+				},
+			},
+		},
+	})
+
+	count := pkg.RewriteSQLStatements(func(stmt *dtsx.SQLStatement) string {
+		return "SET NOCOUNT ON; " + stmt.SQL
+	})
+	if count != 2 {
+		t.Fatalf("Expected 2 statements rewritten, got %d", count)
+	}
+
+	statements := dtsx.NewPackageParser(pkg).GetSQLStatements()
+	if len(statements) != 2 {
+		t.Fatalf("Expected 2 SQL statements, got %d", len(statements))
+	}
+	if statements[0].SQL != "SET NOCOUNT ON; EXEC dbo.LoadFacts" {
+		t.Errorf("Expected control flow SQL rewritten, got %q", statements[0].SQL)
+	}
+	if statements[1].SQL != "SET NOCOUNT ON; SELECT * FROM dbo.Orders" {
+		t.Errorf("Expected dataflow SQL rewritten, got %q", statements[1].SQL)
+	}
+
+	// Returning the SQL unchanged rewrites nothing
+	if count := pkg.RewriteSQLStatements(func(stmt *dtsx.SQLStatement) string { return stmt.SQL }); count != 0 {
+		t.Errorf("Expected no statements rewritten, got %d", count)
+	}
+
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Failed to marshal package: %v", err)
+	}
+	if !strings.Contains(string(data), `SQLTask:SqlStatementSource="SET NOCOUNT ON; EXEC dbo.LoadFacts"`) {
+		t.Errorf("Expected rewritten SQL in marshalled task data:\n%s", data)
+	}
+}
+
+func TestRewriteSQLStatementsRoundTrip(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("SSIS_EXAMPLES", "Scanner.dtsx"))
+	if err != nil {
+		t.Skipf("Scanner.dtsx not available: %v", err)
+	}
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	const marker = "/* v2 */ "
+	count := pkg.RewriteSQLStatements(func(stmt *dtsx.SQLStatement) string {
+		if stmt.TaskType != "Dataflow" {
+			return stmt.SQL
+		}
+		return marker + stmt.SQL
+	})
+	if count == 0 {
+		t.Fatal("Expected data flow statements to be rewritten")
+	}
+
+	out, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	reloaded, err := dtsx.Unmarshal(out)
+	if err != nil {
+		t.Fatalf("Unmarshal of rewritten package failed: %v", err)
+	}
+	persisted, params := 0, 0
+	for _, stmt := range dtsx.NewPackageParser(reloaded).GetSQLStatements() {
+		// OLE DB Source table names (OpenRowset) are not rewritten
+		if stmt.TaskType != "Dataflow" || strings.HasPrefix(stmt.SQL, "SELECT * FROM ") && !strings.HasPrefix(stmt.SQL, marker) {
+			continue
+		}
+		if !strings.HasPrefix(stmt.SQL, marker) {
+			t.Errorf("Expected rewritten SQL after a round trip, got %q", stmt.SQL)
+			continue
+		}
+		persisted++
+		if strings.Contains(stmt.SQL, "?") {
+			params++
+		}
+	}
+	if persisted != count {
+		t.Errorf("Expected %d rewritten statements after a round trip, got %d", count, persisted)
+	}
+	if params == 0 {
+		t.Error("Expected the Lookup SqlCommandParam rewrite to persist")
+	}
+
+	// The OLE DB Command's statement may live on an input column
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Updates">
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Apply" DTS:ExecutableType="Microsoft.Pipeline" DTS:ObjectName="Apply">
+      <DTS:ObjectData>
+        <pipeline>
+          <components>
+            <component refId="Package\Apply\Update Rows" name="Update Rows" componentClassID="Microsoft.OLEDBCommand">
+              <inputs>
+                <input name="OLE DB Command Input">
+                  <inputColumns>
+                    <inputColumn name="Id">
+                      <properties>
+                        <property name="SqlCommand">UPDATE dbo.Orders SET Shipped = 1 WHERE Id = ?</property>
+                      </properties>
+                    </inputColumn>
+                  </inputColumns>
+                </input>
+              </inputs>
+            </component>
+          </components>
+        </pipeline>
+      </DTS:ObjectData>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`
+	pkg, err = dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if count := pkg.RewriteSQLStatements(func(stmt *dtsx.SQLStatement) string {
+		return strings.Replace(stmt.SQL, "dbo.Orders", "sales.Orders", 1)
+	}); count != 1 {
+		t.Fatalf("Expected 1 statement rewritten, got %d", count)
+	}
+	out, err = dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if reloaded, err = dtsx.Unmarshal(out); err != nil {
+		t.Fatalf("Unmarshal of rewritten package failed: %v", err)
+	}
+	statements := dtsx.NewPackageParser(reloaded).GetSQLStatements()
+	if len(statements) != 1 || statements[0].SQL != "UPDATE sales.Orders SET Shipped = 1 WHERE Id = ?" {
+		t.Errorf("Expected the input column SqlCommand rewrite to persist, got %v", statements)
+	}
+}
+
+func TestGetDOTGraph(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Source", "OLEDB", "Data Source=SRC;").
+		AddSQLTask("Truncate Target", "Source", "TRUNCATE TABLE dbo.Target").
+		AddExecutable("Copy Rows", "Microsoft.Pipeline").
+		AddPrecedenceConstraint("Truncate Target", "Copy Rows", "Success").
+		Build()
+
+	dot := dtsx.NewPrecedenceAnalyzer(pkg).GetDOTGraph()
+	if !strings.HasPrefix(dot, "digraph precedence {\n") || !strings.HasSuffix(dot, "}\n") {
+		t.Errorf("Expected a digraph, got:\n%s", dot)
+	}
+	for _, want := range []string{
+		`"Package\\Truncate Target" [label="Truncate Target\nMicrosoft.ExecuteSQLTask"];`,
+		`"Package\\Copy Rows" [label="Copy Rows\nMicrosoft.Pipeline"];`,
+		`"Package\\Truncate Target" -> "Package\\Copy Rows";`,
+	} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("Expected DOT output to contain %s, got:\n%s", want, dot)
+		}
+	}
+}
+
+func TestGetMermaidFlowchart(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddExecutable("Extract", "Microsoft.ExecuteSQLTask").
+		AddExecutable("Load", "Microsoft.Pipeline").
+		AddExecutable("Send \"Failure\" Mail", "Microsoft.SendMailTask").
+		AddPrecedenceConstraint("Extract", "Load", "Success").
+		AddPrecedenceConstraint("Load", "Send \"Failure\" Mail", "Failure").
+		Build()
+
+	chart := dtsx.NewPrecedenceAnalyzer(pkg).GetMermaidFlowchart()
+	if !strings.HasPrefix(chart, "flowchart TD\n") {
+		t.Errorf("Expected a flowchart TD block, got:\n%s", chart)
+	}
+	for _, want := range []string{
+		`t1["Extract"]`,
+		`t3["Send #quot;Failure#quot; Mail"]`,
+		"t1 -->|Success| t2",
+		"t2 -->|Failure| t3",
+	} {
+		if !strings.Contains(chart, want) {
+			t.Errorf("Expected flowchart to contain %q, got:\n%s", want, chart)
+		}
+	}
+}
+
+func TestWrappedPrecedenceConstraints(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("SSIS_EXAMPLES", "DupeAlertFail.dtsx"))
+	if err != nil {
+		t.Skipf("DupeAlertFail.dtsx not available: %v", err)
+	}
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	statuses := pkg.GetConstraintStatus()
+	if len(statuses) != 2 {
+		t.Fatalf("Expected 2 constraint statuses, got %d: %+v", len(statuses), statuses)
+	}
+	expected := []dtsx.ConstraintStatus{
+		{From: []string{`Package\CheckDupCount`}, To: `Package\DO IF DUPES`, Value: "Success", EvalOp: "Expression", Expression: "@[User::TOTAL_DUPS] > 0", Active: false},
+		{From: []string{`Package\CheckDupCount`}, To: `Package\DO IT NO DUPES`, Value: "Success", EvalOp: "Expression", Expression: "@[User::TOTAL_DUPS] == 0", Active: true},
+	}
+	if !reflect.DeepEqual(statuses, expected) {
+		t.Errorf("Expected statuses %+v, got %+v", expected, statuses)
+	}
+
+	analyzer := dtsx.NewPrecedenceAnalyzer(pkg)
+	levels, err := analyzer.GetExecutionLevels()
+	if err != nil {
+		t.Fatalf("GetExecutionLevels failed: %v", err)
+	}
+	expectedLevels := map[int][]string{
+		1: {`Package\CheckDupCount`},
+		2: {`Package\DO IF DUPES`, `Package\DO IT NO DUPES`},
+	}
+	if !reflect.DeepEqual(levels, expectedLevels) {
+		t.Errorf("Expected levels %v, got %v", expectedLevels, levels)
+	}
+	if errs := analyzer.ValidateConstraints(); len(errs) != 0 {
+		t.Errorf("Expected no constraint errors, got %v", errs)
+	}
+	if dot := analyzer.GetDOTGraph(); !strings.Contains(dot, `"Package\\CheckDupCount" -> "Package\\DO IF DUPES";`) {
+		t.Errorf("Expected DOT graph to contain the wrapped constraint edge, got:\n%s", dot)
+	}
+	if chart := analyzer.GetMermaidFlowchart(); !strings.Contains(chart, "t1 --> t2") || !strings.Contains(chart, "t1 --> t3") {
+		t.Errorf("Expected flowchart to contain the wrapped constraint edges, got:\n%s", chart)
+	}
+
+	out, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	reloaded, err := dtsx.Unmarshal(out)
+	if err != nil {
+		t.Fatalf("Unmarshal of marshaled package failed: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded.GetConstraintStatus(), expected) {
+		t.Errorf("Expected constraints to survive a round trip, got %+v", reloaded.GetConstraintStatus())
+	}
+}
+
+func TestPackageClone(t *testing.T) {
+	original := dtsx.NewPackageBuilder().
+		AddVariable("User", "BatchSize", "500").
+		AddConnection("Warehouse", "OLEDB", "Data Source=DW;").
+		AddConnectionExpression("Warehouse", "ConnectionString", `"Data Source=" + @[User::Server]`).
+		AddSQLTask("Load", "Warehouse", "EXEC dbo.Load").
+		Build()
+	original.Executable[0].Property = []*schema.Property{
+		{NameAttr: stringPtr("Description"), PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: "Loads facts"}}},
+	}
+	before, err := dtsx.Marshal(original)
+	if err != nil {
+		t.Fatalf("Failed to marshal package: %v", err)
+	}
+
+	first := original.Clone()
+	second := original.Clone()
+	if !reflect.DeepEqual(first, original) {
+		t.Fatal("Expected the clone to equal the original")
+	}
+
+	// Mutate every kind of element on one clone
+	*first.Variables.Variable[0].ObjectNameAttr = "Renamed"
+	first.Variables.Variable[0].VariableValue.Value = "1000"
+	first.ConnectionManagers.ConnectionManager[0].Property[0].PropertyElementBaseType.AnySimpleType.Value = "Data Source=OTHER;"
+	first.ConnectionManagers.ConnectionManager[0].PropertyExpression[0].AnySimpleType.Value = `"Data Source=X"`
+	first.Executable[0].Property[0].PropertyElementBaseType.AnySimpleType.Value = "Changed"
+	first.Executable[0].ObjectData.InnerXML = ""
+	first.Executable = append(first.Executable[:0], first.Executable[0])
+
+	after, err := dtsx.Marshal(original)
+	if err != nil {
+		t.Fatalf("Failed to marshal package: %v", err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Errorf("Mutating a clone changed the original:\n%s\nvs\n%s", before, after)
+	}
+	if !reflect.DeepEqual(second, original) {
+		t.Error("Mutating one clone changed another")
+	}
+
+	var nilPkg *dtsx.Package
+	if nilPkg.Clone() != nil {
+		t.Error("Expected nil clone of a nil package")
+	}
+}
+
+// fakeCommand writes a shell script standing in for dtexec.exe and returns its path
+func fakeCommand(t *testing.T, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("Fake commands are shell scripts")
+	}
+	path := filepath.Join(t.TempDir(), "dtexec")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write fake command: %v", err)
+	}
+	return path
+}
+
+func TestConnectionManagerProperties(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Connections">
+  <DTS:ConnectionManagers>
+    <DTS:ConnectionManager DTS:refId="Package.ConnectionManagers[Orders File]" DTS:CreationName="FLATFILE" DTS:ObjectName="Orders File">
+      <DTS:ObjectData>
+        <DTS:ConnectionManager DTS:Format="Delimited" DTS:LocaleID="1033" DTS:HeaderRowDelimiter="_x000D__x000A_" DTS:ColumnNamesInFirstDataRow="True" DTS:RowDelimiter="" DTS:TextQualifier="_x003C_none_x003E_" DTS:CodePage="1252" DTS:ConnectionString="C:\data\orders.csv">
+          <DTS:FlatFileColumns>
+            <DTS:FlatFileColumn DTS:ColumnType="Delimited" DTS:ColumnDelimiter="_x002C_" DTS:DataType="3" DTS:TextQualified="True" DTS:ObjectName="OrderID" />
+            <DTS:FlatFileColumn DTS:ColumnType="Delimited" DTS:ColumnDelimiter="_x000D__x000A_" DTS:MaximumWidth="50" DTS:DataType="130" DTS:TextQualified="True" DTS:ObjectName="Customer" />
+          </DTS:FlatFileColumns>
+        </DTS:ConnectionManager>
+      </DTS:ObjectData>
+    </DTS:ConnectionManager>
+    <DTS:ConnectionManager DTS:refId="Package.ConnectionManagers[Warehouse]" DTS:CreationName="OLEDB" DTS:ObjectName="Warehouse">
+      <DTS:ObjectData>
+        <DTS:ConnectionManager DTS:ConnectRetryCount="3" DTS:ConnectRetryInterval="5" DTS:Retain="True" DTS:ConnectionString="Data Source=dbserver;Initial Catalog=Warehouse;Provider=SQLNCLI11.1;Integrated Security=SSPI;" />
+      </DTS:ObjectData>
+    </DTS:ConnectionManager>
+    <DTS:ConnectionManager DTS:refId="Package.ConnectionManagers[Budget]" DTS:CreationName="EXCEL" DTS:ObjectName="Budget">
+      <DTS:ObjectData>
+        <DTS:ConnectionManager DTS:ConnectionString="Provider=Microsoft.ACE.OLEDB.12.0;Data Source=C:\data\budget.xlsx;Extended Properties=&quot;Excel 12.0 XML;HDR=NO&quot;;" />
+      </DTS:ObjectData>
+    </DTS:ConnectionManager>
+  </DTS:ConnectionManagers>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	flatFile, oledb, excel := pkg.ConnectionManagers.ConnectionManager[0], pkg.ConnectionManagers.ConnectionManager[1], pkg.ConnectionManagers.ConnectionManager[2]
+
+	ff := dtsx.GetFlatFileProperties(flatFile)
+	if ff == nil {
+		t.Fatal("Expected flat file properties")
+	}
+	if ff.FilePath != `C:\data\orders.csv` || ff.Format != "Delimited" || ff.CodePage != "1252" || ff.LocaleID != "1033" {
+		t.Errorf("Unexpected flat file settings: %+v", ff)
+	}
+	if ff.HeaderRowDelimiter != "\r\n" || ff.TextQualifier != "" || !ff.ColumnNamesInFirstDataRow {
+		t.Errorf("Expected decoded delimiters and header flag, got %+v", ff)
+	}
+	expectedColumns := []dtsx.FlatFileColumnInfo{
+		{Name: "OrderID", ColumnType: "Delimited", Delimiter: ",", DataType: 3, TextQualified: true},
+		{Name: "Customer", ColumnType: "Delimited", Delimiter: "\r\n", MaximumWidth: 50, DataType: 130, TextQualified: true},
+	}
+	if !reflect.DeepEqual(ff.Columns, expectedColumns) {
+		t.Errorf("Expected columns %+v, got %+v", expectedColumns, ff.Columns)
+	}
+
+	ole := dtsx.GetOLEDBProperties(oledb)
+	expectedOLEDB := &dtsx.OLEDBConnInfo{
+		ConnectionString:     "Data Source=dbserver;Initial Catalog=Warehouse;Provider=SQLNCLI11.1;Integrated Security=SSPI;",
+		Provider:             "SQLNCLI11.1",
+		DataSource:           "dbserver",
+		InitialCatalog:       "Warehouse",
+		RetainSameConnection: true,
+		ConnectRetryCount:    3,
+		ConnectRetryInterval: 5,
+	}
+	if !reflect.DeepEqual(ole, expectedOLEDB) {
+		t.Errorf("Expected OLE DB properties %+v, got %+v", expectedOLEDB, ole)
+	}
+
+	xls := dtsx.GetExcelProperties(excel)
+	if xls == nil {
+		t.Fatal("Expected Excel properties")
+	}
+	if xls.Provider != "Microsoft.ACE.OLEDB.12.0" || xls.FilePath != `C:\data\budget.xlsx` || xls.ExcelVersion != "Excel 12.0 XML" || xls.FirstRowHasColumnNames {
+		t.Errorf("Unexpected Excel settings: %+v", xls)
+	}
+
+	// Accessors only answer for their own connection type
+	if dtsx.GetOLEDBProperties(flatFile) != nil || dtsx.GetFlatFileProperties(oledb) != nil || dtsx.GetExcelProperties(nil) != nil {
+		t.Error("Expected nil for mismatched or nil connection managers")
+	}
+
+	// Builder connections keep their settings as properties
+	built := dtsx.NewPackageBuilder().AddConnection("Export", "FLATFILE", `C:\out\export.csv`).Build()
+	if got := dtsx.GetFlatFileProperties(built.ConnectionManagers.ConnectionManager[0]); got == nil || got.FilePath != `C:\out\export.csv` {
+		t.Errorf("Expected builder file path, got %+v", got)
+	}
+}
+
+func TestParseConnectionString(t *testing.T) {
+	const sqlncli = "Data Source=dbserver\\SQL2019;Initial Catalog=Warehouse;Provider=SQLNCLI11.1;Integrated Security=SSPI;Application Name=SSIS-Load-{GUID};Auto Translate=False;"
+	parts := dtsx.ParseConnectionString(sqlncli)
+	expected := map[string]string{
+		"data source":         `dbserver\SQL2019`,
+		"initial catalog":     "Warehouse",
+		"provider":            "SQLNCLI11.1",
+		"integrated security": "SSPI",
+		"application name":    "SSIS-Load-{GUID}",
+		"auto translate":      "False",
+	}
+	if !reflect.DeepEqual(parts, expected) {
+		t.Errorf("Expected %v, got %v", expected, parts)
+	}
+	info := dtsx.ParseConnectionInfo(sqlncli)
+	if *info != (dtsx.ConnectionInfo{Server: `dbserver\SQL2019`, Database: "Warehouse", Provider: "SQLNCLI11.1", IntegratedSecurity: true}) {
+		t.Errorf("Unexpected connection info: %+v", info)
+	}
+
+	// Quoted values may contain semicolons and doubled quote characters
+	quoted := `Provider=Microsoft.ACE.OLEDB.12.0; Data Source = "C:\data\a;b.xlsx" ;Extended Properties="Excel 12.0 XML;HDR=YES";Password='it''s;secret';Driver={SQL Server;Native}`
+	parts = dtsx.ParseConnectionString(quoted)
+	expected = map[string]string{
+		"provider":            "Microsoft.ACE.OLEDB.12.0",
+		"data source":         `C:\data\a;b.xlsx`,
+		"extended properties": "Excel 12.0 XML;HDR=YES",
+		"password":            "it's;secret",
+		"driver":              "SQL Server;Native",
+	}
+	if !reflect.DeepEqual(parts, expected) {
+		t.Errorf("Expected %v, got %v", expected, parts)
+	}
+
+	// ADO.NET synonyms and SQL authentication
+	info = dtsx.ParseConnectionInfo("Server=tcp:db.example.com,1433;Database=Sales;User ID=loader;Password=x;")
+	if *info != (dtsx.ConnectionInfo{Server: "tcp:db.example.com,1433", Database: "Sales"}) {
+		t.Errorf("Unexpected connection info: %+v", info)
+	}
+	if len(dtsx.ParseConnectionString("")) != 0 {
+		t.Error("Expected no components for an empty connection string")
+	}
+}
+
+func TestGetUndefinedVariableReferences(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "Count", "1").
+		AddConnection("Source", "OLEDB", "Data Source=.;").
+		AddConnectionExpression("Source", "ConnectionString", `"Data Source=" + @[User::Server] + ";Initial Catalog=" + @[User::Server]`).
+		AddConnectionExpression("Source", "Description", `@[User::Count] + @[System::PackageName] + @[$Project::Env] + @[Count]`).
+		AddSQLTask("Load", "Source", "SELECT '@[User::Missing]', '@[User::Server]'").
+		Build()
+
+	undefined := pkg.GetUndefinedVariableReferences()
+	expected := []string{"User::Server", "User::Missing"}
+	if !reflect.DeepEqual(undefined, expected) {
+		t.Errorf("Expected %v, got %v", expected, undefined)
+	}
+
+	if got := dtsx.NewPackageBuilder().AddVariable("User", "Count", "1").Build().GetUndefinedVariableReferences(); len(got) != 0 {
+		t.Errorf("Expected no undefined references, got %v", got)
+	}
+}
+
+func TestConnectionImpactFollowsExpressions(t *testing.T) {
+	// The dynamic connection pattern from examples/build_package.go
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "ServerName", "default-server", "String").
+		AddVariableWithType("User", "DatabaseName", "default-db", "String").
+		AddVariableWithType("User", "PortNumber", "1433", "Int32").
+		AddConnection("DynamicDB", "OLEDB", "Server=placeholder;Database=placeholder;Trusted_Connection=True;").
+		AddConnectionExpression("DynamicDB", "ConnectionString",
+			`"Server=" + @[User::ServerName] + ";Database=" + @[User::DatabaseName] + ";Trusted_Connection=True;"`).
+		AddConnection("StaticDB", "OLEDB", "Server=static;Database=Static;").
+		AddSQLTask("Load Facts", "DynamicDB", "EXEC dbo.LoadFacts").
+		AddSQLTask("Audit", "StaticDB", "EXEC dbo.Audit").
+		Build()
+
+	graph := pkg.BuildDependencyGraph()
+	if got := graph.GetConnectionVariables("DynamicDB"); !reflect.DeepEqual(got, []string{"User::ServerName", "User::DatabaseName"}) {
+		t.Errorf("Expected DynamicDB to depend on ServerName and DatabaseName, got %v", got)
+	}
+	if got := graph.GetConnectionVariables("StaticDB"); len(got) != 0 {
+		t.Errorf("Expected StaticDB to have no variable dependencies, got %v", got)
+	}
+
+	const loadTask = "Executable[0] (Microsoft.ExecuteSQLTask)"
+	if got := graph.GetConnectionImpact("DynamicDB"); !reflect.DeepEqual(got, []string{loadTask}) {
+		t.Errorf("Expected DynamicDB impact %q, got %v", loadTask, got)
+	}
+
+	impact := graph.GetVariableImpact("User::ServerName")
+	for _, expected := range []string{"Connection:DynamicDB", loadTask} {
+		found := false
+		for _, location := range impact {
+			if location == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected ServerName impact to include %q, got %v", expected, impact)
+		}
+	}
+	for _, location := range impact {
+		if strings.Contains(location, "Executable[1]") {
+			t.Errorf("Audit task does not use DynamicDB, got %v", impact)
+		}
+	}
+	if got := graph.GetVariableImpact("User::PortNumber"); len(got) != 0 {
+		t.Errorf("Expected no impact for an unused variable, got %v", got)
+	}
+}
+
+func TestGetEventHandlers(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Handlers">
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Load" DTS:ExecutableType="Microsoft.ExecuteSQLTask" DTS:ObjectName="Load">
+      <DTS:EventHandlers>
+        <DTS:EventHandler DTS:refId="Package\Load.EventHandlers[OnPreExecute]" DTS:CreationName="OnPreExecute" DTS:EventName="OnPreExecute" DTS:LocaleID="-1">
+          <DTS:Executables>
+            <DTS:Executable DTS:refId="Package\Load.EventHandlers[OnPreExecute]\Log Start" DTS:ExecutableType="Microsoft.ExecuteSQLTask" DTS:ObjectName="Log Start" />
+          </DTS:Executables>
+        </DTS:EventHandler>
+      </DTS:EventHandlers>
+    </DTS:Executable>
+    <DTS:Executable DTS:refId="Package\Archive" DTS:ExecutableType="Microsoft.FileSystemTask" DTS:ObjectName="Archive" />
+  </DTS:Executables>
+  <DTS:EventHandlers>
+    <DTS:EventHandler DTS:refId="Package.EventHandlers[OnError]" DTS:CreationName="OnError" DTS:EventName="OnError" DTS:LocaleID="-1">
+      <DTS:Variables>
+        <DTS:Variable DTS:Namespace="System" DTS:ObjectName="Propagate">
+          <DTS:VariableValue DTS:DataType="11">-1</DTS:VariableValue>
+        </DTS:Variable>
+      </DTS:Variables>
+      <DTS:Executables>
+        <DTS:Executable DTS:refId="Package.EventHandlers[OnError]\Notify" DTS:ExecutableType="Microsoft.SendMailTask" DTS:ObjectName="Notify" />
+        <DTS:Executable DTS:refId="Package.EventHandlers[OnError]\Log Error" DTS:ExecutableType="Microsoft.ExecuteSQLTask" DTS:ObjectName="Log Error" />
+      </DTS:Executables>
+    </DTS:EventHandler>
+  </DTS:EventHandlers>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	check := func(label string, pkg *dtsx.Package) {
+		result := pkg.GetEventHandlers()
+		if result.Count != 2 {
+			t.Fatalf("%s: expected 2 event handlers, got %d", label, result.Count)
+		}
+		handlers := result.Results.([]*dtsx.EventHandlerInfo)
+		onError, onPreExecute := handlers[0], handlers[1]
+		if onError.EventName != "OnError" || onError.HostName != "Handlers" || onError.HostRefId != "Package" || onError.HostType != "Package" {
+			t.Errorf("%s: unexpected package handler %+v", label, onError)
+		}
+		if !reflect.DeepEqual(onError.Executables, []string{"Notify", "Log Error"}) {
+			t.Errorf("%s: expected OnError to run Notify and Log Error, got %v", label, onError.Executables)
+		}
+		if onPreExecute.EventName != "OnPreExecute" || onPreExecute.HostName != "Load" || onPreExecute.HostRefId != `Package\Load` || onPreExecute.HostType != "Microsoft.ExecuteSQLTask" {
+			t.Errorf("%s: unexpected task handler %+v", label, onPreExecute)
+		}
+		if !reflect.DeepEqual(onPreExecute.Executables, []string{"Log Start"}) {
+			t.Errorf("%s: expected OnPreExecute to run Log Start, got %v", label, onPreExecute.Executables)
+		}
+	}
+	check("decoded", pkg)
+
+	// Handlers survive a marshal round trip
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	roundTrip, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal of marshalled package failed: %v", err)
+	}
+	check("round trip", roundTrip)
+
+	if got := dtsx.NewPackageBuilder().Build().GetEventHandlers(); got.Count != 0 {
+		t.Errorf("Expected no event handlers, got %d", got.Count)
+	}
+}
+
+func TestGetForEachLoops(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Loops">
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Each File" DTS:CreationName="STOCK:FOREACHLOOP" DTS:ExecutableType="STOCK:FOREACHLOOP" DTS:ObjectName="Each File">
+      <DTS:ForEachEnumerator DTS:CreationName="Microsoft.ForEachFileEnumerator" DTS:ObjectName="{5F0C2D7B-0E0B-4B44-9B3C-1C1B0A5E6F10}">
+        <DTS:ObjectData>
+          <ForEachFileEnumeratorProperties>
+            <FEFEProperty Folder="C:\incoming" />
+            <FEFEProperty FileSpec="*.csv" />
+            <FEFEProperty FileNameRetrievalType="0" />
+            <FEFEProperty Recurse="0" />
+          </ForEachFileEnumeratorProperties>
+        </DTS:ObjectData>
+      </DTS:ForEachEnumerator>
+      <DTS:ForEachVariableMappings>
+        <DTS:ForEachVariableMapping DTS:CreationName="" DTS:ObjectName="{0B5E3F64-5C5A-4D8B-8D0E-5C3A2E0F7A11}" DTS:ValueIndex="0" DTS:VariableName="User::CurrentFile" />
+      </DTS:ForEachVariableMappings>
+    </DTS:Executable>
+    <DTS:Executable DTS:refId="Package\Each Row" DTS:ExecutableType="STOCK:FOREACHLOOP" DTS:ObjectName="Each Row">
+      <DTS:ForEachEnumerator>
+        <DTS:Property DTS:Name="CreationName">Microsoft.SqlServer.Dts.Runtime.Enumerators.ADO.ForEachADOEnumerator, Microsoft.SqlServer.ForEachADOEnumerator</DTS:Property>
+        <DTS:ObjectData>
+          <FEEADO EnumType="EnumerateRowsInFirstTable" VarName="User::Rows" />
+        </DTS:ObjectData>
+      </DTS:ForEachEnumerator>
+      <DTS:ForEachVariableMapping>
+        <DTS:Property DTS:Name="ValueIndex">1</DTS:Property>
+        <DTS:Property DTS:Name="VariableName">User::CustomerID</DTS:Property>
+      </DTS:ForEachVariableMapping>
+    </DTS:Executable>
+    <DTS:Executable DTS:refId="Package\Load" DTS:ExecutableType="Microsoft.ExecuteSQLTask" DTS:ObjectName="Load" />
+  </DTS:Executables>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	roundTrip, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal of marshalled package failed: %v", err)
+	}
+
+	expected := []*dtsx.ForEachLoopInfo{
+		{
+			Name:           "Each File",
+			RefId:          `Package\Each File`,
+			EnumeratorType: "File",
+			CreationName:   "Microsoft.ForEachFileEnumerator",
+			Settings:       map[string]string{"Folder": `C:\incoming`, "FileSpec": "*.csv", "FileNameRetrievalType": "0", "Recurse": "0"},
+			Mappings:       []dtsx.ForEachVariableMapping{{Index: 0, Variable: "User::CurrentFile"}},
+		},
+		{
+			Name:           "Each Row",
+			RefId:          `Package\Each Row`,
+			EnumeratorType: "ADO",
+			CreationName:   "Microsoft.SqlServer.Dts.Runtime.Enumerators.ADO.ForEachADOEnumerator, Microsoft.SqlServer.ForEachADOEnumerator",
+			Settings:       map[string]string{"EnumType": "EnumerateRowsInFirstTable", "VarName": "User::Rows"},
+			Mappings:       []dtsx.ForEachVariableMapping{{Index: 1, Variable: "User::CustomerID"}},
+		},
+	}
+	for label, p := range map[string]*dtsx.Package{"decoded": pkg, "round trip": roundTrip} {
+		loops := p.GetForEachLoops()
+		if !reflect.DeepEqual(loops, expected) {
+			t.Errorf("%s: expected loops %+v, got %+v", label, expected, loops)
+		}
+	}
+
+	if loops := dtsx.NewPackageBuilder().AddSQLTask("Only", "", "SELECT 1").Build().GetForEachLoops(); len(loops) != 0 {
+		t.Errorf("Expected no For Each loops, got %+v", loops)
+	}
+}
+
+func TestWalkExecutablesNestedContainers(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Nested">
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Stage" DTS:ExecutableType="STOCK:SEQUENCE" DTS:ObjectName="Stage">
+      <DTS:Executables>
+        <DTS:Executable DTS:refId="Package\Stage\Truncate" DTS:ExecutableType="Microsoft.ExecuteSQLTask" DTS:ObjectName="Truncate">
+          <DTS:ObjectData>
+            <SQLTask:SqlTaskData SQLTask:SqlStatementSource="TRUNCATE TABLE stg.Orders" xmlns:SQLTask="www.microsoft.com/sqlserver/dts/tasks/sqltask" />
+          </DTS:ObjectData>
+        </DTS:Executable>
+        <DTS:Executable DTS:refId="Package\Stage\Each File" DTS:ExecutableType="STOCK:FOREACHLOOP" DTS:ObjectName="Each File">
+          <DTS:Executables>
+            <DTS:Executable DTS:refId="Package\Stage\Each File\Archive" DTS:ExecutableType="Microsoft.FileSystemTask" DTS:ObjectName="Archive" />
+          </DTS:Executables>
+        </DTS:Executable>
+      </DTS:Executables>
+    </DTS:Executable>
+    <DTS:Executable DTS:refId="Package\Report" DTS:ExecutableType="Microsoft.SendMailTask" DTS:ObjectName="Report" />
+  </DTS:Executables>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	var visited []string
+	pkg.WalkExecutables(func(exec *schema.AnyNonPackageExecutableType, parentRefId string) {
+		visited = append(visited, parentRefId+" > "+dtsx.GetExecutableName(exec))
+	})
+	expected := []string{
+		`Package > Stage`,
+		`Package\Stage > Truncate`,
+		`Package\Stage > Each File`,
+		`Package\Stage\Each File > Archive`,
+		`Package > Report`,
+	}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("Expected walk %v, got %v", expected, visited)
+	}
+
+	statements := dtsx.NewPackageParser(pkg).GetSQLStatements()
+	if len(statements) != 1 || statements[0].TaskName != "Truncate" || statements[0].SQL != "TRUNCATE TABLE stg.Orders" {
+		t.Errorf("Expected the nested SQL task to be found, got %+v", statements)
+	}
+
+	sqlTasks := pkg.QueryExecutables(func(exec *schema.AnyNonPackageExecutableType) bool {
+		return exec.ExecutableTypeAttr == "Microsoft.ExecuteSQLTask"
+	})
+	if len(sqlTasks) != 1 || dtsx.GetExecutableName(sqlTasks[0]) != "Truncate" {
+		t.Errorf("Expected QueryExecutables to find the nested SQL task, got %d", len(sqlTasks))
+	}
+
+	if _, err := dtsx.NewPackageParser(pkg).GetExecutable(`Package\Stage\Each File\Archive`); err != nil {
+		t.Errorf("Expected nested executable lookup by refId: %v", err)
+	}
+
+	// Nested executables survive a marshal round trip
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	roundTrip, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal of marshalled package failed: %v", err)
+	}
+	if got := len(roundTrip.QueryExecutables(func(*schema.AnyNonPackageExecutableType) bool { return true })); got != 5 {
+		t.Errorf("Expected 5 executables after round trip, got %d", got)
+	}
+}
+
+func TestPackageMerge(t *testing.T) {
+	newBase := func() *dtsx.Package {
+		return dtsx.NewPackageBuilder().
+			AddVariable("User", "Count", "1").
+			AddConnection("Source", "OLEDB", "Data Source=base;").
+			AddSQLTask("Load", "Source", "EXEC dbo.LoadBase").
+			Build()
+	}
+	fragment := dtsx.NewPackageBuilder().
+		AddVariable("User", "Count", "2").
+		AddVariable("User", "BatchSize", "500").
+		AddConnection("Source", "OLEDB", "Data Source=fragment;").
+		AddConnection("Audit", "OLEDB", "Data Source=audit;").
+		AddSQLTask("Load", "Source", "EXEC dbo.LoadFragment").
+		AddSQLTask("Log", "Audit", "EXEC dbo.LogRun").
+		Build()
+
+	names := func(pkg *dtsx.Package) (vars, conns, execs []string) {
+		for _, v := range pkg.Variables.Variable {
+			vars = append(vars, dtsx.GetVariableName(v)+"="+dtsx.GetVariableValue(v))
+		}
+		for _, cm := range pkg.ConnectionManagers.ConnectionManager {
+			conns = append(conns, dtsx.GetConnectionName(cm)+"="+dtsx.GetConnectionString(cm))
+		}
+		for _, exec := range pkg.Executable {
+			execs = append(execs, dtsx.GetExecutableName(exec))
+		}
+		return vars, conns, execs
+	}
+
+	tests := []struct {
+		strategy dtsx.MergeStrategy
+		vars     []string
+		conns    []string
+		errors   int
+		loadSQL  string
+	}{
+		{dtsx.MergeSkip, []string{"User::Count=1", "User::BatchSize=500"}, []string{"Source=Data Source=base;", "Audit=Data Source=audit;"}, 0, "EXEC dbo.LoadBase"},
+		{dtsx.MergeOverwrite, []string{"User::Count=2", "User::BatchSize=500"}, []string{"Source=Data Source=fragment;", "Audit=Data Source=audit;"}, 0, "EXEC dbo.LoadFragment"},
+		{dtsx.MergeError, []string{"User::Count=1", "User::BatchSize=500"}, []string{"Source=Data Source=base;", "Audit=Data Source=audit;"}, 3, "EXEC dbo.LoadBase"},
+	}
+
+	for _, test := range tests {
+		pkg := newBase()
+		errs := pkg.Merge(fragment, test.strategy)
+		if len(errs) != test.errors {
+			t.Errorf("strategy %d: expected %d errors, got %v", test.strategy, test.errors, errs)
+		}
+		vars, conns, execs := names(pkg)
+		if !reflect.DeepEqual(vars, test.vars) {
+			t.Errorf("strategy %d: expected variables %v, got %v", test.strategy, test.vars, vars)
+		}
+		if !reflect.DeepEqual(conns, test.conns) {
+			t.Errorf("strategy %d: expected connections %v, got %v", test.strategy, test.conns, conns)
+		}
+		if !reflect.DeepEqual(execs, []string{"Load", "Log"}) {
+			t.Errorf("strategy %d: expected executables [Load Log], got %v", test.strategy, execs)
+		}
+		statements := dtsx.NewPackageParser(pkg).GetSQLStatements()
+		if len(statements) == 0 || statements[0].SQL != test.loadSQL {
+			t.Errorf("strategy %d: expected Load to run %q, got %+v", test.strategy, test.loadSQL, statements)
+		}
+		for _, e := range pkg.Validate() {
+			if strings.HasPrefix(e.Message, "Duplicate") {
+				t.Errorf("strategy %d: merge produced a duplicate: %s", test.strategy, e.Message)
+			}
+		}
+	}
+
+	// The merged elements are copies
+	pkg := newBase()
+	pkg.Merge(fragment, dtsx.MergeOverwrite)
+	pkg.Variables.Variable[0].VariableValue.Value = "changed"
+	if got := dtsx.GetVariableValue(fragment.Variables.Variable[0]); got != "2" {
+		t.Errorf("Expected the source package to be unaffected, got %q", got)
+	}
+
+	if errs := dtsx.NewPackageBuilder().Build().Merge(fragment, dtsx.MergeError); len(errs) != 0 {
+		t.Errorf("Expected no conflicts when merging into an empty package, got %v", errs)
+	}
+}
+
+func TestValidateConstraintsDanglingReference(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddSQLTask("Extract", "", "SELECT 1").
+		AddSQLTask("Load", "", "SELECT 2").
+		AddPrecedenceConstraint("Extract", "Load", "Success").
+		Build()
+	if errs := dtsx.NewPrecedenceAnalyzer(pkg).ValidateConstraints(); len(errs) != 0 {
+		t.Fatalf("Expected a valid constraint, got %v", errs)
+	}
+
+	// Point the constraint at a task that does not exist
+	missing := `Package\Missing`
+	pkg.Executable[1].PrecedenceConstraint[0].Executable[0].IDREFAttr = &missing
+
+	errs := dtsx.NewPrecedenceAnalyzer(pkg).ValidateConstraints()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), missing) || !strings.Contains(errs[0].Error(), `Package\Load`) {
+		t.Fatalf("Expected one dangling reference error, got %v", errs)
+	}
+
+	found := false
+	for _, e := range dtsx.NewPackageValidator(pkg).Validate() {
+		if e.Severity == "error" && e.Path == "PrecedenceConstraints" && strings.Contains(e.Message, missing) {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("Expected Validate to report the dangling IDREF as an error")
+	}
+}
+
+func TestValidateConnectionReferences(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;Initial Catalog=Warehouse;").
+		AddSQLTask("Load", "Warehouse", "EXEC dbo.Load").
+		AddSQLTask("Archive", "Archive DB", "EXEC dbo.Archive").
+		AddExecutable("Notify", "Microsoft.SendMailTask").
+		Build()
+	name := "Connection"
+	pkg.Executable[2].Property = append(pkg.Executable[2].Property, &schema.Property{
+		NameAttr:                &name,
+		PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: "SMTP Server"}},
+	})
+
+	var unknown []string
+	for _, e := range dtsx.NewPackageValidator(pkg).Validate() {
+		if strings.Contains(e.Message, "unknown connection") {
+			if e.Severity != "error" {
+				t.Errorf("Expected error severity, got %q for %s", e.Severity, e.Message)
+			}
+			unknown = append(unknown, e.Path+": "+e.Message)
+		}
+	}
+	expected := []string{
+		`Executables.Package\Archive: Task Archive references unknown connection Archive DB`,
+		`Executables.Package\Notify: Task Notify references unknown connection SMTP Server`,
+	}
+	if !reflect.DeepEqual(unknown, expected) {
+		t.Errorf("Expected %v, got %v", expected, unknown)
+	}
+}
+
+func TestValidationSeverityHelpers(t *testing.T) {
+	results := []dtsx.ValidationError{
+		{Severity: "warning", Message: "Variable has no value", Path: "Variables.User::A"},
+		{Severity: "error", Message: "Duplicate variable name: User::B", Path: "Variables.User::B"},
+		{Severity: "info", Message: "Package has no properties", Path: "Properties"},
+		{Severity: "warning", Message: "Variable has no value", Path: "Variables.User::C"},
+	}
+
+	warnings := dtsx.FilterBySeverity(results, "warning")
+	if len(warnings) != 2 || warnings[0].Path != "Variables.User::A" || warnings[1].Path != "Variables.User::C" {
+		t.Errorf("Expected the two warnings in order, got %+v", warnings)
+	}
+	if got := dtsx.FilterBySeverity(results, "critical"); len(got) != 0 {
+		t.Errorf("Expected no results for an unknown severity, got %+v", got)
+	}
+
+	counts := dtsx.CountBySeverity(results)
+	if !reflect.DeepEqual(counts, map[string]int{"error": 1, "warning": 2, "info": 1}) {
+		t.Errorf("Unexpected counts %v", counts)
+	}
+
+	if !dtsx.ValidationErrors(results).HasErrors() {
+		t.Error("Expected HasErrors with an error present")
+	}
+	if dtsx.ValidationErrors(dtsx.FilterBySeverity(results, "warning")).HasErrors() {
+		t.Error("Expected HasErrors to ignore warnings")
+	}
+	if dtsx.ValidationErrors(nil).HasErrors() {
+		t.Error("Expected HasErrors to be false for no results")
+	}
+}
+
+func TestValidationErrorIsError(t *testing.T) {
+	ve := dtsx.ValidationError{Severity: "error", Message: "Duplicate variable name: User::Count", Path: "Variables.User::Count"}
+	if got := ve.Error(); got != "[error] Variables.User::Count: Duplicate variable name: User::Count" {
+		t.Errorf("Unexpected formatting %q", got)
+	}
+	if got := (dtsx.ValidationError{Severity: "info", Message: "Package has no properties"}).Error(); got != "[info] Package has no properties" {
+		t.Errorf("Unexpected formatting without a path %q", got)
+	}
+
+	var err error = ve
+	wrapped := fmt.Errorf("validating package: %w", err)
+	if !errors.Is(wrapped, ve) {
+		t.Error("Expected errors.Is to find the wrapped ValidationError")
+	}
+	var target dtsx.ValidationError
+	if !errors.As(wrapped, &target) || target.Path != "Variables.User::Count" {
+		t.Errorf("Expected errors.As to recover the ValidationError, got %+v", target)
+	}
+
+	// PackageValidator results are pointers and satisfy error as well
+	pkg := dtsx.NewPackageBuilder().AddVariable("User", "Count", "1").AddVariable("User", "Count", "2").Build()
+	results := dtsx.NewPackageValidator(pkg).Validate()
+	if len(results) == 0 {
+		t.Fatal("Expected a duplicate variable error")
+	}
+	err = results[0]
+	if !strings.HasPrefix(err.Error(), "[error] Variables.User::Count: ") {
+		t.Errorf("Unexpected formatting %q", err.Error())
+	}
+	var ptrTarget *dtsx.ValidationError
+	if !errors.As(fmt.Errorf("wrap: %w", err), &ptrTarget) || ptrTarget != results[0] {
+		t.Error("Expected errors.As to recover the *ValidationError")
+	}
+}
+
+func TestGetLogProviders(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Logged">
+  <DTS:ConnectionManagers>
+    <DTS:ConnectionManager DTS:refId="Package.ConnectionManagers[Log File]" DTS:CreationName="FILE" DTS:ObjectName="Log File">
+      <DTS:ObjectData>
+        <DTS:ConnectionManager DTS:ConnectionString="C:\Logs\etl.log" />
+      </DTS:ObjectData>
+    </DTS:ConnectionManager>
+  </DTS:ConnectionManagers>
+  <DTS:LogProviders>
+    <DTS:LogProvider DTS:ConfigString="Log File" DTS:CreationName="Microsoft.LogProviderTextFile" DTS:Description="Writes log entries for events to a CSV file" DTS:DTSID="{4E5F6A7B-0000-0000-0000-000000000001}" DTS:ObjectName="SSIS log provider for Text files">
+      <DTS:ObjectData>
+        <InnerObject />
+      </DTS:ObjectData>
+    </DTS:LogProvider>
+  </DTS:LogProviders>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	providers := pkg.GetLogProviders()
+	if len(providers) != 1 {
+		t.Fatalf("Expected 1 log provider, got %d", len(providers))
+	}
+	lp := providers[0]
+	if lp.Type != "Text file" || lp.CreationName != "Microsoft.LogProviderTextFile" {
+		t.Errorf("Expected a text file provider, got type %q (%s)", lp.Type, lp.CreationName)
+	}
+	if lp.ConfigString != "Log File" || lp.Name != "SSIS log provider for Text files" {
+		t.Errorf("Unexpected provider configuration %+v", lp)
+	}
+
+	// Older formats carry the same settings as properties
+	name := func(s string) *string { return &s }
+	prop := func(n, v string) *schema.Property {
+		return &schema.Property{NameAttr: name(n), PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: v}}}
+	}
+	pkg.LogProviders = nil
+	pkg.LogProvider = []*schema.LogProviderType{{Property: []*schema.Property{
+		prop("ConfigString", "Application"),
+		prop("CreationName", "DTS.LogProviderEventLog.2"),
+		prop("ObjectName", "SSIS log provider for Windows Event Log"),
+	}}}
+	providers = pkg.GetLogProviders()
+	if len(providers) != 1 || providers[0].Type != "Windows Event Log" || providers[0].ConfigString != "Application" {
+		t.Errorf("Expected the event log provider from properties, got %+v", providers)
+	}
+
+	if got := dtsx.NewPackageBuilder().Build().GetLogProviders(); len(got) != 0 {
+		t.Errorf("Expected no log providers, got %d", len(got))
+	}
+}
+
+func TestStripSensitive(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Secrets">
+  <DTS:ConnectionManagers>
+    <DTS:ConnectionManager DTS:refId="Package.ConnectionManagers[Warehouse]" DTS:CreationName="OLEDB" DTS:ObjectName="Warehouse">
+      <DTS:ObjectData>
+        <DTS:ConnectionManager DTS:ConnectionString="Data Source=.;User ID=etl;Password=&quot;s3cr;et&quot;;Initial Catalog=Warehouse;">
+          <DTS:Password DTS:Name="Password" Sensitive="1" Encrypted="1">AQAAANCMnd8BFdERjHoAwE</DTS:Password>
+        </DTS:ConnectionManager>
+      </DTS:ObjectData>
+    </DTS:ConnectionManager>
+  </DTS:ConnectionManagers>
+  <DTS:PackageParameters>
+    <DTS:PackageParameter DTS:ObjectName="ApiKey" DTS:DataType="8" DTS:Sensitive="True">
+      <DTS:Property DTS:DataType="8" DTS:Name="ParameterValue" Sensitive="1" Encrypted="1">AQAAAKEYKEYKEY</DTS:Property>
+    </DTS:PackageParameter>
+  </DTS:PackageParameters>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	// Sensitive flags keep their unprefixed form on a round trip
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if !strings.Contains(string(data), `DTS:Name="ParameterValue" Sensitive="1" Encrypted="1"`) || !strings.Contains(string(data), `DTS:Sensitive="True"`) {
+		t.Errorf("Expected sensitive flags to round trip, got:\n%s", data)
+	}
+
+	if err := pkg.SetProtectionLevel("Bogus"); err == nil {
+		t.Error("Expected an error for an unknown protection level")
+	}
+	if err := pkg.SetProtectionLevel("DontSaveSensitive"); err != nil {
+		t.Fatalf("SetProtectionLevel failed: %v", err)
+	}
+	if pkg.ProtectionLevelAttr == nil || *pkg.ProtectionLevelAttr != "0" {
+		t.Errorf("Expected ProtectionLevel 0, got %v", pkg.ProtectionLevelAttr)
+	}
+
+	// Password element, parameter value and connection string password
+	if removed := pkg.StripSensitive(); removed != 3 {
+		t.Errorf("Expected 3 sensitive values removed, got %d", removed)
+	}
+	cm := pkg.ConnectionManagers.ConnectionManager[0]
+	if got := *cm.ObjectData.ConnectionManager.ConnectionStringAttr; got != "Data Source=.;User ID=etl;Initial Catalog=Warehouse;" {
+		t.Errorf("Unexpected stripped connection string %q", got)
+	}
+	if cm.ObjectData.ConnectionManager.Password != nil {
+		t.Error("Expected the password element to be removed")
+	}
+	if props := pkg.PackageParameters.PackageParameter[0].Property; len(props) != 0 {
+		t.Errorf("Expected the sensitive parameter value to be removed, got %d properties", len(props))
+	}
+
+	data, err = dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	out := string(data)
+	if !strings.Contains(out, `DTS:ProtectionLevel="0"`) {
+		t.Error("Expected the marshalled package to carry ProtectionLevel 0")
+	}
+	for _, secret := range []string{"s3cr", "AQAAANCMnd8", "KEYKEY"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %q to be stripped from the output", secret)
+		}
+	}
+	if removed := pkg.StripSensitive(); removed != 0 {
+		t.Errorf("Expected nothing left to strip, got %d", removed)
+	}
+
+	// Older formats carry the level as a property
+	legacy := dtsx.NewPackageBuilder().Build()
+	name := "ProtectionLevel"
+	legacy.Property = append(legacy.Property, &schema.Property{
+		NameAttr:                &name,
+		PropertyElementBaseType: &schema.PropertyElementBaseType{AnySimpleType: &schema.AnySimpleType{Value: "1"}},
+	})
+	if err := legacy.SetProtectionLevel("2"); err != nil {
+		t.Fatalf("SetProtectionLevel failed: %v", err)
+	}
+	if got := legacy.Property[len(legacy.Property)-1].Value; got != "2" || legacy.ProtectionLevelAttr != nil {
+		t.Errorf("Expected the ProtectionLevel property to be updated, got %q", got)
+	}
+}
+
+func TestGetExecutableByName(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Lookup">
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Stage" DTS:ExecutableType="STOCK:SEQUENCE" DTS:ObjectName="Stage">
+      <DTS:Executables>
+        <DTS:Executable DTS:refId="Package\Stage\Truncate" DTS:ExecutableType="Microsoft.ExecuteSQLTask" DTS:ObjectName="Truncate" />
+      </DTS:Executables>
+    </DTS:Executable>
+    <DTS:Executable DTS:ExecutableType="Microsoft.SendMailTask">
+      <DTS:Property DTS:Name="ObjectName">Report</DTS:Property>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	for name, exType := range map[string]string{
+		"Stage":    "STOCK:SEQUENCE",
+		"Truncate": "Microsoft.ExecuteSQLTask",
+		"Report":   "Microsoft.SendMailTask",
+	} {
+		exec, err := pkg.GetExecutableByName(name)
+		if err != nil {
+			t.Errorf("GetExecutableByName(%s) failed: %v", name, err)
+			continue
+		}
+		if exec.ExecutableTypeAttr != exType {
+			t.Errorf("GetExecutableByName(%s) returned %s, expected %s", name, exec.ExecutableTypeAttr, exType)
+		}
+	}
+
+	for _, name := range []string{"Missing", "unnamed", ""} {
+		if exec, err := pkg.GetExecutableByName(name); err == nil {
+			t.Errorf("Expected an error for %q, got %s", name, dtsx.GetExecutableName(exec))
+		}
+	}
+}
+
+func TestPackageParserRefresh(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Count", "1", "Int32").
+		AddSQLTask("Load", "", "SELECT 1").
+		Build()
+	parser := dtsx.NewPackageParser(pkg)
+	if value, _ := parser.GetVariableValue("User::Count"); value != int64(1) {
+		t.Fatalf("Expected initial value 1, got %v", value)
+	}
+	if result, _ := parser.EvaluateExpression("@[User::Count] + 1"); result != int64(2) {
+		t.Fatalf("Expected 2, got %v", result)
+	}
+
+	v, err := pkg.GetVariableByName("User::Count")
+	if err != nil {
+		t.Fatalf("GetVariableByName failed: %v", err)
+	}
+	v.VariableValue.Value = "41"
+	extra := dtsx.NewPackageBuilder().AddVariable("User", "Added", "x").Build()
+	pkg.Variables.Variable = append(pkg.Variables.Variable, extra.Variables.Variable...)
+	pkg.Executable[0].RefIdAttr = stringPtr(`Package\Load Orders`)
+
+	// Until Refresh the parser serves the values it indexed
+	if value, _ := parser.GetVariableValue("User::Count"); value != int64(1) {
+		t.Errorf("Expected the stale value before Refresh, got %v", value)
+	}
+
+	parser.Refresh()
+	if value, _ := parser.GetVariableValue("User::Count"); value != int64(41) {
+		t.Errorf("Expected 41 after Refresh, got %v", value)
+	}
+	if result, _ := parser.EvaluateExpression("@[User::Count] + 1"); result != int64(42) {
+		t.Errorf("Expected the cached expression to be re-evaluated, got %v", result)
+	}
+	if _, err := parser.GetVariableValue("User::Added"); err != nil {
+		t.Errorf("Expected the added variable after Refresh: %v", err)
+	}
+	if _, err := parser.GetExecutable(`Package\Load Orders`); err != nil {
+		t.Errorf("Expected the renamed executable after Refresh: %v", err)
+	}
+}
+
+func TestNewVariableValue(t *testing.T) {
+	for name, code := range map[string]int{
+		"String":  8,
+		"Int32":   3,
+		"int64":   20,
+		"Boolean": 11,
+		"DT_R8":   5,
+		"unknown": 8,
+	} {
+		if got := dtsx.DataTypeCode(name); got != code {
+			t.Errorf("DataTypeCode(%s) = %d, expected %d", name, got, code)
+		}
+	}
+
+	value := dtsx.NewVariableValue("42", "Int32")
+	if value.DataTypeAttr == nil || *value.DataTypeAttr != 3 || value.Value != "42" {
+		t.Fatalf("Unexpected variable value %+v", value)
+	}
+
+	// A variable assembled without the builder evaluates with its type
+	pkg := dtsx.NewPackageBuilder().Build()
+	pkg.Variables = &schema.VariablesType{Variable: []*schema.VariableType{{
+		NamespaceAttr:  stringPtr("User"),
+		ObjectNameAttr: stringPtr("Answer"),
+		VariableValue:  value,
+	}}}
+	if result, err := dtsx.EvaluateExpression("@[User::Answer] / (DT_I4)4", pkg); err != nil || result != int64(10) {
+		t.Errorf("Expected integer division on the typed variable, got %v (err %v)", result, err)
+	}
+}
+
+func TestDataTypeCodeFullSet(t *testing.T) {
+	tests := []struct {
+		names []string
+		code  int
+	}{
+		{[]string{"sbyte", "int8", "DT_I1"}, 16},
+		{[]string{"byte", "UInt8", "DT_UI1"}, 17},
+		{[]string{"short", "Int16", "DT_I2"}, 2},
+		{[]string{"ushort", "UInt16", "DT_UI2"}, 18},
+		{[]string{"uint", "UInt32", "DT_UI4"}, 19},
+		{[]string{"UInt64", "DT_UI8"}, 21},
+		{[]string{"date", "DT_DATE"}, 7},
+		{[]string{"dbdate", "DT_DBDATE"}, 133},
+		{[]string{"time", "DT_DBTIME"}, 134},
+		{[]string{"time2", "DT_DBTIME2"}, 145},
+		{[]string{"datetimeoffset", "DT_DBTIMESTAMPOFFSET"}, 146},
+		{[]string{"datetime2", "DT_DBTIMESTAMP2"}, 304},
+		{[]string{"filetime", "DT_FILETIME"}, 64},
+		{[]string{"numeric", "DT_NUMERIC"}, 131},
+		{[]string{"currency", "money", "DT_CY"}, 6},
+		{[]string{"single", "real", "DT_R4"}, 4},
+		{[]string{"bytes", "binary", "DT_BYTES"}, 128},
+		{[]string{"image", "DT_IMAGE"}, 301},
+		{[]string{"text", "DT_TEXT"}, 302},
+		{[]string{"ntext", "DT_NTEXT"}, 303},
+		{[]string{"Object", "DT_OBJECT"}, 13},
+		{[]string{"DT_WSTR", "wstr"}, 8},
+	}
+	for _, tt := range tests {
+		for _, name := range tt.names {
+			if got := dtsx.DataTypeCode(name); got != tt.code {
+				t.Errorf("DataTypeCode(%s) = %d, expected %d", name, got, tt.code)
+			}
+		}
+	}
+
+	pkg := dtsx.NewPackageBuilder().AddVariableWithType("User", "Retries", "3", "byte").Build()
+	if code := *pkg.Variables.Variable[0].VariableValue.DataTypeAttr; code != 17 {
+		t.Errorf("Expected a byte variable to get DT_UI1 (17), got %d", code)
+	}
+	if result, err := dtsx.EvaluateExpression("@[User::Retries] * (DT_I4)2", pkg); err != nil || result != int64(6) {
+		t.Errorf("Expected the byte variable to evaluate as an integer, got %v (err %v)", result, err)
+	}
+}
+
+func TestMarshalWithOptions(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "Table", "dbo.Orders").
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;Initial Catalog=Warehouse;").
+		AddSQLTask("Extract", "Warehouse", "SELECT * FROM dbo.Orders WHERE Total > 5").
+		AddSQLTask("Load", "Warehouse", "EXEC dbo.Load").
+		AddPrecedenceConstraint("Extract", "Load", "Success").
+		Build()
+	expected, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		opts  dtsx.MarshalOptions
+		check func(doc string) bool
+	}{
+		{"compact", dtsx.MarshalOptions{Compact: true}, func(doc string) bool {
+			// Only the XML declaration and the final newline break lines
+			return strings.Count(doc, "\n") == 2 && !strings.Contains(doc, "  <")
+		}},
+		{"tabs", dtsx.MarshalOptions{Indent: "\t"}, func(doc string) bool {
+			return strings.Contains(doc, "\n\t<DTS:") && strings.Contains(doc, "\n\t\t<DTS:") && !strings.Contains(doc, "\n  <")
+		}},
+		{"default", dtsx.MarshalOptions{}, func(doc string) bool { return doc == string(expected) }},
+	}
+	for _, tt := range tests {
+		data, err := dtsx.MarshalWithOptions(pkg, tt.opts)
+		if err != nil {
+			t.Fatalf("%s: MarshalWithOptions failed: %v", tt.name, err)
+		}
+		if !tt.check(string(data)) {
+			t.Errorf("%s: unexpected layout:\n%s", tt.name, data)
+		}
+
+		// Layout is not significant: the document decodes to the same package
+		roundTrip, err := dtsx.Unmarshal(data)
+		if err != nil {
+			t.Fatalf("%s: Unmarshal failed: %v", tt.name, err)
+		}
+		if again, _ := dtsx.Marshal(roundTrip); string(again) != string(expected) {
+			t.Errorf("%s: round trip changed the package:\n%s", tt.name, again)
+		}
+	}
+
+	var b bytes.Buffer
+	n, err := pkg.WriteTo(&b)
+	if err != nil || n != int64(len(expected)) || b.String() != string(expected) {
+		t.Errorf("WriteTo wrote %d bytes (err %v), expected the Marshal output", n, err)
+	}
+	var _ io.WriterTo = pkg
+	if _, err := dtsx.MarshalWithOptions(nil, dtsx.MarshalOptions{}); err == nil {
+		t.Error("Expected an error for a nil package")
+	}
+}
+
+func TestValidateAgainstSchema(t *testing.T) {
+	const valid = `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:ExecutableType="SSIS.Package.2">
+<DTS:Property DTS:Name="PackageFormatVersion">3</DTS:Property>
+<DTS:Property DTS:Name="ObjectName">Pkg</DTS:Property>
+<DTS:Variable>
+<DTS:Property DTS:Name="ObjectName">Count</DTS:Property>
+<DTS:Property DTS:Name="Namespace">User</DTS:Property>
+<DTS:VariableValue DTS:DataType="3">0</DTS:VariableValue>
+</DTS:Variable>
+<DTS:LoggingOptions>
+<DTS:Property DTS:Name="LoggingMode">0</DTS:Property>
+</DTS:LoggingOptions>
+<DTS:Executable DTS:ExecutableType="STOCK:SEQUENCE">
+<DTS:Property DTS:Name="ObjectName">Seq</DTS:Property>
+<DTS:LoggingOptions>
+<DTS:Property DTS:Name="LoggingMode">0</DTS:Property>
+</DTS:LoggingOptions>
+</DTS:Executable>
+</DTS:Executable>`
+
+	if results := dtsx.ValidateAgainstSchema([]byte(valid)); len(results) != 0 {
+		t.Fatalf("expected a valid package, got %v", results)
+	}
+
+	// The nested executable lacks its ExecutableType and LoggingOptions, and
+	// carries an undeclared attribute, an unknown child and a bad data type
+	malformed := strings.NewReplacer(
+		`<DTS:Executable DTS:ExecutableType="STOCK:SEQUENCE">`, `<DTS:Executable DTS:Colour="red">`+"\n<DTS:Widget/>",
+		`DTS:DataType="3"`, `DTS:DataType="999"`,
+	).Replace(valid)
+	malformed = strings.Replace(malformed, "<DTS:LoggingOptions>\n<DTS:Property DTS:Name=\"LoggingMode\">0</DTS:Property>\n</DTS:LoggingOptions>\n</DTS:Executable>\n</DTS:Executable>", "</DTS:Executable>\n</DTS:Executable>", 1)
+
+	expected := []string{
+		`[error] line 8: attribute DTS:DataType on element DTS:VariableValue has invalid value "999": value is not one of the allowed values`,
+		`[error] line 13: attribute DTS:Colour is not allowed on element DTS:Executable`,
+		`[error] line 13: element DTS:Executable is missing required attribute DTS:ExecutableType`,
+		`[error] line 14: element DTS:Widget is not allowed in DTS:Executable`,
+		`[error] line 13: element DTS:Executable is missing required child element DTS:LoggingOptions`,
+	}
+	results := dtsx.ValidateAgainstSchema([]byte(malformed))
+	if len(results) != len(expected) {
+		t.Fatalf("expected %d results, got %d: %v", len(expected), len(results), results)
+	}
+	for i, want := range expected {
+		if got := results[i].Error(); got != want {
+			t.Errorf("result %d: expected %q, got %q", i, want, got)
+		}
+	}
+
+	results = dtsx.ValidateAgainstSchema([]byte("<DTS:Executable xmlns:DTS=\"www.microsoft.com/SqlServer/Dts\">\n<DTS:Property>"))
+	if len(results) == 0 || !strings.Contains(results[len(results)-1].Message, "not well-formed") {
+		t.Errorf("expected a well-formedness error last, got %v", results)
+	}
+
+	results = dtsx.ValidateAgainstSchema([]byte(`<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package"/>`))
+	if len(results) != 1 || results[0].Severity != "warning" {
+		t.Errorf("expected a single warning for a 2012+ package, got %v", results)
+	}
+
+	// Marshal output has no root refId but is still in the 2012+ format
+	built, err := dtsx.Marshal(dtsx.NewPackageBuilder().
+		AddVariable("User", "A", "1").
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;").
+		AddSQLTask("Load", "Warehouse", "SELECT 1").
+		Build())
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if results := dtsx.ValidateAgainstSchema(built); len(results) != 1 || results[0].Severity != "warning" {
+		t.Errorf("expected a single warning for builder output, got %v", results)
+	}
+
+	// Every real sample is a 2012+ package
+	files, _ := filepath.Glob(filepath.Join("SSIS_EXAMPLES", "*.dtsx"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", file, err)
+		}
+		if results := dtsx.ValidateAgainstSchema(data); len(results) != 1 || results[0].Severity != "warning" {
+			t.Errorf("%s: expected a single warning, got %v", file, results)
+		}
+	}
+}
+
+func TestUnmarshalErrorPosition(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package">
+  <DTS:Variables>
+    <DTS:Variable DTS:ObjectName="Count"
+`)
+	_, err := dtsx.Unmarshal(data)
+	if err == nil {
+		t.Fatal("expected an error for a truncated element")
+	}
+	if !strings.Contains(err.Error(), "line 5") {
+		t.Errorf("expected the error to cite line 5, got %q", err)
+	}
+	var syntaxErr *xml.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("expected the error to wrap *xml.SyntaxError, got %T", err)
+	}
+
+	// Decoding errors that are not syntax errors carry the position too
+	data = []byte("<DTS:Executable xmlns:DTS=\"www.microsoft.com/SqlServer/Dts\">\n  <DTS:Variables>\n    <DTS:Variable DTS:ObjectName=\"Count\">\n      <DTS:VariableValue DTS:DataType=\"abc\">1</DTS:VariableValue>\n")
+	if _, err := dtsx.Unmarshal(data); err == nil || !strings.Contains(err.Error(), "line 4") {
+		t.Errorf("expected an error citing line 4, got %v", err)
+	}
+}
+
+func TestGetExpressionsDataflowComponents(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Flows">
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Load" DTS:ObjectName="Load" DTS:ExecutableType="Microsoft.Pipeline">
+      <DTS:PropertyExpression DTS:Name="[Source].[SqlCommand]">"SELECT * FROM " + @[User::Table]</DTS:PropertyExpression>
+      <DTS:PropertyExpression DTS:Name="Disable">@[User::SkipLoad]</DTS:PropertyExpression>
+      <DTS:ObjectData>
+        <pipeline version="1">
+          <components>
+            <component refId="Package\Load\Source" name="Source" componentClassID="Microsoft.OLEDBSource">
+              <properties>
+                <property name="SqlCommand" expressionType="Notify">SELECT 1</property>
+              </properties>
+            </component>
+          </components>
+        </pipeline>
+      </DTS:ObjectData>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`)
+
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	expressions := pkg.GetExpressions().Results.([]*dtsx.ExpressionInfo)
+	if len(expressions) != 2 {
+		t.Fatalf("expected 2 expressions, got %d", len(expressions))
+	}
+
+	component := expressions[0]
+	if component.Location != "DataflowComponent" || component.Name != "SqlCommand" {
+		t.Errorf("expected a DataflowComponent SqlCommand expression, got %s %s", component.Location, component.Name)
+	}
+	if component.Context != "Executable[0] (Load) Component Source" {
+		t.Errorf("unexpected context %q", component.Context)
+	}
+	if component.Expression != `"SELECT * FROM " + @[User::Table]` {
+		t.Errorf("unexpected expression %q", component.Expression)
+	}
+
+	if task := expressions[1]; task.Location != "Executable" || task.Name != "Disable" {
+		t.Errorf("expected the task's own expression at Executable, got %s %s", task.Location, task.Name)
+	}
+}
+
+func TestAddEventHandler(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddExecutable("Load", "Microsoft.ExecuteSQLTask").
+		AddEventHandler(`Package\Load`, "OnError").
+		AddExecutable("Notify", "Microsoft.SendMailTask").
+		Done().
+		Build()
+
+	handlers := pkg.GetEventHandlers().Results.([]*dtsx.EventHandlerInfo)
+	if len(handlers) != 1 {
+		t.Fatalf("expected 1 event handler, got %d", len(handlers))
+	}
+	h := handlers[0]
+	if h.EventName != "OnError" || h.HostRefId != `Package\Load` || h.HostName != "Load" {
+		t.Errorf("unexpected handler %s on %s (%s)", h.EventName, h.HostName, h.HostRefId)
+	}
+	if len(h.Executables) != 1 || h.Executables[0] != "Notify" {
+		t.Errorf("expected the handler to run Notify, got %v", h.Executables)
+	}
+	if ref := *h.Handler.Executables[0].RefIdAttr; ref != `Package\Load.EventHandlers[OnError]\Notify` {
+		t.Errorf("unexpected handler task refId %q", ref)
+	}
+
+	// Package-level handlers survive a marshal round trip
+	eb, err := pkg.AddEventHandler("Package", "OnPreExecute")
+	if err != nil {
+		t.Fatalf("AddEventHandler failed: %v", err)
+	}
+	eb.AddExecutable("Log Start", "Microsoft.ExecuteSQLTask")
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	reparsed, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	handlers = reparsed.GetEventHandlers().Results.([]*dtsx.EventHandlerInfo)
+	if len(handlers) != 2 || handlers[0].EventName != "OnPreExecute" || handlers[0].HostType != "Package" {
+		t.Fatalf("expected the package OnPreExecute handler first after round trip, got %d handlers", len(handlers))
+	}
+	if len(handlers[0].Executables) != 1 || handlers[0].Executables[0] != "Log Start" {
+		t.Errorf("expected the package handler to run Log Start, got %v", handlers[0].Executables)
+	}
+
+	if _, err := pkg.AddEventHandler(`Package\Missing`, "OnError"); err == nil {
+		t.Error("expected an error for an unknown target")
+	}
+}
+
+func TestGetForLoops(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Loops">
+  <DTS:Variables>
+    <DTS:Variable DTS:Namespace="User" DTS:ObjectName="Counter">
+      <DTS:VariableValue DTS:DataType="3">0</DTS:VariableValue>
+    </DTS:Variable>
+  </DTS:Variables>
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Retry" DTS:ObjectName="Retry" DTS:ExecutableType="STOCK:FORLOOP"
+      DTS:InitExpression="@[User::Counter] = 0"
+      DTS:EvalExpression="@[User::Counter] &lt; 10"
+      DTS:AssignExpression="@[User::Counter] = @[User::Counter] + 1" />
+  </DTS:Executables>
+</DTS:Executable>`)
+
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	loops := pkg.GetForLoops()
+	if len(loops) != 1 {
+		t.Fatalf("expected 1 For Loop, got %d", len(loops))
+	}
+	loop := loops[0]
+	if loop.Name != "Retry" || loop.RefId != `Package\Retry` {
+		t.Errorf("unexpected loop %s (%s)", loop.Name, loop.RefId)
+	}
+	if loop.InitExpression != "@[User::Counter] = 0" {
+		t.Errorf("unexpected init expression %q", loop.InitExpression)
+	}
+	if loop.EvalExpression != "@[User::Counter] < 10" {
+		t.Errorf("unexpected eval expression %q", loop.EvalExpression)
+	}
+	if loop.AssignExpression != "@[User::Counter] = @[User::Counter] + 1" {
+		t.Errorf("unexpected assign expression %q", loop.AssignExpression)
+	}
+
+	var names []string
+	for _, expr := range pkg.GetExpressions().Results.([]*dtsx.ExpressionInfo) {
+		if expr.Location == "ForLoop" {
+			names = append(names, expr.Name)
+		}
+	}
+	if want := []string{"InitExpression", "EvalExpression", "AssignExpression"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("expected For Loop expressions %v, got %v", want, names)
+	}
+
+	// Assignments validate on their assigned value
+	for _, e := range dtsx.NewPackageValidator(pkg).Validate() {
+		if strings.HasPrefix(e.Path, "ForLoop") {
+			t.Errorf("unexpected validation error: %v", e)
+		}
+	}
+	loop.Executable.EvalExpressionAttr = stringPtr("@[User::Counter] <")
+	found := false
+	for _, e := range dtsx.NewPackageValidator(pkg).Validate() {
+		found = found || strings.HasPrefix(e.Path, "ForLoop") && strings.Contains(e.Message, "syntax error")
+	}
+	if !found {
+		t.Error("expected a syntax error for a malformed eval expression")
+	}
+}
+
+func TestResolvePropertyPath(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Paths">
+  <DTS:ConnectionManagers>
+    <DTS:ConnectionManager DTS:refId="Package.ConnectionManagers[Warehouse]" DTS:ObjectName="Warehouse" DTS:CreationName="OLEDB">
+      <DTS:ObjectData>
+        <DTS:ConnectionManager DTS:ConnectionString="Data Source=DW;Initial Catalog=Sales;" />
+      </DTS:ObjectData>
+    </DTS:ConnectionManager>
+  </DTS:ConnectionManagers>
+  <DTS:Variables>
+    <DTS:Variable DTS:Namespace="User" DTS:ObjectName="BatchSize">
+      <DTS:VariableValue DTS:DataType="3">500</DTS:VariableValue>
+    </DTS:Variable>
+  </DTS:Variables>
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Stage" DTS:ObjectName="Stage" DTS:ExecutableType="STOCK:SEQUENCE">
+      <DTS:Executables>
+        <DTS:Executable DTS:refId="Package\Stage\Load" DTS:ObjectName="Load" DTS:ExecutableType="Microsoft.ExecuteSQLTask" />
+      </DTS:Executables>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`)
+
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	for path, want := range map[string]interface{}{
+		`\Package.Variables[User::BatchSize].Value`:                    int64(500),
+		`\Package.Variables[User::BatchSize].Properties[Value]`:        int64(500),
+		`\Package.Variables[User::BatchSize].Namespace`:                "User",
+		`\Package.Connections[Warehouse].ConnectionString`:             "Data Source=DW;Initial Catalog=Sales;",
+		`\Package.Connections[Warehouse].Properties[ConnectionString]`: "Data Source=DW;Initial Catalog=Sales;",
+		`\Package.Properties[ObjectName]`:                              "Paths",
+		`\Package\Stage\Load.Properties[ExecutableType]`:               "Microsoft.ExecuteSQLTask",
+	} {
+		got, err := pkg.ResolvePropertyPath(path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %v (%T), got %v (%T)", path, want, want, got, got)
+		}
+	}
+
+	for _, path := range []string{
+		`Package.Variables[User::BatchSize].Value`,
+		`\Package.Variables[User::Missing].Value`,
+		`\Package.Connections[Missing].ConnectionString`,
+		`\Package\Missing.Properties[ExecutableType]`,
+		`\Package.Variables[User::BatchSize`,
+		`\Package.Properties[NoSuchProperty]`,
+	} {
+		if _, err := pkg.ResolvePropertyPath(path); err == nil {
+			t.Errorf("%s: expected an error", path)
+		}
+	}
+}
+
+func TestSetPropertyByPath(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "Region", "East").
+		AddConnection("Warehouse", "OLEDB", "Data Source=DW;").
+		Build()
+
+	if err := pkg.SetPropertyByPath(`\Package.Variables[User::Region].Value`, "West"); err != nil {
+		t.Fatalf("SetPropertyByPath failed: %v", err)
+	}
+	v, err := pkg.GetVariableByName("User::Region")
+	if err != nil {
+		t.Fatalf("GetVariableByName failed: %v", err)
+	}
+	if got := dtsx.GetVariableValue(v); got != "West" {
+		t.Errorf("expected variable value West, got %q", got)
+	}
+
+	if err := pkg.SetPropertyByPath(`\Package.Connections[Warehouse].ConnectionString`, "Data Source=DW2;"); err != nil {
+		t.Fatalf("SetPropertyByPath failed: %v", err)
+	}
+	cm := pkg.GetConnections().Results.([]*schema.ConnectionManagerType)[0]
+	if got := dtsx.GetConnectionString(cm); got != "Data Source=DW2;" {
+		t.Errorf("expected updated connection string, got %q", got)
+	}
+
+	// Attributes and new properties can be set too, and read back by path
+	if err := pkg.SetPropertyByPath(`\Package.Properties[ObjectName]`, "Nightly"); err != nil {
+		t.Fatalf("SetPropertyByPath failed: %v", err)
+	}
+	if err := pkg.SetPropertyByPath(`\Package.Variables[User::Region].Properties[Description]`, "Sales region"); err != nil {
+		t.Fatalf("SetPropertyByPath failed: %v", err)
+	}
+	for path, want := range map[string]string{
+		`\Package.Properties[ObjectName]`:                          "Nightly",
+		`\Package.Variables[User::Region].Properties[Description]`: "Sales region",
+	} {
+		if got, err := pkg.ResolvePropertyPath(path); err != nil || got != want {
+			t.Errorf("%s: expected %q, got %v (%v)", path, want, got, err)
+		}
+	}
+
+	if err := pkg.SetPropertyByPath(`\Package.Variables[User::Missing].Value`, "x"); err == nil {
+		t.Error("expected an error for an unknown variable")
+	}
+}
+
+func TestGetExternalDependencies(t *testing.T) {
+	// The File Processing package from examples/build_package.go, with a task
+	// that runs the processing script
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "InputDirectory", "C:\\incoming\\files\\", "String").
+		AddVariableWithType("User", "FilePattern", "*.csv", "String").
+		AddConnection("FileSystem", "FILE", "C:\\file_operations\\").
+		AddConnection("ArchiveDB", "OLEDB", "Server=archive;Database=FileArchive;Trusted_Connection=True;").
+		AddConnection("Notify", "SMTP", "SmtpServer=mail.company.com;UseWindowsAuthentication=True;").
+		AddExecutable("Process Files", "Microsoft.ExecuteProcess").
+		Build()
+	pkg.Executable[0].ObjectData = &schema.ExecutableObjectDataType{
+		ExecuteProcessData: &schema.ExecuteProcessDataObjectDataType{
+			ExecutableAttr: stringPtr(`C:\tools\process.exe`),
+			ArgumentsAttr:  stringPtr(`-in C:\incoming\files\ -archive "\\archive\share\processed files" -pattern *.csv`),
+		},
+	}
+
+	expected := []dtsx.ExternalDependency{
+		{Kind: "File", Location: `C:\file_operations\`, Source: "FileSystem"},
+		{Kind: "Database", Location: "archive", Database: "FileArchive", Source: "ArchiveDB"},
+		{Kind: "SMTP", Location: "mail.company.com", Source: "Notify"},
+		{Kind: "Process", Location: `C:\tools\process.exe`, Source: "Process Files"},
+		{Kind: "File", Location: `C:\incoming\files\`, Source: "Process Files"},
+		{Kind: "File", Location: `\\archive\share\processed files`, Source: "Process Files"},
+	}
+	if got := pkg.GetExternalDependencies(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("unexpected dependencies:\n got %+v\nwant %+v", got, expected)
+	}
+}
+
+func TestTypedVariableAccessors(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Count", "42", "Int32").
+		AddVariableWithType("User", "Ratio", "2.5", "Double").
+		AddVariableWithType("User", "Enabled", "True", "Boolean").
+		AddVariableWithType("User", "Name", "Sales", "String").
+		AddVariableWithType("User", "Code", "007", "String").
+		Build()
+	parser := dtsx.NewPackageParser(pkg)
+
+	if n, err := parser.GetVariableInt("User::Count"); err != nil || n != 42 {
+		t.Errorf("GetVariableInt(Count) = %d, %v; expected 42", n, err)
+	}
+	if n, err := parser.GetVariableInt("User::Code"); err != nil || n != 7 {
+		t.Errorf("GetVariableInt(Code) = %d, %v; expected numeric text to coerce to 7", n, err)
+	}
+	for _, name := range []string{"User::Ratio", "User::Enabled", "User::Name", "User::Missing"} {
+		if _, err := parser.GetVariableInt(name); err == nil {
+			t.Errorf("GetVariableInt(%s): expected an error", name)
+		}
+	}
+
+	if b, err := parser.GetVariableBool("User::Enabled"); err != nil || !b {
+		t.Errorf("GetVariableBool(Enabled) = %v, %v; expected true", b, err)
+	}
+	if _, err := parser.GetVariableBool("User::Count"); err == nil || !strings.Contains(err.Error(), "is an integer, not a boolean") {
+		t.Errorf("GetVariableBool(Count): expected a type mismatch error, got %v", err)
+	}
+
+	if s, err := parser.GetVariableString("User::Name"); err != nil || s != "Sales" {
+		t.Errorf("GetVariableString(Name) = %q, %v; expected Sales", s, err)
+	}
+	if s, err := parser.GetVariableString("User::Code"); err != nil || s != "007" {
+		t.Errorf("GetVariableString(Code) = %q, %v; expected the stored text 007", s, err)
+	}
+	if _, err := parser.GetVariableString("User::Count"); err == nil || !strings.Contains(err.Error(), "not a string") {
+		t.Errorf("GetVariableString(Count): expected a type mismatch error, got %v", err)
+	}
+}
+
+func TestExpressionDetailsDependencies(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Days", "7", "Int32").
+		AddConnection("Archive", "FILE", `C:\archive\out.txt`).
+		Build()
+	expr := `@[ConnectionManager::Archive] + (DT_WSTR, 30) DATEADD("day", @[User::Days], GETDATE()) + $Project::Env + (DT_WSTR, 5) @[User::Days]`
+
+	details := dtsx.GetExpressionDetails(&dtsx.ExpressionInfo{Expression: expr, Location: "Variable"}, pkg)
+	expectedDeps := []string{"ConnectionManager::Archive", "User::Days", "Project::Env"}
+	if !reflect.DeepEqual(details.Dependencies, expectedDeps) {
+		t.Errorf("Dependencies = %v, expected %v", details.Dependencies, expectedDeps)
+	}
+	expectedFuncs := []string{"DATEADD", "GETDATE"}
+	if !reflect.DeepEqual(details.Functions, expectedFuncs) {
+		t.Errorf("Functions = %v, expected %v", details.Functions, expectedFuncs)
+	}
+}
+
+func TestRenameVariable(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "Region", "West").
+		AddVariable("User", "Label", "").
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;").
+		AddConnectionExpression("Warehouse", "InitialCatalog", `"Sales_" + @[User::Region]`).
+		AddSQLTask("Load", "Warehouse", "SELECT * FROM dbo.Orders WHERE Region = '@[User::Region]'").
+		Build()
+	label, _ := pkg.GetVariableByName("User::Label")
+	label.PropertyExpression = []*schema.PropertyExpressionElementType{{
+		NameAttr:      "Value",
+		AnySimpleType: &schema.AnySimpleType{Value: `@[User::Region] + "/" + @[User::Region]`},
+	}}
+
+	count, err := pkg.RenameVariable("User::Region", "User::SalesRegion")
+	if err != nil {
+		t.Fatalf("RenameVariable failed: %v", err)
+	}
+	if count != 4 {
+		t.Errorf("RenameVariable updated %d references, expected 4", count)
+	}
+	if _, err := pkg.GetVariableByName("User::SalesRegion"); err != nil {
+		t.Errorf("Renamed variable not found: %v", err)
+	}
+	if _, err := pkg.GetVariableByName("User::Region"); err == nil {
+		t.Error("Old variable name is still defined")
+	}
+	for _, expr := range pkg.GetExpressions().Results.([]*dtsx.ExpressionInfo) {
+		if strings.Contains(expr.Expression, "User::Region]") {
+			t.Errorf("Expression %q still references User::Region", expr.Expression)
+		}
+		if !strings.Contains(expr.Expression, "@[User::SalesRegion]") {
+			t.Errorf("Expression %q does not reference User::SalesRegion", expr.Expression)
+		}
+	}
+
+	if _, err := pkg.RenameVariable("User::Missing", "User::Other"); err == nil {
+		t.Error("Expected an error renaming an unknown variable")
+	}
+	if _, err := pkg.RenameVariable("User::SalesRegion", "User::Label"); err == nil {
+		t.Error("Expected an error renaming onto an existing variable")
+	}
+	if _, err := pkg.RenameVariable("User::SalesRegion", "SalesRegion"); err == nil {
+		t.Error("Expected an error for a name without a namespace")
+	}
+}
+
+func TestRenameVariableAttributeExpressions(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("SSIS_EXAMPLES", "Expressions.dtsx"))
+	if err != nil {
+		t.Skipf("Expressions.dtsx not available: %v", err)
+	}
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	// DB_CS and DB_NAME are evaluated from DTS:Expression attributes
+	found := 0
+	for _, info := range pkg.GetExpressions().Results.([]*dtsx.ExpressionInfo) {
+		if info.Location == "Variable" && info.Name == "Expression" && strings.Contains(info.Expression, "@[User::DB_NAME]") {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("Expected GetExpressions to report 2 variable expressions using DB_NAME, got %d", found)
+	}
+
+	count, err := pkg.RenameVariable("User::DB_NAME", "User::SERVER_NAME")
+	if err != nil {
+		t.Fatalf("RenameVariable failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("RenameVariable updated %d references, expected 2", count)
+	}
+	out, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(out), "User::DB_NAME") {
+		t.Error("Expected no references to User::DB_NAME after the rename")
+	}
+	if !strings.Contains(string(out), `DTS:EvaluateAsExpression="True"`) || !strings.Contains(string(out), `DTS:Expression="@[User::SERVER_NAME]"`) {
+		t.Error("Expected the variable expression attributes to round trip with the new name")
+	}
+}
+
+func TestRenameVariableInObjectData(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Derive">
+  <DTS:Variables>
+    <DTS:Variable DTS:Namespace="User" DTS:ObjectName="Cutoff">
+      <DTS:VariableValue DTS:DataType="3">10</DTS:VariableValue>
+    </DTS:Variable>
+  </DTS:Variables>
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Flow" DTS:ExecutableType="Microsoft.Pipeline" DTS:ObjectName="Flow">
+      <DTS:ObjectData>
+        <pipeline>
+          <components>
+            <component refId="Package\Flow\Derive" name="Derive" componentClassID="Microsoft.DerivedColumn">
+              <outputs>
+                <output name="Derived Column Output">
+                  <outputColumns>
+                    <outputColumn name="Limit">
+                      <properties>
+                        <property name="FriendlyExpression">@[User::Cutoff] + 1</property>
+                      </properties>
+                    </outputColumn>
+                  </outputColumns>
+                </output>
+              </outputs>
+            </component>
+          </components>
+        </pipeline>
+      </DTS:ObjectData>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	count, err := pkg.RenameVariable("User::Cutoff", "User::Threshold")
+	if err != nil {
+		t.Fatalf("RenameVariable failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 reference renamed, got %d", count)
+	}
+
+	out, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(out), "@[User::Cutoff]") || !strings.Contains(string(out), "@[User::Threshold] + 1") {
+		t.Errorf("Expected the FriendlyExpression to be renamed in the written XML:\n%s", out)
+	}
+}
+
+func TestRenameConnection(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Source", "OLEDB", "Data Source=.;Initial Catalog=Sales;").
+		AddConnection("Log", "FILE", `C:\logs\run.log`).
+		AddConnectionExpression("Log", "ConnectionString", `"C:\\logs\\" + @[ConnectionManager::Source] + ".log"`).
+		Build()
+	source := pkg.ConnectionManagers.ConnectionManager[0]
+	source.RefIdAttr = stringPtr("Package.ConnectionManagers[Source]")
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{{
+		RefIdAttr:          stringPtr(`Package\Load`),
+		ObjectNameAttr:     stringPtr("Load"),
+		ExecutableTypeAttr: "Microsoft.Pipeline",
+		ObjectData: &schema.ExecutableObjectDataType{
+			Pipeline: &schema.PipelineObjectDataType{
+				Components: &schema.PipelineComponentsType{
+					Component: []*schema.PipelineComponentType{{
+						NameAttr: stringPtr("OLE DB Source"),
+						Connections: &schema.PipelineComponentConnectionsType{
+							Connection: []*schema.PipelineComponentConnectionType{{
+								NameAttr:                stringPtr("OleDbConnection"),
+								ConnectionManagerIDAttr: stringPtr("Package.ConnectionManagers[Source]:external"),
+							}},
+						},
+					}},
+				},
+			},
+		},
+	}}
+
+	count, err := pkg.RenameConnection("Source", "SalesDB")
+	if err != nil {
+		t.Fatalf("RenameConnection failed: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("RenameConnection updated %d references, expected 2", count)
+	}
+	if name := dtsx.GetConnectionName(source); name != "SalesDB" {
+		t.Errorf("Connection name = %s, expected SalesDB", name)
+	}
+	if refId := *source.RefIdAttr; refId != "Package.ConnectionManagers[SalesDB]" {
+		t.Errorf("Connection refId = %s, expected Package.ConnectionManagers[SalesDB]", refId)
+	}
+	conn := pkg.Executable[0].ObjectData.Pipeline.Components.Component[0].Connections.Connection[0]
+	if id := *conn.ConnectionManagerIDAttr; id != "Package.ConnectionManagers[SalesDB]:external" {
+		t.Errorf("Component connectionManagerID = %s, expected the renamed refId", id)
+	}
+	expr := pkg.GetExpressions().Results.([]*dtsx.ExpressionInfo)[0].Expression
+	if !strings.Contains(expr, "@[ConnectionManager::SalesDB]") || strings.Contains(expr, "ConnectionManager::Source") {
+		t.Errorf("Expression was not rewritten: %s", expr)
+	}
+	if _, err := pkg.RenameConnection("Missing", "Other"); err == nil {
+		t.Error("Expected an error renaming an unknown connection")
+	}
+	if _, err := pkg.RenameConnection("SalesDB", "Log"); err == nil {
+		t.Error("Expected an error renaming onto an existing connection")
+	}
+}
+
+func TestRenameConnectionExpressionInObjectData(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Derive">
+  <DTS:ConnectionManagers>
+    <DTS:ConnectionManager DTS:refId="Package.ConnectionManagers[Warehouse]" DTS:ObjectName="Warehouse" DTS:CreationName="OLEDB">
+      <DTS:ObjectData>
+        <DTS:ConnectionManager DTS:ConnectionString="Data Source=DW;" />
+      </DTS:ObjectData>
+    </DTS:ConnectionManager>
+  </DTS:ConnectionManagers>
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Flow" DTS:ExecutableType="Microsoft.Pipeline" DTS:ObjectName="Flow">
+      <DTS:ObjectData>
+        <pipeline>
+          <components>
+            <component refId="Package\Flow\Derive" name="Derive" componentClassID="Microsoft.DerivedColumn">
+              <outputs>
+                <output name="Derived Column Output">
+                  <outputColumns>
+                    <outputColumn name="Source">
+                      <properties>
+                        <property name="FriendlyExpression">@[ConnectionManager::Warehouse]</property>
+                      </properties>
+                    </outputColumn>
+                  </outputColumns>
+                </output>
+              </outputs>
+            </component>
+          </components>
+        </pipeline>
+      </DTS:ObjectData>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	count, err := pkg.RenameConnection("Warehouse", "DW")
+	if err != nil {
+		t.Fatalf("RenameConnection failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 reference renamed, got %d", count)
+	}
+
+	out, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if strings.Contains(string(out), "@[ConnectionManager::Warehouse]") || !strings.Contains(string(out), "@[ConnectionManager::DW]") {
+		t.Errorf("Expected the FriendlyExpression to be renamed in the written XML:\n%s", out)
+	}
+}
+
+func TestRenameConnectionRoundTrip(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("SSIS_EXAMPLES", "Scanner.dtsx"))
+	if err != nil {
+		t.Skipf("Scanner.dtsx not available: %v", err)
+	}
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if _, err := pkg.RenameConnection("Cache Connection Manager", "Lookup Cache"); err != nil {
+		t.Fatalf("RenameConnection failed: %v", err)
+	}
+
+	out, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if n := strings.Count(string(out), "Package.ConnectionManagers[Cache Connection Manager]"); n != 0 {
+		t.Errorf("Expected no references to the old refId, found %d", n)
+	}
+	if !strings.Contains(string(out), `connectionManagerRefId="Package.ConnectionManagers[Lookup Cache]"`) {
+		t.Error("Expected component connectionManagerRefId attributes to be renamed")
+	}
+
+	reloaded, err := dtsx.Unmarshal(out)
+	if err != nil {
+		t.Fatalf("Unmarshal of renamed package failed: %v", err)
+	}
+	for _, name := range reloaded.GetUnusedConnections() {
+		if name == "Lookup Cache" {
+			t.Error("Expected the renamed connection to still be referenced after a round trip")
+		}
+	}
+}
+
+func TestNormalizeExecutableType(t *testing.T) {
+	tests := map[string]string{
+		"STOCK:SQLTask":            "Microsoft.ExecuteSQLTask",
+		"stock:sqltask":            "Microsoft.ExecuteSQLTask",
+		"STOCK:ExecuteSQLTask":     "Microsoft.ExecuteSQLTask",
+		"ExecuteSQLTask":           "Microsoft.ExecuteSQLTask",
+		"SQLTask":                  "Microsoft.ExecuteSQLTask",
+		"Microsoft.ExecuteSQLTask": "Microsoft.ExecuteSQLTask",
+		"Microsoft.SqlServer.Dts.Tasks.ExecuteSQLTask.ExecuteSQLTask, Microsoft.SqlServer.SQLTask, Version=10.0.0.0": "Microsoft.ExecuteSQLTask",
+		"STOCK:Pipeline":     "Microsoft.Pipeline",
+		"SSIS.Pipeline.3":    "Microsoft.Pipeline",
+		"DTS.Pipeline.1":     "Microsoft.Pipeline",
+		"Pipeline":           "Microsoft.Pipeline",
+		"DataFlow":           "Microsoft.Pipeline",
+		"Microsoft.Pipeline": "Microsoft.Pipeline",
+		"STOCK:ScriptTask":   "Microsoft.ScriptTask",
+		"Microsoft.SqlServer.Dts.Tasks.ScriptTask.ScriptTask, Microsoft.SqlServer.ScriptTask": "Microsoft.ScriptTask",
+		"STOCK:ExecutePackageTask": "Microsoft.ExecutePackageTask",
+		"STOCK:ExecuteProcessTask": "Microsoft.ExecuteProcess",
+		"STOCK:FileSystemTask":     "Microsoft.FileSystemTask",
+		"STOCK:SendMailTask":       "Microsoft.SendMailTask",
+		"STOCK:FTPTask":            "Microsoft.FtpTask",
+		"STOCK:BulkInsertTask":     "Microsoft.BulkInsertTask",
+		"STOCK:Sequence":           "STOCK:SEQUENCE",
+		"STOCK:FORLOOP":            "STOCK:FORLOOP",
+		"STOCK:ForEachLoop":        "STOCK:FOREACHLOOP",
+		"Contoso.CustomTask":       "Contoso.CustomTask",
+	}
+	for input, expected := range tests {
+		if got := dtsx.NormalizeExecutableType(input); got != expected {
+			t.Errorf("NormalizeExecutableType(%q) = %q, expected %q", input, got, expected)
+		}
+	}
+
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;Initial Catalog=Sales;").
+		AddSQLTask("Truncate", "Warehouse", "TRUNCATE TABLE dbo.Staging").
+		Build()
+	pkg.Executable[0].ExecutableTypeAttr = "STOCK:SQLTask"
+	statements := dtsx.NewPackageParser(pkg).GetSQLStatements()
+	if len(statements) != 1 || statements[0].SQL != "TRUNCATE TABLE dbo.Staging" {
+		t.Fatalf("Expected the STOCK:SQLTask statement, got %+v", statements)
+	}
+	if len(statements[0].Connections) != 1 || statements[0].Connections[0] != "Warehouse" {
+		t.Errorf("Expected the statement to use Warehouse, got %v", statements[0].Connections)
+	}
+}
+
+func TestGetUnusedConnections(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Source", "OLEDB", "Data Source=.;Initial Catalog=Sales;").
+		AddConnection("Orphan", "FLATFILE", `C:\data\unused.csv`).
+		Build()
+	pkg.ConnectionManagers.ConnectionManager[0].RefIdAttr = stringPtr("Package.ConnectionManagers[Source]")
+	pkg.Executable = []*schema.AnyNonPackageExecutableType{{
+		RefIdAttr:          stringPtr(`Package\Load`),
+		ObjectNameAttr:     stringPtr("Load"),
+		ExecutableTypeAttr: "Microsoft.Pipeline",
+		ObjectData: &schema.ExecutableObjectDataType{
+			Pipeline: &schema.PipelineObjectDataType{
+				Components: &schema.PipelineComponentsType{
+					Component: []*schema.PipelineComponentType{{
+						NameAttr: stringPtr("OLE DB Source"),
+						Connections: &schema.PipelineComponentConnectionsType{
+							Connection: []*schema.PipelineComponentConnectionType{{
+								ConnectionManagerIDAttr: stringPtr("Package.ConnectionManagers[Source]"),
+							}},
+						},
+					}},
+				},
+			},
+		},
+	}}
+
+	unused := pkg.GetUnusedConnections()
+	if len(unused) != 1 || unused[0] != "Orphan" {
+		t.Errorf("GetUnusedConnections() = %v, expected [Orphan]", unused)
+	}
+
+	if unused := dtsx.NewPackageBuilder().Build().GetUnusedConnections(); len(unused) != 0 {
+		t.Errorf("Expected no unused connections in an empty package, got %v", unused)
+	}
+}
+
+func TestStripSensitiveObjectData(t *testing.T) {
+	input := `<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Parent">
+  <DTS:Executables>
+    <DTS:Executable DTS:refId="Package\Run Child" DTS:ExecutableType="Microsoft.ExecutePackageTask" DTS:ObjectName="Run Child">
+      <DTS:ObjectData>
+        <ExecutePackageTask>
+          <PackageName>Child.dtsx</PackageName>
+          <PackagePassword Sensitive="1" Encrypted="1">AQAAChildSecret</PackagePassword>
+          <ParameterAssignment>
+            <ParameterName>Token</ParameterName>
+            <BindedVariableOrParameterName Sensitive="1">AQAATokenSecret</BindedVariableOrParameterName>
+          </ParameterAssignment>
+        </ExecutePackageTask>
+      </DTS:ObjectData>
+    </DTS:Executable>
+  </DTS:Executables>
+</DTS:Executable>`
+
+	pkg, err := dtsx.Unmarshal([]byte(input))
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if removed := pkg.StripSensitive(); removed != 2 {
+		t.Errorf("Expected 2 sensitive values removed, got %d", removed)
+	}
+	if data := pkg.Executable[0].ObjectData.ExecutePackageTask; data == nil || data.PackagePassword != nil {
+		t.Error("Expected the typed package password to be removed")
+	}
+
+	data, err := dtsx.Marshal(pkg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	out := string(data)
+	for _, secret := range []string{"ChildSecret", "TokenSecret", "PackagePassword"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected %q to be stripped from the output:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "<PackageName>Child.dtsx</PackageName>") || !strings.Contains(out, "<ParameterName>Token</ParameterName>") {
+		t.Errorf("Expected the rest of the task data to be kept:\n%s", out)
+	}
+	if _, err := dtsx.Unmarshal(data); err != nil {
+		t.Errorf("Expected the stripped package to parse: %v", err)
+	}
+	if removed := pkg.StripSensitive(); removed != 0 {
+		t.Errorf("Expected nothing left to strip, got %d", removed)
+	}
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
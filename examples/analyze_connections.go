@@ -258,7 +258,7 @@ func main() {
 			}
 
 			// Extract SQL from dataflow components if this is a pipeline
-			if exec.ExecutableTypeAttr == "Microsoft.Pipeline" && exec.ObjectData != nil {
+			if dtsx.NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.Pipeline" && exec.ObjectData != nil {
 				dataflowComponents := extractDataflowComponents(exec.ObjectData, connMap)
 				for _, compInfo := range dataflowComponents {
 					csvRows = append(csvRows, CSVRow{
@@ -695,7 +695,7 @@ func printExecutionFlow(pkg *dtsx.Package, parser *dtsx.PackageParser) {
 		fmt.Println()
 
 		// If it's a dataflow, show component execution order
-		if exec.ExecutableTypeAttr == "Microsoft.Pipeline" && exec.ObjectData != nil {
+		if dtsx.NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.Pipeline" && exec.ObjectData != nil {
 			printDataflowExecutionFlow(exec.ObjectData, taskName)
 		}
 	}
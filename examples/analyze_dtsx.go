@@ -86,7 +86,7 @@ func main() {
 
 	// Filter for specific types
 	sqlTasks := pkg.QueryExecutables(func(exec *schema.AnyNonPackageExecutableType) bool {
-		return exec.ExecutableTypeAttr == "STOCK:SQLTask"
+		return dtsx.NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.ExecuteSQLTask"
 	})
 	if len(sqlTasks) > 0 {
 		fmt.Printf("SQL Tasks: %d\n", len(sqlTasks))
@@ -137,18 +137,35 @@ func main() {
 	}
 
 	// Event Handlers
-	if len(pkg.EventHandler) > 0 {
-		fmt.Printf("\n--- Event Handlers (%d) ---\n", len(pkg.EventHandler))
+	if handlers := pkg.GetEventHandlers(); handlers.Count > 0 {
+		fmt.Printf("\n--- Event Handlers (%d) ---\n", handlers.Count)
+		for _, eh := range handlers.Results.([]*dtsx.EventHandlerInfo) {
+			fmt.Printf("  %s on %s (%s): %d task(s)\n", eh.EventName, eh.HostName, eh.HostType, len(eh.Executables))
+		}
 	}
 
 	// Configurations
-	if len(pkg.Configuration) > 0 {
-		fmt.Printf("\n--- Configurations (%d) ---\n", len(pkg.Configuration))
+	if configs := pkg.GetConfigurations(); configs.Count > 0 {
+		fmt.Printf("\n--- Configurations (%d) ---\n", configs.Count)
+		for _, cfg := range configs.Results.([]*dtsx.ConfigurationType) {
+			if resolved, err := dtsx.ResolveConfiguration(cfg); resolved != nil {
+				fmt.Printf("  %s (%s): %s\n", resolved.Name, resolved.Type, resolved.Source)
+				for _, entry := range resolved.Entries {
+					fmt.Printf("    %s = %s\n", entry.Path, entry.Value)
+				}
+				if err != nil {
+					fmt.Printf("    (unresolved: %v)\n", err)
+				}
+			}
+		}
 	}
 
 	// Log Providers
-	if len(pkg.LogProvider) > 0 {
-		fmt.Printf("\n--- Log Providers (%d) ---\n", len(pkg.LogProvider))
+	if providers := pkg.GetLogProviders(); len(providers) > 0 {
+		fmt.Printf("\n--- Log Providers (%d) ---\n", len(providers))
+		for i, lp := range providers {
+			fmt.Printf("%d. %s (%s) -> %s\n", i+1, lp.Name, lp.Type, lp.ConfigString)
+		}
 	}
 
 	fmt.Println("\n=== Analysis Complete ===")
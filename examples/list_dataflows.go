@@ -6,7 +6,8 @@
 //
 // Usage: go run examples/list_dataflows.go <dtsx_file>
 //
-// Data flows are identified by ExecutableTypeAttr == "STOCK:Pipeline"
+// Data flows are identified by an executable type that normalizes to
+// "Microsoft.Pipeline" ("STOCK:Pipeline" in older packages)
 package main
 
 import (
@@ -37,9 +38,9 @@ func main() {
 		return
 	}
 
-	// Query for data flow tasks (try different possible types)
+	// Query for data flow tasks in any SSIS version
 	dataFlows := pkg.QueryExecutables(func(exec *schema.AnyNonPackageExecutableType) bool {
-		return exec.ExecutableTypeAttr == "STOCK:Pipeline" || exec.ExecutableTypeAttr == "Microsoft.Pipeline"
+		return dtsx.NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.Pipeline"
 	})
 
 	fmt.Printf("Found %d data flow(s) in %s:\n", len(dataFlows), filename)
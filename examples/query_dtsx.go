@@ -118,13 +118,13 @@ func main() {
 
 	// Filter for SQL tasks
 	sqlTasks := pkg.QueryExecutables(func(exec *schema.AnyNonPackageExecutableType) bool {
-		return exec.ExecutableTypeAttr == "STOCK:SQLTask"
+		return dtsx.NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.ExecuteSQLTask"
 	})
 	fmt.Printf("   SQL Tasks: %d\n", len(sqlTasks))
 
 	// Filter for data flow tasks
 	dataFlowTasks := pkg.QueryExecutables(func(exec *schema.AnyNonPackageExecutableType) bool {
-		return exec.ExecutableTypeAttr == "STOCK:Pipeline"
+		return dtsx.NormalizeExecutableType(exec.ExecutableTypeAttr) == "Microsoft.Pipeline"
 	})
 	fmt.Printf("   Data Flow Tasks: %d\n", len(dataFlowTasks))
 
@@ -8,13 +8,17 @@
 // - Logical operators (&&, ||, !)
 // - String concatenation
 // - Type casting ((DT_type)expr)
+// - Typed NULLs (NULL(DT_type)), ISNULL and REPLACENULL
 // - Built-in functions (SUBSTRING, UPPER, LOWER, etc.)
 // - Parentheses for precedence
 
 package dtsx
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -70,7 +74,7 @@ var functions = map[string]func([]interface{}) (interface{}, error){
 			return nil, fmt.Errorf("LEN expects 1 argument")
 		}
 		if s, ok := args[0].(string); ok {
-			return float64(len([]rune(s))), nil
+			return int64(len([]rune(s))), nil
 		}
 		return nil, fmt.Errorf("LEN expects string")
 	},
@@ -86,19 +90,40 @@ var functions = map[string]func([]interface{}) (interface{}, error){
 		}
 		return strings.ReplaceAll(s, old, new), nil
 	},
-	// Date functions
-	"GETDATE": func(args []interface{}) (interface{}, error) {
-		if len(args) != 0 {
-			return nil, fmt.Errorf("GETDATE expects no arguments")
+	"TOKEN": func(args []interface{}) (interface{}, error) {
+		if len(args) != 3 {
+			return nil, fmt.Errorf("TOKEN expects 3 arguments")
+		}
+		s, ok1 := args[0].(string)
+		delims, ok2 := args[1].(string)
+		occurrence, ok3 := args[2].(float64)
+		if !ok1 || !ok2 || !ok3 {
+			return nil, fmt.Errorf("TOKEN expects string, string, number")
+		}
+		tokens := splitTokens(s, delims)
+		if n := int(occurrence); n >= 1 && n <= len(tokens) {
+			return tokens[n-1], nil
+		}
+		return "", nil
+	},
+	"TOKENCOUNT": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("TOKENCOUNT expects 2 arguments")
+		}
+		s, ok1 := args[0].(string)
+		delims, ok2 := args[1].(string)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("TOKENCOUNT expects string, string")
 		}
-		return time.Now(), nil
+		return int64(len(splitTokens(s, delims))), nil
 	},
+	// Date functions; GETDATE and GETUTCDATE are in clockFunctions
 	"YEAR": func(args []interface{}) (interface{}, error) {
 		if len(args) != 1 {
 			return nil, fmt.Errorf("YEAR expects 1 argument")
 		}
 		if t, ok := args[0].(time.Time); ok {
-			return float64(t.Year()), nil
+			return int64(t.Year()), nil
 		}
 		return nil, fmt.Errorf("YEAR expects date")
 	},
@@ -107,7 +132,7 @@ var functions = map[string]func([]interface{}) (interface{}, error){
 			return nil, fmt.Errorf("MONTH expects 1 argument")
 		}
 		if t, ok := args[0].(time.Time); ok {
-			return float64(t.Month()), nil
+			return int64(t.Month()), nil
 		}
 		return nil, fmt.Errorf("MONTH expects date")
 	},
@@ -116,7 +141,7 @@ var functions = map[string]func([]interface{}) (interface{}, error){
 			return nil, fmt.Errorf("DAY expects 1 argument")
 		}
 		if t, ok := args[0].(time.Time); ok {
-			return float64(t.Day()), nil
+			return int64(t.Day()), nil
 		}
 		return nil, fmt.Errorf("DAY expects date")
 	},
@@ -138,7 +163,7 @@ var functions = map[string]func([]interface{}) (interface{}, error){
 			return nil, fmt.Errorf("CEILING expects 1 argument")
 		}
 		if f, ok := args[0].(float64); ok {
-			return float64(int(f + 0.999999)), nil // Simple ceiling
+			return math.Ceil(f), nil
 		}
 		return nil, fmt.Errorf("CEILING expects number")
 	},
@@ -147,10 +172,73 @@ var functions = map[string]func([]interface{}) (interface{}, error){
 			return nil, fmt.Errorf("FLOOR expects 1 argument")
 		}
 		if f, ok := args[0].(float64); ok {
-			return float64(int(f)), nil
+			return math.Floor(f), nil
 		}
 		return nil, fmt.Errorf("FLOOR expects number")
 	},
+	"ROUND": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("ROUND expects 2 arguments")
+		}
+		var f float64
+		switch v := args[0].(type) {
+		case float64:
+			f = v
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("ROUND expects number, number")
+			}
+			f = parsed
+		default:
+			return nil, fmt.Errorf("ROUND expects number, number")
+		}
+		places, ok := args[1].(float64)
+		if !ok {
+			return nil, fmt.Errorf("ROUND expects number, number")
+		}
+		// Halves round away from zero, as in SSIS
+		pow := math.Pow(10, float64(int(places)))
+		return math.Round(f*pow) / pow, nil
+	},
+	"POWER": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("POWER expects 2 arguments")
+		}
+		base, ok1 := args[0].(float64)
+		exp, ok2 := args[1].(float64)
+		if !ok1 || !ok2 {
+			return nil, fmt.Errorf("POWER expects number, number")
+		}
+		return math.Pow(base, exp), nil
+	},
+	"SQRT": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("SQRT expects 1 argument")
+		}
+		if f, ok := args[0].(float64); ok {
+			if f < 0 {
+				return nil, fmt.Errorf("SQRT of negative number")
+			}
+			return math.Sqrt(f), nil
+		}
+		return nil, fmt.Errorf("SQRT expects number")
+	},
+	"SIGN": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("SIGN expects 1 argument")
+		}
+		if f, ok := args[0].(float64); ok {
+			switch {
+			case f > 0:
+				return float64(1), nil
+			case f < 0:
+				return float64(-1), nil
+			}
+			return float64(0), nil
+		}
+		return nil, fmt.Errorf("SIGN expects number")
+	},
 	"DATEADD": func(args []interface{}) (interface{}, error) {
 		if len(args) != 3 {
 			return nil, fmt.Errorf("DATEADD requires 3 arguments")
@@ -217,83 +305,427 @@ var functions = map[string]func([]interface{}) (interface{}, error){
 			if endDate.YearDay() < startDate.YearDay() {
 				years--
 			}
-			return float64(years), nil
+			return int64(years), nil
 		case "QUARTER", "QQ", "Q":
 			quarters := (endDate.Year()-startDate.Year())*4 + (int(endDate.Month())-1)/3 - (int(startDate.Month())-1)/3
-			return float64(quarters), nil
+			return int64(quarters), nil
 		case "MONTH", "MM", "M":
 			months := (endDate.Year()-startDate.Year())*12 + int(endDate.Month()) - int(startDate.Month())
-			return float64(months), nil
+			return int64(months), nil
+		case "DAYOFYEAR", "DY", "Y":
+			return int64(endDate.YearDay() - startDate.YearDay()), nil
+		case "DAY", "DD", "D":
+			return int64(duration.Hours() / 24), nil
+		case "WEEK", "WK", "WW":
+			return int64(duration.Hours() / (24 * 7)), nil
+		case "WEEKDAY", "DW", "W":
+			return int64(duration.Hours() / 24), nil
+		case "HOUR", "HH":
+			return int64(duration.Hours()), nil
+		case "MINUTE", "MI", "N":
+			return int64(duration.Minutes()), nil
+		case "SECOND", "SS", "S":
+			return int64(duration.Seconds()), nil
+		case "MILLISECOND", "MS":
+			return duration.Milliseconds(), nil
+		default:
+			return nil, fmt.Errorf("unknown date part: %s", datePart)
+		}
+	},
+	"DATEPART": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("DATEPART requires 2 arguments")
+		}
+		datePart, ok := args[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("DATEPART first argument must be string")
+		}
+		date, ok := args[1].(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("DATEPART second argument must be date")
+		}
+		// Weeks start on Sunday and weekday 1 is Sunday, as with SQL Server's default DATEFIRST
+		switch strings.ToUpper(datePart) {
+		case "YEAR", "YY", "YYYY":
+			return int64(date.Year()), nil
+		case "QUARTER", "QQ", "Q":
+			return int64((int(date.Month())-1)/3 + 1), nil
+		case "MONTH", "MM", "M":
+			return int64(date.Month()), nil
 		case "DAYOFYEAR", "DY", "Y":
-			return float64(endDate.YearDay() - startDate.YearDay()), nil
+			return int64(date.YearDay()), nil
 		case "DAY", "DD", "D":
-			return float64(int(duration.Hours() / 24)), nil
+			return int64(date.Day()), nil
 		case "WEEK", "WK", "WW":
-			return float64(int(duration.Hours() / (24 * 7))), nil
+			jan1 := time.Date(date.Year(), time.January, 1, 0, 0, 0, 0, date.Location())
+			return int64((date.YearDay()+int(jan1.Weekday())-1)/7 + 1), nil
 		case "WEEKDAY", "DW", "W":
-			return float64(int(duration.Hours() / 24)), nil
+			return int64(date.Weekday() + 1), nil
 		case "HOUR", "HH":
-			return float64(int(duration.Hours())), nil
+			return int64(date.Hour()), nil
 		case "MINUTE", "MI", "N":
-			return float64(int(duration.Minutes())), nil
+			return int64(date.Minute()), nil
 		case "SECOND", "SS", "S":
-			return float64(int(duration.Seconds())), nil
+			return int64(date.Second()), nil
 		case "MILLISECOND", "MS":
-			return float64(int(duration.Milliseconds())), nil
+			return int64(date.Nanosecond() / int(time.Millisecond)), nil
 		default:
 			return nil, fmt.Errorf("unknown date part: %s", datePart)
 		}
 	},
+	// GUID functions
+	"NEWID": func(args []interface{}) (interface{}, error) {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("NEWID expects no arguments")
+		}
+		return strings.ToUpper(generateGUID()), nil
+	},
+	// Null functions; a null argument is passed to these instead of making
+	// the result null (see nullAwareFunctions)
+	"ISNULL": func(args []interface{}) (interface{}, error) {
+		if len(args) != 1 {
+			return nil, fmt.Errorf("ISNULL expects 1 argument")
+		}
+		return args[0] == nil, nil
+	},
+	"REPLACENULL": func(args []interface{}) (interface{}, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("REPLACENULL expects 2 arguments")
+		}
+		if args[0] == nil {
+			return args[1], nil
+		}
+		return args[0], nil
+	},
 }
 
+// clockFunctions are the functions that read the current time, which they
+// take from the evaluation context so it can be pinned (see EvaluateOptions.Now)
+var clockFunctions = map[string]func(now time.Time) time.Time{
+	"GETDATE":    func(now time.Time) time.Time { return now },
+	"GETUTCDATE": func(now time.Time) time.Time { return now.UTC() },
+}
+
+// nullAwareFunctions lists the functions that handle null arguments
+// themselves. Any other function returns null when an argument is null, as
+// in SSIS, so REPLACENULL(UPPER(@[User::A]), "n/a") falls back when A is null.
+var nullAwareFunctions = map[string]bool{"ISNULL": true, "REPLACENULL": true}
+
+// splitTokens splits s on any character in delims, collapsing consecutive
+// delimiters as SSIS TOKEN and TOKENCOUNT do
+func splitTokens(s, delims string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return strings.ContainsRune(delims, r)
+	})
+}
+
+// parseCastType splits a cast type such as "DT_STR, 20, 1252" into its base type and numeric parameters
+func parseCastType(castType string) (string, []int, error) {
+	parts := strings.Split(castType, ",")
+	base := strings.ToUpper(strings.TrimSpace(parts[0]))
+	var params []int
+	for _, part := range parts[1:] {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid parameter %q in cast to %s", strings.TrimSpace(part), base)
+		}
+		params = append(params, n)
+	}
+	return base, params, nil
+}
+
+// castValue converts val to the SSIS type described by castType, which may carry
+// parameters like length, code page, precision and scale (e.g. "DT_WSTR, 50")
 func castValue(val interface{}, castType string) (interface{}, error) {
-	switch castType {
-	case "DT_STR":
-		return fmt.Sprintf("%v", val), nil
-	case "DT_INT":
+	base, params, err := parseCastType(castType)
+	if err != nil {
+		return nil, err
+	}
+	switch base {
+	case "DT_STR", "DT_WSTR":
+		s := fmt.Sprintf("%v", val)
+		// DT_STR takes (length, codepage) and DT_WSTR takes (length); apply the length
+		if len(params) > 0 && params[0] >= 0 {
+			if runes := []rune(s); len(runes) > params[0] {
+				s = string(runes[:params[0]])
+			}
+		}
+		return s, nil
+	case "DT_I1", "DT_I2", "DT_I4", "DT_I8", "DT_UI1", "DT_UI2", "DT_UI4", "DT_UI8", "DT_INT":
+		var n int64
 		switch v := val.(type) {
+		case int64:
+			n = v
 		case float64:
-			return float64(int(v)), nil
+			if n, err = truncateFloat(v, base); err != nil {
+				return nil, err
+			}
+		case bool:
+			// SSIS converts TRUE to -1
+			if v {
+				n = -1
+			}
 		case string:
-			if f, err := strconv.ParseFloat(v, 64); err == nil {
-				return float64(int(f)), nil
+			// Integer strings are parsed exactly; others such as "12.7" are truncated
+			s := strings.TrimSpace(v)
+			parsed, err := strconv.ParseInt(s, 10, 64)
+			if errors.Is(err, strconv.ErrRange) {
+				return nil, fmt.Errorf("value %s is out of range for %s", s, base)
 			}
+			if err != nil {
+				f, err := strconv.ParseFloat(s, 64)
+				if err != nil {
+					return nil, fmt.Errorf("cannot cast %q to %s", v, base)
+				}
+				if parsed, err = truncateFloat(f, base); err != nil {
+					return nil, err
+				}
+			}
+			n = parsed
+		default:
+			return nil, fmt.Errorf("cannot cast to %s", base)
 		}
-		return nil, fmt.Errorf("cannot cast to DT_INT")
-	case "DT_DECIMAL", "DT_NUMERIC":
+		if lo, hi := integerRange(base); n < lo || n > hi {
+			return nil, fmt.Errorf("value %d is out of range for %s", n, base)
+		}
+		return n, nil
+	case "DT_R4", "DT_R8":
 		switch v := val.(type) {
 		case float64:
 			return v, nil
+		case int64:
+			return float64(v), nil
 		case string:
-			if f, err := strconv.ParseFloat(v, 64); err == nil {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
 				return f, nil
 			}
 		}
-		return nil, fmt.Errorf("cannot cast to %s", castType)
+		return nil, fmt.Errorf("cannot cast to %s", base)
+	case "DT_DECIMAL", "DT_NUMERIC":
+		var f float64
+		switch v := val.(type) {
+		case float64:
+			f = v
+		case int64:
+			f = float64(v)
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot cast to %s", base)
+			}
+			f = parsed
+		default:
+			return nil, fmt.Errorf("cannot cast to %s", base)
+		}
+		// DT_NUMERIC takes (precision, scale) and DT_DECIMAL takes (scale)
+		scale := -1
+		if base == "DT_NUMERIC" && len(params) > 1 {
+			scale = params[1]
+			// Only significant integer digits count, so 0.5 fits (DT_NUMERIC,5,5)
+			intDigits := 0
+			if whole := math.Trunc(math.Abs(f)); whole != 0 {
+				intDigits = len(strconv.FormatFloat(whole, 'f', -1, 64))
+			}
+			if params[0] > 0 && intDigits > params[0]-scale {
+				return nil, fmt.Errorf("value %v exceeds precision %d in cast to DT_NUMERIC", f, params[0])
+			}
+		} else if base == "DT_DECIMAL" && len(params) > 0 {
+			scale = params[0]
+		}
+		if scale >= 0 {
+			pow := math.Pow(10, float64(scale))
+			f = math.Round(f*pow) / pow
+		}
+		return f, nil
 	case "DT_BOOL":
 		switch v := val.(type) {
 		case bool:
 			return v, nil
 		case float64:
 			return v != 0, nil
+		case int64:
+			return v != 0, nil
 		case string:
 			return strings.ToLower(v) == "true" || v == "1", nil
 		}
 		return nil, fmt.Errorf("cannot cast to DT_BOOL")
+	case "DT_GUID":
+		if s, ok := val.(string); ok {
+			if guid, ok := normalizeGUID(s); ok {
+				return guid, nil
+			}
+			return nil, fmt.Errorf("cannot cast %q to DT_GUID: not a GUID", s)
+		}
+		return nil, fmt.Errorf("cannot cast %T to DT_GUID", val)
+	case "DT_DATE", "DT_DBTIMESTAMP":
+		switch v := val.(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			s := strings.TrimSpace(v)
+			for _, layout := range dateLayouts {
+				if t, err := time.Parse(layout, s); err == nil {
+					return t, nil
+				}
+			}
+			return nil, fmt.Errorf("cannot cast %q to %s: unrecognized date format", v, base)
+		}
+		return nil, fmt.Errorf("cannot cast to %s", base)
 	}
 	return val, nil // No-op for unknown types
 }
 
+// guidPattern matches a GUID with or without braces
+var guidPattern = regexp.MustCompile(`^\{?([0-9A-Fa-f]{8})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{4})-([0-9A-Fa-f]{12})\}?$`)
+
+// normalizeGUID returns s in the brace-wrapped, upper-case form SSIS uses,
+// e.g. "{0F6E3C3A-7B1D-4F0E-9C2B-5D8A1E4B7C90}"
+func normalizeGUID(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	m := guidPattern.FindStringSubmatch(s)
+	if m == nil || strings.HasPrefix(s, "{") != strings.HasSuffix(s, "}") {
+		return "", false
+	}
+	return "{" + strings.ToUpper(strings.Join(m[1:], "-")) + "}", true
+}
+
+// integerRange returns the inclusive range of an SSIS integer type. Integers
+// are held as int64, so DT_UI8 values above math.MaxInt64 are out of range.
+func integerRange(base string) (int64, int64) {
+	switch base {
+	case "DT_I1":
+		return math.MinInt8, math.MaxInt8
+	case "DT_I2":
+		return math.MinInt16, math.MaxInt16
+	case "DT_I4", "DT_INT":
+		return math.MinInt32, math.MaxInt32
+	case "DT_UI1":
+		return 0, math.MaxUint8
+	case "DT_UI2":
+		return 0, math.MaxUint16
+	case "DT_UI4":
+		return 0, math.MaxUint32
+	case "DT_UI8":
+		return 0, math.MaxInt64
+	}
+	return math.MinInt64, math.MaxInt64
+}
+
+// integerArithmetic applies an arithmetic operator to two int64 operands.
+// Results that do not fit in an int64 are an error, as in SSIS, rather than
+// wrapping around.
+func integerArithmetic(op string, l, r int64) (int64, error) {
+	overflow := false
+	var result int64
+	switch op {
+	case "+":
+		result = l + r
+		overflow = (r > 0 && result < l) || (r < 0 && result > l)
+	case "-":
+		result = l - r
+		overflow = (r > 0 && result > l) || (r < 0 && result < l)
+	case "*":
+		result = l * r
+		overflow = l != 0 && (result/l != r || (l == -1 && r == math.MinInt64))
+	case "/", "%":
+		if r == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		if op == "%" {
+			return l % r, nil
+		}
+		result = l / r
+		overflow = l == math.MinInt64 && r == -1
+	}
+	if overflow {
+		return 0, fmt.Errorf("integer overflow: %d %s %d", l, op, r)
+	}
+	return result, nil
+}
+
+// truncateFloat rounds f toward zero for a cast to the integer type base,
+// failing when the result does not fit in an int64
+func truncateFloat(f float64, base string) (int64, error) {
+	n := math.Trunc(f)
+	// float64(math.MaxInt64) rounds up to 2^63, which is itself out of range
+	if math.IsNaN(n) || n < math.MinInt64 || n >= math.MaxInt64 {
+		return 0, fmt.Errorf("value %v is out of range for %s", f, base)
+	}
+	return int64(n), nil
+}
+
+// dateLayouts lists the date string formats accepted by DT_DATE and DT_DBTIMESTAMP casts
+var dateLayouts = []string{
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 15:04:05",
+	"1/2/2006",
+}
+
+// EvaluateOptions controls how an expression is evaluated
+type EvaluateOptions struct {
+	// Now pins the time returned by GETDATE() (and, converted to UTC, by
+	// GETUTCDATE()); the zero value uses the current time
+	Now time.Time
+	// Params supplies parameter values keyed by "$Project::Name" or "$Package::Name"
+	// (the leading $ may be omitted); they override package parameter defaults
+	Params map[string]interface{}
+}
+
+// evalContext carries what an evaluation needs besides the expression: the
+// variable and parameter values, and the time GETDATE() reports
+type evalContext struct {
+	vars map[string]interface{}
+	now  time.Time // the zero value uses the current time
+}
+
+// currentTime returns the pinned time, or the current time if none is pinned
+func (ctx *evalContext) currentTime() time.Time {
+	if ctx.now.IsZero() {
+		return time.Now()
+	}
+	return ctx.now
+}
+
+// contextEvaluator is implemented by the nodes ParseExpression builds, which
+// evaluate their operands within the caller's context
+type contextEvaluator interface {
+	eval(ctx *evalContext) (interface{}, error)
+}
+
+// evalIn evaluates e within ctx. Expr implementations from outside the
+// package only see the variable values.
+func evalIn(e Expr, ctx *evalContext) (interface{}, error) {
+	if ce, ok := e.(contextEvaluator); ok {
+		return ce.eval(ctx)
+	}
+	return e.Eval(ctx.vars)
+}
+
 // EvaluateExpression evaluates an SSIS expression in the context of a package
 func EvaluateExpression(expr string, pkg *Package) (interface{}, error) {
+	return EvaluateExpressionWithOptions(expr, pkg, EvaluateOptions{})
+}
+
+// EvaluateExpressionWithParams evaluates an SSIS expression with project or package
+// parameter values supplied by the caller alongside the package's variables
+func EvaluateExpressionWithParams(expr string, pkg *Package, params map[string]interface{}) (interface{}, error) {
+	return EvaluateExpressionWithOptions(expr, pkg, EvaluateOptions{Params: params})
+}
+
+// EvaluateExpressionWithOptions evaluates an SSIS expression in the context of a package using the given options
+func EvaluateExpressionWithOptions(expr string, pkg *Package, opts EvaluateOptions) (interface{}, error) {
 	if expr == "" {
 		return nil, fmt.Errorf("empty expression")
 	}
 
-	// Get variables
-	vars, err := getAllVariables(pkg)
+	ctx, err := evaluationContext(pkg, opts)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get variables: %v", err)
+		return nil, err
 	}
 
 	// Parse and evaluate the expression
@@ -302,7 +734,102 @@ func EvaluateExpression(expr string, pkg *Package) (interface{}, error) {
 		return nil, fmt.Errorf("failed to parse expression: %v", err)
 	}
 
-	return parsed.Eval(vars)
+	return evalIn(parsed, ctx)
+}
+
+// evaluationContext returns the context for evaluating an expression against
+// pkg: its variables and parameters, overlaid with the parameters from opts
+// and keyed as Eval expects, and the pinned time from opts
+func evaluationContext(pkg *Package, opts EvaluateOptions) (*evalContext, error) {
+	vars, err := getAllVariables(pkg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get variables: %v", err)
+	}
+	for name, value := range getAllParameters(pkg) {
+		vars[name] = value
+	}
+	for name, value := range opts.Params {
+		if !strings.HasPrefix(name, "$") {
+			name = "$" + name
+		}
+		vars[name] = value
+	}
+	return &evalContext{vars: vars, now: opts.Now}, nil
+}
+
+// EvaluateExpressionSafe evaluates an SSIS expression like EvaluateExpression
+// but does not stop at the first error. A sub-expression that fails, for
+// example by referencing a missing variable, evaluates to null and its error
+// is collected, so the rest of the expression still evaluates: null
+// propagates through operators and functions, and ISNULL, REPLACENULL and
+// conditionals can recover from it. Only the branch a conditional takes is
+// evaluated. Panics are recovered and reported as errors.
+func EvaluateExpressionSafe(expr string, pkg *Package) (result interface{}, partialErrs []error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = nil
+			partialErrs = append(partialErrs, fmt.Errorf("evaluation panicked: %v", r))
+		}
+	}()
+
+	if expr == "" {
+		return nil, []error{fmt.Errorf("empty expression")}
+	}
+	ctx, err := evaluationContext(pkg, EvaluateOptions{})
+	if err != nil {
+		return nil, []error{err}
+	}
+	parsed, err := parseExpression(expr)
+	if err != nil {
+		return nil, []error{fmt.Errorf("failed to parse expression: %v", err)}
+	}
+	result = safeEval(parsed, ctx, &partialErrs)
+	return result, partialErrs
+}
+
+// safeEval evaluates e bottom-up for EvaluateExpressionSafe. Each node is
+// evaluated over the values of its operands, with nil standing in for the
+// ones that failed.
+func safeEval(e Expr, ctx *evalContext, errs *[]error) interface{} {
+	var node Expr
+	switch n := e.(type) {
+	case *BinaryOp:
+		node = &BinaryOp{Left: safeLiteral(n.Left, ctx, errs), Op: n.Op, Right: safeLiteral(n.Right, ctx, errs)}
+	case *UnaryOp:
+		node = &UnaryOp{Op: n.Op, Expr: safeLiteral(n.Expr, ctx, errs)}
+	case *Cast:
+		node = &Cast{Type: n.Type, Expr: safeLiteral(n.Expr, ctx, errs)}
+	case *FunctionCall:
+		args := make([]Expr, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = safeLiteral(arg, ctx, errs)
+		}
+		node = &FunctionCall{Name: n.Name, Args: args}
+	case *Conditional:
+		cond := safeLiteral(n.Condition, ctx, errs)
+		value, err := (&Conditional{Condition: cond, TrueExpr: &Literal{Value: true}, FalseExpr: &Literal{Value: false}}).eval(ctx)
+		if err != nil {
+			*errs = append(*errs, err)
+			return nil
+		}
+		if value == true {
+			return safeEval(n.TrueExpr, ctx, errs)
+		}
+		return safeEval(n.FalseExpr, ctx, errs)
+	default:
+		node = e
+	}
+	value, err := evalIn(node, ctx)
+	if err != nil {
+		*errs = append(*errs, err)
+		return nil
+	}
+	return value
+}
+
+// safeLiteral returns the value of e from safeEval as a Literal
+func safeLiteral(e Expr, ctx *evalContext, errs *[]error) *Literal {
+	return &Literal{Value: safeEval(e, ctx, errs)}
 }
 
 // Expr represents an expression AST node
@@ -339,18 +866,40 @@ type BinaryOp struct {
 }
 
 func (b *BinaryOp) Eval(vars map[string]interface{}) (interface{}, error) {
-	left, err := b.Left.Eval(vars)
+	return b.eval(&evalContext{vars: vars})
+}
+
+func (b *BinaryOp) eval(ctx *evalContext) (interface{}, error) {
+	left, err := evalIn(b.Left, ctx)
 	if err != nil {
 		return nil, err
 	}
-	right, err := b.Right.Eval(vars)
+	right, err := evalIn(b.Right, ctx)
 	if err != nil {
 		return nil, err
 	}
+	// A null operand makes the result null
+	if left == nil || right == nil {
+		return nil, nil
+	}
+	// Integer operands keep integer results, with truncating division as in SSIS
+	if l, ok := left.(int64); ok {
+		if r, ok := right.(int64); ok {
+			switch b.Op {
+			case "+", "-", "*", "/", "%":
+				n, err := integerArithmetic(b.Op, l, r)
+				if err != nil {
+					return nil, err
+				}
+				return n, nil
+			}
+		}
+	}
+
 	switch b.Op {
 	case "+":
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
 				return l + r, nil
 			}
 		}
@@ -361,22 +910,22 @@ func (b *BinaryOp) Eval(vars map[string]interface{}) (interface{}, error) {
 		}
 		return nil, fmt.Errorf("cannot add %T and %T", left, right)
 	case "-":
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
 				return l - r, nil
 			}
 		}
 		return nil, fmt.Errorf("cannot subtract %T and %T", left, right)
 	case "*":
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
 				return l * r, nil
 			}
 		}
 		return nil, fmt.Errorf("cannot multiply %T and %T", left, right)
 	case "/":
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
 				if r == 0 {
 					return nil, fmt.Errorf("division by zero")
 				}
@@ -384,34 +933,74 @@ func (b *BinaryOp) Eval(vars map[string]interface{}) (interface{}, error) {
 			}
 		}
 		return nil, fmt.Errorf("cannot divide %T and %T", left, right)
+	case "%":
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
+				if r == 0 {
+					return nil, fmt.Errorf("division by zero")
+				}
+				return math.Mod(l, r), nil
+			}
+		}
+		return nil, fmt.Errorf("cannot take modulo of %T and %T", left, right)
 	case "==":
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
+				return l == r, nil
+			}
+		}
 		return left == right, nil
 	case "!=":
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
+				return l != r, nil
+			}
+		}
 		return left != right, nil
 	case "<":
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
+				return l < r, nil
+			}
+		}
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
 				return l < r, nil
 			}
 		}
 		return nil, fmt.Errorf("cannot compare %T and %T", left, right)
 	case ">":
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
+				return l > r, nil
+			}
+		}
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
 				return l > r, nil
 			}
 		}
 		return nil, fmt.Errorf("cannot compare %T and %T", left, right)
 	case "<=":
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
+				return l <= r, nil
+			}
+		}
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
 				return l <= r, nil
 			}
 		}
 		return nil, fmt.Errorf("cannot compare %T and %T", left, right)
 	case ">=":
-		if l, ok := left.(float64); ok {
-			if r, ok := right.(float64); ok {
+		if l, ok := toFloat(left); ok {
+			if r, ok := toFloat(right); ok {
+				return l >= r, nil
+			}
+		}
+		if l, ok := left.(string); ok {
+			if r, ok := right.(string); ok {
 				return l >= r, nil
 			}
 		}
@@ -428,6 +1017,17 @@ func (b *BinaryOp) Eval(vars map[string]interface{}) (interface{}, error) {
 	return nil, fmt.Errorf("unknown operator: %s", b.Op)
 }
 
+// toFloat converts a numeric value (float64, or int64 from an integer cast) to float64
+func toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
 // toBool converts a value to boolean
 func toBool(val interface{}) bool {
 	switch v := val.(type) {
@@ -435,6 +1035,8 @@ func toBool(val interface{}) bool {
 		return v
 	case float64:
 		return v != 0
+	case int64:
+		return v != 0
 	case string:
 		return v != ""
 	default:
@@ -444,22 +1046,46 @@ func toBool(val interface{}) bool {
 
 // FunctionCall represents a function call
 type FunctionCall struct {
-	Name string
+	Name string // upper case, as produced by ParseExpression
 	Args []Expr
 }
 
 func (f *FunctionCall) Eval(vars map[string]interface{}) (interface{}, error) {
+	return f.eval(&evalContext{vars: vars})
+}
+
+func (f *FunctionCall) eval(ctx *evalContext) (interface{}, error) {
 	// Evaluate arguments
 	args := make([]interface{}, len(f.Args))
 	for i, arg := range f.Args {
-		val, err := arg.Eval(vars)
+		val, err := evalIn(arg, ctx)
 		if err != nil {
 			return nil, err
 		}
 		args[i] = val
 	}
 
+	// Built-in functions take numbers as float64; the null functions return
+	// an argument as it is, so an integer stays an integer
+	for i, arg := range args {
+		if nullAwareFunctions[f.Name] {
+			continue
+		}
+		if arg == nil {
+			return nil, nil
+		}
+		if n, ok := arg.(int64); ok {
+			args[i] = float64(n)
+		}
+	}
+
 	// Call the function
+	if clock, ok := clockFunctions[f.Name]; ok {
+		if len(args) != 0 {
+			return nil, fmt.Errorf("%s expects no arguments", f.Name)
+		}
+		return clock(ctx.currentTime()), nil
+	}
 	if fn, ok := functions[f.Name]; ok {
 		return fn(args)
 	}
@@ -474,7 +1100,11 @@ type Conditional struct {
 }
 
 func (c *Conditional) Eval(vars map[string]interface{}) (interface{}, error) {
-	cond, err := c.Condition.Eval(vars)
+	return c.eval(&evalContext{vars: vars})
+}
+
+func (c *Conditional) eval(ctx *evalContext) (interface{}, error) {
+	cond, err := evalIn(c.Condition, ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -486,6 +1116,8 @@ func (c *Conditional) Eval(vars map[string]interface{}) (interface{}, error) {
 		condition = v
 	case float64:
 		condition = v != 0
+	case int64:
+		condition = v != 0
 	case string:
 		condition = v != ""
 	default:
@@ -493,22 +1125,30 @@ func (c *Conditional) Eval(vars map[string]interface{}) (interface{}, error) {
 	}
 
 	if condition {
-		return c.TrueExpr.Eval(vars)
+		return evalIn(c.TrueExpr, ctx)
 	}
-	return c.FalseExpr.Eval(vars)
+	return evalIn(c.FalseExpr, ctx)
 }
 
 // Cast represents a type cast
 type Cast struct {
-	Type string
+	Type string // e.g. "DT_I4", or with parameters such as "DT_WSTR, 50" or "DT_NUMERIC, 10, 2"
 	Expr Expr
 }
 
 func (c *Cast) Eval(vars map[string]interface{}) (interface{}, error) {
-	val, err := c.Expr.Eval(vars)
+	return c.eval(&evalContext{vars: vars})
+}
+
+func (c *Cast) eval(ctx *evalContext) (interface{}, error) {
+	val, err := evalIn(c.Expr, ctx)
 	if err != nil {
 		return nil, err
 	}
+	if val == nil {
+		// Casting null gives null; NULL(DT_type) parses to such a cast
+		return nil, nil
+	}
 
 	return castValue(val, c.Type)
 }
@@ -520,10 +1160,17 @@ type UnaryOp struct {
 }
 
 func (u *UnaryOp) Eval(vars map[string]interface{}) (interface{}, error) {
-	val, err := u.Expr.Eval(vars)
+	return u.eval(&evalContext{vars: vars})
+}
+
+func (u *UnaryOp) eval(ctx *evalContext) (interface{}, error) {
+	val, err := evalIn(u.Expr, ctx)
 	if err != nil {
 		return nil, err
 	}
+	if val == nil {
+		return nil, nil
+	}
 
 	switch u.Op {
 	case "!":
@@ -533,6 +1180,8 @@ func (u *UnaryOp) Eval(vars map[string]interface{}) (interface{}, error) {
 			b = v
 		case float64:
 			b = v != 0
+		case int64:
+			b = v != 0
 		case string:
 			b = v != ""
 		default:
@@ -540,8 +1189,14 @@ func (u *UnaryOp) Eval(vars map[string]interface{}) (interface{}, error) {
 		}
 		return !b, nil
 	case "-":
-		if f, ok := val.(float64); ok {
-			return -f, nil
+		switch v := val.(type) {
+		case float64:
+			return -v, nil
+		case int64:
+			if v == math.MinInt64 {
+				return nil, fmt.Errorf("integer overflow: -(%d)", v)
+			}
+			return -v, nil
 		}
 		return nil, fmt.Errorf("cannot negate %T", val)
 	}
@@ -554,14 +1209,423 @@ type Token struct {
 	Value string
 }
 
+// ParseExpression parses an SSIS expression into an AST without evaluating it.
+// The returned Expr can be inspected or rewritten, and evaluated with Eval
+// against a map of variable values keyed by "Namespace::Name".
+func ParseExpression(expr string) (Expr, error) {
+	return parseExpression(expr)
+}
+
+// ValidateExpressionSyntax reports whether expr is a well-formed SSIS
+// expression. The expression is only parsed, never evaluated, so references to
+// variables or parameters that do not exist are not syntax errors.
+func ValidateExpressionSyntax(expr string) error {
+	_, err := parseExpression(expr)
+	return err
+}
+
+// CheckExpression statically inspects a parsed expression for operations that
+// fail whatever values its variables hold: division or modulo by a literal
+// zero, and operators applied to a string and a numeric operand (in SSIS both
+// sides must be cast to a common type). Operand types are only known for
+// literals, casts and the operators built from them, so expressions over
+// variables are never flagged. Each problem found is returned as a message.
+func CheckExpression(e Expr) []string {
+	var issues []string
+	checkExpr(e, &issues)
+	return issues
+}
+
+// checkExpr walks e depth-first, appending the problems CheckExpression reports
+func checkExpr(e Expr, issues *[]string) {
+	switch n := e.(type) {
+	case *BinaryOp:
+		checkExpr(n.Left, issues)
+		checkExpr(n.Right, issues)
+		if (n.Op == "/" || n.Op == "%") && isZeroLiteral(n.Right) {
+			*issues = append(*issues, fmt.Sprintf("division by zero: the right operand of %s is a literal 0", n.Op))
+		}
+		left, right := staticType(n.Left), staticType(n.Right)
+		switch n.Op {
+		case "+", "==", "!=", "<", ">", "<=", ">=":
+			if (left == "string" && right == "numeric") || (left == "numeric" && right == "string") {
+				*issues = append(*issues, fmt.Sprintf("type mismatch: %s applied to %s and %s operands", n.Op, left, right))
+			}
+		case "-", "*", "/", "%":
+			if left == "string" || right == "string" {
+				*issues = append(*issues, fmt.Sprintf("type mismatch: %s applied to a string operand", n.Op))
+			}
+		}
+	case *UnaryOp:
+		checkExpr(n.Expr, issues)
+		if n.Op == "-" && staticType(n.Expr) == "string" {
+			*issues = append(*issues, "type mismatch: - applied to a string operand")
+		}
+	case *Cast:
+		checkExpr(n.Expr, issues)
+	case *Conditional:
+		checkExpr(n.Condition, issues)
+		checkExpr(n.TrueExpr, issues)
+		checkExpr(n.FalseExpr, issues)
+	case *FunctionCall:
+		for _, arg := range n.Args {
+			checkExpr(arg, issues)
+		}
+	}
+}
+
+// isZeroLiteral reports whether e is the numeric literal 0, possibly cast
+func isZeroLiteral(e Expr) bool {
+	switch n := e.(type) {
+	case *Literal:
+		switch v := n.Value.(type) {
+		case float64:
+			return v == 0
+		case int64:
+			return v == 0
+		}
+	case *Cast:
+		return isZeroLiteral(n.Expr)
+	}
+	return false
+}
+
+// staticType returns "string", "numeric" or "boolean" when the type of e is
+// known without evaluating it, and "" otherwise
+func staticType(e Expr) string {
+	switch n := e.(type) {
+	case *Literal:
+		switch n.Value.(type) {
+		case string:
+			return "string"
+		case float64, int64:
+			return "numeric"
+		case bool:
+			return "boolean"
+		}
+	case *Cast:
+		base, _, err := parseCastType(n.Type)
+		if err != nil {
+			return ""
+		}
+		switch base {
+		case "DT_WSTR", "DT_STR", "DT_TEXT", "DT_NTEXT":
+			return "string"
+		case "DT_BOOL":
+			return "boolean"
+		case "DT_I1", "DT_I2", "DT_I4", "DT_I8", "DT_UI1", "DT_UI2", "DT_UI4", "DT_UI8",
+			"DT_R4", "DT_R8", "DT_NUMERIC", "DT_DECIMAL", "DT_CY":
+			return "numeric"
+		}
+	case *UnaryOp:
+		if n.Op == "!" {
+			return "boolean"
+		}
+		return staticType(n.Expr)
+	case *BinaryOp:
+		switch n.Op {
+		case "==", "!=", "<", ">", "<=", ">=", "&&", "||":
+			return "boolean"
+		}
+		if left := staticType(n.Left); left == staticType(n.Right) && left != "boolean" {
+			return left
+		}
+	case *Conditional:
+		if t := staticType(n.TrueExpr); t == staticType(n.FalseExpr) {
+			return t
+		}
+	}
+	return ""
+}
+
+// FormatExpression returns SSIS expression text for e that parses back to an
+// equivalent tree. Spacing is canonical and parentheses are only added where
+// operator precedence requires them, so the text may differ from the source
+// the tree was parsed from.
+func FormatExpression(e Expr) string {
+	text, _ := formatExpr(e)
+	return text
+}
+
+// Precedence levels used by formatExpr, from loosest to tightest binding
+const (
+	precConditional = iota
+	precOr
+	precAnd
+	precComparison
+	precAdditive
+	precMultiplicative
+	precUnary
+)
+
+// binaryPrecedence returns the precedence level of a binary operator
+func binaryPrecedence(op string) int {
+	switch op {
+	case "||":
+		return precOr
+	case "&&":
+		return precAnd
+	case "==", "!=", "<", ">", "<=", ">=":
+		return precComparison
+	case "+", "-":
+		return precAdditive
+	}
+	return precMultiplicative
+}
+
+// formatExpr returns the text of e and the precedence level it binds at
+func formatExpr(e Expr) (string, int) {
+	switch n := e.(type) {
+	case *Literal:
+		return formatLiteral(n.Value), precUnary
+	case *Variable:
+		return "@[" + n.Name + "]", precUnary
+	case *BinaryOp:
+		prec := binaryPrecedence(n.Op)
+		// Operators are left-associative, so a right operand at the same
+		// level needs parentheses: a - (b - c)
+		return formatOperand(n.Left, prec) + " " + n.Op + " " + formatOperand(n.Right, prec+1), prec
+	case *UnaryOp:
+		operand := formatOperand(n.Expr, precUnary)
+		if strings.HasPrefix(operand, n.Op) {
+			operand = "(" + operand + ")"
+		}
+		return n.Op + operand, precUnary
+	case *FunctionCall:
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = FormatExpression(arg)
+		}
+		return n.Name + "(" + strings.Join(args, ", ") + ")", precUnary
+	case *Conditional:
+		return formatOperand(n.Condition, precOr) + " ? " + FormatExpression(n.TrueExpr) + " : " + FormatExpression(n.FalseExpr), precConditional
+	case *Cast:
+		if lit, ok := n.Expr.(*Literal); ok && lit.Value == nil {
+			return "NULL(" + n.Type + ")", precUnary
+		}
+		return "(" + n.Type + ")" + formatOperand(n.Expr, precUnary), precUnary
+	}
+	return "", precUnary
+}
+
+// formatOperand formats e, parenthesized if it binds looser than minPrec
+func formatOperand(e Expr, minPrec int) string {
+	text, prec := formatExpr(e)
+	if prec < minPrec {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+// formatLiteral returns the SSIS text of a literal value
+func formatLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL(DT_NULL)"
+	case string:
+		return `"` + formatStringEscapes.Replace(v) + `"`
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case float64:
+		// Keep a decimal point so the literal parses back as float64, not int64
+		text := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(text, ".NI") {
+			text += ".0"
+		}
+		return text
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case time.Time:
+		return `(DT_DBTIMESTAMP)"` + v.Format(dateLayouts[0]) + `"`
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// formatStringEscapes escapes the characters unescapeString resolves
+var formatStringEscapes = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+
+// FoldConstants returns e with every subtree that does not depend on
+// variables, parameters or the volatile functions GETDATE, GETUTCDATE and
+// NEWID replaced by its value, so @[User::N] + 2 * 3 becomes @[User::N] + 6.
+// A conditional whose condition folds keeps only the branch it selects.
+// Subtrees that fail to evaluate or evaluate to null are kept as they are so
+// the error, or the type of the null, is preserved. e itself is not modified.
+func FoldConstants(e Expr) Expr {
+	switch n := e.(type) {
+	case *BinaryOp:
+		return foldNode(&BinaryOp{Left: FoldConstants(n.Left), Op: n.Op, Right: FoldConstants(n.Right)})
+	case *UnaryOp:
+		return foldNode(&UnaryOp{Op: n.Op, Expr: FoldConstants(n.Expr)})
+	case *Cast:
+		return foldNode(&Cast{Type: n.Type, Expr: FoldConstants(n.Expr)})
+	case *FunctionCall:
+		args := make([]Expr, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = FoldConstants(arg)
+		}
+		folded := &FunctionCall{Name: n.Name, Args: args}
+		if volatileFunctions[n.Name] {
+			return folded
+		}
+		return foldNode(folded)
+	case *Conditional:
+		folded := &Conditional{Condition: FoldConstants(n.Condition), TrueExpr: FoldConstants(n.TrueExpr), FalseExpr: FoldConstants(n.FalseExpr)}
+		if lit, ok := folded.Condition.(*Literal); ok {
+			if cond, ok := lit.Value.(bool); ok {
+				if cond {
+					return folded.TrueExpr
+				}
+				return folded.FalseExpr
+			}
+		}
+		return folded
+	}
+	return e
+}
+
+// volatileFunctions lists the functions whose result differs between calls
+var volatileFunctions = map[string]bool{"GETDATE": true, "GETUTCDATE": true, "NEWID": true}
+
+// isVolatileExpression reports whether expr calls one of the volatileFunctions,
+// so its value must not be reused between evaluations
+func isVolatileExpression(expr string) bool {
+	tokens := tokenize(expr)
+	for i, tok := range tokens {
+		if tok.Type == "identifier" && volatileFunctions[strings.ToUpper(tok.Value)] && i+1 < len(tokens) && tokens[i+1].Type == "lparen" {
+			return true
+		}
+	}
+	return false
+}
+
+// foldNode evaluates e into a Literal when all of its operands are literals
+func foldNode(e Expr) Expr {
+	var operands []Expr
+	switch n := e.(type) {
+	case *BinaryOp:
+		operands = []Expr{n.Left, n.Right}
+	case *UnaryOp:
+		operands = []Expr{n.Expr}
+	case *Cast:
+		operands = []Expr{n.Expr}
+	case *FunctionCall:
+		operands = n.Args
+	}
+	for _, operand := range operands {
+		if _, ok := operand.(*Literal); !ok {
+			return e
+		}
+	}
+	value, err := e.Eval(map[string]interface{}{})
+	if err != nil || value == nil {
+		return e
+	}
+	return &Literal{Value: value}
+}
+
+// isTerminatedString reports whether a string token produced by tokenize ends
+// with an unescaped closing quote
+func isTerminatedString(lit string) bool {
+	if len(lit) < 2 {
+		return false
+	}
+	for i := 1; i < len(lit); i++ {
+		switch lit[i] {
+		case '\\':
+			i++
+		case lit[0]:
+			return i == len(lit)-1
+		}
+	}
+	return false
+}
+
+// splitAssignment splits a For Loop init or assign expression such as
+// "@Counter = @Counter + 1" at its assignment operator. ok is false when expr
+// has no single '=' outside string literals.
+func splitAssignment(expr string) (target, value string, ok bool) {
+	inString := false
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case inString && c == '\\':
+			i++
+		case c == '"':
+			inString = !inString
+		case !inString && c == '=':
+			if i+1 < len(expr) && expr[i+1] == '=' {
+				i++
+				continue
+			}
+			if i > 0 && strings.ContainsRune("=!<>", rune(expr[i-1])) {
+				continue
+			}
+			target = strings.TrimSpace(expr[:i])
+			value = strings.TrimSpace(expr[i+1:])
+			return target, value, target != "" && value != ""
+		}
+	}
+	return "", "", false
+}
+
+// Tokenize breaks an SSIS expression into its lexical tokens
+func Tokenize(expr string) []Token {
+	return tokenize(expr)
+}
+
 // parseExpression parses an SSIS expression into an AST
 func parseExpression(expr string) (Expr, error) {
 	tokens := tokenize(expr)
 	if len(tokens) == 0 {
 		return nil, fmt.Errorf("empty expression")
 	}
-	parsed, _, err := parseExpr(tokens, 0)
-	return parsed, err
+	return parseTokens(tokens)
+}
+
+// parseTokens parses tokens as one complete expression; tokens left over
+// after it, as in "1 2", are an error
+func parseTokens(tokens []Token) (Expr, error) {
+	parsed, pos, err := parseExpr(tokens, 0)
+	if err != nil {
+		return nil, err
+	}
+	if pos < len(tokens) {
+		return nil, fmt.Errorf("unexpected token %q at end of expression", tokens[pos].Value)
+	}
+	return parsed, nil
+}
+
+// unescapeString resolves the backslash escapes SSIS recognises in string
+// literals (\n, \r, \t, \", \' and \\). Other backslashes are kept as written.
+func unescapeString(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		switch s[i+1] {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\'', '\\':
+			b.WriteByte(s[i+1])
+		default:
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+	}
+	return b.String()
 }
 
 // tokenize breaks the expression into tokens
@@ -586,13 +1650,31 @@ func tokenize(expr string) []Token {
 				tokens = append(tokens, Token{Type: "unknown", Value: string(expr[i])})
 				i++
 			}
+		case expr[i] == '$':
+			// Parameter reference: $Project::Name, $Package::Name or $[Project::Name]
+			start := i
+			i++
+			if i < len(expr) && expr[i] == '[' {
+				for i < len(expr) && expr[i] != ']' {
+					i++
+				}
+				if i < len(expr) {
+					i++
+				}
+			} else {
+				for i < len(expr) && (isIdentChar(expr[i]) || expr[i] == ':' || expr[i] == '.') {
+					i++
+				}
+			}
+			tokens = append(tokens, Token{Type: "parameter", Value: expr[start:i]})
 		case expr[i] == '"' || expr[i] == '\'':
 			// String literal
 			quote := expr[i]
 			start := i
 			i++
 			for i < len(expr) && expr[i] != quote {
-				if expr[i] == '\\' {
+				// A backslash escapes the next character, if there is one
+				if expr[i] == '\\' && i+1 < len(expr) {
 					i++
 				}
 				i++
@@ -601,14 +1683,34 @@ func tokenize(expr string) []Token {
 				i++
 			}
 			tokens = append(tokens, Token{Type: "string", Value: expr[start:i]})
+		case expr[i] == '0' && i+2 < len(expr) && (expr[i+1] == 'x' || expr[i+1] == 'X') && isHexDigit(expr[i+2]):
+			// Hex number: 0x1F
+			start := i
+			i += 2
+			for i < len(expr) && isHexDigit(expr[i]) {
+				i++
+			}
+			tokens = append(tokens, Token{Type: "hex", Value: expr[start:i]})
 		case expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.':
-			// Number
+			// Number, with optional exponent: 1.5e3, 2.5E-2
 			start := i
 			for i < len(expr) && (expr[i] >= '0' && expr[i] <= '9' || expr[i] == '.') {
 				i++
 			}
+			if i < len(expr) && (expr[i] == 'e' || expr[i] == 'E') {
+				j := i + 1
+				if j < len(expr) && (expr[j] == '+' || expr[j] == '-') {
+					j++
+				}
+				if j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+					i = j
+					for i < len(expr) && expr[i] >= '0' && expr[i] <= '9' {
+						i++
+					}
+				}
+			}
 			tokens = append(tokens, Token{Type: "number", Value: expr[start:i]})
-		case expr[i] == '+' || expr[i] == '-' || expr[i] == '*' || expr[i] == '/':
+		case expr[i] == '+' || expr[i] == '-' || expr[i] == '*' || expr[i] == '/' || expr[i] == '%':
 			tokens = append(tokens, Token{Type: "operator", Value: string(expr[i])})
 			i++
 		case expr[i] == '=' && i+1 < len(expr) && expr[i+1] == '=':
@@ -630,17 +1732,10 @@ func tokenize(expr string) []Token {
 			tokens = append(tokens, Token{Type: "operator", Value: "||"})
 			i += 2
 		case expr[i] == '(':
-			// Check for cast: (DT_type)
-			if i+3 < len(expr) && expr[i+1] == 'D' && expr[i+2] == 'T' && expr[i+3] == '_' {
-				start := i
-				i += 4
-				for i < len(expr) && expr[i] != ')' {
-					i++
-				}
-				if i < len(expr) {
-					i++
-				}
-				tokens = append(tokens, Token{Type: "cast", Value: expr[start:i]})
+			// Check for cast: (DT_type) or (DT_type, param, ...)
+			if end, ok := scanCast(expr, i); ok {
+				tokens = append(tokens, Token{Type: "cast", Value: expr[i:end]})
+				i = end
 			} else {
 				tokens = append(tokens, Token{Type: "lparen", Value: "("})
 				i++
@@ -683,6 +1778,51 @@ func tokenize(expr string) []Token {
 	return tokens
 }
 
+// isIdentChar reports whether c may appear in an identifier
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// isHexDigit reports whether c is a hexadecimal digit
+func isHexDigit(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// scanCast reports whether a cast such as (DT_WSTR, 50) starts at position i and where it ends
+func scanCast(expr string, i int) (int, bool) {
+	if !strings.HasPrefix(expr[i:], "(DT_") {
+		return 0, false
+	}
+	j := i + 4
+	for j < len(expr) && (expr[j] >= 'A' && expr[j] <= 'Z' || expr[j] >= 'a' && expr[j] <= 'z' || expr[j] >= '0' && expr[j] <= '9' || expr[j] == '_') {
+		j++
+	}
+	// Optional comma-separated numeric parameters
+	for {
+		for j < len(expr) && expr[j] == ' ' {
+			j++
+		}
+		if j >= len(expr) || expr[j] != ',' {
+			break
+		}
+		j++
+		for j < len(expr) && expr[j] == ' ' {
+			j++
+		}
+		start := j
+		for j < len(expr) && expr[j] >= '0' && expr[j] <= '9' {
+			j++
+		}
+		if j == start {
+			return 0, false
+		}
+	}
+	if j >= len(expr) || expr[j] != ')' {
+		return 0, false
+	}
+	return j + 1, true
+}
+
 // parseExpr parses an expression with precedence
 func parseExpr(tokens []Token, pos int) (Expr, int, error) {
 	left, pos, err := parseLogicalOr(tokens, pos)
@@ -690,10 +1830,12 @@ func parseExpr(tokens []Token, pos int) (Expr, int, error) {
 		return nil, pos, err
 	}
 
-	// Check for conditional
+	// Check for conditional; the false branch re-enters parseExpr so that
+	// a ? b : c ? d : e groups as a ? b : (c ? d : e)
 	if pos < len(tokens) && tokens[pos].Type == "question" {
 		pos++ // consume ?
-		trueExpr, pos, err := parseExpr(tokens, pos)
+		var trueExpr, falseExpr Expr
+		trueExpr, pos, err = parseExpr(tokens, pos)
 		if err != nil {
 			return nil, pos, err
 		}
@@ -701,7 +1843,7 @@ func parseExpr(tokens []Token, pos int) (Expr, int, error) {
 			return nil, pos, fmt.Errorf("expected : in conditional")
 		}
 		pos++ // consume :
-		falseExpr, pos, err := parseExpr(tokens, pos)
+		falseExpr, pos, err = parseExpr(tokens, pos)
 		if err != nil {
 			return nil, pos, err
 		}
@@ -787,13 +1929,13 @@ func parseAddSub(tokens []Token, pos int) (Expr, int, error) {
 	return left, pos, nil
 }
 
-// parseTerm parses multiplication and division
+// parseTerm parses multiplication, division and modulo
 func parseTerm(tokens []Token, pos int) (Expr, int, error) {
 	left, pos, err := parseFactor(tokens, pos)
 	if err != nil {
 		return nil, pos, err
 	}
-	for pos < len(tokens) && tokens[pos].Type == "operator" && (tokens[pos].Value == "*" || tokens[pos].Value == "/") {
+	for pos < len(tokens) && tokens[pos].Type == "operator" && (tokens[pos].Value == "*" || tokens[pos].Value == "/" || tokens[pos].Value == "%") {
 		op := tokens[pos].Value
 		pos++
 		right, newPos, err := parseFactor(tokens, pos)
@@ -821,6 +1963,15 @@ func parseFactor(tokens []Token, pos int) (Expr, int, error) {
 		if err != nil {
 			return nil, newPos, err
 		}
+		// Fold a negated numeric literal, so -42 is a literal
+		if lit, ok := expr.(*Literal); ok && token.Value == "-" {
+			switch v := lit.Value.(type) {
+			case int64:
+				return &Literal{Value: -v}, newPos, nil
+			case float64:
+				return &Literal{Value: -v}, newPos, nil
+			}
+		}
 		return &UnaryOp{Op: token.Value, Expr: expr}, newPos, nil
 	}
 
@@ -842,18 +1993,54 @@ func parseFactor(tokens []Token, pos int) (Expr, int, error) {
 	pos++
 	switch token.Type {
 	case "number":
+		// Integer literals are int64, so 7 / 2 divides as integers; a literal
+		// with a decimal point or exponent, or too large for int64, is float64
+		if !strings.ContainsAny(token.Value, ".eE") {
+			if val, err := strconv.ParseInt(token.Value, 10, 64); err == nil {
+				return &Literal{Value: val}, pos, nil
+			}
+		}
 		if val, err := strconv.ParseFloat(token.Value, 64); err == nil {
 			return &Literal{Value: val}, pos, nil
 		}
 		return nil, pos, fmt.Errorf("invalid number: %s", token.Value)
+	case "hex":
+		if val, err := strconv.ParseUint(token.Value[2:], 16, 64); err == nil {
+			if val <= math.MaxInt64 {
+				return &Literal{Value: int64(val)}, pos, nil
+			}
+			return &Literal{Value: float64(val)}, pos, nil
+		}
+		return nil, pos, fmt.Errorf("invalid hex number: %s", token.Value)
 	case "string":
+		if !isTerminatedString(token.Value) {
+			return nil, pos, fmt.Errorf("unterminated string literal %s", token.Value)
+		}
 		// Remove quotes
-		val := token.Value[1 : len(token.Value)-1]
-		// Handle escapes if needed
+		val := unescapeString(token.Value[1 : len(token.Value)-1])
 		return &Literal{Value: val}, pos, nil
 	case "variable":
+		if !strings.HasSuffix(token.Value, "]") {
+			return nil, pos, fmt.Errorf("unterminated variable reference %s", token.Value)
+		}
 		// Remove @[ and ]
 		name := token.Value[2 : len(token.Value)-1]
+		if name == "" {
+			return nil, pos, fmt.Errorf("empty variable reference %s", token.Value)
+		}
+		return &Variable{Name: name}, pos, nil
+	case "parameter":
+		// Normalize $[Project::Name] to $Project::Name
+		name := token.Value
+		if strings.HasPrefix(name, "$[") {
+			if !strings.HasSuffix(name, "]") {
+				return nil, pos, fmt.Errorf("unterminated parameter reference %s", token.Value)
+			}
+			name = "$" + strings.TrimSuffix(name[2:], "]")
+		}
+		if name == "$" {
+			return nil, pos, fmt.Errorf("empty parameter reference %s", token.Value)
+		}
 		return &Variable{Name: name}, pos, nil
 	case "identifier":
 		// Function call
@@ -877,7 +2064,20 @@ func parseFactor(tokens []Token, pos int) (Expr, int, error) {
 				return nil, pos, fmt.Errorf("expected ) in function call")
 			}
 			pos++ // consume )
-			return &FunctionCall{Name: token.Value, Args: args}, pos, nil
+			// Function names are case-insensitive; the tree holds them upper-cased
+			return &FunctionCall{Name: strings.ToUpper(token.Value), Args: args}, pos, nil
+		}
+		// NULL(DT_type): the type is scanned as a cast token
+		if strings.EqualFold(token.Value, "NULL") && pos < len(tokens) && tokens[pos].Type == "cast" {
+			castStr := tokens[pos].Value
+			return &Cast{Type: castStr[1 : len(castStr)-1], Expr: &Literal{Value: nil}}, pos + 1, nil
+		}
+		// Boolean literals (SSIS keywords are case-insensitive)
+		switch strings.ToUpper(token.Value) {
+		case "TRUE":
+			return &Literal{Value: true}, pos, nil
+		case "FALSE":
+			return &Literal{Value: false}, pos, nil
 		}
 		return nil, pos, fmt.Errorf("unexpected identifier: %s", token.Value)
 	case "lparen":
@@ -898,7 +2098,7 @@ func parseFactor(tokens []Token, pos int) (Expr, int, error) {
 // getAllVariables extracts all variables from the package as a map
 func getAllVariables(pkg *Package) (map[string]interface{}, error) {
 	vars := make(map[string]interface{})
-	if pkg == nil || pkg.Variables == nil || pkg.Variables.Variable == nil {
+	if pkg == nil || pkg.ExecutableTypePackage == nil || pkg.Variables == nil || pkg.Variables.Variable == nil {
 		return vars, nil
 	}
 	for _, v := range pkg.Variables.Variable {
@@ -906,27 +2106,7 @@ func getAllVariables(pkg *Package) (map[string]interface{}, error) {
 			continue
 		}
 		fullName := *v.NamespaceAttr + "::" + *v.ObjectNameAttr
-		var value interface{}
-		if v.VariableValue != nil {
-			// Try to parse as number
-			if num, err := strconv.ParseFloat(v.VariableValue.Value, 64); err == nil {
-				value = num
-			} else {
-				value = v.VariableValue.Value
-			}
-		} else {
-			// From properties
-			for _, prop := range v.Property {
-				if prop.NameAttr != nil && *prop.NameAttr == "Value" {
-					if num, err := strconv.ParseFloat(prop.Value, 64); err == nil {
-						value = num
-					} else {
-						value = prop.Value
-					}
-					break
-				}
-			}
-		}
+		value := typedVariableValue(v)
 		if value != nil {
 			vars[fullName] = value
 		}
@@ -934,6 +2114,26 @@ func getAllVariables(pkg *Package) (map[string]interface{}, error) {
 	return vars, nil
 }
 
+// getAllParameters extracts package parameter values as a map keyed by "$Package::Name"
+func getAllParameters(pkg *Package) map[string]interface{} {
+	params := make(map[string]interface{})
+	if pkg == nil || pkg.PackageParameters == nil {
+		return params
+	}
+	for _, param := range pkg.PackageParameters.PackageParameter {
+		if param.ObjectNameAttr == nil {
+			continue
+		}
+		value := GetParameterValue(param)
+		if num, err := strconv.ParseFloat(value, 64); err == nil {
+			params[GetParameterName(param)] = num
+		} else {
+			params[GetParameterName(param)] = value
+		}
+	}
+	return params
+}
+
 // evaluateSimpleExpression provides basic variable substitution (deprecated, use EvaluateExpression)
 func evaluateSimpleExpression(expr string, pkg *Package) (interface{}, error) {
 	// Fallback to old method
@@ -948,6 +2148,8 @@ func evaluateSimpleExpression(expr string, pkg *Package) (interface{}, error) {
 			result = strings.ReplaceAll(result, placeholder, str)
 		} else if num, ok := val.(float64); ok {
 			result = strings.ReplaceAll(result, placeholder, strconv.FormatFloat(num, 'f', -1, 64))
+		} else if num, ok := val.(int64); ok {
+			result = strings.ReplaceAll(result, placeholder, strconv.FormatInt(num, 10))
 		}
 	}
 	// Try to parse as number
@@ -0,0 +1,1244 @@
+package dtsx_test
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/7045kHz/dtsx"
+)
+
+func TestParameterizedCasts(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`(DT_WSTR, 3)"abcdef"`, "abc"},
+		{`(DT_STR, 5, 1252)"abcdefgh"`, "abcde"},
+		{`(DT_WSTR,10)"short"`, "short"},
+		{`(DT_STR, 20, 1252)(1 + 2)`, "3"},
+		{`(DT_NUMERIC, 10, 2)3.14159`, 3.14},
+		{`(DT_DECIMAL, 1)2.26`, 2.3},
+		// With precision equal to scale there are no integer digits to spare
+		{`(DT_NUMERIC,5,5)0.5`, 0.5},
+		{`(DT_NUMERIC, 3, 3)-0.125`, -0.125},
+		{`(DT_NUMERIC, 3, 1)99.94`, 99.9},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, nil)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v (%T), expected %v", tt.expr, result, result, tt.expected)
+		}
+	}
+
+	// Precision overflow is reported
+	if _, err := dtsx.EvaluateExpression(`(DT_NUMERIC, 3, 2)123.4`, nil); err == nil {
+		t.Error("Expected precision error for (DT_NUMERIC, 3, 2)123.4")
+	}
+	if _, err := dtsx.EvaluateExpression(`(DT_NUMERIC, 5, 5)1.5`, nil); err == nil {
+		t.Error("Expected precision error for (DT_NUMERIC, 5, 5)1.5")
+	}
+}
+
+func TestDateCasts(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{`(DT_DBTIMESTAMP)"2024-03-15"`, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+		{`(DT_DBTIMESTAMP)"2024-03-15 13:45:30"`, time.Date(2024, 3, 15, 13, 45, 30, 0, time.UTC)},
+		{`(DT_DATE)"3/15/2024 1:45:30 PM"`, time.Date(2024, 3, 15, 13, 45, 30, 0, time.UTC)},
+		{`(DT_DATE)"2024-03-15"`, time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, nil)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		got, ok := result.(time.Time)
+		if !ok || !got.Equal(tt.expected) {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+
+	// A time.Time passes through unchanged
+	result, err := dtsx.EvaluateExpression(`YEAR((DT_DBTIMESTAMP)GETDATE())`, nil)
+	if err != nil {
+		t.Fatalf("Cast of GETDATE() failed: %v", err)
+	}
+	if result != int64(time.Now().Year()) {
+		t.Errorf("Expected current year, got %v", result)
+	}
+
+	if _, err := dtsx.EvaluateExpression(`(DT_DBTIMESTAMP)"not a date"`, nil); err == nil {
+		t.Error("Expected error for unparseable date string")
+	}
+}
+
+func TestEvaluateWithFixedNow(t *testing.T) {
+	now := time.Date(2019, 7, 4, 10, 30, 0, 0, time.UTC)
+	opts := dtsx.EvaluateOptions{Now: now}
+
+	result, err := dtsx.EvaluateExpressionWithOptions("YEAR(GETDATE())", nil, opts)
+	if err != nil {
+		t.Fatalf("EvaluateExpressionWithOptions failed: %v", err)
+	}
+	if result != int64(2019) {
+		t.Errorf("Expected 2019, got %v", result)
+	}
+
+	result, err = dtsx.EvaluateExpressionWithOptions("GETDATE()", nil, opts)
+	if err != nil {
+		t.Fatalf("EvaluateExpressionWithOptions failed: %v", err)
+	}
+	if got, ok := result.(time.Time); !ok || !got.Equal(now) {
+		t.Errorf("Expected %v, got %v", now, result)
+	}
+}
+
+func TestParserClock(t *testing.T) {
+	est := time.FixedZone("EST", -5*60*60)
+	now := time.Date(2024, 1, 31, 21, 0, 0, 0, est)
+	parser := dtsx.NewPackageParser(dtsx.NewPackageBuilder().Build())
+	parser.SetClock(func() time.Time { return now })
+
+	local, err := parser.EvaluateExpression("GETDATE()")
+	if err != nil {
+		t.Fatalf("EvaluateExpression(GETDATE()) failed: %v", err)
+	}
+	if got, ok := local.(time.Time); !ok || !got.Equal(now) || got.Location() != est {
+		t.Errorf("Expected GETDATE() = %v, got %v", now, local)
+	}
+
+	utc, err := parser.EvaluateExpression("GETUTCDATE()")
+	if err != nil {
+		t.Fatalf("EvaluateExpression(GETUTCDATE()) failed: %v", err)
+	}
+	if got, ok := utc.(time.Time); !ok || !got.Equal(now) || got.Location() != time.UTC {
+		t.Errorf("Expected GETUTCDATE() = %v, got %v", now.UTC(), utc)
+	}
+
+	// The UTC date has already rolled over to February
+	month, err := parser.EvaluateExpression("MONTH(GETUTCDATE())")
+	if err != nil {
+		t.Fatalf("EvaluateExpression(MONTH(GETUTCDATE())) failed: %v", err)
+	}
+	if month != int64(2) {
+		t.Errorf("Expected UTC month 2, got %v", month)
+	}
+
+	// Without a clock GETUTCDATE() reports the current time in UTC
+	parser.SetClock(nil)
+	utc, err = parser.EvaluateExpression("GETUTCDATE()")
+	if err != nil {
+		t.Fatalf("EvaluateExpression(GETUTCDATE()) failed: %v", err)
+	}
+	if got, ok := utc.(time.Time); !ok || got.Location() != time.UTC || time.Since(got) > time.Minute {
+		t.Errorf("Expected current UTC time, got %v", utc)
+	}
+}
+
+func TestDatePart(t *testing.T) {
+	// 2024-03-15 was a Friday
+	opts := dtsx.EvaluateOptions{Now: time.Date(2024, 3, 15, 13, 45, 30, 250*int(time.Millisecond), time.UTC)}
+	tests := []struct {
+		expr     string
+		expected int64
+	}{
+		{`DATEPART("month", GETDATE())`, 3},
+		{`DATEPART("mm", GETDATE())`, 3},
+		{`DATEPART("weekday", GETDATE())`, 6},
+		{`DATEPART("dw", (DT_DBTIMESTAMP)"2024-03-17")`, 1},
+		{`DATEPART("year", GETDATE())`, 2024},
+		{`DATEPART("quarter", GETDATE())`, 1},
+		{`DATEPART("dayofyear", GETDATE())`, 75},
+		{`DATEPART("day", GETDATE())`, 15},
+		{`DATEPART("hour", GETDATE())`, 13},
+		{`DATEPART("minute", GETDATE())`, 45},
+		{`DATEPART("second", GETDATE())`, 30},
+		{`DATEPART("millisecond", GETDATE())`, 250},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpressionWithOptions(tt.expr, nil, opts)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+
+	if _, err := dtsx.EvaluateExpression(`DATEPART("fortnight", GETDATE())`, nil); err == nil {
+		t.Error("Expected error for unknown date part")
+	}
+}
+
+func TestNestedConditionals(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Level", "2", "int").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		// Cascading CASE-like chain selects each branch
+		{`1 == 1 ? "first" : 1 == 1 ? "second" : "third"`, "first"},
+		{`1 == 2 ? "first" : 1 == 1 ? "second" : "third"`, "second"},
+		{`1 == 2 ? "first" : 1 == 2 ? "second" : "third"`, "third"},
+		// Three levels of nesting
+		{`@[User::Level] == 1 ? "one" : @[User::Level] == 2 ? "two" : @[User::Level] == 3 ? "three" : "other"`, "two"},
+		{`@[User::Level] > 5 ? "high" : @[User::Level] > 3 ? "mid" : @[User::Level] > 1 ? "low" : "none"`, "low"},
+		// Nesting in the true branch and inside parentheses
+		{`1 == 1 ? (2 == 2 ? "a" : "b") : "c"`, "a"},
+		{`1 == 1 ? 2 == 3 ? "a" : "b" : "c"`, "b"},
+		{`(1 == 2 ? 1 : 2) + 10`, int64(12)},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+}
+
+func TestNumericLiterals(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"1e3", float64(1000)},
+		{"2.5E-2", 0.025},
+		{"1.5e+2", float64(150)},
+		{"0xFF", int64(255)},
+		{"0x1f + 1", int64(32)},
+		{"-42", int64(-42)},
+		{"10 - -2", int64(12)},
+		{"2e1 * 2", float64(40)},
+		// Literals without a decimal point or exponent are integers
+		{"7 / 2", int64(3)},
+		{"-7 / 2", int64(-3)},
+		{"7 % 4", int64(3)},
+		{"7.0 / 2", 3.5},
+		{"7 / 2.0", 3.5},
+		{"9223372036854775807", int64(math.MaxInt64)},
+		{"9223372036854775808", float64(1 << 63)},
+		// Identifiers ending in 'e' are unaffected
+		{"YEAR(GETDATE()) > 0", true},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, nil)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+}
+
+func TestStringComparisons(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "Region", "West").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`"apple" < "banana"`, true},
+		{`"apple" > "banana"`, false},
+		{`"apple" <= "apple"`, true},
+		{`"b" >= "a"`, true},
+		{`"Zebra" < "apple"`, true}, // ordinal comparison
+		{`@[User::Region] != "East"`, true},
+		{`@[User::Region] == "West"`, true},
+		{`@[User::Region] >= "West"`, true},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+
+	// Mixed string and numeric operands cannot be ordered
+	for _, expr := range []string{`"apple" < 1`, `2 >= "banana"`} {
+		if _, err := dtsx.EvaluateExpression(expr, nil); err == nil {
+			t.Errorf("Expected error comparing mixed types in %s", expr)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`"line1\nline2"`, "line1\nline2"},
+		{`"col1\tcol2"`, "col1\tcol2"},
+		{`"she said \"hi\""`, `she said "hi"`},
+		{`"C:\\temp\\" + "out.csv"`, `C:\temp\out.csv`},
+		{`LEN("a\tb")`, int64(3)},
+		{`"\q"`, `\q`},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, nil)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %q, expected %q", tt.expr, result, tt.expected)
+		}
+	}
+}
+
+func TestStringEndingInBackslash(t *testing.T) {
+	// A trailing backslash has nothing to escape and must not run the scanner past the input
+	tokens := dtsx.Tokenize(`"abc\`)
+	if len(tokens) != 1 || tokens[0].Type != "string" || tokens[0].Value != `"abc\` {
+		t.Errorf("Tokenize(%q) = %v, expected a single string token", `"abc\`, tokens)
+	}
+
+	result, err := dtsx.EvaluateExpression(`"abc\\"`, nil)
+	if err != nil {
+		t.Fatalf("EvaluateExpression failed: %v", err)
+	}
+	if result != `abc\` {
+		t.Errorf("Expected %q, got %q", `abc\`, result)
+	}
+}
+
+func TestBooleanLiterals(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "B", "1", "Int32").
+		AddVariableWithType("User", "Zero", "0", "Int32").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"TRUE", true},
+		{"FALSE", false},
+		{"true", true},
+		{"False", false},
+		{"!TRUE", false},
+		{"TRUE == FALSE", false},
+		{"@[User::B] && TRUE", true},
+		{"@[User::Zero] || FALSE", false},
+		{`TRUE ? "yes" : "no"`, "yes"},
+		{"(DT_BOOL)1 == TRUE", true},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+
+	// TRUE followed by ( is still treated as a function call
+	if _, err := dtsx.EvaluateExpression("TRUE()", nil); err == nil {
+		t.Error("Expected TRUE() to be an unknown function")
+	}
+}
+
+func TestMathFunctions(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Amount", "12.345", "Double").
+		AddVariableWithType("User", "Exp", "10", "Int32").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"ROUND(@[User::Amount], 2)", 12.35},
+		{"ROUND(2.5, 0)", float64(3)},
+		{"ROUND(-2.5, 0)", float64(-3)},
+		{"ROUND(0.125, 2)", 0.13},
+		{`ROUND("3.14159", 3)`, 3.142},
+		{"POWER(2, @[User::Exp])", float64(1024)},
+		{"POWER(4, 0.5)", float64(2)},
+		{"POWER(-2, 3)", float64(-8)},
+		{"SQRT(16)", float64(4)},
+		{"SIGN(-7.5)", float64(-1)},
+		{"SIGN(0)", float64(0)},
+		{"SIGN(3)", float64(1)},
+		{"CEILING(2.0)", float64(2)},
+		{"CEILING(2.1)", float64(3)},
+		{"CEILING(-2.5)", float64(-2)},
+		{"FLOOR(-2.5)", float64(-3)},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+
+	if _, err := dtsx.EvaluateExpression("SQRT(-4)", nil); err == nil {
+		t.Error("Expected error for SQRT of a negative number")
+	}
+}
+
+func TestTokenFunctions(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "CSVLine", "id,name,,city").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`TOKEN(@[User::CSVLine], ",", 2)`, "name"},
+		{`TOKEN(@[User::CSVLine], ",", 3)`, "city"}, // empty segment collapsed
+		{`TOKENCOUNT(@[User::CSVLine], ",")`, int64(3)},
+		{`TOKEN("a;b c|d", "; |", 4)`, "d"},
+		{`TOKENCOUNT("a;b c|d", "; |")`, int64(4)},
+		{`TOKEN(",,lead,trail,,", ",", 1)`, "lead"},
+		{`TOKENCOUNT(",,lead,trail,,", ",")`, int64(2)},
+		{`TOKEN("a,b", ",", 5)`, ""},
+		{`TOKEN("a,b", ",", 0)`, ""},
+		{`TOKENCOUNT("", ",")`, int64(0)},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+}
+
+func TestTokenPathSplitting(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "FilePath", `C:\Data\Inbound\sales_2024-06.csv`).
+		AddVariable("User", "Route", "Zürich→Genève→Bern").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`TOKENCOUNT(@[User::FilePath], "\\")`, int64(4)},
+		{`TOKEN(@[User::FilePath], "\\", 1)`, "C:"},
+		{`TOKEN(@[User::FilePath], "\\", TOKENCOUNT(@[User::FilePath], "\\"))`, "sales_2024-06.csv"},
+		{`TOKEN(TOKEN(@[User::FilePath], "\\", 4), ".", 2)`, "csv"},
+		{`TOKEN(@[User::FilePath], "\\_-.", 5)`, "2024"},
+		{`TOKEN(@[User::FilePath], "\\", 9)`, ""},
+		// Delimiters and tokens are matched as runes, not bytes
+		{`TOKENCOUNT(@[User::Route], "→")`, int64(3)},
+		{`TOKEN(@[User::Route], "→", 2)`, "Genève"},
+		{`TOKEN(@[User::Route], "ü", 1)`, "Z"},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+}
+
+func TestParseExpression(t *testing.T) {
+	parsed, err := dtsx.ParseExpression("@[User::A] + 1")
+	if err != nil {
+		t.Fatalf("ParseExpression failed: %v", err)
+	}
+	root, ok := parsed.(*dtsx.BinaryOp)
+	if !ok {
+		t.Fatalf("Expected *BinaryOp root, got %T", parsed)
+	}
+	if root.Op != "+" {
+		t.Errorf("Expected + operator, got %s", root.Op)
+	}
+	if v, ok := root.Left.(*dtsx.Variable); !ok || v.Name != "User::A" {
+		t.Errorf("Expected left operand User::A, got %#v", root.Left)
+	}
+
+	result, err := parsed.Eval(map[string]interface{}{"User::A": 41.0})
+	if err != nil || result != float64(42) {
+		t.Errorf("Eval = %v (err %v), expected 42", result, err)
+	}
+
+	tokens := dtsx.Tokenize("@[User::A] + 1")
+	if len(tokens) != 3 || tokens[0].Type != "variable" || tokens[1].Value != "+" || tokens[2].Type != "number" {
+		t.Errorf("Unexpected tokens: %+v", tokens)
+	}
+
+	// The whole input must be one expression
+	for _, expr := range []string{"3 & 1", "1 2", `UPPER("a") "b"`, "(1 + 2))"} {
+		if _, err := dtsx.ParseExpression(expr); err == nil {
+			t.Errorf("Expected ParseExpression(%s) to reject the trailing tokens", expr)
+		}
+		if _, err := dtsx.EvaluateExpression(expr, nil); err == nil {
+			t.Errorf("Expected EvaluateExpression(%s) to reject the trailing tokens", expr)
+		}
+	}
+}
+
+func TestEvaluateExpressionWithParams(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "Table", "Orders").
+		Build()
+	params := map[string]interface{}{
+		"$Project::Env": "prod",
+		"Project::Port": 1433.0, // leading $ is optional
+	}
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`@[$Project::Env] + "." + @[User::Table]`, "prod.Orders"},
+		{`$Project::Env + "_" + @[User::Table]`, "prod_Orders"},
+		{`$[Project::Env] == "prod"`, true},
+		{`$Project::Port + 1`, float64(1434)},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpressionWithParams(tt.expr, pkg, params)
+		if err != nil {
+			t.Errorf("EvaluateExpressionWithParams(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpressionWithParams(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+
+	if _, err := dtsx.EvaluateExpression(`@[$Project::Env]`, pkg); err == nil {
+		t.Error("Expected error for an unresolved project parameter")
+	}
+}
+
+func TestPackageParametersFromXML(t *testing.T) {
+	data := []byte(`<?xml version="1.0"?>
+<DTS:Executable xmlns:DTS="www.microsoft.com/SqlServer/Dts" DTS:refId="Package" DTS:ObjectName="Params">
+  <DTS:PackageParameters>
+    <DTS:PackageParameter DTS:ObjectName="BatchSize" DTS:DataType="3">
+      <DTS:Property DTS:DataType="3" DTS:Name="ParameterValue">500</DTS:Property>
+    </DTS:PackageParameter>
+    <DTS:PackageParameter DTS:ObjectName="Region" DTS:DataType="8">
+      <DTS:Property DTS:DataType="8" DTS:Name="ParameterValue">West</DTS:Property>
+    </DTS:PackageParameter>
+  </DTS:PackageParameters>
+</DTS:Executable>`)
+
+	pkg, err := dtsx.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	result, err := dtsx.EvaluateExpression(`@[$Package::BatchSize] * 2`, pkg)
+	if err != nil || result != float64(1000) {
+		t.Errorf("Expected 1000, got %v (err %v)", result, err)
+	}
+
+	// Caller-supplied values override package defaults
+	result, err = dtsx.EvaluateExpressionWithParams(`@[$Package::Region]`, pkg, map[string]interface{}{"$Package::Region": "East"})
+	if err != nil || result != "East" {
+		t.Errorf("Expected East, got %v (err %v)", result, err)
+	}
+}
+
+func TestIntegerCasts(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "A", "-7", "Int32").
+		AddVariableWithType("User", "B", "2", "Int32").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"(DT_I4)(@[User::A] / @[User::B])", int64(-3)},
+		{"(DT_I8)(-7.9)", int64(-7)},
+		{"(DT_I4)7.9", int64(7)},
+		{`(DT_I2)"42"`, int64(42)},
+		{"(DT_I4)TRUE", int64(-1)},
+		// Integer operands use integer division and modulo
+		{"(DT_I4)@[User::A] / (DT_I4)@[User::B]", int64(-3)},
+		{"(DT_I4)@[User::A] % (DT_I4)@[User::B]", int64(-1)},
+		{"(DT_I4)7 % 3", int64(1)},
+		{"(DT_I4)10 * (DT_I4)3 - (DT_I4)1", int64(29)},
+		// Integers mix with floats and compare numerically
+		{"(DT_I4)3 + 0.5", 3.5},
+		{"(DT_I4)3 == 3", true},
+		{"(DT_I4)3 < 3.5", true},
+		{"-(DT_I4)3", int64(-3)},
+		{"ABS((DT_I4)-3)", float64(3)},
+		{"(DT_WSTR, 10)(DT_I4)12.7", "12"},
+		{"(DT_R8)(DT_I4)5 / 2", 2.5},
+		// Integer strings are parsed exactly, right up to the int64 bounds
+		{`(DT_I8)"9223372036854775807"`, int64(math.MaxInt64)},
+		{`(DT_I8)"-9223372036854775808"`, int64(math.MinInt64)},
+		{`(DT_UI8)"9223372036854775807"`, int64(math.MaxInt64)},
+		{`(DT_UI4)"4294967295"`, int64(math.MaxUint32)},
+		{"(DT_I8)9223372036854775807", int64(math.MaxInt64)},
+		{"(DT_UI8)9223372036854775807", int64(math.MaxInt64)},
+		{`(DT_I2)" -12.9 "`, int64(-12)},
+	}
+
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v (%T), expected %v (%T)", tt.expr, result, result, tt.expected, tt.expected)
+		}
+	}
+
+	for _, expr := range []string{
+		"(DT_I1)200", "(DT_UI1)-1", "(DT_I4)1 / (DT_I4)0",
+		// Values beyond int64 are rejected rather than wrapped
+		`(DT_I8)"9223372036854775808"`, `(DT_UI8)"9223372036854775808"`, `(DT_UI8)"18446744073709551615"`,
+		"(DT_UI8)1e19", "(DT_I8)1e19", "(DT_I8)-1e19", `(DT_UI8)"-1"`, "(DT_UI8)9223372036854775808",
+	} {
+		if _, err := dtsx.EvaluateExpression(expr, nil); err == nil {
+			t.Errorf("Expected error for %s", expr)
+		}
+	}
+}
+
+func TestValidateExpressionSyntax(t *testing.T) {
+	// Well-formed expressions are accepted even when their references cannot
+	// be resolved yet
+	for _, expr := range []string{
+		"@[$Project::Missing] + 1",
+		`UPPER(@[User::Undeclared]) == "X"`,
+		"(DT_WSTR, 10)GETDATE()",
+	} {
+		if err := dtsx.ValidateExpressionSyntax(expr); err != nil {
+			t.Errorf("ValidateExpressionSyntax(%s) = %v, expected no error", expr, err)
+		}
+	}
+	if _, err := dtsx.EvaluateExpression("@[$Project::Missing] + 1", nil); err == nil {
+		t.Error("Expected an unresolved parameter to fail evaluation")
+	}
+
+	for _, expr := range []string{"", "(1 + ", "1 + 2 )", "@[User::A] #", `"unterminated`, `"escaped\"`,
+		`"abc\`, `"`, `'`, `@[`, `@[User::X`} {
+		if err := dtsx.ValidateExpressionSyntax(expr); err == nil {
+			t.Errorf("Expected a syntax error for %q", expr)
+		}
+	}
+}
+
+func TestValidatorSeparatesSyntaxErrors(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;").
+		AddConnectionExpression("Warehouse", "ConnectionString", `"Data Source=" + @[$Project::Server]`).
+		AddConnection("Archive", "OLEDB", "Data Source=.;").
+		AddConnectionExpression("Archive", "ConnectionString", `"Data Source=" + (`).
+		Build()
+
+	var syntax, evaluation int
+	for _, e := range dtsx.NewPackageValidator(pkg).Validate() {
+		switch {
+		case strings.HasPrefix(e.Message, "Expression syntax error"):
+			syntax++
+		case strings.HasPrefix(e.Message, "Expression evaluation failed"):
+			evaluation++
+		}
+	}
+	if syntax != 1 || evaluation != 1 {
+		t.Errorf("Expected one syntax and one evaluation error, got %d and %d", syntax, evaluation)
+	}
+}
+
+func TestValidatorReportsUnterminatedTokens(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;").
+		AddConnectionExpression("Warehouse", "ConnectionString", `"Data Source=" + @[`).
+		AddConnection("Archive", "OLEDB", "Data Source=.;").
+		AddConnectionExpression("Archive", "ConnectionString", `"abc\`).
+		Build()
+
+	syntax := 0
+	for _, e := range dtsx.NewPackageValidator(pkg).Validate() {
+		if strings.HasPrefix(e.Message, "Expression syntax error") {
+			syntax++
+		}
+	}
+	if syntax != 2 {
+		t.Errorf("Expected two syntax errors, got %d", syntax)
+	}
+}
+
+func TestTypedVariableValues(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Count", "5", "Int32").
+		AddVariableWithType("User", "Big", "9007199254740993", "Int64").
+		AddVariableWithType("User", "Rate", "2.5", "Double").
+		AddVariable("User", "Text", "7").
+		AddVariable("User", "Zip", "00123").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"@[User::Count]", int64(5)},
+		{"(DT_WSTR, 10)@[User::Count]", "5"},
+		{`"Rows: " + (DT_WSTR, 10)@[User::Count]`, "Rows: 5"},
+		{"@[User::Count] == 5", true},
+		{"@[User::Count] / (DT_I4)2", int64(2)},
+		{"@[User::Big] + (DT_I8)1", int64(9007199254740994)},
+		{"@[User::Rate]", 2.5},
+		{"(DT_WSTR, 10)@[User::Rate]", "2.5"},
+		// String variables keep their text even when it looks numeric
+		{"@[User::Text] + \"1\"", "71"},
+		{"@[User::Zip]", "00123"},
+		{"LEN(@[User::Zip])", int64(5)},
+		{`"ZIP-" + @[User::Zip]`, "ZIP-00123"},
+	}
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v (%T), expected %v (%T)", tt.expr, result, result, tt.expected, tt.expected)
+		}
+	}
+
+	if value, err := dtsx.NewPackageParser(pkg).GetVariableValue("User::Count"); err != nil || value != int64(5) {
+		t.Errorf("Expected parser value int64(5), got %v (%T), err %v", value, value, err)
+	}
+}
+
+func TestBooleanVariables(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Enabled", "-1", "Boolean").
+		AddVariableWithType("User", "Disabled", "0", "Boolean").
+		AddVariableWithType("User", "Flag", "False", "Boolean").
+		AddVariableWithType("User", "Ready", "True", "Boolean").
+		Build()
+
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"@[User::Enabled]", true},
+		{"@[User::Enabled] && TRUE", true},
+		{"@[User::Disabled] && TRUE", false},
+		{"@[User::Disabled] || TRUE", true},
+		// "False" must not be truthy just because the string is non-empty
+		{"@[User::Flag] && TRUE", false},
+		{"!@[User::Flag]", true},
+		{"@[User::Ready] && !@[User::Disabled]", true},
+		{`@[User::Flag] ? "on" : "off"`, "off"},
+		{"@[User::Ready] == TRUE", true},
+	}
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, pkg)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v (%T), expected %v (%T)", tt.expr, result, result, tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestNewIDAndGUIDCasts(t *testing.T) {
+	first, err := dtsx.EvaluateExpression("NEWID()", nil)
+	if err != nil {
+		t.Fatalf("NEWID() failed: %v", err)
+	}
+	guid := regexp.MustCompile(`^\{[0-9A-F]{8}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{4}-[0-9A-F]{12}\}$`)
+	if s, ok := first.(string); !ok || !guid.MatchString(s) {
+		t.Errorf("Expected a brace-wrapped GUID, got %v", first)
+	}
+	if second, _ := dtsx.EvaluateExpression("NEWID()", nil); second == first {
+		t.Errorf("Expected NEWID() to return a new GUID each call, got %v twice", first)
+	}
+	if result, err := dtsx.EvaluateExpression("(DT_GUID)NEWID()", nil); err != nil || !guid.MatchString(result.(string)) {
+		t.Errorf("Expected NEWID() to cast to DT_GUID, got %v (err %v)", result, err)
+	}
+
+	valid := map[string]string{
+		`(DT_GUID)"{0f6e3c3a-7b1d-4f0e-9c2b-5d8a1e4b7c90}"`: "{0F6E3C3A-7B1D-4F0E-9C2B-5D8A1E4B7C90}",
+		`(DT_GUID)"0F6E3C3A-7B1D-4F0E-9C2B-5D8A1E4B7C90"`:   "{0F6E3C3A-7B1D-4F0E-9C2B-5D8A1E4B7C90}",
+	}
+	for expr, expected := range valid {
+		if result, err := dtsx.EvaluateExpression(expr, nil); err != nil || result != expected {
+			t.Errorf("EvaluateExpression(%s) = %v (err %v), expected %s", expr, result, err, expected)
+		}
+	}
+
+	for _, expr := range []string{
+		`(DT_GUID)"not-a-guid"`,
+		`(DT_GUID)"{0F6E3C3A-7B1D-4F0E-9C2B-5D8A1E4B7C90"`,
+		`(DT_GUID)"0F6E3C3A7B1D4F0E9C2B5D8A1E4B7C90"`,
+		"(DT_GUID)42",
+		"NEWID(1)",
+	} {
+		if _, err := dtsx.EvaluateExpression(expr, nil); err == nil {
+			t.Errorf("Expected an error for %s", expr)
+		}
+	}
+}
+
+func TestCheckExpression(t *testing.T) {
+	tests := []struct {
+		expr    string
+		flagged string // substring of the expected issue, "" for none
+	}{
+		{"5 / 0", "division by zero"},
+		{"@[User::X] / 0", "division by zero"},
+		{"@[User::X] % (DT_I4)0", "division by zero"},
+		{`"Total: " + 5`, "type mismatch"},
+		{`(DT_WSTR, 10)@[User::X] - 1`, "type mismatch"},
+		{`@[User::Y] > 5 ? "a" : 1 + "b"`, "type mismatch"},
+		{"@[User::X] / @[User::Y]", ""},
+		{`"Total: " + (DT_WSTR, 10)5`, ""},
+		{"@[User::X] + 1", ""},
+		{"10 / 4", ""},
+	}
+	for _, tt := range tests {
+		ast, err := dtsx.ParseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpression(%s) failed: %v", tt.expr, err)
+		}
+		issues := dtsx.CheckExpression(ast)
+		if tt.flagged == "" {
+			if len(issues) != 0 {
+				t.Errorf("CheckExpression(%s) = %v, expected no issues", tt.expr, issues)
+			}
+			continue
+		}
+		if len(issues) != 1 || !strings.Contains(issues[0], tt.flagged) {
+			t.Errorf("CheckExpression(%s) = %v, expected one %q issue", tt.expr, issues, tt.flagged)
+		}
+	}
+
+	pkg := dtsx.NewPackageBuilder().
+		AddVariable("User", "X", "10").
+		AddVariable("User", "Y", "2").
+		AddConnection("Warehouse", "OLEDB", "Data Source=.;").
+		AddConnectionExpression("Warehouse", "ConnectionString", `"Data Source=" + (DT_WSTR, 10)(@[User::X] / 0)`).
+		AddConnection("Archive", "OLEDB", "Data Source=.;").
+		AddConnectionExpression("Archive", "ConnectionString", `"Data Source=" + (DT_WSTR, 10)(@[User::X] / @[User::Y])`).
+		Build()
+	var warnings []string
+	for _, e := range dtsx.NewPackageValidator(pkg).Validate() {
+		if e.Severity == "warning" && strings.HasPrefix(e.Message, "Expression check") {
+			warnings = append(warnings, e.Message)
+		}
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "division by zero") {
+		t.Errorf("Expected one division-by-zero warning from the validator, got %v", warnings)
+	}
+}
+
+func TestReplaceNullFallback(t *testing.T) {
+	ast, err := dtsx.ParseExpression(`REPLACENULL(@[User::Primary], REPLACENULL(UPPER(@[User::Secondary]), "default"))`)
+	if err != nil {
+		t.Fatalf("ParseExpression failed: %v", err)
+	}
+	tests := []struct {
+		primary, secondary interface{}
+		expected           string
+	}{
+		{"first", "second", "first"},
+		{nil, "second", "SECOND"},
+		{nil, nil, "default"},
+	}
+	for _, tt := range tests {
+		result, err := ast.Eval(map[string]interface{}{"User::Primary": tt.primary, "User::Secondary": tt.secondary})
+		if err != nil {
+			t.Errorf("Eval(%v, %v) failed: %v", tt.primary, tt.secondary, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("Eval(%v, %v) = %v, expected %s", tt.primary, tt.secondary, result, tt.expected)
+		}
+	}
+
+	nullTests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`ISNULL(NULL(DT_WSTR, 10))`, true},
+		{`ISNULL("x")`, false},
+		{`UPPER(NULL(DT_WSTR, 10))`, nil},
+		{`ISNULL(NULL(DT_I4) + 1)`, true},
+		{`REPLACENULL(NULL(DT_I4), 5)`, int64(5)},
+		{`REPLACENULL(NULL(DT_WSTR, 10), REPLACENULL(NULL(DT_WSTR, 10), "third"))`, "third"},
+	}
+	for _, tt := range nullTests {
+		result, err := dtsx.EvaluateExpression(tt.expr, nil)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v (%T), expected %v", tt.expr, result, result, tt.expected)
+		}
+	}
+}
+
+func TestFormatExpressionRoundTrip(t *testing.T) {
+	vars := map[string]interface{}{"User::A": float64(10), "User::B": float64(4), "User::Name": "sales", "$Project::Env": "Prod"}
+	tests := []struct {
+		expr      string
+		formatted string
+	}{
+		{"@[User::A] - (@[User::B] - 1)", "@[User::A] - (@[User::B] - 1)"},
+		{"(@[User::A] + @[User::B]) * 2", "(@[User::A] + @[User::B]) * 2"},
+		{"@[User::A]+@[User::B]*2", "@[User::A] + @[User::B] * 2"},
+		{`UPPER( @[User::Name] )+"\t\"x\""`, `UPPER(@[User::Name]) + "\t\"x\""`},
+		{"-(@[User::A] + 1)", "-(@[User::A] + 1)"},
+		{"!(@[User::A] > 5 && @[User::B] > 5)", "!(@[User::A] > 5 && @[User::B] > 5)"},
+		{`@[User::A] > 5 ? "big" : @[User::A] > 2 ? "mid" : "small"`, `@[User::A] > 5 ? "big" : @[User::A] > 2 ? "mid" : "small"`},
+		{`(@[User::A] > 5 ? 1 : 2) + 3`, `(@[User::A] > 5 ? 1 : 2) + 3`},
+		{`(DT_WSTR, 10)(@[User::A] / 4)`, `(DT_WSTR, 10)(@[User::A] / 4)`},
+		{`@[$Project::Env] == "Prod" || FALSE`, `@[$Project::Env] == "Prod" || FALSE`},
+		{`REPLACENULL(NULL(DT_WSTR, 10), "none")`, `REPLACENULL(NULL(DT_WSTR, 10), "none")`},
+		{`SUBSTRING("abcdef", 2, 3) + (DT_WSTR, 5)-2.5`, `SUBSTRING("abcdef", 2, 3) + (DT_WSTR, 5)-2.5`},
+	}
+	for _, tt := range tests {
+		ast, err := dtsx.ParseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpression(%s) failed: %v", tt.expr, err)
+		}
+		formatted := dtsx.FormatExpression(ast)
+		if formatted != tt.formatted {
+			t.Errorf("FormatExpression(%s) = %s, expected %s", tt.expr, formatted, tt.formatted)
+		}
+		reparsed, err := dtsx.ParseExpression(formatted)
+		if err != nil {
+			t.Errorf("ParseExpression(%s) of formatted text failed: %v", formatted, err)
+			continue
+		}
+		want, wantErr := ast.Eval(vars)
+		got, gotErr := reparsed.Eval(vars)
+		if want != got || (wantErr == nil) != (gotErr == nil) {
+			t.Errorf("%s evaluates to %v (%v) after formatting, expected %v (%v)", formatted, got, gotErr, want, wantErr)
+		}
+	}
+}
+
+func TestFoldConstants(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected string
+	}{
+		{"2 * 3", "6"},
+		{"@[User::N] + 2 * 3", "@[User::N] + 6"},
+		{`UPPER("ab") + LOWER(@[User::Name])`, `"AB" + LOWER(@[User::Name])`},
+		{"(DT_I4)(7 / 2)", "3"},
+		{`1 > 2 ? @[User::A] : @[User::B]`, "@[User::B]"},
+		{`@[User::N] > 0 ? 10 - 4 : 0`, "@[User::N] > 0 ? 6 : 0"},
+		{"GETDATE()", "GETDATE()"},
+		{`DATEADD("day", 1 + 1, GETDATE())`, `DATEADD("day", 2, GETDATE())`},
+		{"@[User::N] / (5 - 5)", "@[User::N] / 0"},
+		{"1 / 0", "1 / 0"},
+		{"NULL(DT_WSTR, 10)", "NULL(DT_WSTR, 10)"},
+	}
+	for _, tt := range tests {
+		ast, err := dtsx.ParseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpression(%s) failed: %v", tt.expr, err)
+		}
+		before := dtsx.FormatExpression(ast)
+		if folded := dtsx.FormatExpression(dtsx.FoldConstants(ast)); folded != tt.expected {
+			t.Errorf("FoldConstants(%s) = %s, expected %s", tt.expr, folded, tt.expected)
+		}
+		if after := dtsx.FormatExpression(ast); after != before {
+			t.Errorf("FoldConstants modified its input: %s became %s", before, after)
+		}
+	}
+
+	ast, _ := dtsx.ParseExpression("2 * 3")
+	if lit, ok := dtsx.FoldConstants(ast).(*dtsx.Literal); !ok || lit.Value != int64(6) {
+		t.Errorf("Expected 2 * 3 to fold to the literal 6, got %#v", dtsx.FoldConstants(ast))
+	}
+}
+
+func TestEvaluateExpressionSafe(t *testing.T) {
+	pkg := dtsx.NewPackageBuilder().
+		AddVariableWithType("User", "Count", "5", "Int32").
+		Build()
+
+	result, errs := dtsx.EvaluateExpressionSafe(`@[User::Count] > 3 ? "many" : @[User::Missing]`, pkg)
+	if result != "many" || len(errs) != 0 {
+		t.Errorf("Expected the taken branch \"many\" with no errors, got %v, %v", result, errs)
+	}
+
+	result, errs = dtsx.EvaluateExpressionSafe(`ISNULL(@[User::Missing]) ? "fallback" : "value"`, pkg)
+	if result != "fallback" || len(errs) != 1 || !strings.Contains(errs[0].Error(), "User::Missing") {
+		t.Errorf("Expected \"fallback\" and one missing variable error, got %v, %v", result, errs)
+	}
+
+	result, errs = dtsx.EvaluateExpressionSafe(`REPLACENULL(UPPER(@[User::Missing]), "none") + (DT_WSTR, 10)(@[User::Count] + @[User::Other])`, pkg)
+	if result != nil || len(errs) != 2 {
+		t.Errorf("Expected a null result and two errors, got %v, %v", result, errs)
+	}
+
+	if _, err := dtsx.EvaluateExpression(`ISNULL(@[User::Missing]) ? "fallback" : "value"`, pkg); err == nil {
+		t.Error("Expected EvaluateExpression to fail on the missing variable")
+	}
+	if _, errs := dtsx.EvaluateExpressionSafe("(1 + ", pkg); len(errs) != 1 {
+		t.Errorf("Expected one parse error, got %v", errs)
+	}
+}
+
+func TestIntegerLiteralArithmetic(t *testing.T) {
+	vars := map[string]interface{}{"User::N": int64(3), "User::Ratio": 3.0}
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{"@[User::N] / 2", int64(1)},
+		{"@[User::N] % 2", int64(1)},
+		{"@[User::N] * 2 + 1", int64(7)},
+		{"@[User::Ratio] / 2", 1.5},
+		{"(DT_R8)@[User::N] / 2", 1.5},
+		{"@[User::N] / 2 == 1", true},
+	}
+	for _, tt := range tests {
+		ast, err := dtsx.ParseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpression(%s) failed: %v", tt.expr, err)
+		}
+		result, err := ast.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("Eval(%s) = %v (%T), expected %v (%T)", tt.expr, result, result, tt.expected, tt.expected)
+		}
+	}
+
+	// Float literals keep their decimal point when formatted, so the text
+	// parses back to the same type
+	ast, _ := dtsx.ParseExpression("(DT_R8)7")
+	folded := dtsx.FormatExpression(dtsx.FoldConstants(ast))
+	if folded != "7.0" {
+		t.Errorf("Expected (DT_R8)7 to fold to 7.0, got %s", folded)
+	}
+	if reparsed, _ := dtsx.ParseExpression(folded); reparsed.(*dtsx.Literal).Value != 7.0 {
+		t.Errorf("Expected %s to parse back as float64", folded)
+	}
+}
+
+func TestIntegerConditionsAndFunctions(t *testing.T) {
+	vars := map[string]interface{}{"User::Count": int64(2), "User::Empty": int64(0)}
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		// An integer condition is true when non-zero
+		{`@[User::Count] ? "a" : "b"`, "a"},
+		{`@[User::Empty] ? "a" : "b"`, "b"},
+		{`!@[User::Empty]`, true},
+		{`@[User::Count] && @[User::Empty]`, false},
+		// Functions SSIS types as integers return int64
+		{`LEN("abcde") / 2`, int64(2)},
+		{`TOKENCOUNT("a,b,c", ",") * 2`, int64(6)},
+		{`YEAR((DT_DBTIMESTAMP)"2024-03-15")`, int64(2024)},
+		{`DATEDIFF("day", (DT_DBTIMESTAMP)"2024-03-01", (DT_DBTIMESTAMP)"2024-03-15")`, int64(14)},
+		{`SUBSTRING("abcdef", @[User::Count], 2)`, "bc"},
+		// The null functions return an integer argument unchanged
+		{`REPLACENULL(@[User::Count], 0)`, int64(2)},
+	}
+	for _, tt := range tests {
+		ast, err := dtsx.ParseExpression(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseExpression(%s) failed: %v", tt.expr, err)
+		}
+		result, err := ast.Eval(vars)
+		if err != nil {
+			t.Errorf("Eval(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("Eval(%s) = %v (%T), expected %v (%T)", tt.expr, result, result, tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestFunctionNamesAreCaseInsensitive(t *testing.T) {
+	for _, expr := range []string{`upper("a")`, `Upper("a")`, `UPPER("a")`} {
+		ast, err := dtsx.ParseExpression(expr)
+		if err != nil {
+			t.Fatalf("ParseExpression(%s) failed: %v", expr, err)
+		}
+		result, err := ast.Eval(nil)
+		if err != nil || result != "A" {
+			t.Errorf("Eval(%s) = %v (err %v), expected A", expr, result, err)
+		}
+		if folded := dtsx.FormatExpression(dtsx.FoldConstants(ast)); folded != `"A"` {
+			t.Errorf("FoldConstants(%s) = %s, expected \"A\"", expr, folded)
+		}
+	}
+
+	ast, _ := dtsx.ParseExpression("year(getdate())")
+	if folded := dtsx.FormatExpression(dtsx.FoldConstants(ast)); folded != "YEAR(GETDATE())" {
+		t.Errorf("Expected a volatile call in any case to stay unfolded, got %s", folded)
+	}
+}
+
+func TestPinnedNowReachesNestedCalls(t *testing.T) {
+	now := time.Date(2021, 12, 31, 23, 0, 0, 0, time.FixedZone("CET", 60*60))
+	opts := dtsx.EvaluateOptions{Now: now}
+	tests := []struct {
+		expr     string
+		expected interface{}
+	}{
+		{`YEAR(DATEADD("hour", 2, GETDATE()))`, int64(2022)},
+		{`DAY(GETUTCDATE()) == 31 ? "utc" : "local"`, "utc"},
+		{`(DT_WSTR, 4)YEAR(GETUTCDATE())`, "2021"},
+	}
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpressionWithOptions(tt.expr, nil, opts)
+		if err != nil {
+			t.Errorf("EvaluateExpressionWithOptions(%s) failed: %v", tt.expr, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("EvaluateExpressionWithOptions(%s) = %v, expected %v", tt.expr, result, tt.expected)
+		}
+	}
+
+	// Without a pinned time the evaluator reads the clock
+	ast, _ := dtsx.ParseExpression("GETDATE()")
+	result, err := ast.Eval(map[string]interface{}{})
+	if got, ok := result.(time.Time); err != nil || !ok || time.Since(got) > time.Minute {
+		t.Errorf("Expected the current time, got %v (err %v)", result, err)
+	}
+	if _, err := dtsx.EvaluateExpression("GETDATE(1)", nil); err == nil {
+		t.Error("Expected an error for GETDATE with an argument")
+	}
+}
+
+func TestParserCacheSkipsVolatileExpressions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	parser := dtsx.NewPackageParser(dtsx.NewPackageBuilder().AddVariable("User", "Name", "a").Build())
+	parser.SetClock(func() time.Time {
+		now = now.Add(time.Hour)
+		return now
+	})
+
+	first, err := parser.EvaluateExpression("GETDATE()")
+	if err != nil {
+		t.Fatalf("EvaluateExpression(GETDATE()) failed: %v", err)
+	}
+	second, _ := parser.EvaluateExpression("GETDATE()")
+	if first == second {
+		t.Errorf("Expected each GETDATE() call to read the clock, got %v twice", first)
+	}
+	if h, _ := parser.EvaluateExpression("DATEPART(\"hour\", getutcdate())"); h != int64(3) {
+		t.Errorf("Expected the third clock reading, got %v", h)
+	}
+	if a, b := mustEvaluate(t, parser, "NEWID()"), mustEvaluate(t, parser, "NEWID()"); a == b {
+		t.Errorf("Expected NEWID() to differ between calls, got %v twice", a)
+	}
+}
+
+func mustEvaluate(t *testing.T, parser *dtsx.PackageParser, expr string) interface{} {
+	t.Helper()
+	result, err := parser.EvaluateExpression(expr)
+	if err != nil {
+		t.Fatalf("EvaluateExpression(%s) failed: %v", expr, err)
+	}
+	return result
+}
+
+func TestParseExpressionRejectsUnterminatedTokens(t *testing.T) {
+	for _, expr := range []string{`"`, `'`, `"a`, `"abc\`, `@[`, `@[User::X`, `@[]`, `$[Project::X`, `"a" + @[User::X`} {
+		if len(dtsx.Tokenize(expr)) == 0 {
+			t.Errorf("Tokenize(%q) returned no tokens", expr)
+		}
+		if e, err := dtsx.ParseExpression(expr); err == nil {
+			t.Errorf("ParseExpression(%q) = %#v, expected an error", expr, e)
+		}
+		if _, err := dtsx.EvaluateExpression(expr, nil); err == nil {
+			t.Errorf("EvaluateExpression(%q) succeeded, expected an error", expr)
+		}
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	for _, expr := range []string{
+		"9223372036854775807 + 1",
+		"-9223372036854775807 - 2",
+		"4611686018427387904 * 2",
+		"(DT_I8)-9223372036854775807 - 1 - 1",
+		"-((DT_I8)-9223372036854775807 - 1)",
+		"((DT_I8)-9223372036854775807 - 1) / -1",
+	} {
+		if result, err := dtsx.EvaluateExpression(expr, nil); err == nil || !strings.Contains(err.Error(), "overflow") {
+			t.Errorf("EvaluateExpression(%s) = %v, %v; expected an overflow error", expr, result, err)
+		}
+	}
+
+	// Results at the edges of the int64 range are fine
+	tests := []struct {
+		expr     string
+		expected int64
+	}{
+		{"9223372036854775806 + 1", math.MaxInt64},
+		{"-9223372036854775807 - 1", math.MinInt64},
+		{"3037000499 * 3037000499", 9223372030926249001},
+		{"((DT_I8)-9223372036854775807 - 1) % -1", 0},
+	}
+	for _, tt := range tests {
+		result, err := dtsx.EvaluateExpression(tt.expr, nil)
+		if err != nil || result != tt.expected {
+			t.Errorf("EvaluateExpression(%s) = %v, %v; expected %d", tt.expr, result, err, tt.expected)
+		}
+	}
+}
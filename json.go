@@ -0,0 +1,173 @@
+// json.go - JSON analysis export
+//
+// This file renders the package analysis (variables, connections, SQL,
+// expressions and execution order) as a JSON document for downstream tools.
+// The document shape is declared by PackageAnalysis so consumers can decode it
+// into the same types.
+
+package dtsx
+
+import (
+	"encoding/json"
+	"fmt"
+
+	schema "github.com/7045kHz/dtsx/schemas"
+)
+
+// PackageAnalysis is the JSON document produced by AnalyzeJSON. Lists keep
+// document order; empty lists are written as [] rather than null.
+type PackageAnalysis struct {
+	Name          string                 `json:"name"`
+	RefId         string                 `json:"refId"`
+	Variables     []AnalysisVariable     `json:"variables"`
+	Connections   []AnalysisConnection   `json:"connections"`
+	SQLStatements []AnalysisSQLStatement `json:"sqlStatements"`
+	Expressions   []AnalysisExpression   `json:"expressions"`
+	// Tasks lists the package's top-level executables. Order is omitted for
+	// every task when the precedence constraints contain a cycle.
+	Tasks []AnalysisTask `json:"tasks"`
+}
+
+// AnalysisVariable is a variable entry in PackageAnalysis
+type AnalysisVariable struct {
+	Name       string `json:"name"` // qualified, e.g. "User::Count"
+	DataType   *int   `json:"dataType,omitempty"`
+	Value      string `json:"value"`
+	Expression string `json:"expression,omitempty"`
+}
+
+// AnalysisConnection is a connection manager entry in PackageAnalysis
+type AnalysisConnection struct {
+	Name             string `json:"name"`
+	RefId            string `json:"refId,omitempty"`
+	Type             string `json:"type"`
+	ConnectionString string `json:"connectionString"`
+}
+
+// AnalysisSQLStatement is a SQL statement entry in PackageAnalysis
+type AnalysisSQLStatement struct {
+	TaskName         string   `json:"taskName"`
+	TaskType         string   `json:"taskType"` // "Control Flow" or "Dataflow"
+	RefId            string   `json:"refId"`
+	SQL              string   `json:"sql"`
+	Connections      []string `json:"connections"`
+	SourceType       string   `json:"sourceType,omitempty"`
+	Source           string   `json:"source,omitempty"`
+	Dialect          string   `json:"dialect,omitempty"`
+	ComponentClassID string   `json:"componentClassId,omitempty"`
+}
+
+// AnalysisExpression is an expression entry in PackageAnalysis
+type AnalysisExpression struct {
+	Expression string `json:"expression"`
+	Location   string `json:"location"`
+	Name       string `json:"name,omitempty"`
+	Context    string `json:"context,omitempty"`
+}
+
+// AnalysisTask is an executable entry in PackageAnalysis
+type AnalysisTask struct {
+	Name      string   `json:"name"`
+	RefId     string   `json:"refId"`
+	Type      string   `json:"type"`
+	Order     int      `json:"order,omitempty"` // 1-based execution order
+	DependsOn []string `json:"dependsOn"`
+}
+
+// Analyze collects the package analysis returned by AnalyzeJSON
+func (p *Package) Analyze() (*PackageAnalysis, error) {
+	if p == nil {
+		return nil, fmt.Errorf("package is nil")
+	}
+
+	analysis := &PackageAnalysis{
+		Name:          derefString(p.ObjectNameAttr),
+		RefId:         derefString(p.RefIdAttr),
+		Variables:     []AnalysisVariable{},
+		Connections:   []AnalysisConnection{},
+		SQLStatements: []AnalysisSQLStatement{},
+		Expressions:   []AnalysisExpression{},
+		Tasks:         []AnalysisTask{},
+	}
+
+	for _, v := range p.GetVariables().Results.([]*schema.VariableType) {
+		variable := AnalysisVariable{
+			Name:       GetVariableName(v),
+			Value:      GetVariableValue(v),
+			Expression: variableExpression(v),
+		}
+		if v.VariableValue != nil {
+			variable.DataType = v.VariableValue.DataTypeAttr
+		}
+		analysis.Variables = append(analysis.Variables, variable)
+	}
+
+	for _, cm := range p.GetConnections().Results.([]*schema.ConnectionManagerType) {
+		analysis.Connections = append(analysis.Connections, AnalysisConnection{
+			Name:             GetConnectionName(cm),
+			RefId:            derefString(cm.RefIdAttr),
+			Type:             derefString(cm.CreationNameAttr),
+			ConnectionString: GetConnectionString(cm),
+		})
+	}
+
+	for _, stmt := range NewPackageParser(p).GetSQLStatements() {
+		connections := stmt.Connections
+		if connections == nil {
+			connections = []string{}
+		}
+		analysis.SQLStatements = append(analysis.SQLStatements, AnalysisSQLStatement{
+			TaskName:         stmt.TaskName,
+			TaskType:         stmt.TaskType,
+			RefId:            stmt.RefId,
+			SQL:              stmt.SQL,
+			Connections:      connections,
+			SourceType:       stmt.SourceType,
+			Source:           stmt.Source,
+			Dialect:          stmt.Dialect,
+			ComponentClassID: stmt.ComponentClassID,
+		})
+	}
+
+	for _, expr := range p.GetExpressions().Results.([]*ExpressionInfo) {
+		analysis.Expressions = append(analysis.Expressions, AnalysisExpression{
+			Expression: expr.Expression,
+			Location:   expr.Location,
+			Name:       expr.Name,
+			Context:    expr.Context,
+		})
+	}
+
+	// Execution order is computed the same way as in ToYAML
+	analyzer := NewPrecedenceAnalyzer(p)
+	var orders map[string]int
+	if len(analyzer.ValidateConstraints()) == 0 {
+		orders, _ = analyzer.GetAllExecutionOrders()
+	}
+	for _, exec := range p.Executable {
+		refId := getRefId(exec)
+		dependsOn := analyzer.dependencies[refId]
+		if dependsOn == nil {
+			dependsOn = []string{}
+		}
+		analysis.Tasks = append(analysis.Tasks, AnalysisTask{
+			Name:      GetExecutableName(exec),
+			RefId:     refId,
+			Type:      exec.ExecutableTypeAttr,
+			Order:     orders[refId],
+			DependsOn: dependsOn,
+		})
+	}
+
+	return analysis, nil
+}
+
+// AnalyzeJSON returns the package analysis as an indented JSON document whose
+// shape is described by PackageAnalysis
+func (p *Package) AnalyzeJSON() ([]byte, error) {
+	analysis, err := p.Analyze()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(analysis, "", "  ")
+}
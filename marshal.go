@@ -0,0 +1,630 @@
+// marshal.go - Namespace-aware DTSX serialization
+//
+// The schema structs carry only local XML names, which decode from any
+// namespace but would encode without one. This file walks those structs with
+// reflection and writes each element and attribute with its proper namespace prefix, so
+// attribute values and text are escaped exactly once and never rewritten.
+
+package dtsx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// dtsNamespace is the namespace bound to the DTS prefix in every DTSX file
+const dtsNamespace = "www.microsoft.com/SqlServer/Dts"
+
+// dtsElements lists the element names that belong to the DTS namespace.
+// Anything else (pipeline XML, task ObjectData payloads) is written unprefixed.
+var dtsElements = map[string]bool{
+	"Executable": true, "Executables": true,
+	"Property": true, "PropertyExpression": true,
+	"ConnectionManagers": true, "ConnectionManager": true,
+	"Configurations": true, "Configuration": true,
+	"LogProviders": true, "LogProvider": true,
+	"LoggingOptions": true, "SelectedLogProviders": true, "SelectedLogProvider": true,
+	"Variables": true, "Variable": true, "VariableValue": true,
+	"PackageVariables": true, "PackageVariable": true, "PackageVariableValue": true,
+	"PackageParameters": true, "PackageParameter": true,
+	"PrecedenceConstraints": true, "PrecedenceConstraint": true,
+	"EventHandlers": true, "EventHandler": true,
+	"ForEachEnumerator": true, "ForEachVariableMappings": true, "ForEachVariableMapping": true,
+	"ObjectData": true, "DesignTimeProperties": true,
+	"FlatFileColumns": true, "FlatFileColumn": true,
+	"CacheColumns": true, "CacheColumn": true,
+	"Password": true,
+}
+
+// unprefixedAttrs lists the attributes SSIS writes without the DTS prefix even
+// though their element is in the DTS namespace
+var unprefixedAttrs = map[string]map[string]bool{
+	"Property": {"Sensitive": true, "Encrypted": true},
+	"Password": {"Sensitive": true, "Encrypted": true},
+}
+
+// taskNamespaces maps task prefixes whose namespace does not follow the
+// www.microsoft.com/sqlserver/dts/tasks/<lowercase prefix> convention
+var taskNamespaces = map[string]string{
+	"WSTask": "www.microsoft.com/sqlserver/dts/tasks/webservicetask",
+}
+
+// taskNamespace returns the namespace URI for a task element prefix
+func taskNamespace(prefix string) string {
+	if ns, ok := taskNamespaces[prefix]; ok {
+		return ns
+	}
+	return "www.microsoft.com/sqlserver/dts/tasks/" + strings.ToLower(prefix)
+}
+
+// xmlField describes one struct field as seen by the encoder
+type xmlField struct {
+	name               string   // local name, possibly with a task prefix
+	parent             []string // wrapper elements from an a>b path tag
+	attr               bool
+	chardata, innerxml bool
+	value              reflect.Value
+}
+
+// xmlAttr is a rendered attribute
+type xmlAttr struct {
+	name, value string
+}
+
+// MarshalOptions controls the layout of MarshalWithOptions output
+type MarshalOptions struct {
+	// Indent is written once per nesting level; empty means two spaces
+	Indent string
+	// Compact writes the document without line breaks or indentation
+	Compact bool
+}
+
+// dtsxEncoder writes schema structs as indented, namespace-prefixed XML
+type dtsxEncoder struct {
+	b    strings.Builder
+	opts MarshalOptions
+}
+
+// lineBreak starts a new line indented to depth, or returns "" in compact mode
+func (e *dtsxEncoder) lineBreak(depth int) string {
+	if e.opts.Compact {
+		return ""
+	}
+	indent := e.opts.Indent
+	if indent == "" {
+		indent = "  "
+	}
+	return "\n" + strings.Repeat(indent, depth)
+}
+
+// encodePackage renders pkg as a complete DTSX document
+func encodePackage(pkg *Package, opts MarshalOptions) ([]byte, error) {
+	e := &dtsxEncoder{opts: opts}
+	e.b.WriteString(xml.Header)
+	root := []xmlAttr{{name: "xmlns:DTS", value: dtsNamespace}}
+	if err := e.writeElement("Executable", root, reflect.ValueOf(pkg), true, 0); err != nil {
+		return nil, err
+	}
+	e.b.WriteString("\n")
+	return []byte(e.b.String()), nil
+}
+
+// writeElement writes v as the element name. inDTS reports whether the parent
+// element is in the DTS namespace; once outside it, children stay unprefixed.
+func (e *dtsxEncoder) writeElement(name string, extra []xmlAttr, v reflect.Value, inDTS bool, depth int) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	dts := false
+	qname := name
+	if prefix, _, ok := strings.Cut(name, ":"); ok {
+		extra = append(extra, xmlAttr{name: "xmlns:" + prefix, value: taskNamespace(prefix)})
+	} else if inDTS && dtsElements[name] {
+		dts = true
+		qname = "DTS:" + name
+	}
+
+	e.b.WriteString("<" + qname)
+	for _, a := range extra {
+		e.writeAttr(a)
+	}
+
+	if v.Kind() != reflect.Struct {
+		text, ok := scalarString(v)
+		if !ok {
+			return fmt.Errorf("cannot marshal %s of kind %s", name, v.Kind())
+		}
+		e.b.WriteString(">")
+		e.b.WriteString(escapeXML(text, false))
+		e.b.WriteString("</" + qname + ">")
+		return nil
+	}
+
+	var fields []xmlField
+	collectFields(v, &fields, nil)
+
+	var children []xmlField
+	var text, inner string
+	for _, f := range fields {
+		switch {
+		case f.attr:
+			s, ok := scalarString(f.value)
+			if !ok {
+				continue
+			}
+			attrName := f.name
+			if dts && !strings.Contains(attrName, ":") && !unprefixedAttrs[name][attrName] {
+				attrName = "DTS:" + attrName
+			}
+			e.writeAttr(xmlAttr{name: attrName, value: s})
+		case f.chardata:
+			text, _ = scalarString(f.value)
+		case f.innerxml:
+			inner, _ = scalarString(f.value)
+		default:
+			children = append(children, f)
+		}
+	}
+
+	// Raw inner XML captured on Unmarshal is authoritative over the typed
+	// children, which were decoded from it and would otherwise be duplicated.
+	// Mutators that change typed ObjectData must update InnerXML too (see
+	// the raw* helpers below), or clear it so the typed children are written.
+	if inner != "" {
+		e.b.WriteString(">" + inner + "</" + qname + ">")
+		return nil
+	}
+
+	if !hasContent(children) {
+		if text == "" {
+			e.b.WriteString(" />")
+			return nil
+		}
+		e.b.WriteString(">" + escapeXML(text, false) + "</" + qname + ">")
+		return nil
+	}
+
+	e.b.WriteString(">")
+	if text != "" {
+		e.b.WriteString(escapeXML(text, false))
+	}
+	if err := e.writeChildren(children, dts, depth+1); err != nil {
+		return err
+	}
+	e.b.WriteString(e.lineBreak(depth) + "</" + qname + ">")
+	return nil
+}
+
+// writeChildren writes child fields, grouping consecutive fields that share
+// an a>b wrapper under a single wrapper element
+func (e *dtsxEncoder) writeChildren(children []xmlField, inDTS bool, depth int) error {
+	for i := 0; i < len(children); {
+		f := children[i]
+		if len(f.parent) == 0 {
+			if err := e.writeField(f, inDTS, depth); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+
+		// Gather the run of fields under the same wrapper
+		j := i + 1
+		for j < len(children) && strings.Join(children[j].parent, ">") == strings.Join(f.parent, ">") {
+			j++
+		}
+		group := children[i:j]
+		i = j
+		if !hasContent(group) {
+			continue
+		}
+
+		wrapper := f.parent[0]
+		qname := wrapper
+		wrapperDTS := inDTS && dtsElements[wrapper]
+		if wrapperDTS {
+			qname = "DTS:" + wrapper
+		}
+		inner := make([]xmlField, len(group))
+		for k, g := range group {
+			g.parent = g.parent[1:]
+			inner[k] = g
+		}
+		e.b.WriteString(e.lineBreak(depth) + "<" + qname + ">")
+		if err := e.writeChildren(inner, wrapperDTS, depth+1); err != nil {
+			return err
+		}
+		e.b.WriteString(e.lineBreak(depth) + "</" + qname + ">")
+	}
+	return nil
+}
+
+// writeField writes a single child field, expanding slices into repeated elements
+func (e *dtsxEncoder) writeField(f xmlField, inDTS bool, depth int) error {
+	v := f.value
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		for i := 0; i < v.Len(); i++ {
+			if isEmptyValue(v.Index(i)) {
+				continue
+			}
+			e.b.WriteString(e.lineBreak(depth))
+			if err := e.writeElement(f.name, nil, v.Index(i), inDTS, depth); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if isEmptyValue(v) {
+		return nil
+	}
+	e.b.WriteString(e.lineBreak(depth))
+	return e.writeElement(f.name, nil, v, inDTS, depth)
+}
+
+// writeAttr writes a single escaped attribute
+func (e *dtsxEncoder) writeAttr(a xmlAttr) {
+	e.b.WriteString(" " + a.name + `="` + escapeXML(a.value, true) + `"`)
+}
+
+// collectFields flattens the encodable fields of a struct in declaration
+// order. Embedded structs and untagged attribute groups are inlined; as with
+// encoding/xml, a field on the outer struct shadows one of the same name in an
+// embedded struct.
+func collectFields(v reflect.Value, out *[]xmlField, taken map[string]bool) {
+	t := v.Type()
+	own := make(map[string]bool)
+	for k := range taken {
+		own[k] = true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("xml")
+		if tag == "" || tag == "-" || sf.Name == "XMLName" || sf.Anonymous {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if name != "" {
+			own[name] = true
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		fv := v.Field(i)
+		tag := sf.Tag.Get("xml")
+		if sf.Name == "XMLName" || tag == "-" || (!sf.IsExported() && !sf.Anonymous) {
+			continue
+		}
+
+		if tag == "" {
+			// Embedded structs and untagged attribute groups are inlined
+			inner := fv
+			for inner.Kind() == reflect.Ptr {
+				if inner.IsNil() {
+					break
+				}
+				inner = inner.Elem()
+			}
+			if sf.Anonymous || (fv.Kind() == reflect.Ptr && sf.Type.Elem().Kind() == reflect.Struct) {
+				if inner.Kind() == reflect.Struct {
+					collectFields(inner, out, own)
+				}
+				continue
+			}
+			if taken[sf.Name] {
+				continue
+			}
+			*out = append(*out, xmlField{name: sf.Name, value: fv})
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name != "" && taken[name] {
+			continue
+		}
+		f := xmlField{name: name, value: fv}
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "attr":
+				f.attr = true
+			case "chardata":
+				f.chardata = true
+			case "innerxml":
+				f.innerxml = true
+			}
+		}
+		if path := strings.Split(name, ">"); len(path) > 1 {
+			f.name = path[len(path)-1]
+			f.parent = path[:len(path)-1]
+		}
+		*out = append(*out, f)
+	}
+}
+
+// hasContent reports whether any field in the group would produce output
+func hasContent(fields []xmlField) bool {
+	for _, f := range fields {
+		if f.value.Kind() == reflect.Slice {
+			if f.value.Len() > 0 {
+				return true
+			}
+			continue
+		}
+		if !isEmptyValue(f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// isEmptyValue reports whether v is a nil pointer or a zero scalar
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.Struct:
+		return false
+	}
+	return v.IsZero()
+}
+
+// scalarString renders a scalar field value; nil pointers and zero values of
+// non-pointer fields report false so they are omitted
+func scalarString(v reflect.Value) (string, bool) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", false
+		}
+		v = v.Elem()
+	} else if v.IsZero() {
+		return "", false
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), true
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), true
+	}
+	return "", false
+}
+
+// escapeXML escapes s for use in element text or, when attr is set, in a
+// double-quoted attribute where whitespace characters must be preserved as
+// character references
+func escapeXML(s string, attr bool) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '"':
+			if attr {
+				b.WriteString("&quot;")
+			} else {
+				b.WriteRune(r)
+			}
+		case '\r':
+			b.WriteString("&#xD;")
+		case '\n':
+			if attr {
+				b.WriteString("&#xA;")
+			} else {
+				b.WriteRune(r)
+			}
+		case '\t':
+			if attr {
+				b.WriteString("&#x9;")
+			} else {
+				b.WriteRune(r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// rawElement locates one element inside raw inner XML. Offsets are byte
+// positions in the scanned string; a self-closing element has an empty
+// content range ending where the element ends.
+type rawElement struct {
+	name                xml.Name // Space holds the prefix as written
+	attrs               []xml.Attr
+	start, contentStart int
+	contentEnd, end     int
+	parent              int // index of the enclosing element, or -1
+}
+
+// scanRawElements lists the elements in raw in document order. Scanning stops
+// at the first malformed token, so a damaged fragment yields what precedes it.
+func scanRawElements(raw string) []rawElement {
+	var elems []rawElement
+	var open []int
+	dec := xml.NewDecoder(strings.NewReader(raw))
+	for {
+		offset := int(dec.InputOffset())
+		tok, err := dec.RawToken()
+		if err != nil {
+			return elems
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			parent := -1
+			if len(open) > 0 {
+				parent = open[len(open)-1]
+			}
+			elems = append(elems, rawElement{
+				name:         t.Name,
+				attrs:        t.Copy().Attr,
+				start:        offset,
+				contentStart: int(dec.InputOffset()),
+				parent:       parent,
+			})
+			open = append(open, len(elems)-1)
+		case xml.EndElement:
+			if len(open) == 0 {
+				return elems
+			}
+			i := open[len(open)-1]
+			open = open[:len(open)-1]
+			elems[i].contentEnd = offset
+			elems[i].end = int(dec.InputOffset())
+		}
+	}
+}
+
+// attr returns the value of the attribute with the given local name,
+// whatever its prefix
+func (el rawElement) attr(local string) (string, bool) {
+	for _, a := range el.attrs {
+		if a.Name.Local == local {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// text returns the unescaped character data directly inside the element
+func (el rawElement) text(raw string) string {
+	var b strings.Builder
+	dec := xml.NewDecoder(strings.NewReader(raw[el.contentStart:el.contentEnd]))
+	depth := 0
+	for {
+		tok, err := dec.RawToken()
+		if err != nil {
+			return b.String()
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+		case xml.EndElement:
+			depth--
+		case xml.CharData:
+			if depth == 0 {
+				b.Write(t)
+			}
+		}
+	}
+}
+
+// rawEdit replaces raw[start:end] with text
+type rawEdit struct {
+	start, end int
+	text       string
+}
+
+// applyRawEdits applies non-overlapping edits to raw
+func applyRawEdits(raw string, edits []rawEdit) string {
+	if len(edits) == 0 {
+		return raw
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var b strings.Builder
+	last := 0
+	for _, ed := range edits {
+		b.WriteString(raw[last:ed.start])
+		b.WriteString(ed.text)
+		last = ed.end
+	}
+	b.WriteString(raw[last:])
+	return b.String()
+}
+
+// rawAttrEdit returns the edit that sets the attribute a of el to value
+func rawAttrEdit(raw string, el rawElement, a xml.Name, value string) (rawEdit, bool) {
+	qname := a.Local
+	if a.Space != "" {
+		qname = a.Space + ":" + a.Local
+	}
+	re := regexp.MustCompile(`\s` + regexp.QuoteMeta(qname) + `\s*=\s*("[^"]*"|'[^']*')`)
+	loc := re.FindStringSubmatchIndex(raw[el.start:el.contentStart])
+	if loc == nil {
+		return rawEdit{}, false
+	}
+	return rawEdit{start: el.start + loc[2], end: el.start + loc[3], text: `"` + escapeXML(value, true) + `"`}, true
+}
+
+// rawTextEdit returns the edit that replaces the content of el with text,
+// opening a self-closing element
+func rawTextEdit(raw string, el rawElement, text string) rawEdit {
+	if el.contentStart == el.end {
+		tag := strings.TrimRight(strings.TrimSuffix(raw[el.start:el.end], "/>"), " \t\r\n")
+		qname := el.name.Local
+		if el.name.Space != "" {
+			qname = el.name.Space + ":" + el.name.Local
+		}
+		return rawEdit{start: el.start, end: el.end, text: tag + ">" + escapeXML(text, false) + "</" + qname + ">"}
+	}
+	return rawEdit{start: el.contentStart, end: el.contentEnd, text: escapeXML(text, false)}
+}
+
+// rewriteRawAttributes passes each attribute of the elements accepted by
+// match to fn and writes back the values it changes. It returns the
+// rewritten XML and the number of elements changed.
+func rewriteRawAttributes(raw string, match func(el rawElement) bool, fn func(name, value string) (string, bool)) (string, int) {
+	var edits []rawEdit
+	changed := 0
+	for _, el := range scanRawElements(raw) {
+		if !match(el) {
+			continue
+		}
+		before := len(edits)
+		for _, a := range el.attrs {
+			value, ok := fn(a.Name.Local, a.Value)
+			if !ok || value == a.Value {
+				continue
+			}
+			if ed, ok := rawAttrEdit(raw, el, a.Name, value); ok {
+				edits = append(edits, ed)
+			}
+		}
+		if len(edits) > before {
+			changed++
+		}
+	}
+	return applyRawEdits(raw, edits), changed
+}
+
+// removeRawElements deletes the elements accepted by match, with the
+// whitespace before them, and returns the new XML and the number removed.
+// Elements inside one already removed are not counted again.
+func removeRawElements(raw string, match func(el rawElement) bool) (string, int) {
+	var edits []rawEdit
+	removedEnd := -1
+	for _, el := range scanRawElements(raw) {
+		if el.start < removedEnd || !match(el) {
+			continue
+		}
+		start := el.start
+		for start > 0 && strings.ContainsRune(" \t\r\n", rune(raw[start-1])) {
+			start--
+		}
+		if len(edits) > 0 && start < edits[len(edits)-1].end {
+			start = edits[len(edits)-1].end
+		}
+		edits = append(edits, rawEdit{start: start, end: el.end})
+		removedEnd = el.end
+	}
+	return applyRawEdits(raw, edits), len(edits)
+}
@@ -11,44 +11,56 @@ type Executable *ExecutableTypePackage
 
 // Property ...
 type Property struct {
-	NameAttr *string `xml:"Name,attr"`
+	NameAttr      *string `xml:"Name,attr"`
+	SensitiveAttr *string `xml:"Sensitive,attr"`
+	EncryptedAttr *string `xml:"Encrypted,attr"`
 	*PropertyElementBaseType
 }
 
 // ExecutableTypePackage ...
 type ExecutableTypePackage struct {
-	ExecutableTypeAttr   *string                          `xml:"ExecutableType,attr"`
-	Property             []*Property                      `xml:"Property"`
-	ConnectionManagers   *ConnectionManagersType          `xml:"ConnectionManagers"`
-	Configuration        []*ConfigurationType             `xml:"Configuration"`
-	LogProvider          []*LogProviderType               `xml:"LogProvider"`
-	Variables            *VariablesType                   `xml:"Variables"`
-	LoggingOptions       *LoggingOptionsType              `xml:"LoggingOptions"`
-	PropertyExpression   []*PropertyExpressionElementType `xml:"PropertyExpression"`
-	Executable           []*AnyNonPackageExecutableType   `xml:"Executables>Executable"`
-	PrecedenceConstraint []*PrecedenceConstraintType      `xml:"PrecedenceConstraint"`
-	EventHandler         []*EventHandlerType              `xml:"EventHandler"`
-	PackageVariable      []*PackageVariableType           `xml:"PackageVariable"`
+	ExecutableTypeAttr    *string                          `xml:"ExecutableType,attr"`
+	Property              []*Property                      `xml:"Property"`
+	ConnectionManagers    *ConnectionManagersType          `xml:"ConnectionManagers"`
+	Configuration         []*ConfigurationType             `xml:"Configuration"`
+	LogProvider           []*LogProviderType               `xml:"LogProvider"`
+	LogProviders          []*LogProviderType               `xml:"LogProviders>LogProvider"`
+	Variables             *VariablesType                   `xml:"Variables"`
+	LoggingOptions        *LoggingOptionsType              `xml:"LoggingOptions"`
+	PropertyExpression    []*PropertyExpressionElementType `xml:"PropertyExpression"`
+	Executable            []*AnyNonPackageExecutableType   `xml:"Executables>Executable"`
+	PrecedenceConstraint  []*PrecedenceConstraintType      `xml:"PrecedenceConstraint"`
+	PrecedenceConstraints []*PrecedenceConstraintType      `xml:"PrecedenceConstraints>PrecedenceConstraint"`
+	EventHandler          []*EventHandlerType              `xml:"EventHandler"`
+	EventHandlers         []*EventHandlerType              `xml:"EventHandlers>EventHandler"`
+	PackageVariable       []*PackageVariableType           `xml:"PackageVariable"`
 }
 
 // AnyNonPackageExecutableType ...
 type AnyNonPackageExecutableType struct {
-	RefIdAttr              *string                          `xml:"refId,attr"`
-	ExecutableTypeAttr     string                           `xml:"ExecutableType,attr"`
-	ObjectNameAttr         *string                          `xml:"ObjectName,attr"`
-	CreationNameAttr       *string                          `xml:"CreationName,attr"`
-	DTSIDAttr              *string                          `xml:"DTSID,attr"`
-	ThreadHintAttr         *int                             `xml:"ThreadHint,attr"`
-	ForEachEnumerator      *ForEachEnumeratorType           `xml:"ForEachEnumerator"`
-	Property               []*Property                      `xml:"Property"`
-	Variable               []*VariableType                  `xml:"Variable"`
-	LoggingOptions         *LoggingOptionsType              `xml:"LoggingOptions"`
-	PropertyExpression     []*PropertyExpressionElementType `xml:"PropertyExpression"`
-	Executable             []*AnyNonPackageExecutableType   `xml:"Executable"`
-	PrecedenceConstraint   []*PrecedenceConstraintType      `xml:"PrecedenceConstraint"`
-	ForEachVariableMapping []*ForEachVariableMappingType    `xml:"ForEachVariableMapping"`
-	EventHandler           []*EventHandlerType              `xml:"EventHandler"`
-	ObjectData             *ExecutableObjectDataType        `xml:"ObjectData"`
+	RefIdAttr               *string                          `xml:"refId,attr"`
+	ExecutableTypeAttr      string                           `xml:"ExecutableType,attr"`
+	ObjectNameAttr          *string                          `xml:"ObjectName,attr"`
+	CreationNameAttr        *string                          `xml:"CreationName,attr"`
+	DTSIDAttr               *string                          `xml:"DTSID,attr"`
+	ThreadHintAttr          *int                             `xml:"ThreadHint,attr"`
+	InitExpressionAttr      *string                          `xml:"InitExpression,attr"`
+	EvalExpressionAttr      *string                          `xml:"EvalExpression,attr"`
+	AssignExpressionAttr    *string                          `xml:"AssignExpression,attr"`
+	ForEachEnumerator       *ForEachEnumeratorType           `xml:"ForEachEnumerator"`
+	Property                []*Property                      `xml:"Property"`
+	Variable                []*VariableType                  `xml:"Variable"`
+	LoggingOptions          *LoggingOptionsType              `xml:"LoggingOptions"`
+	PropertyExpression      []*PropertyExpressionElementType `xml:"PropertyExpression"`
+	Executable              []*AnyNonPackageExecutableType   `xml:"Executable"`
+	Executables             []*AnyNonPackageExecutableType   `xml:"Executables>Executable"`
+	PrecedenceConstraint    []*PrecedenceConstraintType      `xml:"PrecedenceConstraint"`
+	PrecedenceConstraints   []*PrecedenceConstraintType      `xml:"PrecedenceConstraints>PrecedenceConstraint"`
+	ForEachVariableMapping  []*ForEachVariableMappingType    `xml:"ForEachVariableMapping"`
+	ForEachVariableMappings []*ForEachVariableMappingType    `xml:"ForEachVariableMappings>ForEachVariableMapping"`
+	EventHandler            []*EventHandlerType              `xml:"EventHandler"`
+	EventHandlers           []*EventHandlerType              `xml:"EventHandlers>EventHandler"`
+	ObjectData              *ExecutableObjectDataType        `xml:"ObjectData"`
 }
 
 // PackageVariableType ...
@@ -65,6 +77,11 @@ type ConfigurationType struct {
 
 // LogProviderType ...
 type LogProviderType struct {
+	ConfigStringAttr   *string                          `xml:"ConfigString,attr"`
+	CreationNameAttr   *string                          `xml:"CreationName,attr"`
+	DescriptionAttr    *string                          `xml:"Description,attr"`
+	DTSIDAttr          *string                          `xml:"DTSID,attr"`
+	ObjectNameAttr     *string                          `xml:"ObjectName,attr"`
 	Property           []*Property                      `xml:"Property"`
 	PropertyExpression []*PropertyExpressionElementType `xml:"PropertyExpression"`
 	ObjectData         *LogProviderObjectDataType       `xml:"ObjectData"`
@@ -88,6 +105,16 @@ type ConnectionManagerType struct {
 
 // PrecedenceConstraintType ...
 type PrecedenceConstraintType struct {
+	RefIdAttr          *string                                        `xml:"refId,attr"`
+	CreationNameAttr   *string                                        `xml:"CreationName,attr"`
+	DTSIDAttr          *string                                        `xml:"DTSID,attr"`
+	EvalOpAttr         *string                                        `xml:"EvalOp,attr"`
+	ExpressionAttr     *string                                        `xml:"Expression,attr"`
+	FromAttr           *string                                        `xml:"From,attr"`
+	LogicalAndAttr     *string                                        `xml:"LogicalAnd,attr"`
+	ObjectNameAttr     *string                                        `xml:"ObjectName,attr"`
+	ToAttr             *string                                        `xml:"To,attr"`
+	ValueAttr          *string                                        `xml:"Value,attr"`
 	Property           []*Property                                    `xml:"Property"`
 	PropertyExpression []*PropertyExpressionElementType               `xml:"PropertyExpression"`
 	Executable         []*PrecedenceConstraintExecutableReferenceType `xml:"Executable"`
@@ -133,25 +160,39 @@ type VariablesType struct {
 
 // VariableType ...
 type VariableType struct {
-	NamespaceAttr      *string                          `xml:"Namespace,attr"`
-	ObjectNameAttr     *string                          `xml:"ObjectName,attr"`
-	Property           []*Property                      `xml:"Property"`
-	PropertyExpression []*PropertyExpressionElementType `xml:"PropertyExpression"`
-	VariableValue      *VariableValue                   `xml:"VariableValue"`
+	EvaluateAsExpressionAttr *string                          `xml:"EvaluateAsExpression,attr"`
+	ExpressionAttr           *string                          `xml:"Expression,attr"`
+	NamespaceAttr            *string                          `xml:"Namespace,attr"`
+	ObjectNameAttr           *string                          `xml:"ObjectName,attr"`
+	Property                 []*Property                      `xml:"Property"`
+	PropertyExpression       []*PropertyExpressionElementType `xml:"PropertyExpression"`
+	VariableValue            *VariableValue                   `xml:"VariableValue"`
 }
 
 // EventHandlerType ...
 type EventHandlerType struct {
-	Property             []*Property                      `xml:"Property"`
-	PropertyExpression   []*PropertyExpressionElementType `xml:"PropertyExpression"`
-	Variable             []*VariableType                  `xml:"Variable"`
-	LoggingOptions       *LoggingOptionsType              `xml:"LoggingOptions"`
-	Executable           []*AnyNonPackageExecutableType   `xml:"Executable"`
-	PrecedenceConstraint []*PrecedenceConstraintType      `xml:"PrecedenceConstraint"`
+	RefIdAttr             *string                          `xml:"refId,attr"`
+	CreationNameAttr      *string                          `xml:"CreationName,attr"`
+	DTSIDAttr             *string                          `xml:"DTSID,attr"`
+	EventIDAttr           *string                          `xml:"EventID,attr"`
+	EventNameAttr         *string                          `xml:"EventName,attr"`
+	LocaleIDAttr          *string                          `xml:"LocaleID,attr"`
+	Property              []*Property                      `xml:"Property"`
+	PropertyExpression    []*PropertyExpressionElementType `xml:"PropertyExpression"`
+	Variable              []*VariableType                  `xml:"Variable"`
+	Variables             *VariablesType                   `xml:"Variables"`
+	LoggingOptions        *LoggingOptionsType              `xml:"LoggingOptions"`
+	Executable            []*AnyNonPackageExecutableType   `xml:"Executable"`
+	Executables           []*AnyNonPackageExecutableType   `xml:"Executables>Executable"`
+	PrecedenceConstraint  []*PrecedenceConstraintType      `xml:"PrecedenceConstraint"`
+	PrecedenceConstraints []*PrecedenceConstraintType      `xml:"PrecedenceConstraints>PrecedenceConstraint"`
 }
 
 // ForEachEnumeratorType ...
 type ForEachEnumeratorType struct {
+	CreationNameAttr   *string                          `xml:"CreationName,attr"`
+	DTSIDAttr          *string                          `xml:"DTSID,attr"`
+	ObjectNameAttr     *string                          `xml:"ObjectName,attr"`
 	Property           []*Property                      `xml:"Property"`
 	PropertyExpression []*PropertyExpressionElementType `xml:"PropertyExpression"`
 	ObjectData         *ForEachEnumeratorObjectDataType `xml:"ObjectData"`
@@ -159,6 +200,11 @@ type ForEachEnumeratorType struct {
 
 // ForEachVariableMappingType ...
 type ForEachVariableMappingType struct {
+	CreationNameAttr   *string                          `xml:"CreationName,attr"`
+	DTSIDAttr          *string                          `xml:"DTSID,attr"`
+	ObjectNameAttr     *string                          `xml:"ObjectName,attr"`
+	ValueIndexAttr     *int                             `xml:"ValueIndex,attr"`
+	VariableNameAttr   *string                          `xml:"VariableName,attr"`
 	Property           []*Property                      `xml:"Property"`
 	PropertyExpression []*PropertyExpressionElementType `xml:"PropertyExpression"`
 }
@@ -927,10 +973,10 @@ type FEIEItemValueType struct {
 
 // FEFEProperty ...
 type FEFEProperty struct {
-	FolderAttr                *interface{} `xml:"Folder,attr"`
-	FileSpecAttr              *interface{} `xml:"FileSpec,attr"`
-	FileNameRetrievalTypeAttr *int         `xml:"FileNameRetrievalType,attr"`
-	RecurseAttr               *int         `xml:"Recurse,attr"`
+	FolderAttr                *string `xml:"Folder,attr"`
+	FileSpecAttr              *string `xml:"FileSpec,attr"`
+	FileNameRetrievalTypeAttr *int    `xml:"FileNameRetrievalType,attr"`
+	RecurseAttr               *int    `xml:"Recurse,attr"`
 }
 
 // ForEachFileEnumeratorPropertiesType ...
@@ -999,19 +1045,43 @@ type ConnectionManagerObjectDataType struct {
 
 // ConnectionManagerObjectDataConnectionManagerType ...
 type ConnectionManagerObjectDataConnectionManagerType struct {
-	ConnectRetryCountAttr    *string               `xml:"ConnectRetryCount,attr"`
-	ConnectRetryIntervalAttr *string               `xml:"ConnectRetryInterval,attr"`
-	ConnectionStringAttr     *string               `xml:"ConnectionString,attr"`
-	Property                 []*Property           `xml:"Property"`
-	FlatFileColumn           []*FlatFileColumnType `xml:"FlatFileColumn"`
-	CacheColumn              []*CacheColumnType    `xml:"CacheColumn"`
-	FtpConnection            *FtpConnectionType    `xml:"FtpConnection"`
-	HttpConnection           *HttpConnectionType   `xml:"HttpConnection"`
+	ConnectRetryCountAttr         *string               `xml:"ConnectRetryCount,attr"`
+	ConnectRetryIntervalAttr      *string               `xml:"ConnectRetryInterval,attr"`
+	RetainAttr                    *string               `xml:"Retain,attr"`
+	FormatAttr                    *string               `xml:"Format,attr"`
+	LocaleIDAttr                  *string               `xml:"LocaleID,attr"`
+	UnicodeAttr                   *string               `xml:"Unicode,attr"`
+	HeaderRowsToSkipAttr          *string               `xml:"HeaderRowsToSkip,attr"`
+	HeaderRowDelimiterAttr        *string               `xml:"HeaderRowDelimiter,attr"`
+	ColumnNamesInFirstDataRowAttr *string               `xml:"ColumnNamesInFirstDataRow,attr"`
+	RowDelimiterAttr              *string               `xml:"RowDelimiter,attr"`
+	DataRowsToSkipAttr            *string               `xml:"DataRowsToSkip,attr"`
+	TextQualifierAttr             *string               `xml:"TextQualifier,attr"`
+	CodePageAttr                  *string               `xml:"CodePage,attr"`
+	ConnectionStringAttr          *string               `xml:"ConnectionString,attr"`
+	Property                      []*Property           `xml:"Property"`
+	Password                      *PasswordElementType  `xml:"Password"`
+	FlatFileColumn                []*FlatFileColumnType `xml:"FlatFileColumn"`
+	FlatFileColumns               []*FlatFileColumnType `xml:"FlatFileColumns>FlatFileColumn"`
+	CacheColumn                   []*CacheColumnType    `xml:"CacheColumn"`
+	FtpConnection                 *FtpConnectionType    `xml:"FtpConnection"`
+	HttpConnection                *HttpConnectionType   `xml:"HttpConnection"`
 }
 
 // FlatFileColumnType ...
 type FlatFileColumnType struct {
-	Property []*Property `xml:"Property"`
+	ColumnTypeAttr      *string     `xml:"ColumnType,attr"`
+	ColumnDelimiterAttr *string     `xml:"ColumnDelimiter,attr"`
+	ColumnWidthAttr     *string     `xml:"ColumnWidth,attr"`
+	MaximumWidthAttr    *string     `xml:"MaximumWidth,attr"`
+	DataTypeAttr        *string     `xml:"DataType,attr"`
+	DataPrecisionAttr   *string     `xml:"DataPrecision,attr"`
+	DataScaleAttr       *string     `xml:"DataScale,attr"`
+	TextQualifiedAttr   *string     `xml:"TextQualified,attr"`
+	ObjectNameAttr      *string     `xml:"ObjectName,attr"`
+	DTSIDAttr           *string     `xml:"DTSID,attr"`
+	CreationNameAttr    *string     `xml:"CreationName,attr"`
+	Property            []*Property `xml:"Property"`
 }
 
 // CacheColumnType ...
@@ -1042,9 +1112,10 @@ type ConnectionManagerObjectDataSMOServerConnectionManagerType struct {
 
 // PasswordElementType ...
 type PasswordElementType struct {
-	SensitiveAttr *int   `xml:"Sensitive,attr"`
-	EncryptedAttr *int   `xml:"Encrypted,attr"`
-	Value         string `xml:",chardata"`
+	NameAttr      *string `xml:"Name,attr"`
+	SensitiveAttr *int    `xml:"Sensitive,attr"`
+	EncryptedAttr *int    `xml:"Encrypted,attr"`
+	Value         string  `xml:",chardata"`
 }
 
 // ConnectionManagerObjectDataSmtpConnectionManagerType ...
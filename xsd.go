@@ -0,0 +1,952 @@
+// xsd.go - Validation against the bundled DTSX schema
+//
+// The XSD files in source_xsd_files are embedded and interpreted by a small
+// validator that understands the constructs the DTSX schema uses: element and
+// attribute declarations, sequences and choices, type extension, attribute
+// groups, wildcards and simple type facets (enumerations, numeric ranges,
+// patterns and unions). Element order and maxOccurs are not checked.
+//
+// The schema describes the SQL Server 2005/2008 package format only. Packages
+// in the 2012+ format, which covers every package SSIS has written since and
+// the output of Marshal, are reported with a single warning instead of being
+// validated against it.
+
+package dtsx
+
+import (
+	"bytes"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed source_xsd_files/*.xsd
+var xsdFiles embed.FS
+
+const (
+	xsdNamespace      = "http://www.w3.org/2001/XMLSchema"
+	xsiNamespace      = "http://www.w3.org/2001/XMLSchema-instance"
+	xmlNamespace      = "http://www.w3.org/XML/1998/namespace"
+	dtsxSchemaFile    = "source_xsd_files/DTSX.xsd"
+	maxListedEnumSize = 6
+)
+
+var (
+	dtsxSchemaOnce sync.Once
+	dtsxSchemaSet  *xsdSchemaSet
+	dtsxSchemaErr  error
+)
+
+// ValidateAgainstSchema checks the XML in data against the DTSX schema bundled
+// with the library. Each result carries the line of the offending element in
+// Path, e.g. "line 12". Unknown elements and attributes, missing required
+// elements and attributes, and attribute values outside their declared type
+// are reported as errors. A nil result means the document is valid.
+//
+// The bundled schema covers the pre-2012 package format, so a 2012+ package
+// yields a single warning and is not checked further. The format is told
+// apart by its structure (see isPackage2012), so packages written by Marshal
+// are skipped too, even without a root DTS:refId. Element order and
+// maxOccurs are not checked.
+func ValidateAgainstSchema(data []byte) []ValidationError {
+	dtsxSchemaOnce.Do(func() {
+		dtsxSchemaSet, dtsxSchemaErr = loadXSDSchemaSet(dtsxSchemaFile)
+	})
+	if dtsxSchemaErr != nil {
+		return []ValidationError{{
+			Severity: "error",
+			Message:  fmt.Sprintf("bundled schema could not be loaded: %v", dtsxSchemaErr),
+		}}
+	}
+
+	v := &xsdValidator{set: dtsxSchemaSet, data: data, line: 1, format2012: isPackage2012(data)}
+	v.validate()
+	return v.results
+}
+
+// xsdQName is a namespace-qualified XML name
+type xsdQName struct {
+	space, local string
+}
+
+// xsdTypeRef refers to a simple type by name (built-in or declared) or holds
+// an anonymous one
+type xsdTypeRef struct {
+	name   xsdQName
+	inline *xsdSimpleType
+}
+
+// xsdSimpleType is a restriction, union or list simple type
+type xsdSimpleType struct {
+	base     xsdTypeRef
+	enums    []string
+	min, max *float64
+	patterns []*regexp.Regexp
+	union    bool
+	members  []xsdTypeRef
+	list     bool
+}
+
+// xsdAttribute is an attribute declaration
+type xsdAttribute struct {
+	name     xsdQName
+	required bool
+	fixed    *string
+	typ      xsdTypeRef
+}
+
+// xsdAttributeSet holds the attribute declarations of a complex type or a
+// named attribute group
+type xsdAttributeSet struct {
+	attributes   []*xsdAttribute
+	groups       []xsdQName
+	anyAttribute bool
+}
+
+// xsdElement is an element declaration or element reference
+type xsdElement struct {
+	name     xsdQName
+	ref      xsdQName
+	required bool
+	complex  *xsdComplexType
+	typ      xsdTypeRef
+}
+
+// xsdComplexType is a complex type declaration. The fields after resolved
+// combine the type's own declarations with those inherited from its base
+// types and attribute groups.
+type xsdComplexType struct {
+	xsdAttributeSet
+	base          xsdQName
+	elements      []*xsdElement
+	anyElement    bool
+	simpleContent bool
+
+	resolved  bool
+	children  map[xsdQName]*xsdElement
+	required  []*xsdElement
+	attrs     map[xsdQName]*xsdAttribute
+	attrOrder []*xsdAttribute
+	textType  xsdTypeRef
+}
+
+// xsdSchemaSet is a set of loaded schema documents
+type xsdSchemaSet struct {
+	elements     map[xsdQName]*xsdElement
+	complexTypes map[xsdQName]*xsdComplexType
+	simpleTypes  map[xsdQName]*xsdSimpleType
+	attrGroups   map[xsdQName]*xsdAttributeSet
+	prefixes     map[string]string // namespace URI to prefix, for messages
+	allComplex   []*xsdComplexType
+	loaded       map[string]bool
+}
+
+// loadXSDSchemaSet loads an embedded schema file and the files it imports
+func loadXSDSchemaSet(name string) (*xsdSchemaSet, error) {
+	set := &xsdSchemaSet{
+		elements:     make(map[xsdQName]*xsdElement),
+		complexTypes: make(map[xsdQName]*xsdComplexType),
+		simpleTypes:  make(map[xsdQName]*xsdSimpleType),
+		attrGroups:   make(map[xsdQName]*xsdAttributeSet),
+		prefixes:     make(map[string]string),
+		loaded:       make(map[string]bool),
+	}
+	if err := set.loadFile(name); err != nil {
+		return nil, err
+	}
+	for _, ct := range set.allComplex {
+		set.resolve(ct)
+	}
+	return set, nil
+}
+
+// xsdNode is an element of a schema document, keeping only XSD elements
+type xsdNode struct {
+	kind     string
+	attrs    map[string]string
+	children []*xsdNode
+}
+
+// parseXSDTree reads a schema document into a node tree and returns the
+// namespace prefixes declared on its root element
+func parseXSDTree(data []byte) (*xsdNode, map[string]string, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var root *xsdNode
+	var stack []*xsdNode
+	prefixes := make(map[string]string)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &xsdNode{kind: t.Name.Local, attrs: make(map[string]string)}
+			if t.Name.Space != xsdNamespace {
+				node.kind = ""
+			}
+			for _, a := range t.Attr {
+				switch {
+				case a.Name.Space == "xmlns":
+					if root == nil {
+						prefixes[a.Name.Local] = a.Value
+					}
+				case a.Name.Space == "" && a.Name.Local == "xmlns":
+					if root == nil {
+						prefixes[""] = a.Value
+					}
+				case a.Name.Space == "":
+					node.attrs[a.Name.Local] = strings.TrimSpace(a.Value)
+				}
+			}
+			if root == nil {
+				root = node
+			} else {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			}
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if root == nil || root.kind != "schema" {
+		return nil, nil, fmt.Errorf("not an XML schema document")
+	}
+	return root, prefixes, nil
+}
+
+// loadFile adds the declarations of one schema document to the set
+func (s *xsdSchemaSet) loadFile(name string) error {
+	if s.loaded[name] {
+		return nil
+	}
+	s.loaded[name] = true
+
+	data, err := xsdFiles.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	root, prefixes, err := parseXSDTree(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path.Base(name), err)
+	}
+	for prefix, uri := range prefixes {
+		if _, ok := s.prefixes[uri]; !ok && prefix != "" {
+			s.prefixes[uri] = prefix
+		}
+	}
+
+	l := &xsdLoader{
+		set:                 s,
+		target:              root.attrs["targetNamespace"],
+		prefixes:            prefixes,
+		elementsQualified:   root.attrs["elementFormDefault"] == "qualified",
+		attributesQualified: root.attrs["attributeFormDefault"] == "qualified",
+	}
+	for _, n := range root.children {
+		switch n.kind {
+		case "import", "include":
+			if loc := n.attrs["schemaLocation"]; loc != "" {
+				if err := s.loadFile(path.Join(path.Dir(name), loc)); err != nil {
+					return err
+				}
+			}
+		case "element":
+			e := l.element(n, true)
+			s.elements[e.name] = e
+		case "complexType":
+			s.complexTypes[l.globalName(n)] = l.complexType(n)
+		case "simpleType":
+			s.simpleTypes[l.globalName(n)] = l.simpleType(n)
+		case "attributeGroup":
+			group := &xsdAttributeSet{}
+			for _, c := range n.children {
+				l.attributeDecl(group, c)
+			}
+			s.attrGroups[l.globalName(n)] = group
+		}
+	}
+	return nil
+}
+
+// resolve fills in the inherited content of a complex type
+func (s *xsdSchemaSet) resolve(ct *xsdComplexType) {
+	if ct.resolved {
+		return
+	}
+	ct.resolved = true
+	ct.children = make(map[xsdQName]*xsdElement)
+	ct.attrs = make(map[xsdQName]*xsdAttribute)
+
+	if ct.base != (xsdQName{}) {
+		if base := s.complexTypes[ct.base]; base != nil {
+			s.resolve(base)
+			for name, e := range base.children {
+				ct.children[name] = e
+			}
+			ct.required = append(ct.required, base.required...)
+			for _, a := range base.attrOrder {
+				ct.addAttribute(a)
+			}
+			ct.anyElement = ct.anyElement || base.anyElement
+			ct.anyAttribute = ct.anyAttribute || base.anyAttribute
+			ct.simpleContent = ct.simpleContent || base.simpleContent
+			ct.textType = base.textType
+		} else if ct.simpleContent {
+			ct.textType = xsdTypeRef{name: ct.base}
+		}
+	}
+
+	for _, e := range ct.elements {
+		if _, seen := ct.children[e.name]; !seen && e.required {
+			ct.required = append(ct.required, e)
+		}
+		ct.children[e.name] = e
+	}
+	s.collectAttributes(ct, &ct.xsdAttributeSet, make(map[xsdQName]bool))
+}
+
+// collectAttributes adds the attributes of set and its groups to ct
+func (s *xsdSchemaSet) collectAttributes(ct *xsdComplexType, set *xsdAttributeSet, visited map[xsdQName]bool) {
+	for _, a := range set.attributes {
+		ct.addAttribute(a)
+	}
+	if set.anyAttribute {
+		ct.anyAttribute = true
+	}
+	for _, name := range set.groups {
+		if visited[name] {
+			continue
+		}
+		visited[name] = true
+		if group := s.attrGroups[name]; group != nil {
+			s.collectAttributes(ct, group, visited)
+		}
+	}
+}
+
+// addAttribute records a resolved attribute, replacing an earlier declaration
+// of the same name
+func (ct *xsdComplexType) addAttribute(a *xsdAttribute) {
+	if _, ok := ct.attrs[a.name]; !ok {
+		ct.attrOrder = append(ct.attrOrder, a)
+	} else {
+		for i, existing := range ct.attrOrder {
+			if existing.name == a.name {
+				ct.attrOrder[i] = a
+			}
+		}
+	}
+	ct.attrs[a.name] = a
+}
+
+// elementType returns the complex type or simple content type of a declared
+// element, following element references. Both are empty for elements of
+// xs:anyType, whose content is not checked.
+func (s *xsdSchemaSet) elementType(e *xsdElement) (*xsdComplexType, xsdTypeRef) {
+	if e.ref != (xsdQName{}) {
+		global := s.elements[e.ref]
+		if global == nil {
+			return nil, xsdTypeRef{}
+		}
+		e = global
+	}
+	if e.complex != nil {
+		return e.complex, xsdTypeRef{}
+	}
+	if ct := s.complexTypes[e.typ.name]; ct != nil {
+		return ct, xsdTypeRef{}
+	}
+	if e.typ.name == (xsdQName{space: xsdNamespace, local: "anyType"}) {
+		return nil, xsdTypeRef{}
+	}
+	return nil, e.typ
+}
+
+// checkValue validates a value against a simple type, accepting any value for
+// types the set does not declare
+func (s *xsdSchemaSet) checkValue(t xsdTypeRef, value string) error {
+	if t.inline != nil {
+		return s.checkSimple(t.inline, value)
+	}
+	if t.name.space == xsdNamespace {
+		return checkXSDBuiltin(t.name.local, value)
+	}
+	if st := s.simpleTypes[t.name]; st != nil {
+		return s.checkSimple(st, value)
+	}
+	return nil
+}
+
+// checkSimple validates a value against the facets of a simple type
+func (s *xsdSchemaSet) checkSimple(t *xsdSimpleType, value string) error {
+	if t.list {
+		return nil
+	}
+	if t.union {
+		for _, m := range t.members {
+			if s.checkValue(m, value) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("does not match any of the allowed types")
+	}
+
+	if err := s.checkValue(t.base, value); err != nil {
+		return err
+	}
+	if len(t.enums) > 0 && !slices.Contains(t.enums, value) {
+		if len(t.enums) <= maxListedEnumSize {
+			return fmt.Errorf("must be one of %s", strings.Join(t.enums, ", "))
+		}
+		return fmt.Errorf("is not one of the allowed values")
+	}
+	if t.min != nil || t.max != nil {
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return fmt.Errorf("is not a number")
+		}
+		if t.min != nil && f < *t.min {
+			return fmt.Errorf("is less than the minimum %v", *t.min)
+		}
+		if t.max != nil && f > *t.max {
+			return fmt.Errorf("is greater than the maximum %v", *t.max)
+		}
+	}
+	if len(t.patterns) > 0 {
+		matched := false
+		for _, p := range t.patterns {
+			if p.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("does not match the required pattern")
+		}
+	}
+	return nil
+}
+
+// checkXSDBuiltin validates a value against the numeric and boolean built-in
+// types; other built-in types accept any value
+func checkXSDBuiltin(name, value string) error {
+	value = strings.TrimSpace(value)
+	var err error
+	switch name {
+	case "boolean":
+		switch value {
+		case "true", "false", "1", "0":
+		default:
+			return fmt.Errorf("is not a boolean")
+		}
+	case "int":
+		_, err = strconv.ParseInt(value, 10, 32)
+	case "long", "integer":
+		_, err = strconv.ParseInt(value, 10, 64)
+	case "short":
+		_, err = strconv.ParseInt(value, 10, 16)
+	case "byte":
+		_, err = strconv.ParseInt(value, 10, 8)
+	case "unsignedInt":
+		_, err = strconv.ParseUint(value, 10, 32)
+	case "unsignedLong", "nonNegativeInteger":
+		_, err = strconv.ParseUint(value, 10, 64)
+	case "unsignedShort":
+		_, err = strconv.ParseUint(value, 10, 16)
+	case "unsignedByte":
+		_, err = strconv.ParseUint(value, 10, 8)
+	case "double", "float", "decimal":
+		switch value {
+		case "INF", "-INF", "NaN":
+		default:
+			_, err = strconv.ParseFloat(value, 64)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("is not a valid xs:%s", name)
+	}
+	return nil
+}
+
+// displayName formats a qualified name with the prefix the schema uses for
+// its namespace, e.g. "DTS:Property"
+func (s *xsdSchemaSet) displayName(name xsdQName) string {
+	if prefix, ok := s.prefixes[name.space]; ok && name.space != "" {
+		return prefix + ":" + name.local
+	}
+	return name.local
+}
+
+// xsdLoader converts the nodes of one schema document into declarations
+type xsdLoader struct {
+	set                 *xsdSchemaSet
+	target              string
+	prefixes            map[string]string
+	elementsQualified   bool
+	attributesQualified bool
+}
+
+// qname resolves a prefixed name used in an attribute value such as type="..."
+func (l *xsdLoader) qname(value string) xsdQName {
+	if prefix, local, ok := strings.Cut(value, ":"); ok {
+		return xsdQName{space: l.prefixes[prefix], local: local}
+	}
+	return xsdQName{space: l.prefixes[""], local: value}
+}
+
+// globalName returns the name of a top-level declaration
+func (l *xsdLoader) globalName(n *xsdNode) xsdQName {
+	return xsdQName{space: l.target, local: n.attrs["name"]}
+}
+
+// localName returns the name of a local element or attribute declaration,
+// qualified according to its form attribute or the schema default
+func (l *xsdLoader) localName(n *xsdNode, qualifiedByDefault bool) xsdQName {
+	name := xsdQName{local: n.attrs["name"]}
+	if form := n.attrs["form"]; form == "qualified" || (form == "" && qualifiedByDefault) {
+		name.space = l.target
+	}
+	return name
+}
+
+func (l *xsdLoader) element(n *xsdNode, global bool) *xsdElement {
+	e := &xsdElement{}
+	if ref := n.attrs["ref"]; ref != "" {
+		e.ref = l.qname(ref)
+		e.name = e.ref
+		return e
+	}
+	if global {
+		e.name = l.globalName(n)
+	} else {
+		e.name = l.localName(n, l.elementsQualified)
+	}
+	if t := n.attrs["type"]; t != "" {
+		e.typ.name = l.qname(t)
+	}
+	for _, c := range n.children {
+		switch c.kind {
+		case "complexType":
+			e.complex = l.complexType(c)
+		case "simpleType":
+			e.typ.inline = l.simpleType(c)
+		}
+	}
+	if e.complex == nil && e.typ == (xsdTypeRef{}) {
+		e.typ.name = xsdQName{space: xsdNamespace, local: "anyType"}
+	}
+	return e
+}
+
+func (l *xsdLoader) complexType(n *xsdNode) *xsdComplexType {
+	ct := &xsdComplexType{}
+	l.set.allComplex = append(l.set.allComplex, ct)
+	l.complexContent(ct, n)
+	return ct
+}
+
+// complexContent reads the particles and attributes of a complex type or of
+// its extension or restriction
+func (l *xsdLoader) complexContent(ct *xsdComplexType, n *xsdNode) {
+	for _, c := range n.children {
+		switch c.kind {
+		case "sequence", "all":
+			l.particles(ct, c, c.attrs["minOccurs"] == "0")
+		case "choice":
+			l.particles(ct, c, true)
+		case "complexContent", "simpleContent":
+			for _, d := range c.children {
+				if d.kind != "extension" && d.kind != "restriction" {
+					continue
+				}
+				// A complex restriction restates its content in full
+				if base := d.attrs["base"]; base != "" && (d.kind == "extension" || c.kind == "simpleContent") {
+					ct.base = l.qname(base)
+				}
+				ct.simpleContent = c.kind == "simpleContent"
+				l.complexContent(ct, d)
+			}
+		default:
+			l.attributeDecl(&ct.xsdAttributeSet, c)
+		}
+	}
+}
+
+// particles adds the elements of a sequence or choice to ct. Elements inside
+// a choice or an optional group are never required.
+func (l *xsdLoader) particles(ct *xsdComplexType, n *xsdNode, optional bool) {
+	for _, c := range n.children {
+		switch c.kind {
+		case "element":
+			e := l.element(c, false)
+			e.required = !optional && c.attrs["minOccurs"] != "0"
+			ct.elements = append(ct.elements, e)
+		case "sequence", "all":
+			l.particles(ct, c, optional || c.attrs["minOccurs"] == "0")
+		case "choice":
+			l.particles(ct, c, true)
+		case "any":
+			ct.anyElement = true
+		}
+	}
+}
+
+// attributeDecl adds an attribute, attribute group reference or attribute
+// wildcard to set; other nodes are ignored
+func (l *xsdLoader) attributeDecl(set *xsdAttributeSet, n *xsdNode) {
+	switch n.kind {
+	case "attribute":
+		a := &xsdAttribute{
+			name:     l.localName(n, l.attributesQualified),
+			required: n.attrs["use"] == "required",
+		}
+		if fixed, ok := n.attrs["fixed"]; ok {
+			a.fixed = &fixed
+		}
+		if t := n.attrs["type"]; t != "" {
+			a.typ.name = l.qname(t)
+		}
+		for _, c := range n.children {
+			if c.kind == "simpleType" {
+				a.typ.inline = l.simpleType(c)
+			}
+		}
+		set.attributes = append(set.attributes, a)
+	case "attributeGroup":
+		if ref := n.attrs["ref"]; ref != "" {
+			set.groups = append(set.groups, l.qname(ref))
+		}
+	case "anyAttribute":
+		set.anyAttribute = true
+	}
+}
+
+func (l *xsdLoader) simpleType(n *xsdNode) *xsdSimpleType {
+	st := &xsdSimpleType{}
+	for _, c := range n.children {
+		switch c.kind {
+		case "restriction":
+			if base := c.attrs["base"]; base != "" {
+				st.base.name = l.qname(base)
+			}
+			for _, f := range c.children {
+				value := f.attrs["value"]
+				switch f.kind {
+				case "simpleType":
+					st.base.inline = l.simpleType(f)
+				case "enumeration":
+					st.enums = append(st.enums, value)
+				case "minInclusive":
+					if v, err := strconv.ParseFloat(value, 64); err == nil {
+						st.min = &v
+					}
+				case "maxInclusive":
+					if v, err := strconv.ParseFloat(value, 64); err == nil {
+						st.max = &v
+					}
+				case "pattern":
+					if re, err := regexp.Compile("^(?:" + value + ")$"); err == nil {
+						st.patterns = append(st.patterns, re)
+					}
+				}
+			}
+		case "union":
+			st.union = true
+			for _, member := range strings.Fields(c.attrs["memberTypes"]) {
+				st.members = append(st.members, xsdTypeRef{name: l.qname(member)})
+			}
+			for _, f := range c.children {
+				if f.kind == "simpleType" {
+					st.members = append(st.members, xsdTypeRef{inline: l.simpleType(f)})
+				}
+			}
+		case "list":
+			st.list = true
+		}
+	}
+	return st
+}
+
+// xsdFrame is an open element of the document being validated
+type xsdFrame struct {
+	name    xsdQName
+	line    int
+	skip    bool // content is not checked
+	ct      *xsdComplexType
+	text    xsdTypeRef
+	hasText bool
+	buf     strings.Builder
+	seen    map[xsdQName]bool
+}
+
+// xsdValidator validates one document in a single streaming pass
+type xsdValidator struct {
+	set        *xsdSchemaSet
+	data       []byte
+	results    []ValidationError
+	format2012 bool // the document is a 2012+ package and is not checked
+
+	// line is the line number at offset, which only moves forward
+	line   int
+	offset int
+}
+
+func (v *xsdValidator) validate() {
+	dec := xml.NewDecoder(bytes.NewReader(v.data))
+	var stack []*xsdFrame
+	sawRoot := false
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			line := v.lineAt(int(dec.InputOffset()))
+			if syntaxErr, ok := err.(*xml.SyntaxError); ok {
+				line = syntaxErr.Line
+				err = fmt.Errorf("%s", syntaxErr.Msg)
+			}
+			v.addError(line, "XML is not well-formed: %v", err)
+			return
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			line := v.lineAt(v.tagStart(int(offset)))
+			var parent *xsdFrame
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			} else {
+				if sawRoot {
+					v.addError(line, "document has more than one root element")
+					return
+				}
+				sawRoot = true
+				if v.format2012 {
+					v.results = append(v.results, ValidationError{
+						Severity: "warning",
+						Message:  "package uses the SQL Server 2012+ format; the bundled schema describes the pre-2012 format, so schema validation was skipped",
+						Path:     fmt.Sprintf("line %d", line),
+					})
+					return
+				}
+			}
+			stack = append(stack, v.startElement(t, line, parent))
+		case xml.EndElement:
+			frame := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			v.endElement(frame)
+		case xml.CharData:
+			if len(stack) > 0 {
+				if frame := stack[len(stack)-1]; frame.hasText {
+					frame.buf.Write(t)
+				}
+			}
+		}
+	}
+	if !sawRoot {
+		v.addError(v.line, "document has no root element")
+	}
+}
+
+// startElement checks an element against its parent's content model and its
+// own attribute declarations
+func (v *xsdValidator) startElement(t xml.StartElement, line int, parent *xsdFrame) *xsdFrame {
+	elemName := xsdQName{space: t.Name.Space, local: t.Name.Local}
+	frame := &xsdFrame{name: elemName, line: line}
+	name := v.set.displayName(elemName)
+
+	var decl *xsdElement
+	switch {
+	case parent == nil:
+		if decl = v.set.elements[elemName]; decl == nil {
+			v.addError(line, "root element %s is not declared in the DTSX schema", name)
+		}
+	case parent.skip:
+	case parent.ct == nil:
+		v.addError(line, "element %s is not allowed in %s, which has text content only", name, v.set.displayName(parent.name))
+	default:
+		parent.seen[elemName] = true
+		if decl = parent.ct.children[elemName]; decl == nil && !parent.ct.anyElement {
+			v.addError(line, "element %s is not allowed in %s", name, v.set.displayName(parent.name))
+		}
+	}
+	if decl == nil {
+		frame.skip = true
+		return frame
+	}
+
+	ct, text := v.set.elementType(decl)
+	switch {
+	case ct != nil:
+		frame.ct = ct
+		frame.seen = make(map[xsdQName]bool)
+		frame.text = ct.textType
+		frame.hasText = ct.simpleContent
+		v.checkAttributes(t, ct, line)
+	case text != (xsdTypeRef{}):
+		frame.text = text
+		frame.hasText = true
+		for _, a := range t.Attr {
+			if !isNamespaceAttr(a.Name) {
+				v.addError(line, "attribute %s is not allowed on element %s", v.set.displayName(xsdQName{space: a.Name.Space, local: a.Name.Local}), name)
+			}
+		}
+	default:
+		frame.skip = true
+	}
+	return frame
+}
+
+// endElement reports missing required children and invalid text content
+func (v *xsdValidator) endElement(frame *xsdFrame) {
+	name := v.set.displayName(frame.name)
+	if frame.ct != nil {
+		for _, e := range frame.ct.required {
+			if !frame.seen[e.name] {
+				v.addError(frame.line, "element %s is missing required child element %s", name, v.set.displayName(e.name))
+			}
+		}
+	}
+	if frame.hasText {
+		if err := v.set.checkValue(frame.text, frame.buf.String()); err != nil {
+			v.addError(frame.line, "element %s has invalid content: value %v", name, err)
+		}
+	}
+}
+
+// checkAttributes validates the attributes of an element of complex type ct
+func (v *xsdValidator) checkAttributes(t xml.StartElement, ct *xsdComplexType, line int) {
+	name := v.set.displayName(xsdQName{space: t.Name.Space, local: t.Name.Local})
+	present := make(map[xsdQName]bool)
+	for _, a := range t.Attr {
+		if isNamespaceAttr(a.Name) {
+			continue
+		}
+		attrName := xsdQName{space: a.Name.Space, local: a.Name.Local}
+		present[attrName] = true
+		decl := ct.attrs[attrName]
+		if decl == nil {
+			if !ct.anyAttribute {
+				v.addError(line, "attribute %s is not allowed on element %s", v.set.displayName(attrName), name)
+			}
+			continue
+		}
+		if decl.fixed != nil {
+			if a.Value != *decl.fixed {
+				v.addError(line, "attribute %s on element %s must be %q, got %q", v.set.displayName(attrName), name, *decl.fixed, a.Value)
+			}
+		} else if err := v.set.checkValue(decl.typ, a.Value); err != nil {
+			v.addError(line, "attribute %s on element %s has invalid value %q: value %v", v.set.displayName(attrName), name, a.Value, err)
+		}
+	}
+	for _, decl := range ct.attrOrder {
+		if decl.required && !present[decl.name] {
+			v.addError(line, "element %s is missing required attribute %s", name, v.set.displayName(decl.name))
+		}
+	}
+}
+
+func (v *xsdValidator) addError(line int, format string, args ...interface{}) {
+	v.results = append(v.results, ValidationError{
+		Severity: "error",
+		Message:  fmt.Sprintf(format, args...),
+		Path:     fmt.Sprintf("line %d", line),
+	})
+}
+
+// tagStart returns the offset of the first '<' at or after offset, which is
+// where the token read from offset begins
+func (v *xsdValidator) tagStart(offset int) int {
+	if i := bytes.IndexByte(v.data[offset:], '<'); i >= 0 {
+		return offset + i
+	}
+	return offset
+}
+
+// lineAt returns the 1-based line number of a byte offset. Offsets must not
+// decrease between calls.
+func (v *xsdValidator) lineAt(offset int) int {
+	if offset > len(v.data) {
+		offset = len(v.data)
+	}
+	if offset > v.offset {
+		v.line += bytes.Count(v.data[v.offset:offset], []byte{'\n'})
+		v.offset = offset
+	}
+	return v.line
+}
+
+// isNamespaceAttr reports whether an attribute is a namespace declaration or
+// belongs to the xml or xsi namespaces, which the schema does not declare
+func isNamespaceAttr(name xml.Name) bool {
+	return name.Space == "xmlns" || (name.Space == "" && name.Local == "xmlns") ||
+		name.Space == xmlNamespace || name.Space == xsiNamespace
+}
+
+// format2012Elements are the DTS collection elements that only the 2012+
+// format uses; older packages list the items directly in their parent
+var format2012Elements = map[string]bool{
+	"ConnectionManagers": true, "Variables": true, "Executables": true,
+	"PrecedenceConstraints": true, "EventHandlers": true, "LogProviders": true,
+	"Configurations": true, "PackageParameters": true, "ForEachVariableMappings": true,
+	"DesignTimeProperties": true,
+}
+
+// isPackage2012 reports whether data holds a package in the 2012+ format: an
+// element carries a DTS:refId, a 2012+ collection element such as
+// DTS:Executables appears, or PackageFormatVersion is 6 or later. A root
+// refId alone is not enough, since PackageBuilder output has none. Documents
+// that are not well-formed are reported as pre-2012 so that validation can
+// point out the syntax error.
+func isPackage2012(data []byte) bool {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	inFormatVersion := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return false
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space != dtsNamespace {
+				continue
+			}
+			if format2012Elements[t.Name.Local] {
+				return true
+			}
+			for _, a := range t.Attr {
+				if a.Name.Space != dtsNamespace {
+					continue
+				}
+				if a.Name.Local == "refId" {
+					return true
+				}
+				if t.Name.Local == "Property" && a.Name.Local == "Name" && a.Value == "PackageFormatVersion" {
+					inFormatVersion = true
+				}
+			}
+		case xml.CharData:
+			if inFormatVersion {
+				if version, err := strconv.Atoi(strings.TrimSpace(string(t))); err == nil && version >= 6 {
+					return true
+				}
+			}
+		case xml.EndElement:
+			inFormatVersion = false
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// yaml.go - YAML summary export
+//
+// This file renders a flattened YAML view of a package for human review and
+// version control. Only the standard library is used; all scalars are written
+// as double-quoted strings so the output needs no YAML-specific escaping rules.
+
+package dtsx
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	schema "github.com/7045kHz/dtsx/schemas"
+)
+
+// ToYAML returns a flattened, diff-friendly YAML summary of the package:
+// its variables, connections, tasks with execution order, and SQL statements.
+// Sections and entries keep document order so output is stable across runs.
+func (p *Package) ToYAML() ([]byte, error) {
+	if p == nil {
+		return nil, fmt.Errorf("package is nil")
+	}
+
+	var b strings.Builder
+	b.WriteString("package:\n")
+	writeYAMLField(&b, 1, "name", derefString(p.ObjectNameAttr))
+	writeYAMLField(&b, 1, "refId", derefString(p.RefIdAttr))
+	if p.DescriptionAttr != nil && *p.DescriptionAttr != "" {
+		writeYAMLField(&b, 1, "description", *p.DescriptionAttr)
+	}
+
+	// Variables
+	vars := p.GetVariables().Results.([]*schema.VariableType)
+	writeYAMLSection(&b, "variables", len(vars))
+	for _, v := range vars {
+		writeYAMLItem(&b, "name", GetVariableName(v))
+		if v.VariableValue != nil && v.VariableValue.DataTypeAttr != nil {
+			writeYAMLField(&b, 2, "dataType", strconv.Itoa(*v.VariableValue.DataTypeAttr))
+		}
+		writeYAMLField(&b, 2, "value", GetVariableValue(v))
+		if expr := variableExpression(v); expr != "" {
+			writeYAMLField(&b, 2, "expression", expr)
+		}
+	}
+
+	// Connections
+	conns := p.GetConnections().Results.([]*schema.ConnectionManagerType)
+	writeYAMLSection(&b, "connections", len(conns))
+	for _, cm := range conns {
+		writeYAMLItem(&b, "name", GetConnectionName(cm))
+		writeYAMLField(&b, 2, "type", derefString(cm.CreationNameAttr))
+		writeYAMLField(&b, 2, "connectionString", GetConnectionString(cm))
+	}
+
+	// Tasks, with execution order computed in document order for stability
+	analyzer := NewPrecedenceAnalyzer(p)
+	hasCycles := len(analyzer.ValidateConstraints()) > 0
+	writeYAMLSection(&b, "tasks", len(p.Executable))
+	for _, exec := range p.Executable {
+		refId := getRefId(exec)
+		writeYAMLItem(&b, "name", GetExecutableName(exec))
+		writeYAMLField(&b, 2, "refId", refId)
+		writeYAMLField(&b, 2, "type", exec.ExecutableTypeAttr)
+		if refId != "" && !hasCycles {
+			if order, err := analyzer.GetExecutionOrder(refId); err == nil {
+				fmt.Fprintf(&b, "    order: %d\n", order)
+			}
+		}
+		if deps := analyzer.dependencies[refId]; len(deps) > 0 {
+			b.WriteString("    dependsOn:\n")
+			for _, dep := range deps {
+				b.WriteString("      - " + yamlQuote(dep) + "\n")
+			}
+		}
+	}
+
+	// SQL statements
+	statements := NewPackageParser(p).GetSQLStatements()
+	writeYAMLSection(&b, "sql", len(statements))
+	for _, stmt := range statements {
+		writeYAMLItem(&b, "task", stmt.TaskName)
+		writeYAMLField(&b, 2, "refId", stmt.RefId)
+		if len(stmt.Connections) > 0 {
+			b.WriteString("    connections:\n")
+			for _, conn := range stmt.Connections {
+				b.WriteString("      - " + yamlQuote(conn) + "\n")
+			}
+		}
+		if stmt.SourceType != "" {
+			writeYAMLField(&b, 2, "sourceType", stmt.SourceType)
+			writeYAMLField(&b, 2, "source", stmt.Source)
+		}
+		writeYAMLField(&b, 2, "statement", stmt.SQL)
+	}
+
+	return []byte(b.String()), nil
+}
+
+// writeYAMLSection writes a top-level sequence key, using [] for empty sections
+func writeYAMLSection(b *strings.Builder, key string, count int) {
+	if count == 0 {
+		b.WriteString(key + ": []\n")
+		return
+	}
+	b.WriteString(key + ":\n")
+}
+
+// writeYAMLItem starts a new mapping entry in a top-level sequence
+func writeYAMLItem(b *strings.Builder, key, value string) {
+	b.WriteString("  - " + key + ": " + yamlQuote(value) + "\n")
+}
+
+// writeYAMLField writes a quoted key/value pair at the given nesting level
+func writeYAMLField(b *strings.Builder, level int, key, value string) {
+	b.WriteString(strings.Repeat("  ", level) + key + ": " + yamlQuote(value) + "\n")
+}
+
+// yamlQuote returns s as a double-quoted YAML scalar
+func yamlQuote(s string) string {
+	return strconv.Quote(s)
+}
+
+// derefString returns the value of s, or "" if it is nil
+func derefString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}